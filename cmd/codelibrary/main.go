@@ -2,7 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/encryptcookie"
@@ -10,39 +19,220 @@ import (
 
 	"github.com/dense-analysis/codelibrary/internal/api/database"
 	"github.com/dense-analysis/codelibrary/internal/api/errorhandler"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/oidc"
+	"github.com/dense-analysis/codelibrary/internal/api/ratelimit"
 	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/api/server"
+	"github.com/dense-analysis/codelibrary/internal/config"
 	_ "github.com/dense-analysis/codelibrary/internal/docs"
 )
 
+// Exit codes, following sysexits.h where one fits.
+const (
+	exitOK = 0
+	// exitError is for the server failing or not stopping in time.
+	exitError       = 1
+	exitUnavailable = 69
+	exitConfig      = 78
+)
+
 func main() {
-	app := fiber.New(fiber.Config{
-		ErrorHandler: errorhandler.ErrorHandler,
+	os.Exit(run())
+}
+
+// run starts the server and blocks until it stops, returning the exit code.
+// Resources are released before returning.
+func run() int {
+	cfg, err := config.Load()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return exitConfig
+	}
+
+	// The configuration has been checked, so the logger can be created.
+	logger, err := logging.New(os.Stdout, cfg.Log)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return exitConfig
+	}
+
+	slog.SetDefault(logger)
+
+	// Stop starting up or serving on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.Connect(ctx, cfg.Database, func(attempt int, err error, delay time.Duration) {
+		logger.Warn("database not ready", "attempt", attempt, "retry_in", delay, "error", err)
 	})
+
+	if err != nil {
+		// Being stopped while waiting for the database isn't a failure.
+		if ctx.Err() != nil {
+			return exitOK
+		}
+
+		logger.Error("could not connect to the database", "error", err)
+
+		return exitUnavailable
+	}
+
+	defer db.Close()
+
+	appMetrics := metrics.New()
+	appMetrics.RegisterPool(db)
+	db = appMetrics.InstrumentDatabase(db)
+
+	mail, err := mailer.New(cfg.Mail)
+
+	if err != nil {
+		logger.Error("could not set up email", "error", err)
+
+		return exitError
+	}
+
+	providers, err := oidc.New(ctx, cfg.OIDCProviders())
+
+	if err != nil {
+		logger.Error("could not set up single sign-on", "error", err)
+
+		return exitUnavailable
+	}
+
+	accountMail := routes.AccountMail{Mailer: mail, PublicURL: cfg.PublicURL, Pending: &sync.WaitGroup{}}
+	limits := ratelimit.New(cfg.RateLimits.Budgets())
+
+	fiberConfig := fiber.Config{
+		ErrorHandler: errorhandler.ErrorHandler,
+		// Starting up is logged instead, so every line is structured.
+		DisableStartupMessage: true,
+	}
+	cfg.Proxy.Apply(&fiberConfig)
+	app := fiber.New(fiberConfig)
+	app.Use(appMetrics.RequestHandler())
+	app.Use(logging.RequestIDHandler(logger))
+	app.Use(routes.AccessLogHandler())
 	app.Use(encryptcookie.New(encryptcookie.Config{
-		Key: os.Getenv("COOKIE_SECRET"),
+		Key: cfg.CookieSecret,
 	}))
-	db, err := database.New(context.Background())
+	app.Use(routes.RateLimitHandler(db, limits))
 
-	if err != nil {
-		// TODO: Exit more gracefully.
-		panic(err)
+	registrationPolicy := routes.RegistrationPolicy{
+		DisableLocal: cfg.DisableLocalRegistration,
+	}
+	submissionPolicy := routes.SubmissionPolicy{
+		RequireVerifiedEmail: cfg.RequireVerifiedEmail,
+		RequireTwoFactor:     cfg.RequireTwoFactor,
 	}
 
+	app.Get("/healthz", routes.HealthHandler())
+	app.Get("/readyz", routes.ReadyHandler(db))
+	app.Get("/api/version", routes.VersionHandler(db))
 	app.Post("/api/auth/login", routes.LoginHandler(db))
+	app.Post("/api/auth/login/totp", routes.LoginTOTPHandler(db))
 	app.Post("/api/auth/logout", routes.LogoutHandler(db))
-	app.Post("/api/auth/register", routes.RegisterHandler(db))
+	app.Post("/api/auth/register", routes.RegisterHandler(db, accountMail, registrationPolicy))
+	app.Get("/api/auth/oidc/login", routes.OIDCLoginHandler(providers))
+	app.Get("/api/auth/oidc/callback", routes.OIDCCallbackHandler(db, providers))
+	app.Post("/api/auth/password-reset", routes.RequestPasswordResetHandler(db, accountMail))
+	app.Post("/api/auth/password-reset/confirm", routes.ConfirmPasswordResetHandler(db))
+	app.Post("/api/auth/verify-email", routes.VerifyEmailHandler(db))
+	app.Post("/api/auth/totp", routes.EnrolTOTPHandler(db))
+	app.Post("/api/auth/totp/confirm", routes.ConfirmTOTPHandler(db))
+	app.Delete("/api/auth/totp", routes.DisableTOTPHandler(db))
+	app.Get("/api/auth/sessions", routes.ListSessionsHandler(db))
+	app.Delete("/api/auth/sessions/:id", routes.DeleteSessionHandler(db))
+	app.Get("/api/auth/tokens", routes.ListAPITokensHandler(db))
+	app.Post("/api/auth/tokens", routes.CreateAPITokenHandler(db))
+	app.Delete("/api/auth/tokens/:id", routes.DeleteAPITokenHandler(db))
+	app.Get("/api/users/me", routes.GetCurrentUserHandler(db))
+	app.Patch("/api/users/me", routes.UpdateCurrentUserHandler(db, accountMail))
+	app.Delete("/api/users/me", routes.DeleteCurrentUserHandler(db))
+	app.Post("/api/users/me/email/verification", routes.RequestEmailVerificationHandler(db, accountMail))
+	manageRoles := routes.RequirePermission(db, models.PermissionManageRoles)
+	app.Put("/api/users/:id/role", manageRoles, routes.GrantRoleHandler(db))
+	app.Delete("/api/users/:id/role", manageRoles, routes.RevokeRoleHandler(db))
+	app.Get("/api/languages", routes.ListLanguagesHandler(db))
+	manageLanguages := routes.RequirePermission(db, models.PermissionManageLanguages)
+	app.Post("/api/languages", manageLanguages, routes.CreateLanguageHandler(db))
+	app.Get("/api/languages/:id", routes.GetLanguageHandler(db))
+	app.Put("/api/languages/:id", manageLanguages, routes.RenameLanguageHandler(db))
+	app.Delete("/api/languages/:id", manageLanguages, routes.RetireLanguageHandler(db))
 	app.Get("/api/code", routes.ListCodeSamplesHandler(db))
-	app.Post("/api/code", routes.CreateCodeSampleHandler(db))
+	app.Post("/api/code", routes.CreateCodeSampleHandler(db, submissionPolicy))
 	app.Get("/api/code/:id", routes.GetCodeSampleHandler(db))
 	app.Put("/api/code/:id", routes.UpdateCodeSampleHandler(db))
 	app.Delete("/api/code/:id", routes.DeleteCodeSampleHandler(db))
+	app.Get("/api/code/:id/diff", routes.DiffCodeSampleRevisionsHandler(db))
+	app.Get("/api/code/:id/revisions", routes.ListCodeSampleRevisionsHandler(db))
+	app.Get("/api/code/:id/revisions/:rev", routes.GetCodeSampleRevisionHandler(db))
+	app.Post("/api/code/:id/revisions/:rev/restore", routes.RestoreCodeSampleRevisionHandler(db))
+	app.Get("/api/tags", routes.ListTagsHandler(db))
 	app.Get("/api/docs/*", swagger.HandlerDefault)
 
-	port := os.Getenv("API_PORT")
+	// Metrics are served on their own port, so they aren't exposed along
+	// with the API.
+	metricsApp := fiber.New(fiber.Config{
+		ErrorHandler:          errorhandler.ErrorHandler,
+		DisableStartupMessage: true,
+	})
+	metricsApp.Get("/metrics", appMetrics.Handler())
+
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(cfg.Port))
+
+	if err != nil {
+		logger.Error("could not listen", "port", cfg.Port, "error", err)
 
-	if len(port) == 0 {
-		port = "7000"
+		return exitError
 	}
 
-	app.Listen(":" + port)
+	metricsListener, err := net.Listen("tcp", ":"+strconv.Itoa(cfg.MetricsPort))
+
+	if err != nil {
+		listener.Close()
+		logger.Error("could not listen for metrics", "port", cfg.MetricsPort, "error", err)
+
+		return exitError
+	}
+
+	logger.Info("listening", "port", cfg.Port, "metrics_port", cfg.MetricsPort)
+
+	// If either server fails, the other one is stopped too.
+	serveCtx, stopServing := context.WithCancel(ctx)
+	defer stopServing()
+
+	metricsServed := make(chan error, 1)
+
+	go func() {
+		err := server.Serve(serveCtx, metricsApp, metricsListener, cfg.ShutdownTimeout)
+		stopServing()
+		metricsServed <- err
+	}()
+
+	err = server.Serve(serveCtx, app, listener, cfg.ShutdownTimeout)
+	stopServing()
+	// Let emails which are still being sent finish.
+	accountMail.Pending.Wait()
+
+	if err := errors.Join(err, <-metricsServed); err != nil {
+		if errors.Is(err, server.DrainTimeoutErr) {
+			logger.Error("stopped with requests still running", "timeout", cfg.ShutdownTimeout)
+		} else {
+			logger.Error("server failed", "error", err)
+		}
+
+		return exitError
+	}
+
+	logger.Info("stopped")
+
+	return exitOK
 }
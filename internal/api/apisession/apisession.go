@@ -2,6 +2,7 @@ package apisession
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/database"
@@ -12,6 +13,8 @@ import (
 )
 
 var NoUserInSessionErr = errors.New("no user id in session")
+var InvalidTokenErr = errors.New("invalid API token")
+var MissingScopeErr = errors.New("API token is missing a scope")
 
 func setCookie(c *fiber.Ctx, name string, value string, expires time.Time) {
 	cookie := fiber.Cookie{
@@ -25,29 +28,82 @@ func setCookie(c *fiber.Ctx, name string, value string, expires time.Time) {
 	c.Cookie(&cookie)
 }
 
-func saveUserID(c *fiber.Ctx, userID uuid.UUID) error {
-	userIDString := userID.String()
-	setCookie(c, "userID", userIDString, time.Now().Add(24*time.Hour))
+// sessionLifetime is how long a session lasts after it was last used.
+const sessionLifetime = 24 * time.Hour
+
+func saveSessionID(c *fiber.Ctx, id uuid.UUID, expires time.Time) {
+	idString := id.String()
+	setCookie(c, "sessionID", idString, expires)
 	// Save the ID in locals so it can be read back later on in the request.
-	c.Locals("userID", userIDString)
+	c.Locals("sessionID", idString)
+}
 
-	return nil
+// setUserID records who made a request, such as for access logs.
+func setUserID(c *fiber.Ctx, id uuid.UUID) {
+	c.Locals("userID", id)
+}
+
+// UserID returns the ID of the user who made a request, if they have been
+// loaded with LoadUser or logged in with SaveUser.
+func UserID(c *fiber.Ctx) (uuid.UUID, bool) {
+	id, ok := c.Locals("userID").(uuid.UUID)
+
+	return id, ok
+}
+
+// SaveUser starts a new session for a user.
+func SaveUser(c *fiber.Ctx, db database.DatabaseAPI, user models.User) error {
+	return saveSession(c, db, user, false)
+}
+
+// SaveReauthenticatedUser starts a new session for a user who has just logged
+// in again with a provider, which can confirm changes to their account.
+func SaveReauthenticatedUser(c *fiber.Ctx, db database.DatabaseAPI, user models.User) error {
+	return saveSession(c, db, user, true)
 }
 
-func SaveUser(c *fiber.Ctx, user models.User) error {
-	return saveUserID(c, user.ID)
+func saveSession(c *fiber.Ctx, db database.DatabaseAPI, user models.User, reauthenticated bool) error {
+	id, err := uuid.NewRandom()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:        id,
+		UserID:    user.ID,
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IPAddress: c.IP(),
+		Created:   now,
+		LastSeen:  now,
+		Expires:   now.Add(sessionLifetime),
+		// Logging in again is only trusted for the session it starts.
+		Reauthenticated: reauthenticated,
+	}
+
+	if err := db.CreateSession(c.Context(), session); err != nil {
+		return err
+	}
+
+	saveSessionID(c, session.ID, session.Expires)
+	setUserID(c, user.ID)
+
+	return nil
 }
 
-func loadUserID(c *fiber.Ctx) (uuid.UUID, error) {
+// SessionID returns the ID of the session for the request.
+// The session might have expired or been revoked.
+func SessionID(c *fiber.Ctx) (uuid.UUID, error) {
 	// Try to get the ID from locals first.
-	userIDString, _ := c.Locals("userID").(string)
+	idString, _ := c.Locals("sessionID").(string)
 
-	if len(userIDString) == 0 {
+	if len(idString) == 0 {
 		// Try to get the ID from the request cookie.
-		userIDString = c.Cookies("userID")
+		idString = c.Cookies("sessionID")
 	}
 
-	id, err := uuid.Parse(userIDString)
+	id, err := uuid.Parse(idString)
 
 	if err != nil {
 		err = NoUserInSessionErr
@@ -56,22 +112,167 @@ func loadUserID(c *fiber.Ctx) (uuid.UUID, error) {
 	return id, err
 }
 
-func LoadUser(c *fiber.Ctx, db database.DatabaseAPI) (models.User, error) {
-	userID, err := loadUserID(c)
+// bearerToken returns the token from the Authorization header.
+// Any other kind of authorization returns an empty token.
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+
+	if len(header) == 0 {
+		return "", false
+	}
+
+	scheme, token, _ := strings.Cut(header, " ")
+
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", true
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+func loadTokenUser(
+	c *fiber.Ctx,
+	db database.DatabaseAPI,
+	token string,
+	scopes []models.Scope,
+) (models.User, error) {
+	if len(token) == 0 {
+		return models.User{}, InvalidTokenErr
+	}
+
+	user, apiToken, err := db.GetAPITokenUser(c.Context(), database.HashToken(token), time.Now())
+
+	if errors.Is(err, database.NotFoundErr) {
+		return user, InvalidTokenErr
+	}
 
 	if err != nil {
-		var user models.User
 		return user, err
 	}
 
-	return db.GetUser(c.Context(), userID)
+	for _, scope := range scopes {
+		if apiToken.HasScope(scope) {
+			return user, nil
+		}
+	}
+
+	return user, MissingScopeErr
 }
 
-func DeleteUser(c *fiber.Ctx) error {
-	// A better way to clear cookies is to set them with an expiry before now.
-	setCookie(c, "userID", "", fasthttp.CookieExpireDelete)
-	// Clear the user ID from locals.
-	c.Locals("userID", nil)
+// LoadUser loads the user for a bearer token or the session cookie, and
+// extends the session.
+//
+// Tokens must have one of the given scopes. Routes which don't list any
+// scopes can only be used with a session.
+func LoadUser(c *fiber.Ctx, db database.DatabaseAPI, scopes ...models.Scope) (models.User, error) {
+	user, err := loadUser(c, db, scopes)
+
+	if err == nil {
+		setUserID(c, user.ID)
+	}
+
+	return user, err
+}
+
+func loadUser(c *fiber.Ctx, db database.DatabaseAPI, scopes []models.Scope) (models.User, error) {
+	if token, ok := bearerToken(c); ok {
+		return loadTokenUser(c, db, token, scopes)
+	}
+
+	var user models.User
+	id, err := SessionID(c)
+
+	if err != nil {
+		return user, err
+	}
+
+	now := time.Now()
+	expires := now.Add(sessionLifetime)
+	user, err = db.GetSessionUser(c.Context(), id, now, expires)
+
+	// Expired and revoked sessions are the same as no session at all.
+	if errors.Is(err, database.NotFoundErr) {
+		return user, NoUserInSessionErr
+	}
+
+	if err != nil {
+		return user, err
+	}
+
+	saveSessionID(c, id, expires)
+
+	return user, nil
+}
+
+// CheckToken checks a bearer token has a scope, if a token was sent.
+// Routes which can be used without logging in call this so bad tokens are
+// reported instead of being ignored.
+func CheckToken(c *fiber.Ctx, db database.DatabaseAPI, scope models.Scope) error {
+	if _, ok := bearerToken(c); !ok {
+		return nil
+	}
+
+	_, err := LoadUser(c, db, scope)
+
+	return err
+}
+
+// ClientKey identifies who is making a request, such as for rate limiting.
+//
+// Clients are identified by their API token, by the user for their session,
+// or by their IP address. Credentials are checked first, so clients can't get
+// a new identity by making up tokens. Invalid credentials fall back to the
+// IP address, and are rejected later by LoadUser or CheckToken.
+//
+// Credentials are only read, so requests which are turned away don't extend
+// sessions or mark tokens as used.
+func ClientKey(c *fiber.Ctx, db database.DatabaseAPI) (string, error) {
+	now := time.Now()
+
+	if token, ok := bearerToken(c); ok {
+		if len(token) > 0 {
+			tokenID, err := db.GetAPITokenID(c.Context(), database.HashToken(token), now)
+
+			if err == nil {
+				return "token:" + tokenID.String(), nil
+			}
+
+			if !errors.Is(err, database.NotFoundErr) {
+				return "", err
+			}
+		}
+	} else if id, err := SessionID(c); err == nil {
+		session, err := db.GetSession(c.Context(), id, now)
+
+		if err == nil {
+			return "user:" + session.UserID.String(), nil
+		}
+
+		if !errors.Is(err, database.NotFoundErr) {
+			return "", err
+		}
+	}
+
+	return "ip:" + c.IP(), nil
+}
+
+// DeleteUser revokes the session for the request and clears the cookie.
+func DeleteUser(c *fiber.Ctx, db database.DatabaseAPI) error {
+	if id, err := SessionID(c); err == nil {
+		if err := db.DeleteSession(c.Context(), id); err != nil {
+			return err
+		}
+	}
+
+	ClearSession(c)
 
 	return nil
 }
+
+// ClearSession clears the session cookie without revoking the session.
+func ClearSession(c *fiber.Ctx) {
+	// A better way to clear cookies is to set them with an expiry before now.
+	setCookie(c, "sessionID", "", fasthttp.CookieExpireDelete)
+	// Clear the session ID from locals.
+	c.Locals("sessionID", nil)
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
 	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/gofiber/fiber/v2"
@@ -16,7 +17,7 @@ func TestUserSessionWorkflow(t *testing.T) {
 	t.Parallel()
 
 	db := databasemock.New()
-	db.GetUserResult.A = models.User{ID: uuid.New()}
+	db.GetSessionUserResult.A = models.User{ID: uuid.New()}
 
 	app := fiber.New()
 	ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
@@ -27,18 +28,156 @@ func TestUserSessionWorkflow(t *testing.T) {
 	assert.Equal(t, apisession.NoUserInSessionErr, err)
 
 	// Ensure we can save the user without errors.
-	err = apisession.SaveUser(ctx, user)
+	err = apisession.SaveUser(ctx, db, db.GetSessionUserResult.A)
+	assert.Nil(t, err)
 
 	// Ensure we can load the user back again without errors.
 	user, err = apisession.LoadUser(ctx, db)
 	assert.Nil(t, err)
-	assert.Equal(t, db.GetUserResult.A.ID, user.ID)
+	assert.Equal(t, db.GetSessionUserResult.A.ID, user.ID)
 
 	// Ensure we can delete the user without errors.
-	err = apisession.DeleteUser(ctx)
+	err = apisession.DeleteUser(ctx, db)
 	assert.Nil(t, err)
+	assert.Equal(t, 1, len(db.GetCalls("DeleteSession")))
 
 	// Ensure we can't load the user anymore.
 	user, err = apisession.LoadUser(ctx, db)
 	assert.Equal(t, apisession.NoUserInSessionErr, err)
 }
+
+func TestExpiredSession(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	// Expired and revoked sessions aren't found in the database.
+	db.GetSessionUserResult.B = database.NotFoundErr
+
+	app := fiber.New()
+	ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(ctx)
+
+	err := apisession.SaveUser(ctx, db, models.User{ID: uuid.New()})
+	assert.Nil(t, err)
+
+	_, err = apisession.LoadUser(ctx, db)
+	assert.Equal(t, apisession.NoUserInSessionErr, err)
+}
+
+func TestLoadUserWithToken(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	db.GetAPITokenUserResult.User = models.User{ID: uuid.New()}
+	db.GetAPITokenUserResult.Token.Scopes = []models.Scope{models.ScopeSamplesRead}
+
+	app := fiber.New()
+	ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(ctx)
+
+	ctx.Request().Header.Set("Authorization", "Bearer clt_abc")
+
+	user, err := apisession.LoadUser(ctx, db, models.ScopeSamplesRead)
+	assert.Nil(t, err)
+	assert.Equal(t, db.GetAPITokenUserResult.User, user)
+
+	// Ensure tokens need the scope for a route.
+	_, err = apisession.LoadUser(ctx, db, models.ScopeSamplesWrite)
+	assert.Equal(t, apisession.MissingScopeErr, err)
+
+	// Ensure tokens can't be used for routes that need a session.
+	_, err = apisession.LoadUser(ctx, db)
+	assert.Equal(t, apisession.MissingScopeErr, err)
+
+	// Ensure we don't load sessions when a token is sent.
+	assert.Equal(t, 0, len(db.GetCalls("GetSessionUser")))
+}
+
+func TestLoadUserWithInvalidToken(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	db.GetAPITokenUserResult.Err = database.NotFoundErr
+
+	app := fiber.New()
+	ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(ctx)
+
+	ctx.Request().Header.Set("Authorization", "Bearer clt_abc")
+	_, err := apisession.LoadUser(ctx, db, models.ScopeSamplesRead)
+	assert.Equal(t, apisession.InvalidTokenErr, err)
+
+	// Other kinds of authorization aren't accepted.
+	ctx.Request().Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, err = apisession.LoadUser(ctx, db, models.ScopeSamplesRead)
+	assert.Equal(t, apisession.InvalidTokenErr, err)
+	assert.Equal(t, 1, len(db.GetCalls("GetAPITokenUser")))
+}
+
+func TestUserID(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	db.GetAPITokenUserResult.User = models.User{ID: uuid.New()}
+	db.GetAPITokenUserResult.Token.Scopes = []models.Scope{models.ScopeSamplesRead}
+
+	app := fiber.New()
+	ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(ctx)
+
+	ctx.Request().Header.Set("Authorization", "Bearer clt_abc")
+
+	// Users aren't recorded until they're loaded successfully.
+	_, err := apisession.LoadUser(ctx, db, models.ScopeSamplesWrite)
+	assert.Equal(t, apisession.MissingScopeErr, err)
+	_, ok := apisession.UserID(ctx)
+	assert.False(t, ok)
+
+	_, err = apisession.LoadUser(ctx, db, models.ScopeSamplesRead)
+	assert.Nil(t, err)
+	id, ok := apisession.UserID(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, db.GetAPITokenUserResult.User.ID, id)
+}
+
+func TestClientKey(t *testing.T) {
+	t.Parallel()
+
+	user := models.User{ID: uuid.MustParse("00000000-0000-4000-8000-000000000001")}
+	db := databasemock.New()
+	db.GetSessionResult.A = models.Session{UserID: user.ID}
+	db.GetAPITokenIDResult.A = uuid.MustParse("00000000-0000-4000-8000-000000000002")
+
+	app := fiber.New()
+	ctx := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(ctx)
+
+	key, err := apisession.ClientKey(ctx, db)
+	assert.Nil(t, err)
+	assert.Equal(t, "ip:"+ctx.IP(), key)
+
+	err = apisession.SaveUser(ctx, db, user)
+	assert.Nil(t, err)
+
+	key, err = apisession.ClientKey(ctx, db)
+	assert.Nil(t, err)
+	assert.Equal(t, "user:00000000-0000-4000-8000-000000000001", key)
+
+	// Tokens are used instead of sessions.
+	ctx.Request().Header.Set("Authorization", "Bearer clt_abc")
+
+	key, err = apisession.ClientKey(ctx, db)
+	assert.Nil(t, err)
+	assert.Equal(t, "token:00000000-0000-4000-8000-000000000002", key)
+
+	// Made up tokens count against the IP address.
+	db.GetAPITokenIDResult.B = database.NotFoundErr
+
+	key, err = apisession.ClientKey(ctx, db)
+	assert.Nil(t, err)
+	assert.Equal(t, "ip:"+ctx.IP(), key)
+
+	// Sessions aren't extended and tokens aren't marked as used.
+	assert.Empty(t, db.GetCalls("GetSessionUser"))
+	assert.Empty(t, db.GetCalls("GetAPITokenUser"))
+}
@@ -0,0 +1,55 @@
+// Package buildinfo describes the build of the app which is running.
+//
+// The commit and build time can be set when building.
+//
+//	go build -ldflags "\
+//	  -X github.com/dense-analysis/codelibrary/internal/api/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/dense-analysis/codelibrary/internal/api/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"runtime/debug"
+)
+
+// unknown is reported for anything which wasn't recorded for the build.
+const unknown = "unknown"
+
+// Commit is the git commit the app was built from.
+var Commit string
+
+// BuildTime is when the app was built.
+var BuildTime string
+
+// Info describes a build.
+type Info struct {
+	Commit string
+	Time   string
+}
+
+// Get returns the commit and build time. If they weren't set when building,
+// the version control details Go records when building inside a repository
+// are used, which give the time of the commit.
+func Get() Info {
+	info := Info{Commit: Commit, Time: BuildTime}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && len(info.Commit) == 0:
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && len(info.Time) == 0:
+				info.Time = setting.Value
+			}
+		}
+	}
+
+	if len(info.Commit) == 0 {
+		info.Commit = unknown
+	}
+
+	if len(info.Time) == 0 {
+		info.Time = unknown
+	}
+
+	return info
+}
@@ -0,0 +1,22 @@
+package buildinfo_test
+
+import (
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/buildinfo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	// Tests aren't built with version control details.
+	assert.Equal(t, buildinfo.Info{Commit: "unknown", Time: "unknown"}, buildinfo.Get())
+
+	buildinfo.Commit = "3babd66"
+	buildinfo.BuildTime = "2023-09-01T12:00:00Z"
+	defer func() {
+		buildinfo.Commit = ""
+		buildinfo.BuildTime = ""
+	}()
+
+	assert.Equal(t, buildinfo.Info{Commit: "3babd66", Time: "2023-09-01T12:00:00Z"}, buildinfo.Get())
+}
@@ -2,56 +2,412 @@ package database
 
 import (
 	"context"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
-func (db *databaseAPIImpl) FindCodeSamples(
-	ctx context.Context,
-	search models.CodeSampleSearch,
-) (models.CodeSamplePage, error) {
-	var page models.CodeSamplePage
+// maximumAuthorFacets limits the authors counted for facets.
+const maximumAuthorFacets = 20
+
+// whereClause joins conditions for a WHERE clause, if there are any.
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ``
+	}
 
-	filters := ` WHERE search_index @@ websearch_to_tsquery('english', $1)`
-	params := make([]any, 1, 4)
-	params[0] = search.Query
+	return ` WHERE ` + strings.Join(conditions, ` AND `)
+}
+
+// andWhere adds a condition to a WHERE clause, which may be empty.
+func andWhere(where string, condition string) string {
+	if len(where) == 0 {
+		return ` WHERE ` + condition
+	}
+
+	return where + ` AND ` + condition
+}
+
+// codeSampleFilters are the conditions for a search and their parameters.
+type codeSampleFilters struct {
+	params queryParams
+	where  string
+	// textQuery is the tsquery for a text search, used for headlines.
+	textQuery string
+	// codeQuery is the query for a code search.
+	codeQuery string
+	// pattern marks matches for a code search, which can't use headlines.
+	pattern *regexp.Regexp
+	// regex finds lines matching a regex search.
+	regex *regexp.Regexp
+	// otherWhere leaves out the conditions for facets, which are used to
+	// count results for every language and author.
+	otherWhere        string
+	languageCondition string
+	authorCondition   string
+}
+
+func (filters codeSampleFilters) hasQuery() bool {
+	return len(filters.textQuery) > 0 || len(filters.codeQuery) > 0
+}
+
+// rankColumn returns an expression for relevance, adding parameters for it.
+// Parameters are only added here so they aren't sent with a count query.
+func (filters codeSampleFilters) rankColumn(params *queryParams) string {
+	if len(filters.codeQuery) > 0 {
+		return `word_similarity(` + params.add(filters.codeQuery) + `, body)`
+	}
+
+	// Rank using the A/B/C weights in the search index.
+	return `ts_rank_cd(search_index, ` + filters.textQuery + `)`
+}
+
+func searchFilters(search models.CodeSampleSearch) (codeSampleFilters, error) {
+	var filters codeSampleFilters
+
+	filters.params = make(queryParams, 0, 12)
+	conditions := make([]string, 0, 8)
+
+	// An empty query matches everything, so the library can be browsed.
+	if search.Mode == models.ModeCode {
+		if terms := codeSearchTerms(search.Query); len(terms) > 0 {
+			var termConditions []string
+
+			termConditions, filters.pattern = codeSearchConditions(
+				&filters.params,
+				terms,
+				search.CaseSensitive,
+			)
+			conditions = append(conditions, termConditions...)
+			filters.codeQuery = search.Query
+		}
+	} else if len(strings.TrimSpace(search.Query)) > 0 {
+		filters.textQuery = `websearch_to_tsquery('english', ` + filters.params.add(search.Query) + `)`
+		conditions = append(conditions, `search_index @@ `+filters.textQuery)
+	}
+
+	if len(search.Regex) > 0 {
+		var err error
+
+		if filters.regex, err = regexp.Compile(search.Regex); err != nil {
+			return filters, err
+		}
+
+		// The translated pattern lets pg_trgm filter samples using the index.
+		pattern, err := postgresRegex(search.Regex)
+
+		if err != nil {
+			return filters, err
+		}
+
+		conditions = append(conditions, `body ~ `+filters.params.add(pattern))
+	}
 
 	if len(search.Languages) > 0 {
-		filters += ` AND language_id = ANY($2)`
-		params = append(params, search.Languages)
+		filters.languageCondition = `language_id = ANY(` + filters.params.add(search.Languages) + `)`
+		conditions = append(conditions, filters.languageCondition)
+	}
+
+	if len(search.Tags) > 0 {
+		// Tags are deduplicated, so every tag was matched if the counts are equal.
+		tags := filters.params.add(search.Tags)
+		conditions = append(conditions, `
+			(
+				SELECT COUNT(*)
+				FROM codesample_tag
+				WHERE codesample_tag.codesample_id = codesample.id
+				AND codesample_tag.tag = ANY(`+tags+`)
+			) = cardinality(`+tags+`::text[])
+		`)
+	}
+
+	if len(search.AnyTags) > 0 {
+		conditions = append(conditions, `
+			EXISTS (
+				SELECT 1
+				FROM codesample_tag
+				WHERE codesample_tag.codesample_id = codesample.id
+				AND codesample_tag.tag = ANY(`+filters.params.add(search.AnyTags)+`)
+			)
+		`)
+	}
+
+	if search.SubmittedBy != uuid.Nil {
+		filters.authorCondition = `submitted_by_id = ` + filters.params.add(search.SubmittedBy)
+		conditions = append(conditions, filters.authorCondition)
 	}
 
-	// Count the results first.
-	countRow := db.pool.QueryRow(
+	if !search.CreatedAfter.IsZero() {
+		conditions = append(conditions, `codesample.created >= `+filters.params.add(search.CreatedAfter))
+	}
+
+	if !search.CreatedBefore.IsZero() {
+		conditions = append(conditions, `codesample.created < `+filters.params.add(search.CreatedBefore))
+	}
+
+	if !search.ModifiedAfter.IsZero() {
+		conditions = append(conditions, `codesample.modified >= `+filters.params.add(search.ModifiedAfter))
+	}
+
+	filters.where = whereClause(conditions)
+	otherConditions := make([]string, 0, len(conditions))
+
+	for _, condition := range conditions {
+		if condition != filters.languageCondition && condition != filters.authorCondition {
+			otherConditions = append(otherConditions, condition)
+		}
+	}
+
+	filters.otherWhere = whereClause(otherConditions)
+
+	return filters, nil
+}
+
+func (db *databaseAPIImpl) countCodeSamples(
+	ctx context.Context,
+	filters codeSampleFilters,
+	facets bool,
+) (uint64, *models.CodeSampleFacets, error) {
+	var count uint64
+
+	if !facets {
+		row := db.pool.QueryRow(
+			ctx,
+			`SELECT COUNT(*) FROM codesample`+filters.where,
+			filters.params...,
+		)
+		err := row.Scan(&count)
+
+		return count, nil, err
+	}
+
+	languageMatch := `TRUE`
+	authorMatch := `TRUE`
+
+	if len(filters.languageCondition) > 0 {
+		languageMatch = filters.languageCondition
+	}
+
+	if len(filters.authorCondition) > 0 {
+		authorMatch = filters.authorCondition
+	}
+
+	// Count results and facets together, marking which rows match the
+	// filters for facets so every facet can ignore its own filter.
+	row := db.pool.QueryRow(
 		ctx,
-		`SELECT COUNT(*) FROM codesample`+filters,
-		params...,
+		`
+			WITH matches AS (
+				SELECT
+					language_id,
+					submitted_by_id,
+					`+languageMatch+` AS language_match,
+					`+authorMatch+` AS author_match
+				FROM codesample
+			`+filters.otherWhere+`
+			)
+			SELECT
+				(
+					SELECT COUNT(*)
+					FROM matches
+					WHERE language_match AND author_match
+				) AS count,
+				(
+					SELECT COALESCE(
+						json_agg(
+							json_build_object(
+								'language', json_build_object(
+									'id', language.id,
+									'name', language.name,
+									'retired', language.retired
+								),
+								'count', facet.count
+							)
+							ORDER BY facet.count DESC, language.name
+						),
+						'[]'
+					)
+					FROM (
+						SELECT language_id, COUNT(*) AS count
+						FROM matches
+						WHERE author_match
+						GROUP BY language_id
+					) AS facet
+					INNER JOIN language
+					ON language.id = facet.language_id
+				) AS languages,
+				(
+					SELECT COALESCE(
+						json_agg(
+							json_build_object(
+								'author', json_build_object(
+									'id', facet.id,
+									'username', facet.username
+								),
+								'count', facet.count
+							)
+							ORDER BY facet.count DESC, facet.username
+						),
+						'[]'
+					)
+					FROM (
+						SELECT "user".id, "user".username, COUNT(*) AS count
+						FROM matches
+						INNER JOIN "user"
+						ON "user".id = matches.submitted_by_id
+						WHERE language_match
+						GROUP BY "user".id
+						ORDER BY count DESC, "user".username
+						LIMIT `+strconv.Itoa(maximumAuthorFacets)+`
+					) AS facet
+				) AS authors
+		`,
+		filters.params...,
 	)
-	err := countRow.Scan(&page.Count)
+
+	result := &models.CodeSampleFacets{}
+	err := row.Scan(&count, &result.Languages, &result.Authors)
+
+	return count, result, err
+}
+
+// codeSamplePage is the state for fetching a page of search results.
+type codeSamplePage struct {
+	filters codeSampleFilters
+	params  queryParams
+	key     sortKey
+	cursor  *codeSampleCursor
+	offset  uint64
+	counted bool
+	count   uint64
+	facets  *models.CodeSampleFacets
+}
+
+// startCodeSamplePage counts the results for a search if needed, and works
+// out how to fetch a page of results.
+func (db *databaseAPIImpl) startCodeSamplePage(
+	ctx context.Context,
+	search models.CodeSampleSearch,
+) (codeSamplePage, error) {
+	var page codeSamplePage
+	var err error
+
+	if page.filters, err = searchFilters(search); err != nil {
+		return page, err
+	}
+
+	if len(search.Cursor) > 0 {
+		cursor, err := decodeCursor(search.Cursor)
+
+		if err != nil {
+			return page, err
+		}
+
+		page.cursor = &cursor
+	} else {
+		page.offset = (search.Page - 1) * search.PageSize
+	}
+
+	// Facets are counted in the same query as the results.
+	if search.CountIncluded() || search.Facets {
+		page.count, page.facets, err = db.countCodeSamples(ctx, page.filters, search.Facets)
+
+		if err != nil {
+			return page, err
+		}
+
+		page.counted = true
+	}
+
+	page.params = page.filters.params
+	page.key = newSortKey(search, page.filters, &page.params)
+
+	// Cursors can't be used for a different order.
+	if page.cursor != nil &&
+		(page.cursor.Sort != page.key.sort || page.cursor.Descending != page.key.descending) {
+		return page, InvalidCursorErr
+	}
+
+	return page, nil
+}
+
+// empty returns true if there's no need to fetch any results.
+func (page *codeSamplePage) empty() bool {
+	return page.counted && page.count == 0
+}
+
+// clauses creates the clauses after FROM for fetching a page, with
+// parameters added after any other parameters for the query.
+func (page *codeSamplePage) clauses(pageSize uint64) string {
+	where := page.filters.where
+
+	if page.cursor != nil {
+		where = andWhere(where, page.key.after(*page.cursor, &page.params))
+	}
+
+	pagination := ` LIMIT ` + page.params.add(pageSize)
+
+	if page.cursor == nil {
+		pagination += ` OFFSET ` + page.params.add(page.offset)
+	}
+
+	return where + page.key.orderBy() + pagination
+}
+
+// capacity determines the capacity for a page.
+// Either it's the page size, or the remaining items on the last page.
+func (page *codeSamplePage) capacity(pageSize uint64) uint64 {
+	if page.counted && page.cursor == nil && page.count < page.offset+pageSize {
+		return page.count - page.offset
+	}
+
+	return pageSize
+}
+
+// nextCursor creates a cursor after the last result, if there may be more.
+func (page *codeSamplePage) nextCursor(
+	pageSize uint64,
+	resultCount int,
+	lastKey string,
+	lastID uuid.UUID,
+) string {
+	if uint64(resultCount) < pageSize ||
+		(page.counted && page.cursor == nil && page.offset+pageSize >= page.count) {
+		return ""
+	}
+
+	return page.key.cursor(lastKey, lastID)
+}
+
+func (db *databaseAPIImpl) FindCodeSamples(
+	ctx context.Context,
+	search models.CodeSampleSearch,
+) (models.CodeSamplePage, error) {
+	var page models.CodeSamplePage
+
+	state, err := db.startCodeSamplePage(ctx, search)
 
 	if err != nil {
 		return page, err
 	}
 
+	page.Count = state.count
+	page.Facets = state.facets
+
 	// If there are no results, don't run the second query to fetch a page.
-	if page.Count == 0 {
+	if state.empty() {
 		// Ensure we have an empty slice to avoid serialization issues.
 		page.Results = []models.CodeSample{}
 		return page, nil
 	}
 
-	offset := (search.Page - 1) * search.PageSize
-
 	// Fetch a page of results.
-	orderBy := ` ORDER BY (search_index @@ websearch_to_tsquery('english', $1))`
-	pagination := ` LIMIT $` +
-		strconv.Itoa(len(params)+1) +
-		` OFFSET $` +
-		strconv.Itoa(len(params)+2)
-	params = append(params, search.PageSize)
-	params = append(params, offset)
+	clauses := state.clauses(search.PageSize)
 	pageRows, err := db.pool.Query(
 		ctx,
 		`
@@ -61,34 +417,31 @@ func (db *databaseAPIImpl) FindCodeSamples(
 				username,
 				language_id,
 				language.name AS language_name,
+				language.retired AS language_retired,
 				title,
 				description,
 				body,
+				`+tagsColumn+`,
 				created,
-				modified
+				modified,
+				`+state.key.column+`::text AS sort_key
 			FROM codesample
 			INNER JOIN "user"
 			ON "user".id = codesample.submitted_by_id
 			INNER JOIN language
 			ON language.id = codesample.language_id
-		`+filters+orderBy+pagination,
-		params...,
+		`+clauses,
+		state.params...,
 	)
 
 	if err != nil {
 		return page, err
 	}
 
-	// Determine the capacity for the page.
-	// Either it's the page size, or the remaining
-	// items on the last page.
-	pageCapacity := search.PageSize
+	defer pageRows.Close()
 
-	if page.Count < offset+search.PageSize {
-		pageCapacity = page.Count - offset
-	}
-
-	page.Results = make([]models.CodeSample, 0, pageCapacity)
+	page.Results = make([]models.CodeSample, 0, state.capacity(search.PageSize))
+	var lastKey string
 
 	for pageRows.Next() {
 		sample := models.CodeSample{}
@@ -98,21 +451,146 @@ func (db *databaseAPIImpl) FindCodeSamples(
 			&sample.SubmittedBy.Username,
 			&sample.Language.ID,
 			&sample.Language.Name,
+			&sample.Language.Retired,
 			&sample.Title,
 			&sample.Description,
 			&sample.Body,
+			&sample.Tags,
 			&sample.Created,
 			&sample.Modified,
+			&lastKey,
 		)
 
 		if err != nil {
 			return page, err
 		}
 
+		if state.filters.regex != nil {
+			sample.MatchedLines = matchedLines(sample.Body, state.filters.regex)
+		}
+
 		page.Results = append(page.Results, sample)
 	}
 
-	return page, nil
+	if len(page.Results) > 0 {
+		lastID := page.Results[len(page.Results)-1].ID
+		page.NextCursor = state.nextCursor(search.PageSize, len(page.Results), lastKey, lastID)
+	}
+
+	return page, pageRows.Err()
+}
+
+func (db *databaseAPIImpl) FindCodeSampleSummaries(
+	ctx context.Context,
+	search models.CodeSampleSearch,
+) (models.CodeSampleSummaryPage, error) {
+	var page models.CodeSampleSummaryPage
+
+	state, err := db.startCodeSamplePage(ctx, search)
+
+	if err != nil {
+		return page, err
+	}
+
+	page.Count = state.count
+	page.Facets = state.facets
+
+	if state.empty() {
+		// Ensure we have an empty slice to avoid serialization issues.
+		page.Results = []models.CodeSampleSummary{}
+		return page, nil
+	}
+
+	filters := state.filters
+	headlines := headlineColumns(&state.params, filters.textQuery)
+	clauses := state.clauses(search.PageSize)
+	rows, err := db.pool.Query(
+		ctx,
+		`
+			SELECT
+				codesample.id,
+				submitted_by_id,
+				username,
+				language_id,
+				language.name AS language_name,
+				language.retired AS language_retired,
+				title,
+				description,
+				`+tagsColumn+`,
+				`+headlines+`,
+				created,
+				modified,
+				`+state.key.column+`::text AS sort_key
+			FROM codesample
+			INNER JOIN "user"
+			ON "user".id = codesample.submitted_by_id
+			INNER JOIN language
+			ON language.id = codesample.language_id
+		`+clauses,
+		state.params...,
+	)
+
+	if err != nil {
+		return page, err
+	}
+
+	defer rows.Close()
+
+	page.Results = make([]models.CodeSampleSummary, 0, state.capacity(search.PageSize))
+	var lastKey string
+
+	for rows.Next() {
+		var titleHeadline, descriptionHeadline, bodyHeadline string
+
+		summary := models.CodeSampleSummary{}
+		err = rows.Scan(
+			&summary.ID,
+			&summary.SubmittedBy.ID,
+			&summary.SubmittedBy.Username,
+			&summary.Language.ID,
+			&summary.Language.Name,
+			&summary.Language.Retired,
+			&summary.Title,
+			&summary.Description,
+			&summary.Tags,
+			&titleHeadline,
+			&descriptionHeadline,
+			&bodyHeadline,
+			&summary.Created,
+			&summary.Modified,
+			&lastKey,
+		)
+
+		if err != nil {
+			return page, err
+		}
+
+		if filters.pattern != nil {
+			titleHeadline = markMatches(titleHeadline, filters.pattern)
+			bodyHeadline = markMatches(bodyHeadline, filters.pattern)
+		}
+
+		// Show the lines matching a regex in place of other matches.
+		if filters.regex != nil {
+			bodyHeadline = unmarkedReplacer.Replace(bodyHeadline)
+			summary.MatchedLines = matchedLines(bodyHeadline, filters.regex)
+			bodyHeadline = markMatches(bodyHeadline, filters.regex)
+		}
+
+		summary.Highlights = models.CodeSampleHighlights{
+			Title:       highlightHTML(titleHeadline),
+			Description: highlightHTML(descriptionHeadline),
+			Lines:       highlightLines(bodyHeadline),
+		}
+		page.Results = append(page.Results, summary)
+	}
+
+	if len(page.Results) > 0 {
+		lastID := page.Results[len(page.Results)-1].ID
+		page.NextCursor = state.nextCursor(search.PageSize, len(page.Results), lastKey, lastID)
+	}
+
+	return page, rows.Err()
 }
 
 func (db *databaseAPIImpl) GetCodeSample(ctx context.Context, id uuid.UUID) (models.CodeSample, error) {
@@ -124,9 +602,11 @@ func (db *databaseAPIImpl) GetCodeSample(ctx context.Context, id uuid.UUID) (mod
 				username,
 				language_id,
 				language.name AS language_name,
+				language.retired AS language_retired,
 				title,
 				description,
 				body,
+				`+tagsColumn+`,
 				created,
 				modified
 			FROM codesample
@@ -145,9 +625,11 @@ func (db *databaseAPIImpl) GetCodeSample(ctx context.Context, id uuid.UUID) (mod
 		&sample.SubmittedBy.Username,
 		&sample.Language.ID,
 		&sample.Language.Name,
+		&sample.Language.Retired,
 		&sample.Title,
 		&sample.Description,
 		&sample.Body,
+		&sample.Tags,
 		&sample.Created,
 		&sample.Modified,
 	)
@@ -156,60 +638,118 @@ func (db *databaseAPIImpl) GetCodeSample(ctx context.Context, id uuid.UUID) (mod
 }
 
 func (db *databaseAPIImpl) CreateCodeSample(ctx context.Context, sample models.CodeSample) error {
-	_, err := db.pool.Exec(
-		ctx,
-		`
-			INSERT INTO codesample (
-				id, submitted_by_id, language_id,
-				title, description, body,
-				created, modified,
-				search_index
-			)
-			VALUES (
-				$1, $2, $3,
-				$4, $5, $6,
-				$7, $8,
-				setweight(to_tsvector($4), 'A') ||
-					setweight(to_tsvector($5), 'B') ||
-					setweight(to_tsvector($6), 'C')
-			)
-		`,
-		sample.ID, sample.SubmittedBy.ID, sample.Language.ID,
-		sample.Title, sample.Description, sample.Body,
-		sample.Created, sample.Modified,
-	)
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`
+				INSERT INTO codesample (
+					id, submitted_by_id, language_id,
+					title, description, body,
+					created, modified,
+					search_index
+				)
+				VALUES (
+					$1, $2, $3,
+					$4, $5, $6,
+					$7, $8,
+					setweight(to_tsvector($4), 'A') ||
+						setweight(to_tsvector($5), 'B') ||
+						setweight(to_tsvector($6), 'C')
+				)
+			`,
+			sample.ID, sample.SubmittedBy.ID, sample.Language.ID,
+			sample.Title, sample.Description, sample.Body,
+			sample.Created, sample.Modified,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if err := saveTags(ctx, tx, sample); err != nil {
+			return err
+		}
 
-	return err
+		return insertRevision(ctx, tx, sample, sample.SubmittedBy.ID)
+	})
 }
 
-func (db *databaseAPIImpl) UpdateCodeSample(ctx context.Context, sample models.CodeSample) error {
-	_, err := db.pool.Exec(
-		ctx,
-		`
-			UPDATE codesample
-			SET
-				submitted_by_id = $2, language_id = $3,
-				title = $4, description = $5, body = $6,
-				created = $7, modified = $8,
-				search_index = setweight(to_tsvector($4), 'A') ||
-					setweight(to_tsvector($5), 'B') ||
-					setweight(to_tsvector($6), 'C')
-			WHERE codesample.id = $1
-		`,
-		sample.ID, sample.SubmittedBy.ID, sample.Language.ID,
-		sample.Title, sample.Description, sample.Body,
-		sample.Created, sample.Modified,
-	)
+// UpdateCodeSample saves changes to a sample, recording the editor in the
+// new revision. Changes by anyone other than the submitter are moderation.
+func (db *databaseAPIImpl) UpdateCodeSample(
+	ctx context.Context,
+	sample models.CodeSample,
+	editorID uuid.UUID,
+) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`
+				UPDATE codesample
+				SET
+					submitted_by_id = $2, language_id = $3,
+					title = $4, description = $5, body = $6,
+					created = $7, modified = $8,
+					search_index = setweight(to_tsvector($4), 'A') ||
+						setweight(to_tsvector($5), 'B') ||
+						setweight(to_tsvector($6), 'C')
+				WHERE codesample.id = $1
+			`,
+			sample.ID, sample.SubmittedBy.ID, sample.Language.ID,
+			sample.Title, sample.Description, sample.Body,
+			sample.Created, sample.Modified,
+		)
 
-	return err
+		if err != nil {
+			return err
+		}
+
+		if err := saveTags(ctx, tx, sample); err != nil {
+			return err
+		}
+
+		if err := insertRevision(ctx, tx, sample, editorID); err != nil {
+			return err
+		}
+
+		if editorID == sample.SubmittedBy.ID {
+			return nil
+		}
+
+		return insertModerationAction(ctx, tx, moderationAction{
+			actorID:      editorID,
+			action:       "editSample",
+			codeSampleID: &sample.ID,
+			userID:       &sample.SubmittedBy.ID,
+			details:      sample.Title,
+			created:      sample.Modified,
+		})
+	})
 }
 
-func (db *databaseAPIImpl) DeleteCodeSample(ctx context.Context, id uuid.UUID) error {
-	_, err := db.pool.Exec(
-		ctx,
-		`DELETE FROM codesample WHERE id = $1`,
-		id,
-	)
+// DeleteCodeSample deletes a sample. Deleting anyone else's sample is
+// recorded as moderation.
+func (db *databaseAPIImpl) DeleteCodeSample(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		var submitterID uuid.UUID
+		var title string
+		err := tx.QueryRow(
+			ctx,
+			`DELETE FROM codesample WHERE id = $1 RETURNING submitted_by_id, title`,
+			id,
+		).Scan(&submitterID, &title)
+
+		if err != nil || submitterID == actorID {
+			return err
+		}
 
-	return err
+		return insertModerationAction(ctx, tx, moderationAction{
+			actorID:      actorID,
+			action:       "deleteSample",
+			codeSampleID: &id,
+			userID:       &submitterID,
+			details:      title,
+			created:      time.Now(),
+		})
+	})
 }
@@ -2,11 +2,13 @@ package database_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/google/uuid"
 	"github.com/pashagolub/pgxmock/v2"
 	"github.com/stretchr/testify/assert"
 )
@@ -24,6 +26,36 @@ var pythonCodeSample = models.CodeSample{
 	Title:       "Adding two numbers",
 	Description: "How to add two numbers together",
 	Body:        "x + y",
+	Tags:        []string{"math"},
+}
+
+// expectSaveTags expects the tags for a sample to be replaced.
+func expectSaveTags(mock pgxmock.PgxPoolIface, sample models.CodeSample) {
+	mock.ExpectExec(`INSERT INTO tag`).
+		WithArgs(sample.Tags).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(`DELETE FROM codesample_tag`).
+		WithArgs(sample.ID, sample.Tags).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`INSERT INTO codesample_tag`).
+		WithArgs(sample.ID, sample.Tags).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
+// expectInsertRevision expects a revision to be saved for a sample.
+func expectInsertRevision(mock pgxmock.PgxPoolIface, sample models.CodeSample, editorID uuid.UUID) {
+	mock.ExpectExec(`INSERT INTO codesample_revision`).
+		WithArgs(
+			sample.ID,
+			editorID,
+			sample.Language.ID,
+			sample.Title,
+			sample.Description,
+			sample.Body,
+			sample.Tags,
+			sample.Modified,
+		).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 }
 
 func TestFindCodeSamples(t *testing.T) {
@@ -49,11 +81,14 @@ func TestFindCodeSamples(t *testing.T) {
 			"username",
 			"language_id",
 			"language_name",
+			"language_retired",
 			"title",
 			"description",
 			"body",
+			"tags",
 			"created",
 			"modified",
+			"sort_key",
 		}).
 		AddRow(
 			testutils.UUIDFromInt(1),
@@ -61,11 +96,14 @@ func TestFindCodeSamples(t *testing.T) {
 			"some_user",
 			"python",
 			"Python",
+			false,
 			"Adding two numbers",
 			"How to add two numbers together",
 			"x + y",
+			[]string{"math"},
 			firstCreated,
 			firstModified,
+			"0.2",
 		).
 		AddRow(
 			testutils.UUIDFromInt(2),
@@ -73,11 +111,14 @@ func TestFindCodeSamples(t *testing.T) {
 			"another_user",
 			"javascript",
 			"JavaScript",
+			false,
 			"Concatenating strings",
 			"How to concatenate strings together",
 			"a + b",
+			[]string{},
 			secondCreated,
 			secondModified,
+			"0.1",
 		)
 	mock.ExpectQuery(`SELECT .* FROM codesample .* LIMIT`).
 		WithArgs("search phrase", uint64(20), uint64(40)).
@@ -129,6 +170,7 @@ func TestFindCodeSamples(t *testing.T) {
 				Title:       "Concatenating strings",
 				Description: "How to concatenate strings together",
 				Body:        "a + b",
+				Tags:        []string{},
 			},
 		},
 	}
@@ -181,9 +223,11 @@ func TestGetCodeSample(t *testing.T) {
 			"username",
 			"language_id",
 			"language_name",
+			"language_retired",
 			"title",
 			"description",
 			"body",
+			"tags",
 			"created",
 			"modified",
 		}).
@@ -192,9 +236,11 @@ func TestGetCodeSample(t *testing.T) {
 			"some_user",
 			"python",
 			"Python",
+			false,
 			"Adding two numbers",
 			"How to add two numbers together",
 			"x + y",
+			[]string{"math"},
 			created,
 			modified,
 		)
@@ -222,6 +268,7 @@ func TestCreateCodeSample(t *testing.T) {
 	mock, db := startDatabaseTest(t)
 	defer mock.Close()
 
+	mock.ExpectBegin()
 	mock.ExpectExec(`INSERT INTO codesample`).
 		WithArgs(
 			pythonCodeSample.ID,
@@ -234,6 +281,9 @@ func TestCreateCodeSample(t *testing.T) {
 			pythonCodeSample.Modified,
 		).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	expectSaveTags(mock, pythonCodeSample)
+	expectInsertRevision(mock, pythonCodeSample, pythonCodeSample.SubmittedBy.ID)
+	mock.ExpectCommit()
 
 	err := db.CreateCodeSample(context.Background(), pythonCodeSample)
 	assert.Nil(t, err)
@@ -247,6 +297,38 @@ func TestUpdateCodeSample(t *testing.T) {
 	mock, db := startDatabaseTest(t)
 	defer mock.Close()
 
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE codesample`).
+		WithArgs(
+			pythonCodeSample.ID,
+			pythonCodeSample.SubmittedBy.ID,
+			pythonCodeSample.Language.ID,
+			pythonCodeSample.Title,
+			pythonCodeSample.Description,
+			pythonCodeSample.Body,
+			pythonCodeSample.Created,
+			pythonCodeSample.Modified,
+		).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectSaveTags(mock, pythonCodeSample)
+	expectInsertRevision(mock, pythonCodeSample, pythonCodeSample.SubmittedBy.ID)
+	mock.ExpectCommit()
+
+	err := db.UpdateCodeSample(context.Background(), pythonCodeSample, pythonCodeSample.SubmittedBy.ID)
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateCodeSampleByModerator(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	moderatorID := testutils.UUIDFromInt(999)
+
+	mock.ExpectBegin()
 	mock.ExpectExec(`UPDATE codesample`).
 		WithArgs(
 			pythonCodeSample.ID,
@@ -259,8 +341,21 @@ func TestUpdateCodeSample(t *testing.T) {
 			pythonCodeSample.Modified,
 		).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectSaveTags(mock, pythonCodeSample)
+	expectInsertRevision(mock, pythonCodeSample, moderatorID)
+	mock.ExpectExec(`INSERT INTO moderation_action`).
+		WithArgs(
+			moderatorID,
+			"editSample",
+			&pythonCodeSample.ID,
+			&pythonCodeSample.SubmittedBy.ID,
+			pythonCodeSample.Title,
+			pythonCodeSample.Modified,
+		).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
 
-	err := db.UpdateCodeSample(context.Background(), pythonCodeSample)
+	err := db.UpdateCodeSample(context.Background(), pythonCodeSample, moderatorID)
 	assert.Nil(t, err)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -272,14 +367,500 @@ func TestDeleteCodeSample(t *testing.T) {
 	mock, db := startDatabaseTest(t)
 	defer mock.Close()
 
-	mock.ExpectExec(`DELETE FROM codesample WHERE id = \$1`).
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM codesample WHERE id = \$1 RETURNING submitted_by_id, title`).
 		WithArgs(testutils.UUIDFromInt(1)).
-		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		WillReturnRows(
+			pgxmock.NewRows([]string{"submitted_by_id", "title"}).
+				AddRow(testutils.UUIDFromInt(123), "Adding numbers"),
+		)
+	mock.ExpectCommit()
 
-	err := db.DeleteCodeSample(context.Background(), testutils.UUIDFromInt(1))
+	err := db.DeleteCodeSample(context.Background(), testutils.UUIDFromInt(1), testutils.UUIDFromInt(123))
 	assert.Nil(t, err)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Unfilfilled expectations: %s", err)
 	}
 }
+
+func TestDeleteCodeSampleByModerator(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	id := testutils.UUIDFromInt(1)
+	submitterID := testutils.UUIDFromInt(123)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM codesample`).
+		WithArgs(id).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"submitted_by_id", "title"}).
+				AddRow(submitterID, "Buy cheap watches"),
+		)
+	mock.ExpectExec(`INSERT INTO moderation_action`).
+		WithArgs(
+			testutils.UUIDFromInt(999),
+			"deleteSample",
+			&id,
+			&submitterID,
+			"Buy cheap watches",
+			pgxmock.AnyArg(),
+		).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := db.DeleteCodeSample(context.Background(), id, testutils.UUIDFromInt(999))
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateCodeSampleRollback(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE codesample`).
+		WithArgs(
+			pythonCodeSample.ID,
+			pythonCodeSample.SubmittedBy.ID,
+			pythonCodeSample.Language.ID,
+			pythonCodeSample.Title,
+			pythonCodeSample.Description,
+			pythonCodeSample.Body,
+			pythonCodeSample.Created,
+			pythonCodeSample.Modified,
+		).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	expectSaveTags(mock, pythonCodeSample)
+	mock.ExpectExec(`INSERT INTO codesample_revision`).
+		WithArgs(
+			pythonCodeSample.ID,
+			pythonCodeSample.SubmittedBy.ID,
+			pythonCodeSample.Language.ID,
+			pythonCodeSample.Title,
+			pythonCodeSample.Description,
+			pythonCodeSample.Body,
+			pythonCodeSample.Tags,
+			pythonCodeSample.Modified,
+		).
+		WillReturnError(errors.New("revision error"))
+	mock.ExpectRollback()
+
+	err := db.UpdateCodeSample(context.Background(), pythonCodeSample, pythonCodeSample.SubmittedBy.ID)
+	assert.Equal(t, errors.New("revision error"), err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestFindCodeSamplesTags(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	expectedCountRows := pgxmock.
+		NewRows([]string{"count"}).
+		AddRow(uint64(0))
+	mock.ExpectQuery(
+		`SELECT COUNT.* FROM codesample .*`+
+			`codesample_tag.tag = ANY\(\$2\)\s+\) = cardinality\(\$2::text\[\]\)`+
+			`.* AND EXISTS .* codesample_tag.tag = ANY\(\$3\)`,
+	).
+		WithArgs("search phrase", []string{"http", "regex"}, []string{"go", "python"}).
+		WillReturnRows(expectedCountRows)
+
+	search := models.CodeSampleSearch{
+		Query:    "search phrase",
+		Tags:     []string{"http", "regex"},
+		AnyTags:  []string{"go", "python"},
+		Page:     1,
+		PageSize: 20,
+	}
+	page, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Equal(t, uint64(0), page.Count)
+}
+
+func TestFindCodeSamplesOrder(t *testing.T) {
+	var tests = map[string]struct {
+		sort            models.CodeSampleSort
+		order           models.SortOrder
+		expectedOrderBy string
+	}{
+		"Default": {
+			expectedOrderBy: `ORDER BY ts_rank_cd\(search_index, websearch_to_tsquery\('english', \$1\)\) DESC, codesample.id DESC`,
+		},
+		"RelevanceAscending": {
+			sort:            models.SortRelevance,
+			order:           models.OrderAscending,
+			expectedOrderBy: `ORDER BY ts_rank_cd\(.*\) ASC, codesample.id ASC`,
+		},
+		"Created": {
+			sort:            models.SortCreated,
+			expectedOrderBy: `ORDER BY codesample.created DESC, codesample.id DESC`,
+		},
+		"ModifiedAscending": {
+			sort:            models.SortModified,
+			order:           models.OrderAscending,
+			expectedOrderBy: `ORDER BY codesample.modified ASC, codesample.id ASC`,
+		},
+		"Title": {
+			sort:            models.SortTitle,
+			expectedOrderBy: `ORDER BY codesample.title ASC, codesample.id ASC`,
+		},
+		"TitleDescending": {
+			sort:            models.SortTitle,
+			order:           models.OrderDescending,
+			expectedOrderBy: `ORDER BY codesample.title DESC, codesample.id DESC`,
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			mock.ExpectQuery(`SELECT COUNT.* FROM codesample`).
+				WithArgs("search phrase").
+				WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+			mock.ExpectQuery(`SELECT .* FROM codesample .* `+testData.expectedOrderBy+` LIMIT`).
+				WithArgs("search phrase", uint64(20), uint64(0)).
+				WillReturnRows(pgxmock.NewRows([]string{"id"}))
+
+			search := models.CodeSampleSearch{
+				Query:    "search phrase",
+				Sort:     testData.sort,
+				Order:    testData.order,
+				Page:     1,
+				PageSize: 20,
+			}
+			_, err := db.FindCodeSamples(context.Background(), search)
+
+			assert.Nil(t, err)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestFindCodeSamplesWithoutQuery(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM codesample WHERE language_id = ANY\(\$1\)$`).
+		WithArgs([]string{"python"}).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+	mock.ExpectQuery(
+		`SELECT .* FROM codesample .* ORDER BY codesample.created DESC, codesample.id DESC LIMIT \$2 OFFSET \$3`,
+	).
+		WithArgs([]string{"python"}, uint64(20), uint64(0)).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+
+	search := models.CodeSampleSearch{
+		Query:     "  ",
+		Languages: []string{"python"},
+		Sort:      models.SortRelevance,
+		Page:      1,
+		PageSize:  20,
+	}
+	_, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestFindCodeSamplesRowError(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	rowError := errors.New("connection lost")
+	columns := []string{
+		"id", "submitted_by_id", "username", "language_id", "language_name", "language_retired",
+		"title", "description", "body", "tags", "created", "modified", "sort_key",
+	}
+	row := []any{
+		pythonCodeSample.ID,
+		pythonCodeSample.SubmittedBy.ID,
+		pythonCodeSample.SubmittedBy.Username,
+		pythonCodeSample.Language.ID,
+		pythonCodeSample.Language.Name,
+		false,
+		pythonCodeSample.Title,
+		pythonCodeSample.Description,
+		pythonCodeSample.Body,
+		pythonCodeSample.Tags,
+		time.Now(),
+		time.Now(),
+		"0.1",
+	}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM codesample$`).
+		WithArgs().
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(2)))
+	mock.ExpectQuery(`SELECT .* FROM codesample .* LIMIT`).
+		WithArgs(uint64(20), uint64(0)).
+		WillReturnRows(pgxmock.NewRows(columns).AddRow(row...).AddRow(row...).RowError(1, rowError)).
+		RowsWillBeClosed()
+
+	// A page cut short by an error isn't returned as if it were complete.
+	_, err := db.FindCodeSamples(
+		context.Background(),
+		models.CodeSampleSearch{Page: 1, PageSize: 20},
+	)
+
+	assert.Equal(t, rowError, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestFindCodeSamplesAll(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM codesample$`).
+		WithArgs().
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(0)))
+
+	page, err := db.FindCodeSamples(
+		context.Background(),
+		models.CodeSampleSearch{Page: 1, PageSize: 20},
+	)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Equal(t, []models.CodeSample{}, page.Results)
+}
+
+func TestFindCodeSamplesUserAndDateFilters(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	createdAfter := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	createdBefore := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	modifiedAfter := time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(
+		`SELECT COUNT.* FROM codesample WHERE `+
+			`search_index @@ websearch_to_tsquery\('english', \$1\) `+
+			`AND submitted_by_id = \$2 `+
+			`AND codesample.created >= \$3 `+
+			`AND codesample.created < \$4 `+
+			`AND codesample.modified >= \$5$`,
+	).
+		WithArgs("search phrase", testutils.UUIDFromInt(1), createdAfter, createdBefore, modifiedAfter).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(0)))
+
+	search := models.CodeSampleSearch{
+		Query:         "search phrase",
+		SubmittedBy:   testutils.UUIDFromInt(1),
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		ModifiedAfter: modifiedAfter,
+		Page:          1,
+		PageSize:      20,
+	}
+	_, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+var summaryColumns = []string{
+	"id",
+	"submitted_by_id",
+	"username",
+	"language_id",
+	"language_name",
+	"language_retired",
+	"title",
+	"description",
+	"tags",
+	"title_headline",
+	"description_headline",
+	"body_headline",
+	"created",
+	"modified",
+	"sort_key",
+}
+
+func TestFindCodeSampleSummaries(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	body := "import math\n" +
+		"\n" +
+		"def \uE000add\uE001(x, y):\n" +
+		"    return x + y\n" +
+		"\n" +
+		"assert \uE000add\uE001(1, 2) < 4\r\n" +
+		"assert \uE000add\uE001(2, 2) == 4\n" +
+		"assert \uE000add\uE001(2, 3) == 5\n"
+
+	mock.ExpectQuery(`SELECT COUNT.* FROM codesample`).
+		WithArgs("add").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+	mock.ExpectQuery(
+		`SELECT .* ts_headline\('english', title, websearch_to_tsquery\('english', \$1\), \$2\) AS title_headline`+
+			`.* ts_headline\('english', description, websearch_to_tsquery\('english', \$1\), \$3\)`+
+			`.* ts_headline\('english', body, websearch_to_tsquery\('english', \$1\), \$2\)`+
+			`.* LIMIT \$4 OFFSET \$5`,
+	).
+		WithArgs(
+			"add",
+			"StartSel=\"\uE000\", StopSel=\"\uE001\", HighlightAll=true",
+			"StartSel=\"\uE000\", StopSel=\"\uE001\"",
+			uint64(20),
+			uint64(0),
+		).
+		WillReturnRows(
+			pgxmock.NewRows(summaryColumns).AddRow(
+				testutils.UUIDFromInt(1),
+				testutils.UUIDFromInt(123),
+				"some_user",
+				"python",
+				"Python",
+				false,
+				"Adding two numbers",
+				"How to add two numbers together",
+				[]string{"math"},
+				"\uE000Adding\uE001 two numbers",
+				"How to \uE000add\uE001 two numbers together",
+				body,
+				created,
+				created,
+				"2023-01-01 00:00:00+00",
+			),
+		)
+
+	search := models.CodeSampleSearch{
+		Query:    "add",
+		View:     models.ViewSummary,
+		Page:     1,
+		PageSize: 20,
+	}
+	page, err := db.FindCodeSampleSummaries(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	expectedPage := models.CodeSampleSummaryPage{
+		Count: 1,
+		Results: []models.CodeSampleSummary{
+			{
+				ID: testutils.UUIDFromInt(1),
+				SubmittedBy: models.User{
+					ID:       testutils.UUIDFromInt(123),
+					Username: "some_user",
+				},
+				Language: models.Language{
+					ID:   "python",
+					Name: "Python",
+				},
+				Title:       "Adding two numbers",
+				Description: "How to add two numbers together",
+				Tags:        []string{"math"},
+				Highlights: models.CodeSampleHighlights{
+					Title:       "<mark>Adding</mark> two numbers",
+					Description: "How to <mark>add</mark> two numbers together",
+					Lines: []models.CodeSampleLine{
+						{Number: 3, Text: "def <mark>add</mark>(x, y):"},
+						{Number: 6, Text: "assert <mark>add</mark>(1, 2) &lt; 4"},
+						{Number: 7, Text: "assert <mark>add</mark>(2, 2) == 4"},
+					},
+				},
+				Created:  created,
+				Modified: created,
+			},
+		},
+	}
+
+	assert.Equal(t, expectedPage, page)
+}
+
+func TestFindCodeSampleSummariesWithoutQuery(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT COUNT.* FROM codesample$`).
+		WithArgs().
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+	mock.ExpectQuery(`SELECT .* title, description, body,.* ORDER BY codesample.created DESC`).
+		WithArgs(uint64(20), uint64(0)).
+		WillReturnRows(
+			pgxmock.NewRows(summaryColumns).AddRow(
+				testutils.UUIDFromInt(1),
+				testutils.UUIDFromInt(123),
+				"some_user",
+				"html",
+				"HTML",
+				false,
+				"Links",
+				"Making <a> tags",
+				[]string{},
+				"Links",
+				"Making <a> tags",
+				"<a href=\"/\">\nHome\n</a>\n<br>",
+				created,
+				created,
+				"2023-01-01 00:00:00+00",
+			),
+		)
+
+	page, err := db.FindCodeSampleSummaries(
+		context.Background(),
+		models.CodeSampleSearch{Page: 1, PageSize: 20},
+	)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	if assert.Equal(t, 1, len(page.Results)) {
+		assert.Equal(
+			t,
+			models.CodeSampleHighlights{
+				Title:       "Links",
+				Description: "Making &lt;a&gt; tags",
+				Lines: []models.CodeSampleLine{
+					{Number: 1, Text: "&lt;a href=&#34;/&#34;&gt;"},
+					{Number: 2, Text: "Home"},
+					{Number: 3, Text: "&lt;/a&gt;"},
+				},
+			},
+			page.Results[0].Highlights,
+		)
+	}
+}
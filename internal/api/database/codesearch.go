@@ -0,0 +1,135 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// likeEscaper escapes the wildcards in LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// codeSearchTerms splits a code search into terms separated by whitespace.
+// Text in double quotes is kept together as one term.
+func codeSearchTerms(query string) []string {
+	terms := []string{}
+
+	for len(query) > 0 {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+
+		if strings.HasPrefix(query, `"`) {
+			if end := strings.Index(query[1:], `"`); end >= 0 {
+				if end > 0 {
+					terms = append(terms, query[1:end+1])
+				}
+
+				query = query[end+2:]
+
+				continue
+			}
+		}
+
+		end := strings.IndexFunc(query, unicode.IsSpace)
+
+		if end < 0 {
+			end = len(query)
+		}
+
+		if end > 0 {
+			terms = append(terms, query[:end])
+		}
+
+		query = query[end:]
+	}
+
+	return terms
+}
+
+// identifierParts splits camelCase and snake_case identifiers into lowercase
+// words, so `parseHTTPRequest` becomes `parse`, `http`, and `request`.
+func identifierParts(term string) []string {
+	if !identifierRegex.MatchString(term) {
+		return nil
+	}
+
+	parts := []string{}
+	runes := []rune(term)
+	start := 0
+
+	for i := 0; i <= len(runes); i++ {
+		boundary := i == len(runes) || runes[i] == '_'
+
+		if !boundary && i > start && unicode.IsUpper(runes[i]) {
+			// Split before an upper case letter following a lower case one,
+			// and before the last letter of an acronym followed by a word.
+			boundary = !unicode.IsUpper(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))
+		}
+
+		if boundary {
+			if i > start {
+				parts = append(parts, strings.ToLower(string(runes[start:i])))
+			}
+
+			start = i
+
+			if i < len(runes) && runes[i] == '_' {
+				start++
+			}
+		}
+	}
+
+	return parts
+}
+
+// identifierPattern matches an identifier written in any of camelCase,
+// PascalCase, snake_case or SCREAMING_SNAKE_CASE, when matched without case.
+// The pattern works for both Go and PostgreSQL regular expressions.
+func identifierPattern(parts []string) string {
+	return strings.Join(parts, `_*`)
+}
+
+// codeSearchConditions creates conditions matching every term in a code search,
+// and a regular expression for marking matches in Go.
+//
+// Terms are matched as exact substrings. When matching without case,
+// identifiers also match other spellings, so `getUserName` finds
+// `get_user_name`.
+func codeSearchConditions(
+	params *queryParams,
+	terms []string,
+	caseSensitive bool,
+) ([]string, *regexp.Regexp) {
+	conditions := make([]string, 0, len(terms))
+	patterns := make([]string, 0, len(terms))
+
+	for _, term := range terms {
+		like := params.add(`%` + likeEscaper.Replace(term) + `%`)
+		pattern := regexp.QuoteMeta(term)
+
+		if caseSensitive {
+			conditions = append(conditions, `body LIKE `+like)
+		} else if parts := identifierParts(term); len(parts) > 1 {
+			identifier := identifierPattern(parts)
+			pattern += `|` + identifier
+			conditions = append(
+				conditions,
+				`(body ILIKE `+like+` OR body ~* `+params.add(identifier)+`)`,
+			)
+		} else {
+			conditions = append(conditions, `body ILIKE `+like)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	flags := `(?i)`
+
+	if caseSensitive {
+		flags = ``
+	}
+
+	return conditions, regexp.MustCompile(flags + strings.Join(patterns, `|`))
+}
@@ -0,0 +1,179 @@
+package database_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindCodeSamplesCodeMode(t *testing.T) {
+	var tests = map[string]struct {
+		query              string
+		caseSensitive      bool
+		expectedConditions string
+		expectedArgs       []any
+	}{
+		"Symbols": {
+			query:              `fmt.Sprintf ->`,
+			expectedConditions: `body ILIKE \$1 AND body ILIKE \$2`,
+			expectedArgs:       []any{`%fmt.Sprintf%`, `%->%`},
+		},
+		"QuotedSubstring": {
+			query:              `"std::vector<int> v" 100%`,
+			expectedConditions: `body ILIKE \$1 AND body ILIKE \$2`,
+			expectedArgs:       []any{`%std::vector<int> v%`, `%100\%%`},
+		},
+		"Identifier": {
+			query:              `parseHTTPRequest`,
+			expectedConditions: `\(body ILIKE \$1 OR body ~\* \$2\)`,
+			expectedArgs:       []any{`%parseHTTPRequest%`, `parse_*http_*request`},
+		},
+		"SnakeCaseIdentifier": {
+			query:              `get_user_name`,
+			expectedConditions: `\(body ILIKE \$1 OR body ~\* \$2\)`,
+			expectedArgs:       []any{`%get\_user\_name%`, `get_*user_*name`},
+		},
+		"Dunder": {
+			query:              `__init__`,
+			expectedConditions: `body ILIKE \$1`,
+			expectedArgs:       []any{`%\_\_init\_\_%`},
+		},
+		"CaseSensitive": {
+			query:              `getUserName`,
+			caseSensitive:      true,
+			expectedConditions: `body LIKE \$1`,
+			expectedArgs:       []any{`%getUserName%`},
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			argCount := len(testData.expectedArgs)
+
+			mock.ExpectQuery(`SELECT COUNT.* FROM codesample WHERE ` + testData.expectedConditions + `$`).
+				WithArgs(testData.expectedArgs...).
+				WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+			mock.ExpectQuery(
+				`SELECT .* FROM codesample .* WHERE ` + testData.expectedConditions +
+					` ORDER BY word_similarity\(\$` + strconv.Itoa(argCount+1) + `, body\) DESC`,
+			).
+				WithArgs(append(testData.expectedArgs, testData.query, uint64(20), uint64(0))...).
+				WillReturnRows(pgxmock.NewRows([]string{"id"}))
+
+			search := models.CodeSampleSearch{
+				Query:         testData.query,
+				Mode:          models.ModeCode,
+				CaseSensitive: testData.caseSensitive,
+				Page:          1,
+				PageSize:      20,
+			}
+			_, err := db.FindCodeSamples(context.Background(), search)
+
+			assert.Nil(t, err)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestFindCodeSamplesCodeModeSortedByDate(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT COUNT.* FROM codesample WHERE body ILIKE \$1$`).
+		WithArgs(`%->%`).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+	// The query for ranking should not be sent when it's not used.
+	mock.ExpectQuery(`SELECT .* FROM codesample .* ORDER BY codesample.modified DESC`).
+		WithArgs(`%->%`, uint64(20), uint64(0)).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}))
+
+	search := models.CodeSampleSearch{
+		Query:    `->`,
+		Mode:     models.ModeCode,
+		Sort:     models.SortModified,
+		Page:     1,
+		PageSize: 20,
+	}
+	_, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestFindCodeSampleSummariesCodeMode(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT COUNT.* FROM codesample`).
+		WithArgs(`%userName%`, `user_*name`).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+	mock.ExpectQuery(`SELECT .* title, description, body,.* ORDER BY word_similarity\(\$3, body\) DESC`).
+		WithArgs(`%userName%`, `user_*name`, `userName`, uint64(20), uint64(0)).
+		WillReturnRows(
+			pgxmock.NewRows(summaryColumns).AddRow(
+				testutils.UUIDFromInt(1),
+				testutils.UUIDFromInt(123),
+				"some_user",
+				"python",
+				"Python",
+				false,
+				"Reading a user_name",
+				"Reading names",
+				[]string{},
+				"Reading a user_name",
+				"Reading names",
+				"import os\n\nuser_name = os.environ['USER_NAME']\nprint(userName)",
+				created,
+				created,
+				"0.5",
+			),
+		)
+
+	search := models.CodeSampleSearch{
+		Query:    `userName`,
+		Mode:     models.ModeCode,
+		View:     models.ViewSummary,
+		Page:     1,
+		PageSize: 20,
+	}
+	page, err := db.FindCodeSampleSummaries(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	if assert.Equal(t, 1, len(page.Results)) {
+		assert.Equal(
+			t,
+			models.CodeSampleHighlights{
+				Title:       "Reading a <mark>user_name</mark>",
+				Description: "Reading names",
+				Lines: []models.CodeSampleLine{
+					{Number: 3, Text: "<mark>user_name</mark> = os.environ[&#39;<mark>USER_NAME</mark>&#39;]"},
+					{Number: 4, Text: "print(<mark>userName</mark>)"},
+				},
+			},
+			page.Results[0].Highlights,
+		)
+	}
+}
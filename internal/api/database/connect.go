@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultConnectAttempts is how many times Connect tries to reach the database
+// when the configuration doesn't say.
+const DefaultConnectAttempts = 10
+
+// pingTimeout is how long to wait for the database to answer each attempt.
+const pingTimeout = 5 * time.Second
+
+// Backoff is how long to wait between attempts to reach the database. The wait
+// doubles after each failure, up to Max.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+var DefaultBackoff = Backoff{Initial: 500 * time.Millisecond, Max: 30 * time.Second}
+
+// Delay returns how long to wait after a failed attempt, counting from 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := b.Initial
+
+	for i := 1; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+
+	if delay > b.Max {
+		delay = b.Max
+	}
+
+	return delay
+}
+
+// RetryFunc is called after an attempt to reach the database fails, before
+// waiting to try again.
+type RetryFunc func(attempt int, err error, delay time.Duration)
+
+// Wait pings the database until it answers, up to a number of attempts.
+// The last error is returned if every attempt fails, or the context error if
+// the context is cancelled while waiting.
+func Wait(ctx context.Context, db DatabaseAPI, attempts int, backoff Backoff, onRetry RetryFunc) error {
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := db.Ping(pingCtx)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= attempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := backoff.Delay(attempt)
+
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Connect creates a connection pool and waits until the database can be
+// reached, so the app doesn't start before the database does.
+func Connect(ctx context.Context, config Config, onRetry RetryFunc) (DatabaseAPI, error) {
+	db, err := New(ctx, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := config.ConnectAttempts
+
+	if attempts <= 0 {
+		attempts = DefaultConnectAttempts
+	}
+
+	if err := Wait(ctx, db, attempts, DefaultBackoff, onRetry); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
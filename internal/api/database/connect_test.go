@@ -0,0 +1,121 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func startPingTest(t *testing.T) (pgxmock.PgxPoolIface, database.DatabaseAPI) {
+	t.Parallel()
+	t.Helper()
+
+	mock, err := pgxmock.NewPool(pgxmock.MonitorPingsOption(true))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.NewWithPool(mock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mock, db
+}
+
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+	backoff := database.Backoff{Initial: time.Second, Max: 5 * time.Second}
+
+	assert.Equal(t, time.Second, backoff.Delay(1))
+	assert.Equal(t, 2*time.Second, backoff.Delay(2))
+	assert.Equal(t, 4*time.Second, backoff.Delay(3))
+	assert.Equal(t, 5*time.Second, backoff.Delay(4))
+	assert.Equal(t, 5*time.Second, backoff.Delay(100))
+}
+
+func TestWait(t *testing.T) {
+	mock, db := startPingTest(t)
+	pingErr := errors.New("connection refused")
+
+	mock.ExpectPing().WillReturnError(pingErr)
+	mock.ExpectPing().WillReturnError(pingErr)
+	mock.ExpectPing()
+
+	retries := []int{}
+	err := database.Wait(
+		context.Background(),
+		db,
+		3,
+		database.Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+		func(attempt int, err error, delay time.Duration) {
+			assert.Equal(t, pingErr, err)
+			assert.Equal(t, time.Millisecond, delay)
+			retries = append(retries, attempt)
+		},
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, retries)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestWaitGivesUp(t *testing.T) {
+	mock, db := startPingTest(t)
+	pingErr := errors.New("connection refused")
+
+	mock.ExpectPing().WillReturnError(pingErr)
+	mock.ExpectPing().WillReturnError(pingErr)
+
+	err := database.Wait(
+		context.Background(),
+		db,
+		2,
+		database.Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+		nil,
+	)
+
+	assert.Equal(t, pingErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	mock, db := startPingTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	err := database.Wait(
+		ctx,
+		db,
+		10,
+		database.Backoff{Initial: time.Hour, Max: time.Hour},
+		func(int, error, time.Duration) { cancel() },
+	)
+
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestClose(t *testing.T) {
+	mock, db := startPingTest(t)
+
+	mock.ExpectClose()
+	db.Close()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
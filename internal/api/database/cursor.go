@@ -0,0 +1,127 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+)
+
+// codeSampleCursor is a position after a code sample in a sorted list.
+type codeSampleCursor struct {
+	Sort       models.CodeSampleSort `json:"sort"`
+	Descending bool                  `json:"desc"`
+	// Key is the value the last sample was sorted by, as text.
+	Key string    `json:"key"`
+	ID  uuid.UUID `json:"id"`
+}
+
+// encodeCursor encodes a cursor as an opaque string for clients.
+func encodeCursor(cursor codeSampleCursor) string {
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(text string) (codeSampleCursor, error) {
+	var cursor codeSampleCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(text)
+
+	if err != nil {
+		return cursor, InvalidCursorErr
+	}
+
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, InvalidCursorErr
+	}
+
+	return cursor, nil
+}
+
+// sortKey is the expression code samples are sorted by, which is also used
+// to continue from a cursor.
+type sortKey struct {
+	sort   models.CodeSampleSort
+	column string
+	// cast is the type of the column, for reading keys from cursors.
+	cast       string
+	descending bool
+}
+
+// newSortKey works out how to sort the results of a search.
+// Results are always ordered by ID last so pages never overlap.
+func newSortKey(
+	search models.CodeSampleSearch,
+	filters codeSampleFilters,
+	params *queryParams,
+) sortKey {
+	key := sortKey{sort: search.Sort}
+
+	if len(key.sort) == 0 {
+		key.sort = models.SortRelevance
+	}
+
+	// Relevance is meaningless without a query, so show the newest first.
+	if key.sort == models.SortRelevance && !filters.hasQuery() {
+		key.sort = models.SortCreated
+	}
+
+	order := search.Order
+
+	if len(order) == 0 {
+		order = key.sort.DefaultOrder()
+	}
+
+	key.descending = order == models.OrderDescending
+
+	switch key.sort {
+	case models.SortCreated:
+		key.column = `codesample.created`
+		key.cast = `timestamp with time zone`
+	case models.SortModified:
+		key.column = `codesample.modified`
+		key.cast = `timestamp with time zone`
+	case models.SortTitle:
+		key.column = `codesample.title`
+		key.cast = `text`
+	default:
+		key.column = filters.rankColumn(params)
+		key.cast = `real`
+	}
+
+	return key
+}
+
+func (key sortKey) orderBy() string {
+	direction := ` ASC`
+
+	if key.descending {
+		direction = ` DESC`
+	}
+
+	return ` ORDER BY ` + key.column + direction + `, codesample.id` + direction
+}
+
+// after creates a condition for results after a cursor.
+func (key sortKey) after(cursor codeSampleCursor, params *queryParams) string {
+	operator := ` > `
+
+	if key.descending {
+		operator = ` < `
+	}
+
+	return `(` + key.column + `, codesample.id)` + operator +
+		`(CAST(` + params.add(cursor.Key) + ` AS ` + key.cast + `), ` + params.add(cursor.ID) + `)`
+}
+
+// cursor creates a cursor after a result.
+func (key sortKey) cursor(value string, id uuid.UUID) string {
+	return encodeCursor(codeSampleCursor{
+		Sort:       key.sort,
+		Descending: key.descending,
+		Key:        value,
+		ID:         id,
+	})
+}
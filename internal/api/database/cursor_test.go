@@ -0,0 +1,148 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+var cursorColumns = []string{
+	"id",
+	"submitted_by_id",
+	"username",
+	"language_id",
+	"language_name",
+	"language_retired",
+	"title",
+	"description",
+	"body",
+	"tags",
+	"created",
+	"modified",
+	"sort_key",
+}
+
+func addCursorRow(rows *pgxmock.Rows, id uint64, title string) *pgxmock.Rows {
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return rows.AddRow(
+		testutils.UUIDFromInt(id),
+		testutils.UUIDFromInt(123),
+		"some_user",
+		"python",
+		"Python",
+		false,
+		title,
+		"",
+		"",
+		[]string{},
+		created,
+		created,
+		title,
+	)
+}
+
+func TestFindCodeSamplesCursor(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	// The first page is fetched with an offset, and gives a cursor.
+	mock.ExpectQuery(`SELECT COUNT.* FROM codesample$`).
+		WithArgs().
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(3)))
+	mock.ExpectQuery(
+		`SELECT .* codesample.title::text AS sort_key .* `+
+			`ORDER BY codesample.title ASC, codesample.id ASC LIMIT \$1 OFFSET \$2$`,
+	).
+		WithArgs(uint64(2), uint64(0)).
+		WillReturnRows(
+			addCursorRow(addCursorRow(pgxmock.NewRows(cursorColumns), 1, "A"), 2, "B"),
+		)
+
+	search := models.CodeSampleSearch{Sort: models.SortTitle, Page: 1, PageSize: 2}
+	page, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", page.NextCursor)
+
+	// The next page continues after the last sample without counting.
+	mock.ExpectQuery(
+		`SELECT .* FROM codesample .* `+
+			`WHERE \(codesample.title, codesample.id\) > \(CAST\(\$1 AS text\), \$2\) `+
+			`ORDER BY codesample.title ASC, codesample.id ASC LIMIT \$3$`,
+	).
+		WithArgs("B", testutils.UUIDFromInt(2), uint64(2)).
+		WillReturnRows(addCursorRow(pgxmock.NewRows(cursorColumns), 3, "C"))
+
+	includeCount := false
+	search.IncludeCount = &includeCount
+	search.Cursor = page.NextCursor
+	page, err = db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Equal(t, uint64(0), page.Count)
+	assert.Equal(t, 1, len(page.Results))
+	assert.Equal(t, "", page.NextCursor)
+}
+
+func TestFindCodeSamplesCursorWithoutCount(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	// A full page gives a cursor when the total isn't known.
+	mock.ExpectQuery(`SELECT .* FROM codesample .* LIMIT \$2 OFFSET \$3$`).
+		WithArgs([]string{"python"}, uint64(1), uint64(0)).
+		WillReturnRows(addCursorRow(pgxmock.NewRows(cursorColumns), 1, "A"))
+
+	includeCount := false
+	search := models.CodeSampleSearch{
+		Languages:    []string{"python"},
+		Sort:         models.SortTitle,
+		IncludeCount: &includeCount,
+		Page:         1,
+		PageSize:     1,
+	}
+	page, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.NotEqual(t, "", page.NextCursor)
+
+	// The cursor can't be used for a different order.
+	search.Cursor = page.NextCursor
+	search.Order = models.OrderDescending
+	_, err = db.FindCodeSamples(context.Background(), search)
+
+	assert.Equal(t, database.InvalidCursorErr, err)
+}
+
+func TestFindCodeSamplesInvalidCursor(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	for _, cursor := range []string{"not a cursor", "bm90IGpzb24"} {
+		search := models.CodeSampleSearch{Cursor: cursor, PageSize: 20}
+		_, err := db.FindCodeSamples(context.Background(), search)
+
+		assert.Equal(t, database.InvalidCursorErr, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
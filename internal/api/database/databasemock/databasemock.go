@@ -2,6 +2,7 @@ package databasemock
 
 import (
 	"context"
+	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/database"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
@@ -10,16 +11,69 @@ import (
 )
 
 type MockDatabaseAPI struct {
-	calls                        map[string][][]any
-	GetUserResult                ranges.Pair[models.User, error]
-	GetUserWithCredentialsResult ranges.Pair[models.User, error]
-	RegisterUserResult           error
-	GetLanguageResult            ranges.Pair[models.Language, error]
-	FindCodeSamplesResult        ranges.Pair[models.CodeSamplePage, error]
-	GetCodeSampleResult          ranges.Pair[models.CodeSample, error]
-	CreateCodeSampleResult       error
-	UpdateCodeSampleResult       error
-	DeleteCodeSampleResult       error
+	calls                         map[string][][]any
+	GetUserResult                 ranges.Pair[models.User, error]
+	GetUserWithCredentialsResult  ranges.Pair[models.User, error]
+	RegisterUserResult            error
+	UpdateAccountResult           error
+	DeleteUserResult              error
+	GetUserByEmailResult          ranges.Pair[models.User, error]
+	CreatePasswordResetResult     error
+	ResetPasswordResult           error
+	GetAccountResult              ranges.Pair[models.Account, error]
+	CreateEmailVerificationResult error
+	VerifyEmailResult             error
+	GetLoginLockoutResult         ranges.Pair[time.Time, error]
+	RecordLoginFailureResult      ranges.Pair[int, error]
+	LockLoginResult               error
+	ClearLoginFailuresResult      error
+	GetTOTPResult                 ranges.Pair[models.TOTP, error]
+	SetTOTPResult                 error
+	ConfirmTOTPResult             error
+	UseTOTPStepResult             error
+	UseRecoveryCodeResult         error
+	DeleteTOTPResult              error
+	CreatePendingLoginResult      error
+	GetPendingLoginResult         ranges.Pair[models.User, error]
+	DeletePendingLoginResult      error
+	GetExternalIdentityUserResult ranges.Pair[models.User, error]
+	CreateExternalUserResult      ranges.Pair[models.User, error]
+	SetUserRoleResult             ranges.Pair[models.User, error]
+	CreateSessionResult           error
+	GetSessionUserResult          ranges.Pair[models.User, error]
+	GetSessionResult              ranges.Pair[models.Session, error]
+	ListSessionsResult            ranges.Pair[[]models.Session, error]
+	DeleteSessionResult           error
+	DeleteUserSessionResult       error
+	CreateAPITokenResult          error
+	GetAPITokenUserResult         GetAPITokenUserResult
+	GetAPITokenIDResult           ranges.Pair[uuid.UUID, error]
+	ListAPITokensResult           ranges.Pair[[]models.APIToken, error]
+	DeleteAPITokenResult          error
+	GetLanguageResult             ranges.Pair[models.Language, error]
+	ListLanguagesResult           ranges.Pair[[]models.LanguageSummary, error]
+	GetLanguageSummaryResult      ranges.Pair[models.LanguageSummary, error]
+	CreateLanguageResult          error
+	RenameLanguageResult          error
+	RetireLanguageResult          error
+	FindCodeSamplesResult         ranges.Pair[models.CodeSamplePage, error]
+	FindCodeSampleSummariesResult ranges.Pair[models.CodeSampleSummaryPage, error]
+	GetCodeSampleResult           ranges.Pair[models.CodeSample, error]
+	CreateCodeSampleResult        error
+	UpdateCodeSampleResult        error
+	DeleteCodeSampleResult        error
+	ListCodeSampleRevisionsResult ranges.Pair[[]models.CodeSampleRevision, error]
+	GetCodeSampleRevisionResult   ranges.Pair[models.CodeSampleRevision, error]
+	ListTagsResult                ranges.Pair[[]models.TagSummary, error]
+	GetSchemaVersionResult        ranges.Pair[int, error]
+	PingResult                    error
+}
+
+// GetAPITokenUserResult is the result for GetAPITokenUser.
+type GetAPITokenUserResult struct {
+	User  models.User
+	Token models.APIToken
+	Err   error
 }
 
 func (db *MockDatabaseAPI) addCall(name string, args ...any) {
@@ -47,18 +101,328 @@ func (db *MockDatabaseAPI) GetUserWithCredentials(
 	return db.GetUserWithCredentialsResult.Get()
 }
 
-func (db *MockDatabaseAPI) RegisterUser(ctx context.Context, user models.User, password string) error {
-	db.addCall("RegisterUser", user, password)
+func (db *MockDatabaseAPI) RegisterUser(ctx context.Context, account models.Account, password string) error {
+	db.addCall("RegisterUser", account, password)
 
 	return db.RegisterUserResult
 }
 
+func (db *MockDatabaseAPI) UpdateAccount(ctx context.Context, id uuid.UUID, changes database.AccountChanges) error {
+	db.addCall("UpdateAccount", id, changes)
+
+	return db.UpdateAccountResult
+}
+
+func (db *MockDatabaseAPI) DeleteUser(ctx context.Context, id uuid.UUID, samples models.SampleDisposal) error {
+	db.addCall("DeleteUser", id, samples)
+
+	return db.DeleteUserResult
+}
+
+func (db *MockDatabaseAPI) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	db.addCall("GetUserByEmail", email)
+
+	return db.GetUserByEmailResult.Get()
+}
+
+func (db *MockDatabaseAPI) CreatePasswordReset(
+	ctx context.Context,
+	userID uuid.UUID,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) error {
+	db.addCall("CreatePasswordReset", userID, hash, created, expires)
+
+	return db.CreatePasswordResetResult
+}
+
+func (db *MockDatabaseAPI) ResetPassword(
+	ctx context.Context,
+	hash string,
+	password string,
+	now time.Time,
+) error {
+	db.addCall("ResetPassword", hash, password, now)
+
+	return db.ResetPasswordResult
+}
+
+func (db *MockDatabaseAPI) GetAccount(ctx context.Context, id uuid.UUID) (models.Account, error) {
+	db.addCall("GetAccount", id)
+
+	return db.GetAccountResult.Get()
+}
+
+func (db *MockDatabaseAPI) CreateEmailVerification(
+	ctx context.Context,
+	userID uuid.UUID,
+	email string,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) error {
+	db.addCall("CreateEmailVerification", userID, email, hash, created, expires)
+
+	return db.CreateEmailVerificationResult
+}
+
+func (db *MockDatabaseAPI) VerifyEmail(ctx context.Context, hash string, now time.Time) error {
+	db.addCall("VerifyEmail", hash, now)
+
+	return db.VerifyEmailResult
+}
+
+func (db *MockDatabaseAPI) GetLoginLockout(ctx context.Context, keys []string, now time.Time) (time.Time, error) {
+	db.addCall("GetLoginLockout", keys, now)
+
+	return db.GetLoginLockoutResult.Get()
+}
+
+func (db *MockDatabaseAPI) RecordLoginFailure(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	resetBefore time.Time,
+) (int, error) {
+	db.addCall("RecordLoginFailure", key, now, resetBefore)
+
+	return db.RecordLoginFailureResult.Get()
+}
+
+func (db *MockDatabaseAPI) LockLogin(
+	ctx context.Context,
+	key string,
+	failures int,
+	until time.Time,
+	now time.Time,
+) error {
+	db.addCall("LockLogin", key, failures, until, now)
+
+	return db.LockLoginResult
+}
+
+func (db *MockDatabaseAPI) ClearLoginFailures(ctx context.Context, key string) error {
+	db.addCall("ClearLoginFailures", key)
+
+	return db.ClearLoginFailuresResult
+}
+
+func (db *MockDatabaseAPI) GetTOTP(ctx context.Context, userID uuid.UUID) (models.TOTP, error) {
+	db.addCall("GetTOTP", userID)
+
+	return db.GetTOTPResult.Get()
+}
+
+func (db *MockDatabaseAPI) SetTOTP(ctx context.Context, totp models.TOTP) error {
+	db.addCall("SetTOTP", totp)
+
+	return db.SetTOTPResult
+}
+
+func (db *MockDatabaseAPI) ConfirmTOTP(
+	ctx context.Context,
+	userID uuid.UUID,
+	step int64,
+	recoveryHashes []string,
+) error {
+	db.addCall("ConfirmTOTP", userID, step, recoveryHashes)
+
+	return db.ConfirmTOTPResult
+}
+
+func (db *MockDatabaseAPI) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	db.addCall("UseTOTPStep", userID, step)
+
+	return db.UseTOTPStepResult
+}
+
+func (db *MockDatabaseAPI) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) error {
+	db.addCall("UseRecoveryCode", userID, hash)
+
+	return db.UseRecoveryCodeResult
+}
+
+func (db *MockDatabaseAPI) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	db.addCall("DeleteTOTP", userID)
+
+	return db.DeleteTOTPResult
+}
+
+func (db *MockDatabaseAPI) CreatePendingLogin(
+	ctx context.Context,
+	userID uuid.UUID,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) error {
+	db.addCall("CreatePendingLogin", userID, hash, created, expires)
+
+	return db.CreatePendingLoginResult
+}
+
+func (db *MockDatabaseAPI) GetPendingLogin(ctx context.Context, hash string, now time.Time) (models.User, error) {
+	db.addCall("GetPendingLogin", hash, now)
+
+	return db.GetPendingLoginResult.Get()
+}
+
+func (db *MockDatabaseAPI) DeletePendingLogin(ctx context.Context, hash string) error {
+	db.addCall("DeletePendingLogin", hash)
+
+	return db.DeletePendingLoginResult
+}
+
+func (db *MockDatabaseAPI) GetExternalIdentityUser(
+	ctx context.Context,
+	issuer string,
+	subject string,
+) (models.User, error) {
+	db.addCall("GetExternalIdentityUser", issuer, subject)
+
+	return db.GetExternalIdentityUserResult.Get()
+}
+
+func (db *MockDatabaseAPI) CreateExternalUser(
+	ctx context.Context,
+	account models.Account,
+	identity models.ExternalIdentity,
+) (models.User, error) {
+	db.addCall("CreateExternalUser", account, identity)
+
+	return db.CreateExternalUserResult.Get()
+}
+
+func (db *MockDatabaseAPI) SetUserRole(
+	ctx context.Context,
+	id uuid.UUID,
+	role models.Role,
+	actorID uuid.UUID,
+) (models.User, error) {
+	db.addCall("SetUserRole", id, role, actorID)
+
+	return db.SetUserRoleResult.Get()
+}
+
+func (db *MockDatabaseAPI) CreateSession(ctx context.Context, session models.Session) error {
+	db.addCall("CreateSession", session)
+
+	return db.CreateSessionResult
+}
+
+func (db *MockDatabaseAPI) GetSessionUser(
+	ctx context.Context,
+	id uuid.UUID,
+	lastSeen time.Time,
+	expires time.Time,
+) (models.User, error) {
+	db.addCall("GetSessionUser", id, lastSeen, expires)
+
+	return db.GetSessionUserResult.Get()
+}
+
+func (db *MockDatabaseAPI) GetSession(ctx context.Context, id uuid.UUID, now time.Time) (models.Session, error) {
+	db.addCall("GetSession", id, now)
+
+	return db.GetSessionResult.Get()
+}
+
+func (db *MockDatabaseAPI) ListSessions(
+	ctx context.Context,
+	userID uuid.UUID,
+	now time.Time,
+) ([]models.Session, error) {
+	db.addCall("ListSessions", userID, now)
+
+	return db.ListSessionsResult.Get()
+}
+
+func (db *MockDatabaseAPI) DeleteSession(ctx context.Context, id uuid.UUID) error {
+	db.addCall("DeleteSession", id)
+
+	return db.DeleteSessionResult
+}
+
+func (db *MockDatabaseAPI) DeleteUserSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	db.addCall("DeleteUserSession", userID, id)
+
+	return db.DeleteUserSessionResult
+}
+
+func (db *MockDatabaseAPI) CreateAPIToken(ctx context.Context, token models.APIToken, hash string) error {
+	db.addCall("CreateAPIToken", token, hash)
+
+	return db.CreateAPITokenResult
+}
+
+func (db *MockDatabaseAPI) GetAPITokenUser(
+	ctx context.Context,
+	hash string,
+	now time.Time,
+) (models.User, models.APIToken, error) {
+	db.addCall("GetAPITokenUser", hash, now)
+	result := db.GetAPITokenUserResult
+
+	return result.User, result.Token, result.Err
+}
+
+func (db *MockDatabaseAPI) GetAPITokenID(ctx context.Context, hash string, now time.Time) (uuid.UUID, error) {
+	db.addCall("GetAPITokenID", hash, now)
+
+	return db.GetAPITokenIDResult.Get()
+}
+
+func (db *MockDatabaseAPI) ListAPITokens(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error) {
+	db.addCall("ListAPITokens", userID)
+
+	return db.ListAPITokensResult.Get()
+}
+
+func (db *MockDatabaseAPI) DeleteAPIToken(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	db.addCall("DeleteAPIToken", userID, id)
+
+	return db.DeleteAPITokenResult
+}
+
 func (db *MockDatabaseAPI) GetLanguage(ctx context.Context, id string) (models.Language, error) {
 	db.addCall("GetLanguage", id)
 
 	return db.GetLanguageResult.Get()
 }
 
+func (db *MockDatabaseAPI) ListLanguages(
+	ctx context.Context,
+	includeRetired bool,
+) ([]models.LanguageSummary, error) {
+	db.addCall("ListLanguages", includeRetired)
+
+	return db.ListLanguagesResult.Get()
+}
+
+func (db *MockDatabaseAPI) GetLanguageSummary(ctx context.Context, id string) (models.LanguageSummary, error) {
+	db.addCall("GetLanguageSummary", id)
+
+	return db.GetLanguageSummaryResult.Get()
+}
+
+func (db *MockDatabaseAPI) CreateLanguage(ctx context.Context, language models.Language) error {
+	db.addCall("CreateLanguage", language)
+
+	return db.CreateLanguageResult
+}
+
+func (db *MockDatabaseAPI) RenameLanguage(ctx context.Context, id string, name string) error {
+	db.addCall("RenameLanguage", id, name)
+
+	return db.RenameLanguageResult
+}
+
+func (db *MockDatabaseAPI) RetireLanguage(ctx context.Context, id string) error {
+	db.addCall("RetireLanguage", id)
+
+	return db.RetireLanguageResult
+}
+
 func (db *MockDatabaseAPI) FindCodeSamples(
 	ctx context.Context,
 	search models.CodeSampleSearch,
@@ -68,6 +432,15 @@ func (db *MockDatabaseAPI) FindCodeSamples(
 	return db.FindCodeSamplesResult.Get()
 }
 
+func (db *MockDatabaseAPI) FindCodeSampleSummaries(
+	ctx context.Context,
+	search models.CodeSampleSearch,
+) (models.CodeSampleSummaryPage, error) {
+	db.addCall("FindCodeSampleSummaries", search)
+
+	return db.FindCodeSampleSummariesResult.Get()
+}
+
 func (db *MockDatabaseAPI) GetCodeSample(ctx context.Context, id uuid.UUID) (models.CodeSample, error) {
 	db.addCall("GetCodeSample", id)
 
@@ -80,18 +453,63 @@ func (db *MockDatabaseAPI) CreateCodeSample(ctx context.Context, sample models.C
 	return db.CreateCodeSampleResult
 }
 
-func (db *MockDatabaseAPI) UpdateCodeSample(ctx context.Context, sample models.CodeSample) error {
-	db.addCall("UpdateCodeSample", sample)
+func (db *MockDatabaseAPI) UpdateCodeSample(
+	ctx context.Context,
+	sample models.CodeSample,
+	editorID uuid.UUID,
+) error {
+	db.addCall("UpdateCodeSample", sample, editorID)
 
 	return db.UpdateCodeSampleResult
 }
 
-func (db *MockDatabaseAPI) DeleteCodeSample(ctx context.Context, id uuid.UUID) error {
-	db.addCall("DeleteCodeSample", id)
+func (db *MockDatabaseAPI) DeleteCodeSample(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	db.addCall("DeleteCodeSample", id, actorID)
 
 	return db.DeleteCodeSampleResult
 }
 
+func (db *MockDatabaseAPI) ListCodeSampleRevisions(
+	ctx context.Context,
+	id uuid.UUID,
+) ([]models.CodeSampleRevision, error) {
+	db.addCall("ListCodeSampleRevisions", id)
+
+	return db.ListCodeSampleRevisionsResult.Get()
+}
+
+func (db *MockDatabaseAPI) GetCodeSampleRevision(
+	ctx context.Context,
+	id uuid.UUID,
+	revision uint64,
+) (models.CodeSampleRevision, error) {
+	db.addCall("GetCodeSampleRevision", id, revision)
+
+	return db.GetCodeSampleRevisionResult.Get()
+}
+
+func (db *MockDatabaseAPI) ListTags(ctx context.Context) ([]models.TagSummary, error) {
+	db.addCall("ListTags")
+
+	return db.ListTagsResult.Get()
+}
+
+func (db *MockDatabaseAPI) GetSchemaVersion(ctx context.Context) (int, error) {
+	db.addCall("GetSchemaVersion")
+
+	return db.GetSchemaVersionResult.Get()
+}
+
+func (db *MockDatabaseAPI) Ping(ctx context.Context) error {
+	db.addCall("Ping")
+
+	return db.PingResult
+}
+
+func (db *MockDatabaseAPI) Close() {
+	db.addCall("Close")
+}
+
 func New() *MockDatabaseAPI {
 	return &MockDatabaseAPI{
 		calls: make(map[string][][]any),
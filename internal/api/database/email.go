@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (db *databaseAPIImpl) GetAccount(ctx context.Context, id uuid.UUID) (models.Account, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			SELECT
+				username,
+				role,
+				email,
+				email_verified,
+				EXISTS (SELECT 1 FROM totp WHERE user_id = "user".id AND confirmed),
+				password_hash <> ''
+			FROM "user"
+			WHERE id = $1
+		`,
+		id,
+	)
+
+	account := models.Account{User: models.User{ID: id}}
+	err := row.Scan(
+		&account.Username,
+		&account.Role,
+		&account.Email,
+		&account.EmailVerified,
+		&account.TwoFactorEnabled,
+		&account.HasPassword,
+	)
+
+	return account, err
+}
+
+// checkEmailAvailable returns DuplicateEmailErr if another user has verified
+// an email address. Addresses nobody has verified can be added by anyone, so
+// nobody can keep an address from its owner by adding it first.
+func checkEmailAvailable(ctx context.Context, tx pgx.Tx, id uuid.UUID, email string) error {
+	var taken bool
+	err := tx.QueryRow(
+		ctx,
+		`
+			SELECT EXISTS (
+				SELECT 1 FROM "user"
+				WHERE lower(email) = lower($2) AND email_verified AND id <> $1
+			)
+		`,
+		id, email,
+	).Scan(&taken)
+
+	if err == nil && taken {
+		err = DuplicateEmailErr
+	}
+
+	return err
+}
+
+// setEmail sets a new unverified email address for a user, or removes the
+// address if it is nil. Links sent for any previous address stop working.
+func setEmail(ctx context.Context, tx pgx.Tx, id uuid.UUID, email *string) error {
+	if email != nil {
+		if err := checkEmailAvailable(ctx, tx, id, *email); err != nil {
+			return err
+		}
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE "user" SET email = $2, email_verified = false WHERE id = $1`,
+		id, email,
+	)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM email_verification WHERE user_id = $1`, id)
+
+	return err
+}
+
+// CreateEmailVerification saves the hash of a token for verifying an email
+// address. Only the newest token for a user can be used.
+func (db *databaseAPIImpl) CreateEmailVerification(
+	ctx context.Context,
+	userID uuid.UUID,
+	email string,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `DELETE FROM email_verification WHERE user_id = $1`, userID)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO email_verification (token_hash, user_id, email, created, expires)
+				VALUES ($1, $2, $3, $4, $5)
+			`,
+			hash, userID, email, created, expires,
+		)
+
+		return err
+	})
+}
+
+// VerifyEmail uses up a verification token to mark an email address as
+// verified. Other users who added the address without verifying it lose it.
+// NotFoundErr is returned if the token is invalid, has expired, or was sent
+// for an address the user no longer has. DuplicateEmailErr is returned if
+// someone else verified the address first.
+func (db *databaseAPIImpl) VerifyEmail(ctx context.Context, hash string, now time.Time) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		var userID uuid.UUID
+		var email string
+		err := tx.QueryRow(
+			ctx,
+			`
+				DELETE FROM email_verification
+				WHERE token_hash = $1 AND expires > $2
+				RETURNING user_id, email
+			`,
+			hash, now,
+		).Scan(&userID, &email)
+
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE "user" SET email_verified = true WHERE id = $1 AND email = $2`,
+			userID, email,
+		)
+
+		var pgErr *pgconn.PgError
+
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "user_verified_email_unique" {
+			err = DuplicateEmailErr
+		}
+
+		if err == nil && tag.RowsAffected() == 0 {
+			err = NotFoundErr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`
+				UPDATE "user" SET email = NULL
+				WHERE lower(email) = lower($2) AND NOT email_verified AND id <> $1
+			`,
+			userID, email,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`DELETE FROM email_verification WHERE lower(email) = lower($2) AND user_id <> $1`,
+			userID, email,
+		)
+
+		return err
+	})
+}
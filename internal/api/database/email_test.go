@@ -0,0 +1,169 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAccount(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	email := "user@example.com"
+
+	mock.ExpectQuery(`SELECT .* email_verified, EXISTS \(SELECT 1 FROM totp .*\), password_hash <> '' FROM "user" WHERE id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"username", "role", "email", "email_verified", "exists", "has_password"}).
+				AddRow("user", models.RoleUser, &email, true, true, true),
+		)
+
+	account, err := db.GetAccount(context.Background(), testutils.UUIDFromInt(1))
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		models.Account{
+			User:             models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser},
+			Email:            &email,
+			EmailVerified:    true,
+			TwoFactorEnabled: true,
+			HasPassword:      true,
+		},
+		account,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestCreateEmailVerification(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM email_verification WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`INSERT INTO email_verification`).
+		WithArgs("hash", testutils.UUIDFromInt(1), "user@example.com", now, expires).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := db.CreateEmailVerification(
+		context.Background(),
+		testutils.UUIDFromInt(1),
+		"user@example.com",
+		"hash",
+		now,
+		expires,
+	)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	email := "user@example.com"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM email_verification WHERE token_hash = \$1 AND expires > \$2 RETURNING user_id, email`).
+		WithArgs("hash", now).
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "email"}).AddRow(testutils.UUIDFromInt(1), email))
+	mock.ExpectExec(`UPDATE "user" SET email_verified = true WHERE id = \$1 AND email = \$2`).
+		WithArgs(testutils.UUIDFromInt(1), email).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	// Other users who added the address without verifying it lose it.
+	mock.ExpectExec(`UPDATE "user" SET email = NULL WHERE lower\(email\) = lower\(\$2\) AND NOT email_verified`).
+		WithArgs(testutils.UUIDFromInt(1), email).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`DELETE FROM email_verification WHERE lower\(email\) = lower\(\$2\) AND user_id <> \$1`).
+		WithArgs(testutils.UUIDFromInt(1), email).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+
+	err := db.VerifyEmail(context.Background(), "hash", now)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestVerifyEmailErrors(t *testing.T) {
+	var tests = map[string]struct {
+		setup         func(mock pgxmock.PgxPoolIface)
+		expectedError error
+	}{
+		"InvalidToken": {
+			setup: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`DELETE FROM email_verification`).
+					WithArgs("hash", pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "email"}))
+			},
+			expectedError: database.NotFoundErr,
+		},
+		"EmailChanged": {
+			setup: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`DELETE FROM email_verification`).
+					WithArgs("hash", pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "email"}).AddRow(testutils.UUIDFromInt(1), "old@example.com"))
+				mock.ExpectExec(`UPDATE "user" SET email_verified = true`).
+					WithArgs(testutils.UUIDFromInt(1), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedError: database.NotFoundErr,
+		},
+		"VerifiedElsewhere": {
+			setup: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`DELETE FROM email_verification`).
+					WithArgs("hash", pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "email"}).AddRow(testutils.UUIDFromInt(1), "user@example.com"))
+				mock.ExpectExec(`UPDATE "user" SET email_verified = true`).
+					WithArgs(testutils.UUIDFromInt(1), pgxmock.AnyArg()).
+					WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "user_verified_email_unique"})
+			},
+			expectedError: database.DuplicateEmailErr,
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			mock.ExpectBegin()
+			testData.setup(mock)
+			mock.ExpectRollback()
+
+			err := db.VerifyEmail(context.Background(), "hash", time.Now())
+
+			assert.Equal(t, testData.expectedError, err)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
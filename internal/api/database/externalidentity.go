@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// identityExistsErr rolls back creating a user for an identity which has
+// already been linked to another user.
+var identityExistsErr = errors.New("external identity already exists")
+
+// GetExternalIdentityUser loads the user linked to a subject from an
+// OpenID Connect issuer.
+func (db *databaseAPIImpl) GetExternalIdentityUser(
+	ctx context.Context,
+	issuer string,
+	subject string,
+) (models.User, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			SELECT "user".id, "user".username, "user".role
+			FROM external_identity
+			JOIN "user" ON "user".id = external_identity.user_id
+			WHERE external_identity.issuer = $1 AND external_identity.subject = $2
+		`,
+		issuer, subject,
+	)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Role)
+
+	return user, err
+}
+
+// CreateExternalUser creates an account for someone logging in with
+// OpenID Connect for the first time, linked to their identity, and returns
+// the user for the identity.
+// The account has no password, as no password matches an empty hash.
+// DuplicateErr is returned if the username or email address is taken.
+//
+// If the same identity logs in twice at once, the account created first is
+// kept, and the user for it is returned instead.
+func (db *databaseAPIImpl) CreateExternalUser(
+	ctx context.Context,
+	account models.Account,
+	identity models.ExternalIdentity,
+) (models.User, error) {
+	err := db.withTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			`
+				INSERT INTO "user" (id, username, role, email, email_verified, password_hash)
+				VALUES ($1, $2, $3, $4, $5, '')
+				ON CONFLICT DO NOTHING
+			`,
+			account.ID, account.Username, account.Role, account.Email, account.EmailVerified,
+		)
+
+		if err == nil && tag.RowsAffected() == 0 {
+			err = DuplicateErr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		tag, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO external_identity (issuer, subject, user_id, created)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (issuer, subject) DO NOTHING
+			`,
+			identity.Issuer, identity.Subject, account.ID, identity.Created,
+		)
+
+		if err == nil && tag.RowsAffected() == 0 {
+			// Roll back creating the user, so only the first account is kept.
+			err = identityExistsErr
+		}
+
+		return err
+	})
+
+	if errors.Is(err, identityExistsErr) {
+		return db.GetExternalIdentityUser(ctx, identity.Issuer, identity.Subject)
+	}
+
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return account.User, nil
+}
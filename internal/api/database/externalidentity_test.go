@@ -0,0 +1,130 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetExternalIdentityUser(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectQuery(
+		`SELECT "user".id, "user".username, "user".role FROM external_identity `+
+			`JOIN "user" ON "user".id = external_identity.user_id `+
+			`WHERE external_identity.issuer = \$1 AND external_identity.subject = \$2`,
+	).
+		WithArgs("https://sso.example", "subject").
+		WillReturnRows(
+			pgxmock.NewRows([]string{"id", "username", "role"}).
+				AddRow(testutils.UUIDFromInt(1), "someone", models.RoleUser),
+		)
+
+	user, err := db.GetExternalIdentityUser(context.Background(), "https://sso.example", "subject")
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		models.User{ID: testutils.UUIDFromInt(1), Username: "someone", Role: models.RoleUser},
+		user,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestCreateExternalUser(t *testing.T) {
+	var tests = map[string]struct {
+		rowsAffected         int64
+		identityRowsAffected int64
+		expectedUser         models.User
+		expectedError        error
+	}{
+		"New": {
+			rowsAffected:         1,
+			identityRowsAffected: 1,
+			expectedUser:         models.User{ID: testutils.UUIDFromInt(1), Username: "someone", Role: models.RoleUser},
+		},
+		"Duplicate": {rowsAffected: 0, expectedError: database.DuplicateErr},
+		// Another login for the same identity created a user first.
+		"IdentityExists": {
+			rowsAffected:         1,
+			identityRowsAffected: 0,
+			expectedUser:         models.User{ID: testutils.UUIDFromInt(2), Username: "someone-1234", Role: models.RoleUser},
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			email := "someone@example.com"
+			account := models.Account{
+				User: models.User{
+					ID:       testutils.UUIDFromInt(1),
+					Username: "someone",
+					Role:     models.RoleUser,
+				},
+				Email:         &email,
+				EmailVerified: true,
+			}
+			identity := models.ExternalIdentity{
+				UserID:  testutils.UUIDFromInt(1),
+				Issuer:  "https://sso.example",
+				Subject: "subject",
+				Created: time.Now(),
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(
+				`INSERT INTO "user" \(id, username, role, email, email_verified, password_hash\) `+
+					`VALUES \(\$1, \$2, \$3, \$4, \$5, ''\) ON CONFLICT DO NOTHING`,
+			).
+				WithArgs(testutils.UUIDFromInt(1), "someone", models.RoleUser, &email, true).
+				WillReturnResult(pgxmock.NewResult("INSERT", testData.rowsAffected))
+
+			if testData.rowsAffected > 0 {
+				mock.ExpectExec(
+					`INSERT INTO external_identity \(issuer, subject, user_id, created\) .* `+
+						`ON CONFLICT \(issuer, subject\) DO NOTHING`,
+				).
+					WithArgs("https://sso.example", "subject", testutils.UUIDFromInt(1), identity.Created).
+					WillReturnResult(pgxmock.NewResult("INSERT", testData.identityRowsAffected))
+			}
+
+			if testData.identityRowsAffected > 0 {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			if testData.rowsAffected > 0 && testData.identityRowsAffected == 0 {
+				mock.ExpectQuery(`SELECT .* FROM external_identity .* WHERE external_identity.issuer = \$1`).
+					WithArgs("https://sso.example", "subject").
+					WillReturnRows(
+						pgxmock.NewRows([]string{"id", "username", "role"}).
+							AddRow(testutils.UUIDFromInt(2), "someone-1234", models.RoleUser),
+					)
+			}
+
+			user, err := db.CreateExternalUser(context.Background(), account, identity)
+
+			assert.Equal(t, testData.expectedError, err)
+			assert.Equal(t, testData.expectedUser, user)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
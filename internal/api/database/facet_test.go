@@ -0,0 +1,99 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindCodeSamplesFacets(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	languages := []models.LanguageFacet{
+		{Language: models.Language{ID: "python", Name: "Python"}, Count: 3},
+		{Language: models.Language{ID: "go", Name: "Go"}, Count: 1},
+	}
+	authors := []models.AuthorFacet{
+		{Author: models.User{ID: testutils.UUIDFromInt(1), Username: "some_user"}, Count: 2},
+	}
+
+	// The count uses every filter, but each facet ignores its own filter.
+	mock.ExpectQuery(
+		`WITH matches AS \(\s*SELECT\s+language_id,\s+submitted_by_id,\s+`+
+			`language_id = ANY\(\$2\) AS language_match,\s+`+
+			`submitted_by_id = \$3 AS author_match\s+`+
+			`FROM codesample WHERE search_index @@ websearch_to_tsquery\('english', \$1\)\s+\)`+
+			`.* WHERE language_match AND author_match`+
+			`.* WHERE author_match\s+GROUP BY language_id`+
+			`.* WHERE language_match\s+GROUP BY "user".id`,
+	).
+		WithArgs("search phrase", []string{"python"}, testutils.UUIDFromInt(1)).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"count", "languages", "authors"}).
+				AddRow(uint64(0), languages, authors),
+		)
+
+	search := models.CodeSampleSearch{
+		Query:       "search phrase",
+		Languages:   []string{"python"},
+		SubmittedBy: testutils.UUIDFromInt(1),
+		Facets:      true,
+		Page:        1,
+		PageSize:    20,
+	}
+	page, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	expectedPage := models.CodeSamplePage{
+		Count:   0,
+		Results: []models.CodeSample{},
+		Facets: &models.CodeSampleFacets{
+			Languages: languages,
+			Authors:   authors,
+		},
+	}
+
+	assert.Equal(t, expectedPage, page)
+}
+
+func TestFindCodeSampleSummariesFacetsWithoutFilters(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectQuery(
+		`WITH matches AS \(\s*SELECT\s+language_id,\s+submitted_by_id,\s+` +
+			`TRUE AS language_match,\s+TRUE AS author_match\s+FROM codesample\s+\)`,
+	).
+		WithArgs().
+		WillReturnRows(
+			pgxmock.NewRows([]string{"count", "languages", "authors"}).
+				AddRow(uint64(0), []models.LanguageFacet{}, []models.AuthorFacet{}),
+		)
+
+	page, err := db.FindCodeSampleSummaries(
+		context.Background(),
+		models.CodeSampleSearch{Facets: true, Page: 1, PageSize: 20},
+	)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Equal(
+		t,
+		&models.CodeSampleFacets{Languages: []models.LanguageFacet{}, Authors: []models.AuthorFacet{}},
+		page.Facets,
+	)
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+)
+
+// Matches are marked with private use characters by ts_headline so text can
+// be escaped safely before the markers are replaced with HTML tags.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+const (
+	maximumHighlightLines      = 3
+	maximumHighlightLineLength = 200
+)
+
+const highlightSelectors = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `"`
+
+var highlightReplacer = strings.NewReplacer(
+	highlightStart, "<mark>",
+	highlightStop, "</mark>",
+)
+
+// headlineColumns selects the title, description and body with matches for
+// a tsquery marked, or the plain columns when there is no tsquery.
+// The whole title and body are kept so lines can be picked from the body.
+func headlineColumns(params *queryParams, tsQuery string) string {
+	if len(tsQuery) == 0 {
+		return `title, description, body`
+	}
+
+	all := params.add(highlightSelectors + `, HighlightAll=true`)
+	excerpt := params.add(highlightSelectors)
+
+	return `
+		ts_headline('english', title, ` + tsQuery + `, ` + all + `) AS title_headline,
+		ts_headline('english', description, ` + tsQuery + `, ` + excerpt + `) AS description_headline,
+		ts_headline('english', body, ` + tsQuery + `, ` + all + `) AS body_headline
+	`
+}
+
+// unmarkedReplacer removes highlight markers from text.
+var unmarkedReplacer = strings.NewReplacer(highlightStart, "", highlightStop, "")
+
+// markMatches marks matches for a pattern in text. Matches spanning lines are
+// marked on every line, so each line can be shown with balanced highlights.
+func markMatches(text string, pattern *regexp.Regexp) string {
+	text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+		match = strings.ReplaceAll(match, "\n", highlightStop+"\n"+highlightStart)
+
+		return highlightStart + match + highlightStop
+	})
+
+	// Remove empty highlights left by matches starting or ending at newlines.
+	return strings.ReplaceAll(text, highlightStart+highlightStop, "")
+}
+
+// highlightHTML escapes text as HTML and wraps marked matches in <mark> tags.
+func highlightHTML(text string) string {
+	return highlightReplacer.Replace(html.EscapeString(text))
+}
+
+// truncateLine cuts long lines short, closing any match cut in half.
+func truncateLine(line string) string {
+	if utf8.RuneCountInString(line) <= maximumHighlightLineLength {
+		return line
+	}
+
+	line = string([]rune(line)[:maximumHighlightLineLength])
+
+	if strings.Count(line, highlightStart) > strings.Count(line, highlightStop) {
+		line += highlightStop
+	}
+
+	return line + "…"
+}
+
+// highlightLines picks numbered lines with matches from a body, or the first
+// lines of the body if none of them match.
+func highlightLines(body string) []models.CodeSampleLine {
+	lines := strings.Split(body, "\n")
+	numbers := make([]int, 0, maximumHighlightLines)
+
+	for i := 0; i < len(lines) && len(numbers) < maximumHighlightLines; i++ {
+		if strings.Contains(lines[i], highlightStart) {
+			numbers = append(numbers, i)
+		}
+	}
+
+	if len(numbers) == 0 {
+		for i := 0; i < len(lines) && i < maximumHighlightLines; i++ {
+			numbers = append(numbers, i)
+		}
+	}
+
+	result := make([]models.CodeSampleLine, 0, len(numbers))
+
+	for _, i := range numbers {
+		result = append(result, models.CodeSampleLine{
+			Number: uint64(i + 1),
+			Text:   highlightHTML(truncateLine(strings.TrimSuffix(lines[i], "\r"))),
+		})
+	}
+
+	return result
+}
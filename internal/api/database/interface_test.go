@@ -0,0 +1,56 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigConnString(t *testing.T) {
+	t.Parallel()
+
+	config := database.Config{
+		Host:     "db",
+		Port:     "5432",
+		User:     "postgres",
+		Password: "p@ss/word",
+		Name:     "codelibrary",
+	}
+
+	assert.Equal(t, "postgres://postgres:p%40ss%2Fword@db:5432/codelibrary", config.ConnString())
+
+	config.URL = "postgres://other@localhost/other"
+	assert.Equal(t, "postgres://other@localhost/other", config.ConnString())
+}
+
+func TestConfigPoolConfig(t *testing.T) {
+	t.Parallel()
+
+	poolConfig, err := database.Config{
+		URL:             "postgres://postgres@localhost:5432/codelibrary",
+		MaxConns:        20,
+		MinConns:        2,
+		MaxConnLifetime: time.Hour,
+		MaxConnIdleTime: time.Minute,
+	}.PoolConfig()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost", poolConfig.ConnConfig.Host)
+	assert.Equal(t, "codelibrary", poolConfig.ConnConfig.Database)
+	assert.Equal(t, int32(20), poolConfig.MaxConns)
+	assert.Equal(t, int32(2), poolConfig.MinConns)
+	assert.Equal(t, time.Hour, poolConfig.MaxConnLifetime)
+	assert.Equal(t, time.Minute, poolConfig.MaxConnIdleTime)
+}
+
+func TestNewBadConfig(t *testing.T) {
+	t.Parallel()
+
+	db, err := database.New(context.Background(), database.Config{URL: "postgres://localhost:notaport/db"})
+
+	assert.NotNil(t, err)
+	assert.Nil(t, db)
+}
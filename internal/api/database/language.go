@@ -7,10 +7,121 @@ import (
 )
 
 func (db *databaseAPIImpl) GetLanguage(ctx context.Context, id string) (models.Language, error) {
-	row := db.pool.QueryRow(ctx, `SELECT name FROM language WHERE id = $1`, id)
+	row := db.pool.QueryRow(ctx, `SELECT name, retired FROM language WHERE id = $1`, id)
 
 	language := models.Language{ID: id}
-	err := row.Scan(&language.Name)
+	err := row.Scan(&language.Name, &language.Retired)
 
 	return language, err
 }
+
+func (db *databaseAPIImpl) ListLanguages(
+	ctx context.Context,
+	includeRetired bool,
+) ([]models.LanguageSummary, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`
+			SELECT
+				language.id,
+				language.name,
+				language.retired,
+				COUNT(codesample.id) AS sample_count
+			FROM language
+			LEFT JOIN codesample
+			ON codesample.language_id = language.id
+			WHERE $1 OR NOT language.retired
+			GROUP BY language.id
+			ORDER BY language.name, language.id
+		`,
+		includeRetired,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// Ensure we have an empty slice to avoid serialization issues.
+	languages := []models.LanguageSummary{}
+
+	for rows.Next() {
+		var language models.LanguageSummary
+		err = rows.Scan(
+			&language.ID,
+			&language.Name,
+			&language.Retired,
+			&language.SampleCount,
+		)
+
+		if err != nil {
+			return languages, err
+		}
+
+		languages = append(languages, language)
+	}
+
+	return languages, rows.Err()
+}
+
+func (db *databaseAPIImpl) GetLanguageSummary(ctx context.Context, id string) (models.LanguageSummary, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			SELECT
+				language.name,
+				language.retired,
+				COUNT(codesample.id) AS sample_count
+			FROM language
+			LEFT JOIN codesample
+			ON codesample.language_id = language.id
+			WHERE language.id = $1
+			GROUP BY language.id
+		`,
+		id,
+	)
+
+	language := models.LanguageSummary{Language: models.Language{ID: id}}
+	err := row.Scan(&language.Name, &language.Retired, &language.SampleCount)
+
+	return language, err
+}
+
+func (db *databaseAPIImpl) CreateLanguage(ctx context.Context, language models.Language) error {
+	tag, err := db.pool.Exec(
+		ctx,
+		`
+			INSERT INTO language (id, name, retired)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`,
+		language.ID, language.Name, language.Retired,
+	)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = DuplicateErr
+	}
+
+	return err
+}
+
+func (db *databaseAPIImpl) RenameLanguage(ctx context.Context, id string, name string) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE language SET name = $2 WHERE id = $1`, id, name)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	return err
+}
+
+func (db *databaseAPIImpl) RetireLanguage(ctx context.Context, id string) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE language SET retired = true WHERE id = $1`, id)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	return err
+}
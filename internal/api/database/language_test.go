@@ -15,8 +15,8 @@ func TestGetLanguage(t *testing.T) {
 	mock, db := startDatabaseTest(t)
 	defer mock.Close()
 
-	expectedRows := pgxmock.NewRows([]string{"name"}).
-		AddRow("Python")
+	expectedRows := pgxmock.NewRows([]string{"name", "retired"}).
+		AddRow("Python", false)
 	mock.ExpectQuery(`SELECT .* FROM language WHERE id = \$1`).
 		WithArgs("python").
 		WillReturnRows(expectedRows)
@@ -47,3 +47,136 @@ func TestGetLanguageMissing(t *testing.T) {
 
 	assert.Equal(t, database.NotFoundErr, err)
 }
+
+func TestListLanguages(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	expectedRows := pgxmock.NewRows([]string{"id", "name", "retired", "sample_count"}).
+		AddRow("cobol", "COBOL", true, uint64(3)).
+		AddRow("python", "Python", false, uint64(42))
+	mock.ExpectQuery(`SELECT .* FROM language LEFT JOIN codesample .* GROUP BY`).
+		WithArgs(true).
+		WillReturnRows(expectedRows)
+
+	languages, err := db.ListLanguages(context.Background(), true)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	expectedLanguages := []models.LanguageSummary{
+		{
+			Language:    models.Language{ID: "cobol", Name: "COBOL", Retired: true},
+			SampleCount: 3,
+		},
+		{
+			Language:    models.Language{ID: "python", Name: "Python"},
+			SampleCount: 42,
+		},
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, expectedLanguages, languages)
+}
+
+func TestListLanguagesEmpty(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT .* FROM language`).
+		WithArgs(false).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "retired", "sample_count"}))
+
+	languages, err := db.ListLanguages(context.Background(), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.LanguageSummary{}, languages)
+}
+
+func TestGetLanguageSummary(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	expectedRows := pgxmock.NewRows([]string{"name", "retired", "sample_count"}).
+		AddRow("Python", false, uint64(42))
+	mock.ExpectQuery(`SELECT .* FROM language .* WHERE language.id = \$1`).
+		WithArgs("python").
+		WillReturnRows(expectedRows)
+
+	language, err := db.GetLanguageSummary(context.Background(), "python")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	expectedLanguage := models.LanguageSummary{
+		Language:    models.Language{ID: "python", Name: "Python"},
+		SampleCount: 42,
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, expectedLanguage, language)
+}
+
+func TestCreateLanguage(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`INSERT INTO language`).
+		WithArgs("zig", "Zig", false).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	err := db.CreateLanguage(context.Background(), models.Language{ID: "zig", Name: "Zig"})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Nil(t, err)
+}
+
+func TestCreateLanguageDuplicate(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`INSERT INTO language`).
+		WithArgs("python", "Python", false).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+	err := db.CreateLanguage(context.Background(), models.Language{ID: "python", Name: "Python"})
+
+	assert.Equal(t, database.DuplicateErr, err)
+}
+
+func TestRenameLanguage(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`UPDATE language SET name = \$2 WHERE id = \$1`).
+		WithArgs("fortran", "Fortran").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	err := db.RenameLanguage(context.Background(), "fortran", "Fortran")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Nil(t, err)
+}
+
+func TestRetireLanguageMissing(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`UPDATE language SET retired = true WHERE id = \$1`).
+		WithArgs("logo").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	err := db.RetireLanguage(context.Background(), "logo")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Equal(t, database.NotFoundErr, err)
+}
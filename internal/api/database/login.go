@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetLoginLockout returns the time the latest lockout for any of the keys
+// ends, or a zero time if none of them are locked out.
+func (db *databaseAPIImpl) GetLoginLockout(ctx context.Context, keys []string, now time.Time) (time.Time, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`SELECT max(locked_until) FROM login_failure WHERE key = ANY($1) AND locked_until > $2`,
+		keys, now,
+	)
+
+	var lockedUntil *time.Time
+
+	if err := row.Scan(&lockedUntil); err != nil || lockedUntil == nil {
+		return time.Time{}, err
+	}
+
+	return *lockedUntil, nil
+}
+
+// RecordLoginFailure counts a failed login for a key and returns how many
+// failures there have been. Failures before resetBefore are forgotten, and
+// keys with only forgotten failures which aren't locked out are deleted.
+func (db *databaseAPIImpl) RecordLoginFailure(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	resetBefore time.Time,
+) (int, error) {
+	var failures int
+
+	err := db.withTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`
+				DELETE FROM login_failure
+				WHERE last_failure < $1
+				AND (locked_until IS NULL OR locked_until <= $2)
+			`,
+			resetBefore, now,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		row := tx.QueryRow(
+			ctx,
+			`
+				INSERT INTO login_failure (key, failures, last_failure)
+				VALUES ($1, 1, $2)
+				ON CONFLICT (key) DO UPDATE SET
+					failures = CASE
+						WHEN login_failure.last_failure < $3 THEN 1
+						ELSE login_failure.failures + 1
+					END,
+					last_failure = $2
+				RETURNING failures
+			`,
+			key, now, resetBefore,
+		)
+
+		return row.Scan(&failures)
+	})
+
+	return failures, err
+}
+
+// LockLogin stops logins for a key until a given time, and keeps a record of
+// the lockout.
+func (db *databaseAPIImpl) LockLogin(
+	ctx context.Context,
+	key string,
+	failures int,
+	until time.Time,
+	now time.Time,
+) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `UPDATE login_failure SET locked_until = $2 WHERE key = $1`, key, until)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO login_lockout (key, failures, locked_until, created)
+				VALUES ($1, $2, $3, $4)
+			`,
+			key, failures, until, now,
+		)
+
+		return err
+	})
+}
+
+// ClearLoginFailures forgets failed logins for a key.
+func (db *databaseAPIImpl) ClearLoginFailures(ctx context.Context, key string) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM login_failure WHERE key = $1`, key)
+
+	return err
+}
@@ -0,0 +1,121 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLoginLockout(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	lockedUntil := now.Add(time.Minute)
+	keys := []string{"username:user", "ip:127.0.0.1"}
+
+	mock.ExpectQuery(`SELECT max\(locked_until\) FROM login_failure WHERE key = ANY\(\$1\) AND locked_until > \$2`).
+		WithArgs(keys, now).
+		WillReturnRows(pgxmock.NewRows([]string{"max"}).AddRow(&lockedUntil))
+
+	actualLockedUntil, err := db.GetLoginLockout(context.Background(), keys, now)
+
+	assert.Nil(t, err)
+	assert.Equal(t, lockedUntil, actualLockedUntil)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestGetLoginLockoutNotLocked(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	keys := []string{"username:user", "ip:127.0.0.1"}
+
+	mock.ExpectQuery(`SELECT max\(locked_until\) FROM login_failure`).
+		WithArgs(keys, now).
+		WillReturnRows(pgxmock.NewRows([]string{"max"}).AddRow((*time.Time)(nil)))
+
+	lockedUntil, err := db.GetLoginLockout(context.Background(), keys, now)
+
+	assert.Nil(t, err)
+	assert.True(t, lockedUntil.IsZero())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	resetBefore := now.Add(-24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM login_failure WHERE last_failure < \$1 AND \(locked_until IS NULL OR locked_until <= \$2\)`).
+		WithArgs(resetBefore, now).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+	mock.ExpectQuery(`INSERT INTO login_failure .* ON CONFLICT \(key\) DO UPDATE .* RETURNING failures`).
+		WithArgs("username:user", now, resetBefore).
+		WillReturnRows(pgxmock.NewRows([]string{"failures"}).AddRow(3))
+	mock.ExpectCommit()
+
+	failures, err := db.RecordLoginFailure(context.Background(), "username:user", now, resetBefore)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, failures)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestLockLogin(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	until := now.Add(30 * time.Second)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE login_failure SET locked_until = \$2 WHERE key = \$1`).
+		WithArgs("username:user", until).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`INSERT INTO login_lockout`).
+		WithArgs("username:user", 5, until, now).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := db.LockLogin(context.Background(), "username:user", 5, until, now)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestClearLoginFailures(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`DELETE FROM login_failure WHERE key = \$1`).
+		WithArgs("username:user").
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	err := db.ClearLoginFailures(context.Background(), "username:user")
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// moderationAction is a record of a change to someone else's content.
+type moderationAction struct {
+	actorID      uuid.UUID
+	action       string
+	codeSampleID *uuid.UUID
+	userID       *uuid.UUID
+	details      string
+	created      time.Time
+}
+
+// insertModerationAction records who made a change.
+//
+// This should be run in the same transaction as the change itself.
+func insertModerationAction(ctx context.Context, tx pgx.Tx, action moderationAction) error {
+	_, err := tx.Exec(
+		ctx,
+		`
+			INSERT INTO moderation_action (
+				actor_id, action, codesample_id, user_id, details, created
+			)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`,
+		action.actorID, action.action, action.codeSampleID, action.userID,
+		action.details, action.created,
+	)
+
+	return err
+}
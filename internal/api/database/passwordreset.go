@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetUserByEmail finds a user by an email address they have verified,
+// ignoring case.
+func (db *databaseAPIImpl) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`SELECT id, username, role FROM "user" WHERE lower(email) = lower($1) AND email_verified`,
+		email,
+	)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Role)
+
+	return user, err
+}
+
+// CreatePasswordReset saves the hash of a token for resetting a password.
+// Only the newest token for a user can be used.
+func (db *databaseAPIImpl) CreatePasswordReset(
+	ctx context.Context,
+	userID uuid.UUID,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `DELETE FROM password_reset WHERE user_id = $1`, userID)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO password_reset (token_hash, user_id, created, expires)
+				VALUES ($1, $2, $3, $4)
+			`,
+			hash, userID, created, expires,
+		)
+
+		return err
+	})
+}
+
+// ResetPassword uses up a password reset token to set a new password, and
+// logs out every session for the user.
+// NotFoundErr is returned if the token is invalid or has expired.
+func (db *databaseAPIImpl) ResetPassword(
+	ctx context.Context,
+	hash string,
+	password string,
+	now time.Time,
+) error {
+	passwordHash, err := HashPassword(password)
+
+	if err != nil {
+		return err
+	}
+
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		var userID uuid.UUID
+		err := tx.QueryRow(
+			ctx,
+			`DELETE FROM password_reset WHERE token_hash = $1 AND expires > $2 RETURNING user_id`,
+			hash, now,
+		).Scan(&userID)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE "user" SET password_hash = $2 WHERE id = $1`, userID, passwordHash)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM session WHERE user_id = $1`, userID)
+
+		return err
+	})
+}
@@ -0,0 +1,106 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUserByEmail(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	// Addresses which haven't been verified might belong to someone else.
+	mock.ExpectQuery(`SELECT id, username, role FROM "user" WHERE lower\(email\) = lower\(\$1\) AND email_verified`).
+		WithArgs("User@Example.com").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "username", "role"}).
+			AddRow(testutils.UUIDFromInt(1), "user", models.RoleUser))
+
+	user, err := db.GetUserByEmail(context.Background(), "User@Example.com")
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}, user)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestCreatePasswordReset(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM password_reset WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(`INSERT INTO password_reset`).
+		WithArgs("hash", testutils.UUIDFromInt(1), now, expires).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := db.CreatePasswordReset(context.Background(), testutils.UUIDFromInt(1), "hash", now, expires)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM password_reset WHERE token_hash = \$1 AND expires > \$2 RETURNING user_id`).
+		WithArgs("hash", now).
+		WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testutils.UUIDFromInt(1)))
+	mock.ExpectExec(`UPDATE "user" SET password_hash = \$2 WHERE id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1), hashMatcher{"new password"}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`DELETE FROM session WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+	mock.ExpectCommit()
+
+	err := db.ResetPassword(context.Background(), "hash", "new password", now)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestResetPasswordExpired(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM password_reset`).
+		WithArgs("hash", now).
+		WillReturnRows(pgxmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+
+	err := db.ResetPassword(context.Background(), "hash", "new password", now)
+
+	assert.Equal(t, database.NotFoundErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,13 @@
+package database
+
+import "strconv"
+
+// queryParams builds a list of numbered query parameters.
+type queryParams []any
+
+// add adds a parameter and returns the placeholder for it, such as `$1`.
+func (p *queryParams) add(value any) string {
+	*p = append(*p, value)
+
+	return "$" + strconv.Itoa(len(*p))
+}
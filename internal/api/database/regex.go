@@ -0,0 +1,232 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maximumMatchedLines limits the line numbers returned for a regex search.
+const maximumMatchedLines = 100
+
+var errUnsupportedRegex = errors.New("unsupported regular expression")
+
+// postgresRegex translates an RE2 regular expression into an equivalent
+// PostgreSQL regular expression, so a search has the same meaning in the
+// database as it does in Go. Every group is written out explicitly because
+// PostgreSQL only supports flags at the start of a pattern.
+func postgresRegex(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+
+	if err := writePostgresRegex(&builder, re); err != nil {
+		return "", err
+	}
+
+	return builder.String(), nil
+}
+
+// CheckRegex returns an error if a regex can't be translated for searching
+// in the database.
+func CheckRegex(pattern string) error {
+	_, err := postgresRegex(pattern)
+
+	return err
+}
+
+func writePostgresRegex(builder *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == 0 {
+				return errUnsupportedRegex
+			}
+
+			if re.Flags&syntax.FoldCase != 0 && unicode.SimpleFold(r) != r {
+				builder.WriteString(`[`)
+
+				for folded := r; ; {
+					writePostgresRune(builder, folded)
+
+					if folded = unicode.SimpleFold(folded); folded == r {
+						break
+					}
+				}
+
+				builder.WriteString(`]`)
+			} else {
+				writePostgresRune(builder, r)
+			}
+		}
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return errUnsupportedRegex
+		}
+
+		builder.WriteString(`[`)
+
+		for i := 0; i < len(re.Rune); i += 2 {
+			low, high := re.Rune[i], re.Rune[i+1]
+
+			// Text can't contain NUL characters, and PostgreSQL rejects them.
+			if low == 0 {
+				if high == 0 {
+					continue
+				}
+
+				low = 1
+			}
+
+			writePostgresRune(builder, low)
+
+			if high != low {
+				builder.WriteString(`-`)
+				writePostgresRune(builder, high)
+			}
+		}
+
+		builder.WriteString(`]`)
+	case syntax.OpAnyCharNotNL:
+		builder.WriteString(`[^\n]`)
+	case syntax.OpAnyChar:
+		// `.` matches newlines in PostgreSQL without newline sensitive mode.
+		builder.WriteString(`.`)
+	case syntax.OpBeginLine:
+		builder.WriteString(`(?:^|(?<=\n))`)
+	case syntax.OpEndLine:
+		builder.WriteString(`(?:$|(?=\n))`)
+	case syntax.OpBeginText:
+		builder.WriteString(`^`)
+	case syntax.OpEndText:
+		builder.WriteString(`$`)
+	case syntax.OpWordBoundary:
+		builder.WriteString(`\y`)
+	case syntax.OpNoWordBoundary:
+		builder.WriteString(`\Y`)
+	case syntax.OpCapture:
+		// Captures aren't used, so they are written as plain groups.
+		return writePostgresGroup(builder, re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if err := writePostgresGroup(builder, re.Sub[0]); err != nil {
+			return err
+		}
+
+		switch re.Op {
+		case syntax.OpStar:
+			builder.WriteString(`*`)
+		case syntax.OpPlus:
+			builder.WriteString(`+`)
+		case syntax.OpQuest:
+			builder.WriteString(`?`)
+		default:
+			builder.WriteString(`{` + strconv.Itoa(re.Min))
+
+			if re.Max < 0 {
+				builder.WriteString(`,`)
+			} else if re.Max != re.Min {
+				builder.WriteString(`,` + strconv.Itoa(re.Max))
+			}
+
+			builder.WriteString(`}`)
+		}
+
+		if re.Flags&syntax.NonGreedy != 0 {
+			builder.WriteString(`?`)
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := writePostgresRegex(builder, sub); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		builder.WriteString(`(?:`)
+
+		for i, sub := range re.Sub {
+			if i > 0 {
+				builder.WriteString(`|`)
+			}
+
+			if err := writePostgresRegex(builder, sub); err != nil {
+				return err
+			}
+		}
+
+		builder.WriteString(`)`)
+	default:
+		return errUnsupportedRegex
+	}
+
+	return nil
+}
+
+func writePostgresGroup(builder *strings.Builder, re *syntax.Regexp) error {
+	builder.WriteString(`(?:`)
+
+	if err := writePostgresRegex(builder, re); err != nil {
+		return err
+	}
+
+	builder.WriteString(`)`)
+
+	return nil
+}
+
+// writePostgresRune writes a character which is safe both in and out of
+// bracket expressions.
+func writePostgresRune(builder *strings.Builder, r rune) {
+	switch {
+	case r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		builder.WriteRune(r)
+	case r < 0x80 && unicode.IsPrint(r):
+		// A backslash before any other character makes it a literal.
+		builder.WriteRune('\\')
+		builder.WriteRune(r)
+	case r <= 0xFFFF:
+		fmt.Fprintf(builder, `\u%04X`, r)
+	default:
+		fmt.Fprintf(builder, `\U%08X`, r)
+	}
+}
+
+// matchedLines returns the numbers of lines with matches for a pattern.
+// Matches spanning several lines include every line they span.
+func matchedLines(body string, pattern *regexp.Regexp) []uint64 {
+	lines := []uint64{}
+	line := uint64(1)
+	offset := 0
+
+	for _, match := range pattern.FindAllStringIndex(body, -1) {
+		line += uint64(strings.Count(body[offset:match[0]], "\n"))
+		first := line
+		// A newline at the end of a match belongs to the line it ends.
+		last := first + uint64(strings.Count(strings.TrimSuffix(body[match[0]:match[1]], "\n"), "\n"))
+		line += uint64(strings.Count(body[match[0]:match[1]], "\n"))
+		offset = match[1]
+
+		// Skip lines already added for a previous match.
+		if len(lines) > 0 && first <= lines[len(lines)-1] {
+			first = lines[len(lines)-1] + 1
+		}
+
+		for number := first; number <= last; number++ {
+			if len(lines) == maximumMatchedLines {
+				return lines
+			}
+
+			lines = append(lines, number)
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,213 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindCodeSamplesRegexTranslation(t *testing.T) {
+	var tests = map[string]struct {
+		regex           string
+		expectedPattern string
+	}{
+		"Escapes": {
+			regex:           `func \w+\(ctx context\.Context`,
+			expectedPattern: `func\ (?:[0-9A-Z\_a-z])+\(ctx\ context\.Context`,
+		},
+		"IgnoreCase": {
+			regex:           `(?i)from`,
+			expectedPattern: `[Ff][Rr][Oo][Mm]`,
+		},
+		"DotWithoutNewlines": {
+			regex:           `a.b`,
+			expectedPattern: `a[^\n]b`,
+		},
+		"DotWithNewlines": {
+			regex:           `(?s)a.b`,
+			expectedPattern: `a.b`,
+		},
+		"Lines": {
+			regex:           `(?m)^return nil$`,
+			expectedPattern: `(?:^|(?<=\n))return\ nil(?:$|(?=\n))`,
+		},
+		"NegatedClass": {
+			regex:           `[^a-]`,
+			expectedPattern: `[\u0001-\,\.-\` + "`" + `b-\U0010FFFF]`,
+		},
+		"RepeatAndAlternate": {
+			regex:           `(?:ab|cd){2,3}?\b`,
+			expectedPattern: `(?:(?:ab|cd)){2,3}?\y`,
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			mock.ExpectQuery(`SELECT COUNT.* FROM codesample WHERE body ~ \$1$`).
+				WithArgs(testData.expectedPattern).
+				WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(0)))
+
+			search := models.CodeSampleSearch{
+				Regex:    testData.regex,
+				Page:     1,
+				PageSize: 20,
+			}
+			_, err := db.FindCodeSamples(context.Background(), search)
+
+			assert.Nil(t, err)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckRegex(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, database.CheckRegex(`func \w+\(`))
+	assert.NotNil(t, database.CheckRegex(`a\x00`))
+	assert.NotNil(t, database.CheckRegex(`[^\x00-\x{10FFFF}]`))
+	assert.NotNil(t, database.CheckRegex(`func (`))
+}
+
+func TestFindCodeSamplesRegexMatchedLines(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	body := "package main\n" +
+		"\n" +
+		"func Load(ctx context.Context) error {\n" +
+		"\treturn nil\n" +
+		"}\n" +
+		"\n" +
+		"func Save(\n" +
+		"\tctx context.Context,\n" +
+		") error {\n" +
+		"\treturn nil\n" +
+		"}\n"
+
+	mock.ExpectQuery(`SELECT COUNT.* FROM codesample WHERE search_index .* AND body ~ \$2$`).
+		WithArgs("context", `func\ (?:[0-9A-Z\_a-z])+\((?:[\u0009-\u000A\u000C-\u000D\ ])*ctx`).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+	mock.ExpectQuery(`SELECT .* FROM codesample .* LIMIT \$3 OFFSET \$4`).
+		WithArgs("context", `func\ (?:[0-9A-Z\_a-z])+\((?:[\u0009-\u000A\u000C-\u000D\ ])*ctx`, uint64(20), uint64(0)).
+		WillReturnRows(
+			pgxmock.NewRows([]string{
+				"id",
+				"submitted_by_id",
+				"username",
+				"language_id",
+				"language_name",
+				"language_retired",
+				"title",
+				"description",
+				"body",
+				"tags",
+				"created",
+				"modified",
+				"sort_key",
+			}).AddRow(
+				testutils.UUIDFromInt(1),
+				testutils.UUIDFromInt(123),
+				"some_user",
+				"go",
+				"Go",
+				false,
+				"Contexts",
+				"Passing contexts",
+				body,
+				[]string{},
+				created,
+				created,
+				"2023-01-01 00:00:00+00",
+			),
+		)
+
+	search := models.CodeSampleSearch{
+		Query:    "context",
+		Regex:    `func \w+\(\s*ctx`,
+		Page:     1,
+		PageSize: 20,
+	}
+	page, err := db.FindCodeSamples(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	if assert.Equal(t, 1, len(page.Results)) {
+		assert.Equal(t, []uint64{3, 7, 8}, page.Results[0].MatchedLines)
+	}
+}
+
+func TestFindCodeSampleSummariesRegex(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT COUNT.* FROM codesample WHERE body ~ \$1$`).
+		WithArgs(`x\ \=\ 1\u000A`).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(uint64(1)))
+	mock.ExpectQuery(`SELECT .* title, description, body,.* ORDER BY codesample.created DESC`).
+		WithArgs(`x\ \=\ 1\u000A`, uint64(20), uint64(0)).
+		WillReturnRows(
+			pgxmock.NewRows(summaryColumns).AddRow(
+				testutils.UUIDFromInt(1),
+				testutils.UUIDFromInt(123),
+				"some_user",
+				"python",
+				"Python",
+				false,
+				"Assignment",
+				"Assigning variables",
+				[]string{},
+				"Assignment",
+				"Assigning variables",
+				"# Assign x\nx = 1\ny = 2",
+				created,
+				created,
+				"2023-01-01 00:00:00+00",
+			),
+		)
+
+	search := models.CodeSampleSearch{
+		Regex:    "x = 1\n",
+		View:     models.ViewSummary,
+		Page:     1,
+		PageSize: 20,
+	}
+	page, err := db.FindCodeSampleSummaries(context.Background(), search)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	if assert.Equal(t, 1, len(page.Results)) {
+		assert.Equal(t, []uint64{2}, page.Results[0].MatchedLines)
+		assert.Equal(
+			t,
+			[]models.CodeSampleLine{
+				{Number: 2, Text: "<mark>x = 1</mark>"},
+			},
+			page.Results[0].Highlights.Lines,
+		)
+	}
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// insertRevision saves the current state of a sample as its next revision,
+// recording who made the change.
+//
+// This should be run in the same transaction as the sample is saved in.
+// Updates lock the codesample row, so revision numbers can't collide.
+func insertRevision(ctx context.Context, tx pgx.Tx, sample models.CodeSample, editorID uuid.UUID) error {
+	_, err := tx.Exec(
+		ctx,
+		`
+			INSERT INTO codesample_revision (
+				codesample_id, revision, edited_by_id, language_id,
+				title, description, body, tags,
+				created
+			)
+			SELECT
+				$1, COALESCE(MAX(revision), 0) + 1, $2, $3,
+				$4, $5, $6, $7,
+				$8
+			FROM codesample_revision
+			WHERE codesample_id = $1
+		`,
+		sample.ID, editorID, sample.Language.ID,
+		sample.Title, sample.Description, sample.Body, sampleTags(sample),
+		sample.Modified,
+	)
+
+	return err
+}
+
+func (db *databaseAPIImpl) ListCodeSampleRevisions(
+	ctx context.Context,
+	id uuid.UUID,
+) ([]models.CodeSampleRevision, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`
+			SELECT
+				revision,
+				edited_by_id,
+				username,
+				language_id,
+				language.name AS language_name,
+				language.retired AS language_retired,
+				title,
+				description,
+				body,
+				tags,
+				created
+			FROM codesample_revision
+			INNER JOIN "user"
+			ON "user".id = codesample_revision.edited_by_id
+			INNER JOIN language
+			ON language.id = codesample_revision.language_id
+			WHERE codesample_id = $1
+			ORDER BY revision DESC
+		`,
+		id,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// Ensure we have an empty slice to avoid serialization issues.
+	revisions := []models.CodeSampleRevision{}
+
+	for rows.Next() {
+		revision := models.CodeSampleRevision{CodeSampleID: id}
+		err = rows.Scan(
+			&revision.Revision,
+			&revision.EditedBy.ID,
+			&revision.EditedBy.Username,
+			&revision.Language.ID,
+			&revision.Language.Name,
+			&revision.Language.Retired,
+			&revision.Title,
+			&revision.Description,
+			&revision.Body,
+			&revision.Tags,
+			&revision.Created,
+		)
+
+		if err != nil {
+			return revisions, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (db *databaseAPIImpl) GetCodeSampleRevision(
+	ctx context.Context,
+	id uuid.UUID,
+	revision uint64,
+) (models.CodeSampleRevision, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			SELECT
+				edited_by_id,
+				username,
+				language_id,
+				language.name AS language_name,
+				language.retired AS language_retired,
+				title,
+				description,
+				body,
+				tags,
+				created
+			FROM codesample_revision
+			INNER JOIN "user"
+			ON "user".id = codesample_revision.edited_by_id
+			INNER JOIN language
+			ON language.id = codesample_revision.language_id
+			WHERE codesample_id = $1 AND revision = $2
+		`,
+		id,
+		revision,
+	)
+
+	result := models.CodeSampleRevision{CodeSampleID: id, Revision: revision}
+	err := row.Scan(
+		&result.EditedBy.ID,
+		&result.EditedBy.Username,
+		&result.Language.ID,
+		&result.Language.Name,
+		&result.Language.Retired,
+		&result.Title,
+		&result.Description,
+		&result.Body,
+		&result.Tags,
+		&result.Created,
+	)
+
+	return result, err
+}
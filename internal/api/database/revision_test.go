@@ -0,0 +1,171 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListCodeSampleRevisions(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Now()
+
+	expectedRows := pgxmock.
+		NewRows([]string{
+			"revision",
+			"edited_by_id",
+			"username",
+			"language_id",
+			"language_name",
+			"language_retired",
+			"title",
+			"description",
+			"body",
+			"tags",
+			"created",
+		}).
+		AddRow(
+			uint64(2),
+			testutils.UUIDFromInt(123),
+			"some_user",
+			"python",
+			"Python",
+			false,
+			"Adding two numbers",
+			"How to add two numbers together",
+			"x + y",
+			[]string{"math"},
+			created,
+		).
+		AddRow(
+			uint64(1),
+			testutils.UUIDFromInt(123),
+			"some_user",
+			"python",
+			"Python",
+			false,
+			"Adding numbers",
+			"",
+			"x+y",
+			nil,
+			created,
+		)
+	mock.ExpectQuery(`SELECT .* FROM codesample_revision .* WHERE codesample_id = \$1 ORDER BY revision DESC`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnRows(expectedRows)
+
+	revisions, err := db.ListCodeSampleRevisions(context.Background(), testutils.UUIDFromInt(1))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(revisions))
+
+	for i := range revisions {
+		assert.Equal(t, created.Unix(), revisions[i].Created.Unix())
+		revisions[i].Created = time.Time{}
+	}
+
+	expectedRevisions := []models.CodeSampleRevision{
+		{
+			CodeSampleID: testutils.UUIDFromInt(1),
+			Revision:     2,
+			EditedBy:     pythonCodeSample.SubmittedBy,
+			Language:     pythonCodeSample.Language,
+			Title:        "Adding two numbers",
+			Description:  "How to add two numbers together",
+			Body:         "x + y",
+			Tags:         []string{"math"},
+		},
+		{
+			CodeSampleID: testutils.UUIDFromInt(1),
+			Revision:     1,
+			EditedBy:     pythonCodeSample.SubmittedBy,
+			Language:     pythonCodeSample.Language,
+			Title:        "Adding numbers",
+			Body:         "x+y",
+		},
+	}
+	assert.Equal(t, expectedRevisions, revisions)
+}
+
+func TestGetCodeSampleRevision(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Now()
+
+	expectedRows := pgxmock.
+		NewRows([]string{
+			"edited_by_id",
+			"username",
+			"language_id",
+			"language_name",
+			"language_retired",
+			"title",
+			"description",
+			"body",
+			"tags",
+			"created",
+		}).
+		AddRow(
+			testutils.UUIDFromInt(123),
+			"some_user",
+			"python",
+			"Python",
+			false,
+			"Adding two numbers",
+			"How to add two numbers together",
+			"x + y",
+			[]string{"math"},
+			created,
+		)
+	mock.ExpectQuery(`SELECT .* FROM codesample_revision .* WHERE codesample_id = \$1 AND revision = \$2`).
+		WithArgs(testutils.UUIDFromInt(1), uint64(3)).
+		WillReturnRows(expectedRows)
+
+	revision, err := db.GetCodeSampleRevision(context.Background(), testutils.UUIDFromInt(1), 3)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, created.Unix(), revision.Created.Unix())
+	revision.Created = time.Time{}
+
+	expectedRevision := models.CodeSampleRevision{
+		CodeSampleID: testutils.UUIDFromInt(1),
+		Revision:     3,
+		EditedBy:     pythonCodeSample.SubmittedBy,
+		Language:     pythonCodeSample.Language,
+		Title:        pythonCodeSample.Title,
+		Description:  pythonCodeSample.Description,
+		Body:         pythonCodeSample.Body,
+		Tags:         pythonCodeSample.Tags,
+	}
+	assert.Equal(t, expectedRevision, revision)
+}
+
+func TestGetCodeSampleRevisionMissing(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT .* FROM codesample_revision`).
+		WithArgs(testutils.UUIDFromInt(1), uint64(3)).
+		WillReturnError(database.NotFoundErr)
+
+	_, err := db.GetCodeSampleRevision(context.Background(), testutils.UUIDFromInt(1), 3)
+
+	assert.Equal(t, database.NotFoundErr, err)
+}
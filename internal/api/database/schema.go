@@ -0,0 +1,18 @@
+package database
+
+import (
+	"context"
+)
+
+// SchemaVersion is the version of sql/codelibrary.sql this code needs.
+// Increase it along with the version recorded at the end of the file.
+const SchemaVersion = 1
+
+// GetSchemaVersion returns the version of the schema in the database.
+func (db *databaseAPIImpl) GetSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+
+	err := db.pool.QueryRow(ctx, `SELECT version FROM schema_version`).Scan(&version)
+
+	return version, err
+}
@@ -0,0 +1,25 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSchemaVersion(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+
+	mock.ExpectQuery(`SELECT version FROM schema_version`).
+		WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(3))
+
+	version, err := db.GetSchemaVersion(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *databaseAPIImpl) CreateSession(ctx context.Context, session models.Session) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		// Clear out sessions for the user that can't be used any more.
+		_, err := tx.Exec(
+			ctx,
+			`DELETE FROM session WHERE user_id = $1 AND expires <= $2`,
+			session.UserID, session.Created,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO session (
+					id, user_id, created, last_seen, expires, user_agent, ip_address,
+					reauthenticated
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			`,
+			session.ID, session.UserID, session.Created, session.LastSeen, session.Expires,
+			session.UserAgent, session.IPAddress, session.Reauthenticated,
+		)
+
+		return err
+	})
+}
+
+// GetSessionUser loads the user for a session which hasn't expired, and
+// extends the session so it expires later.
+func (db *databaseAPIImpl) GetSessionUser(
+	ctx context.Context,
+	id uuid.UUID,
+	lastSeen time.Time,
+	expires time.Time,
+) (models.User, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			UPDATE session
+			SET last_seen = $2, expires = $3
+			FROM "user"
+			WHERE session.id = $1
+			AND session.expires > $2
+			AND "user".id = session.user_id
+			RETURNING "user".id, "user".username, "user".role
+		`,
+		id, lastSeen, expires,
+	)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Role)
+
+	return user, err
+}
+
+// GetSession loads a session which hasn't expired, without extending it.
+func (db *databaseAPIImpl) GetSession(ctx context.Context, id uuid.UUID, now time.Time) (models.Session, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			SELECT user_id, created, last_seen, expires, user_agent, ip_address,
+				reauthenticated
+			FROM session
+			WHERE id = $1
+			AND expires > $2
+		`,
+		id, now,
+	)
+
+	session := models.Session{ID: id}
+	err := row.Scan(
+		&session.UserID,
+		&session.Created,
+		&session.LastSeen,
+		&session.Expires,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.Reauthenticated,
+	)
+
+	return session, err
+}
+
+func (db *databaseAPIImpl) ListSessions(
+	ctx context.Context,
+	userID uuid.UUID,
+	now time.Time,
+) ([]models.Session, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`
+			SELECT id, created, last_seen, expires, user_agent, ip_address
+			FROM session
+			WHERE user_id = $1
+			AND expires > $2
+			ORDER BY last_seen DESC
+		`,
+		userID, now,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// Ensure we have an empty slice to avoid serialization issues.
+	sessions := []models.Session{}
+
+	for rows.Next() {
+		session := models.Session{UserID: userID}
+		err = rows.Scan(
+			&session.ID,
+			&session.Created,
+			&session.LastSeen,
+			&session.Expires,
+			&session.UserAgent,
+			&session.IPAddress,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes a session, if it still exists.
+func (db *databaseAPIImpl) DeleteSession(ctx context.Context, id uuid.UUID) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM session WHERE id = $1`, id)
+
+	return err
+}
+
+// DeleteUserSession revokes a session belonging to a given user.
+func (db *databaseAPIImpl) DeleteUserSession(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM session WHERE id = $1 AND user_id = $2`, id, userID)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	return err
+}
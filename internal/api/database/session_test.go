@@ -0,0 +1,191 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSession(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	session := models.Session{
+		ID:        testutils.UUIDFromInt(1),
+		UserID:    testutils.UUIDFromInt(2),
+		UserAgent: "curl/8.0",
+		IPAddress: "127.0.0.1",
+		Created:   now,
+		LastSeen:  now,
+		Expires:   now.Add(24 * time.Hour),
+		// Sessions from logging in again with a provider are marked.
+		Reauthenticated: true,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM session WHERE user_id = \$1 AND expires <= \$2`).
+		WithArgs(session.UserID, now).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`INSERT INTO session`).
+		WithArgs(
+			session.ID, session.UserID, now, now, session.Expires,
+			"curl/8.0", "127.0.0.1", true,
+		).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := db.CreateSession(context.Background(), session)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestGetSessionUser(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	expires := now.Add(24 * time.Hour)
+
+	mock.ExpectQuery(`UPDATE session SET last_seen = \$2, expires = \$3 .* AND session.expires > \$2`).
+		WithArgs(testutils.UUIDFromInt(1), now, expires).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"id", "username", "role"}).
+				AddRow(testutils.UUIDFromInt(2), "some_user", models.RoleUser),
+		)
+
+	user, err := db.GetSessionUser(context.Background(), testutils.UUIDFromInt(1), now, expires)
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		models.User{ID: testutils.UUIDFromInt(2), Username: "some_user", Role: models.RoleUser},
+		user,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestGetSessionUserExpired(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	expires := now.Add(24 * time.Hour)
+
+	mock.ExpectQuery(`UPDATE session`).
+		WithArgs(testutils.UUIDFromInt(1), now, expires).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "username", "role"}))
+
+	_, err := db.GetSessionUser(context.Background(), testutils.UUIDFromInt(1), now, expires)
+
+	assert.Equal(t, database.NotFoundErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT user_id, .* FROM session WHERE id = \$1 AND expires > \$2`).
+		WithArgs(testutils.UUIDFromInt(1), now).
+		WillReturnRows(
+			pgxmock.NewRows([]string{
+				"user_id", "created", "last_seen", "expires", "user_agent", "ip_address", "reauthenticated",
+			}).
+				AddRow(testutils.UUIDFromInt(2), now, now, now, "curl/8.0", "127.0.0.1", true),
+		)
+
+	session, err := db.GetSession(context.Background(), testutils.UUIDFromInt(1), now)
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		models.Session{
+			ID:              testutils.UUIDFromInt(1),
+			UserID:          testutils.UUIDFromInt(2),
+			UserAgent:       "curl/8.0",
+			IPAddress:       "127.0.0.1",
+			Created:         now,
+			LastSeen:        now,
+			Expires:         now,
+			Reauthenticated: true,
+		},
+		session,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .* FROM session WHERE user_id = \$1 AND expires > \$2 ORDER BY last_seen DESC`).
+		WithArgs(testutils.UUIDFromInt(2), now).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"id", "created", "last_seen", "expires", "user_agent", "ip_address"}).
+				AddRow(testutils.UUIDFromInt(1), now, now, now, "curl/8.0", "127.0.0.1"),
+		)
+
+	sessions, err := db.ListSessions(context.Background(), testutils.UUIDFromInt(2), now)
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]models.Session{
+			{
+				ID:        testutils.UUIDFromInt(1),
+				UserID:    testutils.UUIDFromInt(2),
+				UserAgent: "curl/8.0",
+				IPAddress: "127.0.0.1",
+				Created:   now,
+				LastSeen:  now,
+				Expires:   now,
+			},
+		},
+		sessions,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteUserSessionNotFound(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`DELETE FROM session WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(testutils.UUIDFromInt(1), testutils.UUIDFromInt(2)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	err := db.DeleteUserSession(context.Background(), testutils.UUIDFromInt(2), testutils.UUIDFromInt(1))
+
+	assert.Equal(t, database.NotFoundErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// tagsColumn selects the sorted tags for a sample as an array.
+const tagsColumn = `
+	ARRAY(
+		SELECT tag
+		FROM codesample_tag
+		WHERE codesample_tag.codesample_id = codesample.id
+		ORDER BY tag
+	) AS tags
+`
+
+// sampleTags returns the tags for a sample, making sure a nil slice is sent
+// as an empty array.
+func sampleTags(sample models.CodeSample) []string {
+	if sample.Tags == nil {
+		return []string{}
+	}
+
+	return sample.Tags
+}
+
+// saveTags replaces the tags for a sample with the tags set on it.
+//
+// This should be run in the same transaction as the sample is saved in.
+func saveTags(ctx context.Context, tx pgx.Tx, sample models.CodeSample) error {
+	tags := sampleTags(sample)
+
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO tag (name) SELECT unnest($1::text[]) ON CONFLICT DO NOTHING`,
+		tags,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`DELETE FROM codesample_tag WHERE codesample_id = $1 AND NOT (tag = ANY($2))`,
+		sample.ID, tags,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`
+			INSERT INTO codesample_tag (codesample_id, tag)
+			SELECT $1, unnest($2::text[])
+			ON CONFLICT DO NOTHING
+		`,
+		sample.ID, tags,
+	)
+
+	return err
+}
+
+func (db *databaseAPIImpl) ListTags(ctx context.Context) ([]models.TagSummary, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`
+			SELECT tag, COUNT(*) AS sample_count
+			FROM codesample_tag
+			GROUP BY tag
+			ORDER BY sample_count DESC, tag
+		`,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// Ensure we have an empty slice to avoid serialization issues.
+	tags := []models.TagSummary{}
+
+	for rows.Next() {
+		var tag models.TagSummary
+
+		if err := rows.Scan(&tag.Name, &tag.SampleCount); err != nil {
+			return tags, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,34 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTags(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	expectedRows := pgxmock.NewRows([]string{"tag", "sample_count"}).
+		AddRow("concurrency", uint64(5)).
+		AddRow("regex", uint64(2))
+	mock.ExpectQuery(`SELECT tag, COUNT\(\*\) AS sample_count FROM codesample_tag GROUP BY tag`).
+		WillReturnRows(expectedRows)
+
+	tags, err := db.ListTags(context.Background())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+
+	expectedTags := []models.TagSummary{
+		{Name: "concurrency", SampleCount: 5},
+		{Name: "regex", SampleCount: 2},
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, expectedTags, tags)
+}
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+)
+
+// HashToken hashes an API token for storage.
+//
+// Tokens are long and random, so they don't need a slow hash like passwords,
+// and a plain hash lets us look tokens up directly.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func scopeStrings(scopes []models.Scope) []string {
+	strings := make([]string, len(scopes))
+
+	for i, scope := range scopes {
+		strings[i] = string(scope)
+	}
+
+	return strings
+}
+
+func stringScopes(strings []string) []models.Scope {
+	scopes := make([]models.Scope, len(strings))
+
+	for i, text := range strings {
+		scopes[i] = models.Scope(text)
+	}
+
+	return scopes
+}
+
+func (db *databaseAPIImpl) CreateAPIToken(ctx context.Context, token models.APIToken, hash string) error {
+	_, err := db.pool.Exec(
+		ctx,
+		`
+			INSERT INTO api_token (
+				id, user_id, name, token_hash, scopes, created, expires
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`,
+		token.ID, token.UserID, token.Name, hash, scopeStrings(token.Scopes), token.Created, token.Expires,
+	)
+
+	return err
+}
+
+// GetAPITokenUser loads the user and token for a token hash, if the token
+// hasn't expired, and records when the token was used.
+func (db *databaseAPIImpl) GetAPITokenUser(
+	ctx context.Context,
+	hash string,
+	now time.Time,
+) (models.User, models.APIToken, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			UPDATE api_token
+			SET last_used = $2
+			FROM "user"
+			WHERE api_token.token_hash = $1
+			AND (api_token.expires IS NULL OR api_token.expires > $2)
+			AND "user".id = api_token.user_id
+			RETURNING
+				"user".id,
+				"user".username,
+				"user".role,
+				api_token.id,
+				api_token.name,
+				api_token.scopes,
+				api_token.created,
+				api_token.expires,
+				api_token.last_used
+		`,
+		hash, now,
+	)
+
+	var user models.User
+	var token models.APIToken
+	var scopes []string
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Role,
+		&token.ID,
+		&token.Name,
+		&scopes,
+		&token.Created,
+		&token.Expires,
+		&token.LastUsed,
+	)
+	token.UserID = user.ID
+	token.Scopes = stringScopes(scopes)
+
+	return user, token, err
+}
+
+// GetAPITokenID finds the ID of a token which hasn't expired, without
+// recording that it was used.
+func (db *databaseAPIImpl) GetAPITokenID(ctx context.Context, hash string, now time.Time) (uuid.UUID, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			SELECT id
+			FROM api_token
+			WHERE token_hash = $1
+			AND (expires IS NULL OR expires > $2)
+		`,
+		hash, now,
+	)
+
+	var id uuid.UUID
+	err := row.Scan(&id)
+
+	return id, err
+}
+
+func (db *databaseAPIImpl) ListAPITokens(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error) {
+	rows, err := db.pool.Query(
+		ctx,
+		`
+			SELECT id, name, scopes, created, expires, last_used
+			FROM api_token
+			WHERE user_id = $1
+			ORDER BY created DESC
+		`,
+		userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// Ensure we have an empty slice to avoid serialization issues.
+	tokens := []models.APIToken{}
+
+	for rows.Next() {
+		token := models.APIToken{UserID: userID}
+		var scopes []string
+		err = rows.Scan(
+			&token.ID,
+			&token.Name,
+			&scopes,
+			&token.Created,
+			&token.Expires,
+			&token.LastUsed,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		token.Scopes = stringScopes(scopes)
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken revokes a token belonging to a given user.
+func (db *databaseAPIImpl) DeleteAPIToken(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM api_token WHERE id = $1 AND user_id = $2`, id, userID)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	return err
+}
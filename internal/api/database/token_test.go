@@ -0,0 +1,168 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashToken(t *testing.T) {
+	assert.Equal(
+		t,
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		database.HashToken("abc"),
+	)
+}
+
+func TestCreateAPIToken(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Now()
+	token := models.APIToken{
+		ID:      testutils.UUIDFromInt(1),
+		UserID:  testutils.UUIDFromInt(2),
+		Name:    "Editor",
+		Scopes:  []models.Scope{models.ScopeSamplesRead, models.ScopeSamplesWrite},
+		Created: created,
+	}
+
+	mock.ExpectExec(`INSERT INTO api_token`).
+		WithArgs(
+			token.ID, token.UserID, "Editor", "hash",
+			[]string{"samples:read", "samples:write"}, created, token.Expires,
+		).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	err := db.CreateAPIToken(context.Background(), token, "hash")
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestGetAPITokenUser(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	var expires *time.Time
+
+	mock.ExpectQuery(
+		`UPDATE api_token SET last_used = \$2 .* WHERE api_token.token_hash = \$1 `+
+			`AND \(api_token.expires IS NULL OR api_token.expires > \$2\)`,
+	).
+		WithArgs("hash", now).
+		WillReturnRows(
+			pgxmock.NewRows([]string{
+				"id", "username", "role",
+				"id", "name", "scopes", "created", "expires", "last_used",
+			}).AddRow(
+				testutils.UUIDFromInt(2), "some_user", models.RoleUser,
+				testutils.UUIDFromInt(1), "Editor", []string{"samples:read"}, now, expires, &now,
+			),
+		)
+
+	user, token, err := db.GetAPITokenUser(context.Background(), "hash", now)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.User{ID: testutils.UUIDFromInt(2), Username: "some_user", Role: models.RoleUser}, user)
+	assert.Equal(
+		t,
+		models.APIToken{
+			ID:       testutils.UUIDFromInt(1),
+			UserID:   testutils.UUIDFromInt(2),
+			Name:     "Editor",
+			Scopes:   []models.Scope{models.ScopeSamplesRead},
+			Created:  now,
+			LastUsed: &now,
+		},
+		token,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestGetAPITokenID(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT id FROM api_token WHERE token_hash = \$1 AND \(expires IS NULL OR expires > \$2\)`).
+		WithArgs("hash", now).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testutils.UUIDFromInt(1)))
+
+	id, err := db.GetAPITokenID(context.Background(), "hash", now)
+
+	assert.Nil(t, err)
+	assert.Equal(t, testutils.UUIDFromInt(1), id)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestListAPITokens(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	var lastUsed *time.Time
+
+	mock.ExpectQuery(`SELECT .* FROM api_token WHERE user_id = \$1 ORDER BY created DESC`).
+		WithArgs(testutils.UUIDFromInt(2)).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"id", "name", "scopes", "created", "expires", "last_used"}).
+				AddRow(testutils.UUIDFromInt(1), "Editor", []string{"samples:write"}, now, &now, lastUsed),
+		)
+
+	tokens, err := db.ListAPITokens(context.Background(), testutils.UUIDFromInt(2))
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		[]models.APIToken{
+			{
+				ID:      testutils.UUIDFromInt(1),
+				UserID:  testutils.UUIDFromInt(2),
+				Name:    "Editor",
+				Scopes:  []models.Scope{models.ScopeSamplesWrite},
+				Created: now,
+				Expires: &now,
+			},
+		},
+		tokens,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteAPITokenNotFound(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`DELETE FROM api_token WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(testutils.UUIDFromInt(1), testutils.UUIDFromInt(2)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	err := db.DeleteAPIToken(context.Background(), testutils.UUIDFromInt(2), testutils.UUIDFromInt(1))
+
+	assert.Equal(t, database.NotFoundErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetTOTP loads the TOTP secret for a user, confirmed or not.
+func (db *databaseAPIImpl) GetTOTP(ctx context.Context, userID uuid.UUID) (models.TOTP, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`SELECT secret, confirmed, created FROM totp WHERE user_id = $1`,
+		userID,
+	)
+
+	totp := models.TOTP{UserID: userID}
+	err := row.Scan(&totp.Secret, &totp.Confirmed, &totp.Created)
+
+	return totp, err
+}
+
+// SetTOTP saves a new unconfirmed secret for a user, replacing any other
+// unconfirmed secret.
+// DuplicateErr is returned if the user has already confirmed a secret.
+func (db *databaseAPIImpl) SetTOTP(ctx context.Context, totp models.TOTP) error {
+	tag, err := db.pool.Exec(
+		ctx,
+		`
+			INSERT INTO totp (user_id, secret, created) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id) DO UPDATE SET
+				secret = EXCLUDED.secret,
+				created = EXCLUDED.created
+			WHERE NOT totp.confirmed
+		`,
+		totp.UserID, totp.Secret, totp.Created,
+	)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = DuplicateErr
+	}
+
+	return err
+}
+
+// ConfirmTOTP turns on two-factor authentication for a user after they have
+// entered their first code, and replaces their recovery codes.
+func (db *databaseAPIImpl) ConfirmTOTP(
+	ctx context.Context,
+	userID uuid.UUID,
+	step int64,
+	recoveryHashes []string,
+) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE totp SET confirmed = true, last_step = $2 WHERE user_id = $1 AND NOT confirmed`,
+			userID, step,
+		)
+
+		if err == nil && tag.RowsAffected() == 0 {
+			err = NotFoundErr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM recovery_code WHERE user_id = $1`, userID)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO recovery_code (user_id, code_hash) SELECT $1, unnest($2::text[])`,
+			userID, recoveryHashes,
+		)
+
+		return err
+	})
+}
+
+// UseTOTPStep records the time step of a code that has been used.
+// NotFoundErr is returned if a code for the step or a later step has already
+// been used, so codes can't be replayed.
+func (db *databaseAPIImpl) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	tag, err := db.pool.Exec(
+		ctx,
+		`
+			UPDATE totp SET last_step = $2
+			WHERE user_id = $1 AND confirmed AND (last_step IS NULL OR last_step < $2)
+		`,
+		userID, step,
+	)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	return err
+}
+
+// UseRecoveryCode uses up a recovery code.
+// NotFoundErr is returned if the user has no such code.
+func (db *databaseAPIImpl) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) error {
+	tag, err := db.pool.Exec(
+		ctx,
+		`DELETE FROM recovery_code WHERE user_id = $1 AND code_hash = $2`,
+		userID, hash,
+	)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	return err
+}
+
+// DeleteTOTP turns off two-factor authentication for a user.
+func (db *databaseAPIImpl) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM totp WHERE user_id = $1`, userID)
+
+		if err == nil && tag.RowsAffected() == 0 {
+			err = NotFoundErr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM recovery_code WHERE user_id = $1`, userID)
+
+		return err
+	})
+}
+
+// CreatePendingLogin saves the hash of a token for finishing a login with a
+// second factor.
+func (db *databaseAPIImpl) CreatePendingLogin(
+	ctx context.Context,
+	userID uuid.UUID,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) error {
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `DELETE FROM pending_login WHERE expires <= $1`, created)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`
+				INSERT INTO pending_login (token_hash, user_id, created, expires)
+				VALUES ($1, $2, $3, $4)
+			`,
+			hash, userID, created, expires,
+		)
+
+		return err
+	})
+}
+
+// GetPendingLogin loads the user for a pending login which hasn't expired.
+func (db *databaseAPIImpl) GetPendingLogin(ctx context.Context, hash string, now time.Time) (models.User, error) {
+	row := db.pool.QueryRow(
+		ctx,
+		`
+			SELECT "user".id, "user".username, "user".role
+			FROM pending_login
+			INNER JOIN "user" ON "user".id = pending_login.user_id
+			WHERE pending_login.token_hash = $1
+			AND pending_login.expires > $2
+		`,
+		hash, now,
+	)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Role)
+
+	return user, err
+}
+
+func (db *databaseAPIImpl) DeletePendingLogin(ctx context.Context, hash string) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM pending_login WHERE token_hash = $1`, hash)
+
+	return err
+}
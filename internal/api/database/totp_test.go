@@ -0,0 +1,220 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/pashagolub/pgxmock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTOTP(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	created := time.Now()
+
+	mock.ExpectQuery(`SELECT secret, confirmed, created FROM totp WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"secret", "confirmed", "created"}).
+				AddRow("SECRET", true, created),
+		)
+
+	totp, err := db.GetTOTP(context.Background(), testutils.UUIDFromInt(1))
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		models.TOTP{UserID: testutils.UUIDFromInt(1), Secret: "SECRET", Confirmed: true, Created: created},
+		totp,
+	)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestSetTOTP(t *testing.T) {
+	var tests = map[string]struct {
+		rowsAffected  int64
+		expectedError error
+	}{
+		"New":              {rowsAffected: 1},
+		"AlreadyConfirmed": {rowsAffected: 0, expectedError: database.DuplicateErr},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			created := time.Now()
+
+			mock.ExpectExec(`INSERT INTO totp .* ON CONFLICT \(user_id\) DO UPDATE .* WHERE NOT totp.confirmed`).
+				WithArgs(testutils.UUIDFromInt(1), "SECRET", created).
+				WillReturnResult(pgxmock.NewResult("INSERT", testData.rowsAffected))
+
+			err := db.SetTOTP(context.Background(), models.TOTP{
+				UserID:  testutils.UUIDFromInt(1),
+				Secret:  "SECRET",
+				Created: created,
+			})
+
+			assert.Equal(t, testData.expectedError, err)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	hashes := []string{"hash1", "hash2"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE totp SET confirmed = true, last_step = \$2 WHERE user_id = \$1 AND NOT confirmed`).
+		WithArgs(testutils.UUIDFromInt(1), int64(100)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`DELETE FROM recovery_code WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`INSERT INTO recovery_code \(user_id, code_hash\) SELECT \$1, unnest\(\$2::text\[\]\)`).
+		WithArgs(testutils.UUIDFromInt(1), hashes).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+	mock.ExpectCommit()
+
+	err := db.ConfirmTOTP(context.Background(), testutils.UUIDFromInt(1), 100, hashes)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	var tests = map[string]struct {
+		rowsAffected  int64
+		expectedError error
+	}{
+		"NewStep":  {rowsAffected: 1},
+		"Replayed": {rowsAffected: 0, expectedError: database.NotFoundErr},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			mock.ExpectExec(`UPDATE totp SET last_step = \$2 .* \(last_step IS NULL OR last_step < \$2\)`).
+				WithArgs(testutils.UUIDFromInt(1), int64(100)).
+				WillReturnResult(pgxmock.NewResult("UPDATE", testData.rowsAffected))
+
+			err := db.UseTOTPStep(context.Background(), testutils.UUIDFromInt(1), 100)
+
+			assert.Equal(t, testData.expectedError, err)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectExec(`DELETE FROM recovery_code WHERE user_id = \$1 AND code_hash = \$2`).
+		WithArgs(testutils.UUIDFromInt(1), "hash").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	err := db.UseRecoveryCode(context.Background(), testutils.UUIDFromInt(1), "hash")
+
+	assert.Equal(t, database.NotFoundErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteTOTP(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM totp WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(`DELETE FROM recovery_code WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 10))
+	mock.ExpectCommit()
+
+	err := db.DeleteTOTP(context.Background(), testutils.UUIDFromInt(1))
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestCreatePendingLogin(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+	expires := now.Add(5 * time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM pending_login WHERE expires <= \$1`).
+		WithArgs(now).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`INSERT INTO pending_login`).
+		WithArgs("hash", testutils.UUIDFromInt(1), now, expires).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := db.CreatePendingLogin(context.Background(), testutils.UUIDFromInt(1), "hash", now, expires)
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestGetPendingLogin(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .* FROM pending_login .* WHERE pending_login.token_hash = \$1 AND pending_login.expires > \$2`).
+		WithArgs("hash", now).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"id", "username", "role"}).
+				AddRow(testutils.UUIDFromInt(1), "user", models.RoleUser),
+		)
+
+	user, err := db.GetPendingLogin(context.Background(), "hash", now)
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}, user)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
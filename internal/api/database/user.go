@@ -2,17 +2,27 @@ package database
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// GhostUserID is the user samples from deleted accounts are credited to.
+var GhostUserID = uuid.MustParse("00000000-0000-4000-8000-000000000000")
+
+// GhostUsername is the name of the ghost user, which nobody else can use.
+const GhostUsername = "ghost"
+
 func (db *databaseAPIImpl) GetUser(ctx context.Context, id uuid.UUID) (models.User, error) {
-	row := db.pool.QueryRow(ctx, `SELECT username FROM "user" WHERE id = $1`, id)
+	row := db.pool.QueryRow(ctx, `SELECT username, role FROM "user" WHERE id = $1`, id)
 
 	user := models.User{ID: id}
-	err := row.Scan(&user.Username)
+	err := row.Scan(&user.Username, &user.Role)
 
 	return user, err
 }
@@ -32,11 +42,11 @@ func (db *databaseAPIImpl) GetUserWithCredentials(
 	username string,
 	password string,
 ) (models.User, error) {
-	row := db.pool.QueryRow(ctx, `SELECT id, password_hash FROM "user" WHERE username = $1`, username)
+	row := db.pool.QueryRow(ctx, `SELECT id, role, password_hash FROM "user" WHERE username = $1`, username)
 
 	user := models.User{Username: username}
 	var hash string
-	err := row.Scan(&user.ID, &hash)
+	err := row.Scan(&user.ID, &user.Role, &hash)
 
 	if err == nil && !CheckPasswordHash(password, hash) {
 		err = NotFoundErr
@@ -45,18 +55,198 @@ func (db *databaseAPIImpl) GetUserWithCredentials(
 	return user, err
 }
 
-func (db *databaseAPIImpl) RegisterUser(ctx context.Context, user models.User, password string) error {
+// RegisterUser creates a new account.
+// DuplicateErr is returned if the username or email address is taken.
+func (db *databaseAPIImpl) RegisterUser(ctx context.Context, account models.Account, password string) error {
 	hash, err := HashPassword(password)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = db.pool.Exec(
-		ctx,
-		`INSERT INTO "user" (id, username, password_hash) VALUES ($1, $2, $3)`,
-		user.ID, user.Username, hash,
-	)
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		if account.Email != nil {
+			if err := checkEmailAvailable(ctx, tx, account.ID, *account.Email); err != nil {
+				return err
+			}
+		}
+
+		tag, err := tx.Exec(
+			ctx,
+			`
+				INSERT INTO "user" (id, username, role, email, password_hash) VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT DO NOTHING
+			`,
+			account.ID, account.Username, account.Role, account.Email, hash,
+		)
+
+		if err == nil && tag.RowsAffected() == 0 {
+			err = DuplicateErr
+		}
+
+		return err
+	})
+}
+
+// AccountChanges are changes to an account which are saved together.
+type AccountChanges struct {
+	// Username is a new name for the user, if it isn't nil.
+	Username *string
+	// ChangeEmail sets Email as a new unverified email address, or removes
+	// the address if Email is nil.
+	ChangeEmail bool
+	Email       *string
+	// Password is a new password, if it isn't nil. Every session except
+	// KeepSessionID is logged out, so anyone who knew the old password loses
+	// access.
+	Password      *string
+	KeepSessionID uuid.UUID
+}
+
+// UpdateAccount saves changes to an account in one transaction, so either
+// every change is made or none are.
+// DuplicateUsernameErr or DuplicateEmailErr is returned if another user has
+// the name or has verified the address.
+func (db *databaseAPIImpl) UpdateAccount(ctx context.Context, id uuid.UUID, changes AccountChanges) error {
+	var hash string
+
+	// Hash the password before starting the transaction, as it is slow.
+	if changes.Password != nil {
+		var err error
+
+		if hash, err = HashPassword(*changes.Password); err != nil {
+			return err
+		}
+	}
+
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		if changes.Username != nil {
+			if err := changeUsername(ctx, tx, id, *changes.Username); err != nil {
+				return err
+			}
+		}
+
+		if changes.ChangeEmail {
+			if err := setEmail(ctx, tx, id, changes.Email); err != nil {
+				return err
+			}
+		}
+
+		if changes.Password != nil {
+			if err := changePassword(ctx, tx, id, hash, changes.KeepSessionID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func changeUsername(ctx context.Context, tx pgx.Tx, id uuid.UUID, username string) error {
+	tag, err := tx.Exec(ctx, `UPDATE "user" SET username = $2 WHERE id = $1`, id, username)
+
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "username_unique" {
+		err = DuplicateUsernameErr
+	}
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
 
 	return err
 }
+
+func changePassword(ctx context.Context, tx pgx.Tx, id uuid.UUID, hash string, keepSessionID uuid.UUID) error {
+	tag, err := tx.Exec(ctx, `UPDATE "user" SET password_hash = $2 WHERE id = $1`, id, hash)
+
+	if err == nil && tag.RowsAffected() == 0 {
+		err = NotFoundErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM session WHERE user_id = $1 AND id <> $2`, id, keepSessionID)
+
+	return err
+}
+
+// DeleteUser deletes an account. Samples submitted by the user are either
+// deleted or reassigned to the ghost user. Revisions the user made to other
+// samples are always reassigned, so the history of those samples is kept.
+func (db *databaseAPIImpl) DeleteUser(ctx context.Context, id uuid.UUID, samples models.SampleDisposal) error {
+	if id == GhostUserID {
+		return NotFoundErr
+	}
+
+	return db.withTransaction(ctx, func(tx pgx.Tx) error {
+		var err error
+
+		if samples == models.SamplesReassign {
+			_, err = tx.Exec(
+				ctx,
+				`UPDATE codesample SET submitted_by_id = $2 WHERE submitted_by_id = $1`,
+				id, GhostUserID,
+			)
+		} else {
+			_, err = tx.Exec(ctx, `DELETE FROM codesample WHERE submitted_by_id = $1`, id)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE codesample_revision SET edited_by_id = $2 WHERE edited_by_id = $1`,
+			id, GhostUserID,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, `DELETE FROM "user" WHERE id = $1`, id)
+
+		if err == nil && tag.RowsAffected() == 0 {
+			err = NotFoundErr
+		}
+
+		return err
+	})
+}
+
+// SetUserRole changes the role for a user, recording the admin who made the
+// change.
+func (db *databaseAPIImpl) SetUserRole(
+	ctx context.Context,
+	id uuid.UUID,
+	role models.Role,
+	actorID uuid.UUID,
+) (models.User, error) {
+	user := models.User{ID: id}
+	err := db.withTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(
+			ctx,
+			`UPDATE "user" SET role = $2 WHERE id = $1 RETURNING username, role`,
+			id, role,
+		).Scan(&user.Username, &user.Role)
+
+		if err != nil {
+			return err
+		}
+
+		return insertModerationAction(ctx, tx, moderationAction{
+			actorID: actorID,
+			action:  "setRole",
+			userID:  &id,
+			details: string(role),
+			created: time.Now(),
+		})
+	})
+
+	return user, err
+}
@@ -7,10 +7,15 @@ import (
 	"github.com/dense-analysis/codelibrary/internal/api/database"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pashagolub/pgxmock/v2"
 	"github.com/stretchr/testify/assert"
 )
 
+// nilUUID is a missing UUID, for matching query arguments.
+var nilUUID *uuid.UUID
+
 // hashMatcher accepts a password and matches a generated hash.
 type hashMatcher struct {
 	password string
@@ -26,8 +31,8 @@ func TestGetUser(t *testing.T) {
 	mock, db := startDatabaseTest(t)
 	defer mock.Close()
 
-	expectedRows := pgxmock.NewRows([]string{"username"}).
-		AddRow("some_user")
+	expectedRows := pgxmock.NewRows([]string{"username", "role"}).
+		AddRow("some_user", models.RoleUser)
 	mock.ExpectQuery(`SELECT .* FROM "user" WHERE id = \$1`).
 		WithArgs(testutils.UUIDFromInt(1)).
 		WillReturnRows(expectedRows)
@@ -41,6 +46,7 @@ func TestGetUser(t *testing.T) {
 	expectedUser := models.User{
 		ID:       testutils.UUIDFromInt(1),
 		Username: "some_user",
+		Role:     models.RoleUser,
 	}
 	assert.Nil(t, err)
 	assert.Equal(t, expectedUser, user)
@@ -52,8 +58,8 @@ func TestGetUserWithCredentials(t *testing.T) {
 
 	hash, _ := database.HashPassword("password123")
 
-	expectedRows := pgxmock.NewRows([]string{"id", "password_hash"}).
-		AddRow(testutils.UUIDFromInt(1), hash)
+	expectedRows := pgxmock.NewRows([]string{"id", "role", "password_hash"}).
+		AddRow(testutils.UUIDFromInt(1), models.RoleUser, hash)
 	mock.ExpectQuery(`SELECT .* FROM "user" WHERE username = \$1`).
 		WithArgs("some_user").
 		WillReturnRows(expectedRows)
@@ -71,6 +77,7 @@ func TestGetUserWithCredentials(t *testing.T) {
 	expectedUser := models.User{
 		ID:       testutils.UUIDFromInt(1),
 		Username: "some_user",
+		Role:     models.RoleUser,
 	}
 	assert.Nil(t, err)
 	assert.Equal(t, expectedUser, user)
@@ -82,8 +89,8 @@ func TestGetUserWithCredentialsWrongPassword(t *testing.T) {
 
 	hash, _ := database.HashPassword("password123")
 
-	expectedRows := pgxmock.NewRows([]string{"id", "password_hash"}).
-		AddRow(testutils.UUIDFromInt(1), hash)
+	expectedRows := pgxmock.NewRows([]string{"id", "role", "password_hash"}).
+		AddRow(testutils.UUIDFromInt(1), models.RoleUser, hash)
 	mock.ExpectQuery(`SELECT .* FROM "user" WHERE username = \$1`).
 		WithArgs("some_user").
 		WillReturnRows(expectedRows)
@@ -105,22 +112,34 @@ func TestRegisterUser(t *testing.T) {
 	mock, db := startDatabaseTest(t)
 	defer mock.Close()
 
-	user := models.User{
-		ID:       testutils.UUIDFromInt(1),
-		Username: "some_user",
+	email := "user@example.com"
+	account := models.Account{
+		User: models.User{
+			ID:       testutils.UUIDFromInt(1),
+			Username: "some_user",
+			Role:     models.RoleUser,
+		},
+		Email: &email,
 	}
 
-	mock.ExpectExec(`INSERT INTO "user" \(id, username, password_hash\)`).
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS .* lower\(email\) = lower\(\$2\) AND email_verified AND id <> \$1`).
+		WithArgs(testutils.UUIDFromInt(1), email).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`INSERT INTO "user" \(id, username, role, email, password_hash\)`).
 		WithArgs(
 			testutils.UUIDFromInt(1),
 			"some_user",
+			models.RoleUser,
+			&email,
 			hashMatcher{"password123"},
 		).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
 
 	err := db.RegisterUser(
 		context.Background(),
-		user,
+		account,
 		"password123",
 	)
 
@@ -130,3 +149,253 @@ func TestRegisterUser(t *testing.T) {
 
 	assert.Nil(t, err)
 }
+
+func TestSetUserRole(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	id := testutils.UUIDFromInt(1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "user" SET role = \$2 WHERE id = \$1 RETURNING username, role`).
+		WithArgs(id, models.RoleModerator).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"username", "role"}).AddRow("some_user", models.RoleModerator),
+		)
+	mock.ExpectExec(`INSERT INTO moderation_action`).
+		WithArgs(testutils.UUIDFromInt(2), "setRole", nilUUID, &id, "moderator", pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	user, err := db.SetUserRole(context.Background(), id, models.RoleModerator, testutils.UUIDFromInt(2))
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.User{ID: id, Username: "some_user", Role: models.RoleModerator}, user)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestSetUserRoleNotFound(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "user" SET role`).
+		WithArgs(testutils.UUIDFromInt(1), models.RoleAdmin).
+		WillReturnRows(pgxmock.NewRows([]string{"username", "role"}))
+	mock.ExpectRollback()
+
+	_, err := db.SetUserRole(context.Background(), testutils.UUIDFromInt(1), models.RoleAdmin, testutils.UUIDFromInt(2))
+
+	assert.Equal(t, database.NotFoundErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestRegisterUserDuplicate(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "user" .* ON CONFLICT DO NOTHING`).
+		WithArgs(testutils.UUIDFromInt(1), "ghost", models.RoleUser, (*string)(nil), hashMatcher{"password123"}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	mock.ExpectRollback()
+
+	err := db.RegisterUser(
+		context.Background(),
+		models.Account{User: models.User{ID: testutils.UUIDFromInt(1), Username: "ghost", Role: models.RoleUser}},
+		"password123",
+	)
+
+	assert.Equal(t, database.DuplicateErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+// Addresses can only be added while nobody else has verified them.
+func TestRegisterUserVerifiedEmailTaken(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	email := "taken@example.com"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(testutils.UUIDFromInt(1), email).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	err := db.RegisterUser(
+		context.Background(),
+		models.Account{
+			User:  models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser},
+			Email: &email,
+		},
+		"password123",
+	)
+
+	assert.Equal(t, database.DuplicateEmailErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateAccount(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	email := "new@example.com"
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "user" SET username = \$2 WHERE id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1), "new_name").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(testutils.UUIDFromInt(1), email).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`UPDATE "user" SET email = \$2, email_verified = false WHERE id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1), &email).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`DELETE FROM email_verification WHERE user_id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectExec(`UPDATE "user" SET password_hash = \$2 WHERE id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1), hashMatcher{"new password"}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`DELETE FROM session WHERE user_id = \$1 AND id <> \$2`).
+		WithArgs(testutils.UUIDFromInt(1), testutils.UUIDFromInt(2)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+	mock.ExpectCommit()
+
+	username := "new_name"
+	password := "new password"
+	err := db.UpdateAccount(context.Background(), testutils.UUIDFromInt(1), database.AccountChanges{
+		Username:      &username,
+		ChangeEmail:   true,
+		Email:         &email,
+		Password:      &password,
+		KeepSessionID: testutils.UUIDFromInt(2),
+	})
+
+	assert.Nil(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateAccountDuplicateUsername(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "user" SET username = \$2 WHERE id = \$1`).
+		WithArgs(testutils.UUIDFromInt(1), "taken").
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "username_unique"})
+	mock.ExpectRollback()
+
+	username := "taken"
+	err := db.UpdateAccount(context.Background(), testutils.UUIDFromInt(1), database.AccountChanges{Username: &username})
+
+	assert.Equal(t, database.DuplicateUsernameErr, err)
+	assert.ErrorIs(t, err, database.DuplicateErr)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+// An address someone else has verified rolls back the new username saved
+// before it.
+func TestUpdateAccountDuplicateEmail(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	email := "taken@example.com"
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "user" SET username`).
+		WithArgs(testutils.UUIDFromInt(1), "new_name").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(testutils.UUIDFromInt(1), email).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	username := "new_name"
+	err := db.UpdateAccount(context.Background(), testutils.UUIDFromInt(1), database.AccountChanges{
+		Username:    &username,
+		ChangeEmail: true,
+		Email:       &email,
+	})
+
+	assert.Equal(t, database.DuplicateEmailErr, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfilfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	var tests = map[string]struct {
+		samples           models.SampleDisposal
+		expectedStatement string
+		expectedArgs      []any
+	}{
+		"Delete": {
+			samples:           models.SamplesDelete,
+			expectedStatement: `DELETE FROM codesample WHERE submitted_by_id = \$1`,
+			expectedArgs:      []any{testutils.UUIDFromInt(1)},
+		},
+		"Reassign": {
+			samples:           models.SamplesReassign,
+			expectedStatement: `UPDATE codesample SET submitted_by_id = \$2 WHERE submitted_by_id = \$1`,
+			expectedArgs:      []any{testutils.UUIDFromInt(1), database.GhostUserID},
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			mock, db := startDatabaseTest(t)
+			defer mock.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec(testData.expectedStatement).
+				WithArgs(testData.expectedArgs...).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+			mock.ExpectExec(`UPDATE codesample_revision SET edited_by_id = \$2 WHERE edited_by_id = \$1`).
+				WithArgs(testutils.UUIDFromInt(1), database.GhostUserID).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			mock.ExpectExec(`DELETE FROM "user" WHERE id = \$1`).
+				WithArgs(testutils.UUIDFromInt(1)).
+				WillReturnResult(pgxmock.NewResult("DELETE", 1))
+			mock.ExpectCommit()
+
+			err := db.DeleteUser(context.Background(), testutils.UUIDFromInt(1), testData.samples)
+
+			assert.Nil(t, err)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfilfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestDeleteGhostUser(t *testing.T) {
+	mock, db := startDatabaseTest(t)
+	defer mock.Close()
+
+	err := db.DeleteUser(context.Background(), database.GhostUserID, models.SamplesReassign)
+
+	assert.Equal(t, database.NotFoundErr, err)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/dense-analysis/codelibrary/internal/api/apisession"
 	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/gofiber/fiber/v2"
 )
@@ -24,6 +25,21 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 		))
 	}
 
+	// If an API token is wrong or has expired, the client must authenticate.
+	if errors.Is(err, apisession.InvalidTokenErr) {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+
+		return c.Status(401).JSON(models.NewError(
+			models.NewErrorLocation("invalidToken", "Invalid API token", "header", "Authorization"),
+		))
+	}
+
+	if errors.Is(err, apisession.MissingScopeErr) {
+		return c.Status(403).JSON(models.NewError(
+			models.NewErrorLocation("insufficientScope", "API token does not have the required scope", "header", "Authorization"),
+		))
+	}
+
 	// If we fail to find something from the database, return 404.
 	if errors.Is(err, database.NotFoundErr) {
 		return c.Status(404).JSON(models.NewError(
@@ -31,7 +47,29 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 		))
 	}
 
-	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	if code < fiber.StatusInternalServerError {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+
+		return c.Status(code).SendString(err.Error())
+	}
+
+	// Internal errors are logged for operators, and clients are only told the
+	// request ID, so details of the failure aren't leaked.
+	logging.Logger(c).ErrorContext(
+		c.UserContext(),
+		"request failed",
+		"method", c.Method(),
+		"path", c.Path(),
+		"status", code,
+		"error", err,
+	)
+
+	response := models.NewError(models.ErrorLocation{
+		Type: "internalError",
+		Msg:  "Internal server error",
+		Loc:  []string{},
+	})
+	response.RequestID = logging.RequestID(c)
 
-	return c.Status(code).SendString(err.Error())
+	return c.Status(code).JSON(response)
 }
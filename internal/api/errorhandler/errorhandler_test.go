@@ -0,0 +1,86 @@
+package errorhandler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/errorhandler"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newApp(buffer *bytes.Buffer, err error) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: errorhandler.ErrorHandler})
+	app.Use(logging.RequestIDHandler(slog.New(slog.NewJSONHandler(buffer, nil))))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return err
+	})
+
+	return app
+}
+
+func TestInternalErrorsAreLogged(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+	app := newApp(&buffer, errors.New("connection refused by 10.0.0.5"))
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-ID", "abc-123")
+
+	response, err := app.Test(request)
+
+	if assert.Nil(t, err) {
+		assert.Equal(t, 500, response.StatusCode)
+
+		body, _ := io.ReadAll(response.Body)
+		assert.NotContains(t, string(body), "10.0.0.5")
+
+		var actualError models.Error
+		assert.Nil(t, json.Unmarshal(body, &actualError))
+		assert.Equal(
+			t,
+			models.Error{
+				Detail:    []models.ErrorLocation{{Type: "internalError", Msg: "Internal server error", Loc: []string{}}},
+				RequestID: "abc-123",
+			},
+			actualError,
+		)
+
+		var entry map[string]any
+		assert.Nil(t, json.Unmarshal(buffer.Bytes(), &entry))
+		assert.Equal(t, "ERROR", entry["level"])
+		assert.Equal(t, "abc-123", entry["request_id"])
+		assert.Equal(t, "connection refused by 10.0.0.5", entry["error"])
+		assert.Equal(t, 500.0, entry["status"])
+	}
+}
+
+func TestClientErrorsAreNotLogged(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		err    error
+		status int
+	}{
+		{database.NotFoundErr, 404},
+		{fiber.ErrBadRequest, 400},
+	} {
+		var buffer bytes.Buffer
+		app := newApp(&buffer, test.err)
+
+		response, err := app.Test(httptest.NewRequest("GET", "/", nil))
+
+		if assert.Nil(t, err) {
+			assert.Equal(t, test.status, response.StatusCode)
+			assert.Equal(t, 0, buffer.Len())
+		}
+	}
+}
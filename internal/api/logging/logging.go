@@ -0,0 +1,101 @@
+// Package logging writes structured logs with log/slog, and gives each
+// request an ID so everything logged for it can be found together.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// maxRequestIDLength limits the size of request IDs sent by clients.
+const maxRequestIDLength = 128
+
+type Config struct {
+	// Format is FormatText or FormatJSON.
+	Format string `toml:"format" yaml:"format"`
+	// Level is the least severe level logged, such as debug, info, warn or
+	// error.
+	Level string `toml:"level" yaml:"level"`
+}
+
+// New creates a logger writing to w.
+func New(w io.Writer, config Config) (*slog.Logger, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	switch config.Format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", config.Format)
+	}
+}
+
+// validRequestID checks a request ID from a client is short and printable,
+// so it can be trusted in headers and logs.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, char := range []byte(id) {
+		if char < '!' || char > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequestIDHandler gives each request an ID, taken from the X-Request-ID
+// header if the client sent a valid one, and sends it back in the response.
+// Requests get a logger which includes the ID with everything logged.
+func RequestIDHandler(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set(fiber.HeaderXRequestID, id)
+		c.Locals("requestID", id)
+		c.Locals("logger", logger.With("request_id", id))
+
+		return c.Next()
+	}
+}
+
+// RequestID returns the ID for a request, or an empty string if the request
+// wasn't given one.
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestID").(string)
+
+	return id
+}
+
+// Logger returns the logger for a request, or the default logger if the
+// request wasn't given one.
+func Logger(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals("logger").(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
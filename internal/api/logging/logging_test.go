@@ -0,0 +1,110 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+	logger, err := logging.New(&buffer, logging.Config{Format: logging.FormatJSON, Level: "warn"})
+
+	if assert.Nil(t, err) {
+		logger.Info("hidden")
+		logger.Warn("shown", "count", 3)
+
+		var entry map[string]any
+		assert.Nil(t, json.Unmarshal(buffer.Bytes(), &entry))
+		assert.Equal(t, "WARN", entry["level"])
+		assert.Equal(t, "shown", entry["msg"])
+		assert.Equal(t, 3.0, entry["count"])
+	}
+
+	buffer.Reset()
+	logger, err = logging.New(&buffer, logging.Config{Format: logging.FormatText, Level: "info"})
+
+	if assert.Nil(t, err) {
+		logger.Info("shown")
+		assert.Contains(t, buffer.String(), "level=INFO msg=shown")
+	}
+
+	_, err = logging.New(&buffer, logging.Config{Format: "xml", Level: "info"})
+	assert.NotNil(t, err)
+
+	_, err = logging.New(&buffer, logging.Config{Format: logging.FormatJSON, Level: "loud"})
+	assert.NotNil(t, err)
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+	app := fiber.New()
+	app.Use(logging.RequestIDHandler(slog.New(slog.NewJSONHandler(&buffer, nil))))
+	app.Get("/", func(c *fiber.Ctx) error {
+		logging.Logger(c).Info("handled")
+
+		return c.SendString(logging.RequestID(c))
+	})
+
+	for _, test := range []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"valid", "abc-123", true},
+		{"missing", "", false},
+		{"spaces", "abc 123", false},
+		{"too long", strings.Repeat("a", 129), false},
+	} {
+		buffer.Reset()
+		request := httptest.NewRequest("GET", "/", nil)
+
+		if len(test.header) > 0 {
+			request.Header.Set("X-Request-ID", test.header)
+		}
+
+		response, err := app.Test(request)
+
+		if assert.Nil(t, err, test.name) {
+			id := response.Header.Get("X-Request-ID")
+
+			if test.keep {
+				assert.Equal(t, test.header, id, test.name)
+			} else {
+				_, err := uuid.Parse(id)
+				assert.Nil(t, err, test.name)
+			}
+
+			var entry map[string]any
+			assert.Nil(t, json.Unmarshal(buffer.Bytes(), &entry), test.name)
+			assert.Equal(t, id, entry["request_id"], test.name)
+		}
+	}
+}
+
+func TestLoggerWithoutRequestID(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		assert.Equal(t, "", logging.RequestID(c))
+		assert.Equal(t, slog.Default(), logging.Logger(c))
+
+		return nil
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Nil(t, err)
+}
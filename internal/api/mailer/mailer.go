@@ -0,0 +1,226 @@
+// Package mailer sends emails to users, such as for resetting passwords.
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// headerEscaper stops header values from adding more headers.
+var headerEscaper = strings.NewReplacer("\r", "", "\n", "")
+
+// format writes out a message with headers, ready for sending.
+func format(from string, message Message) []byte {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "From: %s\r\n", headerEscaper.Replace(from))
+	fmt.Fprintf(&builder, "To: %s\r\n", headerEscaper.Replace(message.To))
+	fmt.Fprintf(&builder, "Subject: %s\r\n", headerEscaper.Replace(message.Subject))
+	fmt.Fprintf(&builder, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return []byte(builder.String())
+}
+
+// sendTimeout is the longest sending a message through SMTP can take, for
+// contexts without a deadline.
+const sendTimeout = 30 * time.Second
+
+// SMTPMailer sends messages through an SMTP server.
+type SMTPMailer struct {
+	host string
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer for an SMTP server.
+// Messages are sent without authentication if the username is empty.
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	var auth smtp.Auth
+
+	if len(username) > 0 {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{host: host, addr: net.JoinHostPort(host, port), from: from, auth: auth}
+}
+
+// Send delivers a message like smtp.SendMail, but gives up when the context
+// is done, so a slow server can't hold up requests.
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+
+	if err != nil {
+		return err
+	}
+
+	// Closing the connection when the context is done stops any read or
+	// write in progress.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := m.send(conn, message); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m *SMTPMailer) send(conn net.Conn, message Message) error {
+	client, err := smtp.NewClient(conn, m.host)
+
+	if err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+
+		if err := client.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(message.To); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(format(m.from, message)); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// LogMailer writes messages out instead of sending them, for development
+// and tests.
+type LogMailer struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+func NewLogMailer(writer io.Writer) *LogMailer {
+	return &LogMailer{writer: writer}
+}
+
+// NewFileMailer creates a mailer which appends messages to a file.
+func NewFileMailer(path string) (*LogMailer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLogMailer(file), nil
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, err := fmt.Fprintf(m.writer, "%s\r\n\r\n", format("codelibrary", message))
+
+	return err
+}
+
+// Config is how to deliver email.
+type Config struct {
+	SMTPHost     string `toml:"smtp_host" yaml:"smtp_host"`
+	SMTPPort     string `toml:"smtp_port" yaml:"smtp_port"`
+	SMTPUsername string `toml:"smtp_username" yaml:"smtp_username"`
+	SMTPPassword string `toml:"smtp_password" yaml:"smtp_password"`
+	From         string `toml:"from" yaml:"from"`
+	// File is a file to append messages to instead of sending them.
+	File string `toml:"file" yaml:"file"`
+	// Log writes messages to stdout when nothing else is set. It is only for
+	// development, as anyone reading the logs could use the links in them.
+	Log bool `toml:"log" yaml:"log"`
+}
+
+// NotConfiguredErr is returned when there is no way to deliver messages.
+var NotConfiguredErr = errors.New("no SMTP server, file or log set for email")
+
+// New creates a mailer from configuration.
+//
+// Messages are sent through SMTPHost if it is set, written to File if that
+// is set, and written to stdout if Log is set.
+func New(config Config) (Mailer, error) {
+	if len(config.SMTPHost) > 0 {
+		return NewSMTPMailer(
+			config.SMTPHost,
+			config.SMTPPort,
+			config.SMTPUsername,
+			config.SMTPPassword,
+			config.From,
+		), nil
+	}
+
+	if len(config.File) > 0 {
+		return NewFileMailer(config.File)
+	}
+
+	if config.Log {
+		return NewLogMailer(os.Stdout), nil
+	}
+
+	return nil, NotConfiguredErr
+}
@@ -0,0 +1,160 @@
+package mailer_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buffer bytes.Buffer
+	mail := mailer.NewLogMailer(&buffer)
+
+	err := mail.Send(context.Background(), mailer.Message{
+		To:      "someone@example.com",
+		Subject: "Hello",
+		Body:    "Line one\nLine two",
+	})
+
+	assert.Nil(t, err)
+
+	text := buffer.String()
+	assert.Contains(t, text, "To: someone@example.com\r\n")
+	assert.Contains(t, text, "Subject: Hello\r\n")
+	assert.Contains(t, text, "\r\n\r\nLine one\r\nLine two")
+}
+
+func TestLogMailerHeaderInjection(t *testing.T) {
+	var buffer bytes.Buffer
+	mail := mailer.NewLogMailer(&buffer)
+
+	err := mail.Send(context.Background(), mailer.Message{
+		To:      "someone@example.com\r\nBcc: everyone@example.com",
+		Subject: "Hello",
+	})
+
+	assert.Nil(t, err)
+
+	for _, line := range strings.Split(buffer.String(), "\r\n") {
+		assert.False(t, strings.HasPrefix(line, "Bcc:"))
+	}
+}
+
+func TestNewRequiresDelivery(t *testing.T) {
+	_, err := mailer.New(mailer.Config{})
+
+	assert.ErrorIs(t, err, mailer.NotConfiguredErr)
+
+	mail, err := mailer.New(mailer.Config{Log: true})
+
+	assert.Nil(t, err)
+	assert.IsType(t, &mailer.LogMailer{}, mail)
+}
+
+// startSMTPServer runs a server for one connection, which answers every
+// command and sends back the message data.
+func startSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+	data := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost\r\n"))
+
+		for {
+			line, err := reader.ReadString('\n')
+
+			if err != nil {
+				return
+			}
+
+			switch command := strings.ToUpper(strings.Fields(line)[0]); command {
+			case "DATA":
+				conn.Write([]byte("354 Go ahead\r\n"))
+				var message strings.Builder
+
+				for {
+					line, err := reader.ReadString('\n')
+
+					if err != nil || line == ".\r\n" {
+						break
+					}
+
+					message.WriteString(line)
+				}
+
+				data <- message.String()
+				conn.Write([]byte("250 OK\r\n"))
+			case "QUIT":
+				conn.Write([]byte("221 Bye\r\n"))
+
+				return
+			default:
+				conn.Write([]byte("250 OK\r\n"))
+			}
+		}
+	}()
+
+	return listener.Addr().String(), data
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, data := startSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+	mail := mailer.NewSMTPMailer(host, port, "", "", "codelibrary@example.com")
+
+	err := mail.Send(context.Background(), mailer.Message{
+		To:      "someone@example.com",
+		Subject: "Hello",
+		Body:    "Hi",
+	})
+
+	if assert.Nil(t, err) {
+		text := <-data
+		assert.Contains(t, text, "From: codelibrary@example.com\r\n")
+		assert.Contains(t, text, "To: someone@example.com\r\n")
+	}
+}
+
+func TestSMTPMailerContext(t *testing.T) {
+	// The server accepts connections but never replies.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	mail := mailer.NewSMTPMailer(host, port, "", "", "codelibrary@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = mail.Send(ctx, mailer.Message{To: "someone@example.com"})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,561 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// instrumentedDatabase times every call to a database.
+type instrumentedDatabase struct {
+	db       database.DatabaseAPI
+	duration *prometheus.HistogramVec
+}
+
+// InstrumentDatabase wraps a database so the time taken by each call is
+// recorded, labelled with the method and whether it succeeded.
+// Pass the unwrapped database to RegisterPool.
+func (m *Metrics) InstrumentDatabase(db database.DatabaseAPI) database.DatabaseAPI {
+	return &instrumentedDatabase{db: db, duration: m.databaseDuration}
+}
+
+// databaseResult labels the outcome of a call. Objects not being found or
+// already existing are expected, so they're labelled apart from other errors.
+func databaseResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, database.NotFoundErr):
+		return "not_found"
+	case errors.Is(err, database.DuplicateErr):
+		return "duplicate"
+	default:
+		return "error"
+	}
+}
+
+func (d *instrumentedDatabase) observe(method string, start time.Time, err *error) {
+	d.duration.WithLabelValues(method, databaseResult(*err)).Observe(time.Since(start).Seconds())
+}
+
+func (d *instrumentedDatabase) GetUser(
+	ctx context.Context,
+	id uuid.UUID,
+) (_ models.User, err error) {
+	defer d.observe("GetUser", time.Now(), &err)
+
+	return d.db.GetUser(ctx, id)
+}
+
+func (d *instrumentedDatabase) GetUserWithCredentials(
+	ctx context.Context,
+	username string,
+	password string,
+) (_ models.User, err error) {
+	defer d.observe("GetUserWithCredentials", time.Now(), &err)
+
+	return d.db.GetUserWithCredentials(ctx, username, password)
+}
+
+func (d *instrumentedDatabase) RegisterUser(
+	ctx context.Context,
+	account models.Account,
+	password string,
+) (err error) {
+	defer d.observe("RegisterUser", time.Now(), &err)
+
+	return d.db.RegisterUser(ctx, account, password)
+}
+
+func (d *instrumentedDatabase) UpdateAccount(
+	ctx context.Context,
+	id uuid.UUID,
+	changes database.AccountChanges,
+) (err error) {
+	defer d.observe("UpdateAccount", time.Now(), &err)
+
+	return d.db.UpdateAccount(ctx, id, changes)
+}
+
+func (d *instrumentedDatabase) DeleteUser(
+	ctx context.Context,
+	id uuid.UUID,
+	samples models.SampleDisposal,
+) (err error) {
+	defer d.observe("DeleteUser", time.Now(), &err)
+
+	return d.db.DeleteUser(ctx, id, samples)
+}
+
+func (d *instrumentedDatabase) GetUserByEmail(
+	ctx context.Context,
+	email string,
+) (_ models.User, err error) {
+	defer d.observe("GetUserByEmail", time.Now(), &err)
+
+	return d.db.GetUserByEmail(ctx, email)
+}
+
+func (d *instrumentedDatabase) CreatePasswordReset(
+	ctx context.Context,
+	userID uuid.UUID,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) (err error) {
+	defer d.observe("CreatePasswordReset", time.Now(), &err)
+
+	return d.db.CreatePasswordReset(ctx, userID, hash, created, expires)
+}
+
+func (d *instrumentedDatabase) ResetPassword(
+	ctx context.Context,
+	hash string,
+	password string,
+	now time.Time,
+) (err error) {
+	defer d.observe("ResetPassword", time.Now(), &err)
+
+	return d.db.ResetPassword(ctx, hash, password, now)
+}
+
+func (d *instrumentedDatabase) GetAccount(
+	ctx context.Context,
+	id uuid.UUID,
+) (_ models.Account, err error) {
+	defer d.observe("GetAccount", time.Now(), &err)
+
+	return d.db.GetAccount(ctx, id)
+}
+
+func (d *instrumentedDatabase) CreateEmailVerification(
+	ctx context.Context,
+	userID uuid.UUID,
+	email string,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) (err error) {
+	defer d.observe("CreateEmailVerification", time.Now(), &err)
+
+	return d.db.CreateEmailVerification(ctx, userID, email, hash, created, expires)
+}
+
+func (d *instrumentedDatabase) VerifyEmail(
+	ctx context.Context,
+	hash string,
+	now time.Time,
+) (err error) {
+	defer d.observe("VerifyEmail", time.Now(), &err)
+
+	return d.db.VerifyEmail(ctx, hash, now)
+}
+
+func (d *instrumentedDatabase) GetLoginLockout(
+	ctx context.Context,
+	keys []string,
+	now time.Time,
+) (_ time.Time, err error) {
+	defer d.observe("GetLoginLockout", time.Now(), &err)
+
+	return d.db.GetLoginLockout(ctx, keys, now)
+}
+
+func (d *instrumentedDatabase) RecordLoginFailure(
+	ctx context.Context,
+	key string,
+	now time.Time,
+	resetBefore time.Time,
+) (_ int, err error) {
+	defer d.observe("RecordLoginFailure", time.Now(), &err)
+
+	return d.db.RecordLoginFailure(ctx, key, now, resetBefore)
+}
+
+func (d *instrumentedDatabase) LockLogin(
+	ctx context.Context,
+	key string,
+	failures int,
+	until time.Time,
+	now time.Time,
+) (err error) {
+	defer d.observe("LockLogin", time.Now(), &err)
+
+	return d.db.LockLogin(ctx, key, failures, until, now)
+}
+
+func (d *instrumentedDatabase) ClearLoginFailures(ctx context.Context, key string) (err error) {
+	defer d.observe("ClearLoginFailures", time.Now(), &err)
+
+	return d.db.ClearLoginFailures(ctx, key)
+}
+
+func (d *instrumentedDatabase) GetTOTP(
+	ctx context.Context,
+	userID uuid.UUID,
+) (_ models.TOTP, err error) {
+	defer d.observe("GetTOTP", time.Now(), &err)
+
+	return d.db.GetTOTP(ctx, userID)
+}
+
+func (d *instrumentedDatabase) SetTOTP(ctx context.Context, totp models.TOTP) (err error) {
+	defer d.observe("SetTOTP", time.Now(), &err)
+
+	return d.db.SetTOTP(ctx, totp)
+}
+
+func (d *instrumentedDatabase) ConfirmTOTP(
+	ctx context.Context,
+	userID uuid.UUID,
+	step int64,
+	recoveryHashes []string,
+) (err error) {
+	defer d.observe("ConfirmTOTP", time.Now(), &err)
+
+	return d.db.ConfirmTOTP(ctx, userID, step, recoveryHashes)
+}
+
+func (d *instrumentedDatabase) UseTOTPStep(
+	ctx context.Context,
+	userID uuid.UUID,
+	step int64,
+) (err error) {
+	defer d.observe("UseTOTPStep", time.Now(), &err)
+
+	return d.db.UseTOTPStep(ctx, userID, step)
+}
+
+func (d *instrumentedDatabase) UseRecoveryCode(
+	ctx context.Context,
+	userID uuid.UUID,
+	hash string,
+) (err error) {
+	defer d.observe("UseRecoveryCode", time.Now(), &err)
+
+	return d.db.UseRecoveryCode(ctx, userID, hash)
+}
+
+func (d *instrumentedDatabase) DeleteTOTP(ctx context.Context, userID uuid.UUID) (err error) {
+	defer d.observe("DeleteTOTP", time.Now(), &err)
+
+	return d.db.DeleteTOTP(ctx, userID)
+}
+
+func (d *instrumentedDatabase) CreatePendingLogin(
+	ctx context.Context,
+	userID uuid.UUID,
+	hash string,
+	created time.Time,
+	expires time.Time,
+) (err error) {
+	defer d.observe("CreatePendingLogin", time.Now(), &err)
+
+	return d.db.CreatePendingLogin(ctx, userID, hash, created, expires)
+}
+
+func (d *instrumentedDatabase) GetPendingLogin(
+	ctx context.Context,
+	hash string,
+	now time.Time,
+) (_ models.User, err error) {
+	defer d.observe("GetPendingLogin", time.Now(), &err)
+
+	return d.db.GetPendingLogin(ctx, hash, now)
+}
+
+func (d *instrumentedDatabase) DeletePendingLogin(ctx context.Context, hash string) (err error) {
+	defer d.observe("DeletePendingLogin", time.Now(), &err)
+
+	return d.db.DeletePendingLogin(ctx, hash)
+}
+
+func (d *instrumentedDatabase) GetExternalIdentityUser(
+	ctx context.Context,
+	issuer string,
+	subject string,
+) (_ models.User, err error) {
+	defer d.observe("GetExternalIdentityUser", time.Now(), &err)
+
+	return d.db.GetExternalIdentityUser(ctx, issuer, subject)
+}
+
+func (d *instrumentedDatabase) CreateExternalUser(
+	ctx context.Context,
+	account models.Account,
+	identity models.ExternalIdentity,
+) (_ models.User, err error) {
+	defer d.observe("CreateExternalUser", time.Now(), &err)
+
+	return d.db.CreateExternalUser(ctx, account, identity)
+}
+
+func (d *instrumentedDatabase) SetUserRole(
+	ctx context.Context,
+	id uuid.UUID,
+	role models.Role,
+	actorID uuid.UUID,
+) (_ models.User, err error) {
+	defer d.observe("SetUserRole", time.Now(), &err)
+
+	return d.db.SetUserRole(ctx, id, role, actorID)
+}
+
+func (d *instrumentedDatabase) CreateSession(
+	ctx context.Context,
+	session models.Session,
+) (err error) {
+	defer d.observe("CreateSession", time.Now(), &err)
+
+	return d.db.CreateSession(ctx, session)
+}
+
+func (d *instrumentedDatabase) GetSessionUser(
+	ctx context.Context,
+	id uuid.UUID,
+	lastSeen time.Time,
+	expires time.Time,
+) (_ models.User, err error) {
+	defer d.observe("GetSessionUser", time.Now(), &err)
+
+	return d.db.GetSessionUser(ctx, id, lastSeen, expires)
+}
+
+func (d *instrumentedDatabase) GetSession(
+	ctx context.Context,
+	id uuid.UUID,
+	now time.Time,
+) (_ models.Session, err error) {
+	defer d.observe("GetSession", time.Now(), &err)
+
+	return d.db.GetSession(ctx, id, now)
+}
+
+func (d *instrumentedDatabase) ListSessions(
+	ctx context.Context,
+	userID uuid.UUID,
+	now time.Time,
+) (_ []models.Session, err error) {
+	defer d.observe("ListSessions", time.Now(), &err)
+
+	return d.db.ListSessions(ctx, userID, now)
+}
+
+func (d *instrumentedDatabase) DeleteSession(ctx context.Context, id uuid.UUID) (err error) {
+	defer d.observe("DeleteSession", time.Now(), &err)
+
+	return d.db.DeleteSession(ctx, id)
+}
+
+func (d *instrumentedDatabase) DeleteUserSession(
+	ctx context.Context,
+	userID uuid.UUID,
+	id uuid.UUID,
+) (err error) {
+	defer d.observe("DeleteUserSession", time.Now(), &err)
+
+	return d.db.DeleteUserSession(ctx, userID, id)
+}
+
+func (d *instrumentedDatabase) CreateAPIToken(
+	ctx context.Context,
+	token models.APIToken,
+	hash string,
+) (err error) {
+	defer d.observe("CreateAPIToken", time.Now(), &err)
+
+	return d.db.CreateAPIToken(ctx, token, hash)
+}
+
+func (d *instrumentedDatabase) GetAPITokenUser(
+	ctx context.Context,
+	hash string,
+	now time.Time,
+) (_ models.User, _ models.APIToken, err error) {
+	defer d.observe("GetAPITokenUser", time.Now(), &err)
+
+	return d.db.GetAPITokenUser(ctx, hash, now)
+}
+
+func (d *instrumentedDatabase) GetAPITokenID(
+	ctx context.Context,
+	hash string,
+	now time.Time,
+) (_ uuid.UUID, err error) {
+	defer d.observe("GetAPITokenID", time.Now(), &err)
+
+	return d.db.GetAPITokenID(ctx, hash, now)
+}
+
+func (d *instrumentedDatabase) ListAPITokens(
+	ctx context.Context,
+	userID uuid.UUID,
+) (_ []models.APIToken, err error) {
+	defer d.observe("ListAPITokens", time.Now(), &err)
+
+	return d.db.ListAPITokens(ctx, userID)
+}
+
+func (d *instrumentedDatabase) DeleteAPIToken(
+	ctx context.Context,
+	userID uuid.UUID,
+	id uuid.UUID,
+) (err error) {
+	defer d.observe("DeleteAPIToken", time.Now(), &err)
+
+	return d.db.DeleteAPIToken(ctx, userID, id)
+}
+
+func (d *instrumentedDatabase) GetLanguage(
+	ctx context.Context,
+	id string,
+) (_ models.Language, err error) {
+	defer d.observe("GetLanguage", time.Now(), &err)
+
+	return d.db.GetLanguage(ctx, id)
+}
+
+func (d *instrumentedDatabase) ListLanguages(
+	ctx context.Context,
+	includeRetired bool,
+) (_ []models.LanguageSummary, err error) {
+	defer d.observe("ListLanguages", time.Now(), &err)
+
+	return d.db.ListLanguages(ctx, includeRetired)
+}
+
+func (d *instrumentedDatabase) GetLanguageSummary(
+	ctx context.Context,
+	id string,
+) (_ models.LanguageSummary, err error) {
+	defer d.observe("GetLanguageSummary", time.Now(), &err)
+
+	return d.db.GetLanguageSummary(ctx, id)
+}
+
+func (d *instrumentedDatabase) CreateLanguage(
+	ctx context.Context,
+	language models.Language,
+) (err error) {
+	defer d.observe("CreateLanguage", time.Now(), &err)
+
+	return d.db.CreateLanguage(ctx, language)
+}
+
+func (d *instrumentedDatabase) RenameLanguage(
+	ctx context.Context,
+	id string,
+	name string,
+) (err error) {
+	defer d.observe("RenameLanguage", time.Now(), &err)
+
+	return d.db.RenameLanguage(ctx, id, name)
+}
+
+func (d *instrumentedDatabase) RetireLanguage(ctx context.Context, id string) (err error) {
+	defer d.observe("RetireLanguage", time.Now(), &err)
+
+	return d.db.RetireLanguage(ctx, id)
+}
+
+func (d *instrumentedDatabase) FindCodeSamples(
+	ctx context.Context,
+	search models.CodeSampleSearch,
+) (_ models.CodeSamplePage, err error) {
+	defer d.observe("FindCodeSamples", time.Now(), &err)
+
+	return d.db.FindCodeSamples(ctx, search)
+}
+
+func (d *instrumentedDatabase) FindCodeSampleSummaries(
+	ctx context.Context,
+	search models.CodeSampleSearch,
+) (_ models.CodeSampleSummaryPage, err error) {
+	defer d.observe("FindCodeSampleSummaries", time.Now(), &err)
+
+	return d.db.FindCodeSampleSummaries(ctx, search)
+}
+
+func (d *instrumentedDatabase) GetCodeSample(
+	ctx context.Context,
+	id uuid.UUID,
+) (_ models.CodeSample, err error) {
+	defer d.observe("GetCodeSample", time.Now(), &err)
+
+	return d.db.GetCodeSample(ctx, id)
+}
+
+func (d *instrumentedDatabase) CreateCodeSample(
+	ctx context.Context,
+	sample models.CodeSample,
+) (err error) {
+	defer d.observe("CreateCodeSample", time.Now(), &err)
+
+	return d.db.CreateCodeSample(ctx, sample)
+}
+
+func (d *instrumentedDatabase) UpdateCodeSample(
+	ctx context.Context,
+	sample models.CodeSample,
+	editorID uuid.UUID,
+) (err error) {
+	defer d.observe("UpdateCodeSample", time.Now(), &err)
+
+	return d.db.UpdateCodeSample(ctx, sample, editorID)
+}
+
+func (d *instrumentedDatabase) DeleteCodeSample(
+	ctx context.Context,
+	id uuid.UUID,
+	actorID uuid.UUID,
+) (err error) {
+	defer d.observe("DeleteCodeSample", time.Now(), &err)
+
+	return d.db.DeleteCodeSample(ctx, id, actorID)
+}
+
+func (d *instrumentedDatabase) ListCodeSampleRevisions(
+	ctx context.Context,
+	id uuid.UUID,
+) (_ []models.CodeSampleRevision, err error) {
+	defer d.observe("ListCodeSampleRevisions", time.Now(), &err)
+
+	return d.db.ListCodeSampleRevisions(ctx, id)
+}
+
+func (d *instrumentedDatabase) GetCodeSampleRevision(
+	ctx context.Context,
+	id uuid.UUID,
+	revision uint64,
+) (_ models.CodeSampleRevision, err error) {
+	defer d.observe("GetCodeSampleRevision", time.Now(), &err)
+
+	return d.db.GetCodeSampleRevision(ctx, id, revision)
+}
+
+func (d *instrumentedDatabase) ListTags(ctx context.Context) (_ []models.TagSummary, err error) {
+	defer d.observe("ListTags", time.Now(), &err)
+
+	return d.db.ListTags(ctx)
+}
+
+func (d *instrumentedDatabase) GetSchemaVersion(ctx context.Context) (_ int, err error) {
+	defer d.observe("GetSchemaVersion", time.Now(), &err)
+
+	return d.db.GetSchemaVersion(ctx)
+}
+
+func (d *instrumentedDatabase) Ping(ctx context.Context) (err error) {
+	defer d.observe("Ping", time.Now(), &err)
+
+	return d.db.Ping(ctx)
+}
+
+func (d *instrumentedDatabase) Close() {
+	d.db.Close()
+}
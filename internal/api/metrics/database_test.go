@@ -0,0 +1,63 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentDatabase(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	mock := databasemock.New()
+	db := m.InstrumentDatabase(mock)
+	id := uuid.New()
+
+	mock.GetCodeSampleResult.A = models.CodeSample{ID: id}
+	sample, err := db.GetCodeSample(context.Background(), id)
+
+	assert.Nil(t, err)
+	assert.Equal(t, id, sample.ID, "Results should be passed through")
+	assert.Equal(t, [][]any{{id}}, mock.GetCalls("GetCodeSample"), "Arguments should be passed through")
+
+	mock.GetCodeSampleResult.B = database.NotFoundErr
+	_, err = db.GetCodeSample(context.Background(), id)
+	assert.Equal(t, database.NotFoundErr, err)
+
+	mock.CreateLanguageResult = database.DuplicateErr
+	db.CreateLanguage(context.Background(), models.Language{})
+	mock.CreateLanguageResult = errors.New("connection reset")
+	db.CreateLanguage(context.Background(), models.Language{})
+	db.CreateLanguage(context.Background(), models.Language{})
+
+	for _, test := range []struct {
+		method   string
+		result   string
+		expected uint64
+	}{
+		{"GetCodeSample", "ok", 1},
+		{"GetCodeSample", "not_found", 1},
+		{"CreateLanguage", "duplicate", 1},
+		{"CreateLanguage", "error", 2},
+		{"CreateLanguage", "ok", 0},
+	} {
+		assert.Equal(
+			t,
+			test.expected,
+			histogramCount(t, m.Registry, "codelibrary_database_call_duration_seconds", map[string]string{
+				"method": test.method,
+				"result": test.result,
+			}),
+			"%s %s",
+			test.method,
+			test.result,
+		)
+	}
+}
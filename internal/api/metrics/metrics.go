@@ -0,0 +1,130 @@
+// Package metrics records Prometheus metrics for requests, database calls and
+// events such as code samples being created, and serves them for scraping.
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/routeinfo"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "codelibrary"
+
+// Counters for events, which are shared by every registry so handlers can
+// count events without being passed the metrics.
+var (
+	CodeSamplesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "code_samples_created_total",
+		Help:      "Code samples created.",
+	})
+	LoginsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_failed_total",
+		Help:      "Logins refused because of a wrong password or code.",
+	})
+	UsersRegistered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_registered_total",
+		Help:      "Accounts created, by how they were created.",
+	}, []string{"method"})
+)
+
+// Metrics holds the collectors for an instance of the app.
+type Metrics struct {
+	Registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	databaseDuration *prometheus.HistogramVec
+}
+
+// New creates a registry with metrics for requests, database calls, events,
+// and the Go runtime and process.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "How long HTTP requests take, by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		databaseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "database",
+			Name:      "call_duration_seconds",
+			Help:      "How long database calls take, by method and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "result"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.databaseDuration,
+		CodeSamplesCreated,
+		LoginsFailed,
+		UsersRegistered,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{}))
+}
+
+// statusCode returns the status a request will be sent with, including for
+// errors which haven't been through the error handler yet.
+func statusCode(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+
+	var fiberError *fiber.Error
+
+	if errors.As(err, &fiberError) {
+		return fiberError.Code
+	}
+
+	return fiber.StatusInternalServerError
+}
+
+// RequestHandler counts requests and times them, labelled with the route
+// template such as /api/code/:id rather than the path.
+func (m *Metrics) RequestHandler() fiber.Handler {
+	var matcher routeinfo.Matcher
+
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		duration := time.Since(start)
+
+		labels := prometheus.Labels{
+			"method": c.Method(),
+			"route":  matcher.Route(c),
+			"status": strconv.Itoa(statusCode(c, err)),
+		}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(duration.Seconds())
+
+		return err
+	}
+}
@@ -0,0 +1,111 @@
+package metrics_test
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// histogramCount returns how many observations a histogram has for some
+// labels.
+func histogramCount(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) uint64 {
+	t.Helper()
+	families, err := registry.Gather()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+
+			return metric.GetHistogram().GetSampleCount()
+		}
+	}
+
+	return 0
+}
+
+func TestRequestHandler(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	app := fiber.New()
+	app.Use(m.RequestHandler())
+	app.Use("/api/languages", func(c *fiber.Ctx) error {
+		return c.SendStatus(429)
+	})
+	app.Get("/api/code/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "missing" {
+			return fiber.ErrNotFound
+		}
+
+		if c.Params("id") == "broken" {
+			return errors.New("broken")
+		}
+
+		return c.SendStatus(200)
+	})
+
+	for _, path := range []string{"/api/code/1", "/api/code/2", "/api/code/missing", "/api/code/broken", "/nowhere", "/api/languages"} {
+		_, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.Nil(t, err)
+	}
+
+	err := testutil.GatherAndCompare(m.Registry, strings.NewReader(`
+# HELP codelibrary_http_requests_total HTTP requests, by method, route and status.
+# TYPE codelibrary_http_requests_total counter
+codelibrary_http_requests_total{method="GET",route="/api/code/:id",status="200"} 2
+codelibrary_http_requests_total{method="GET",route="/api/code/:id",status="404"} 1
+codelibrary_http_requests_total{method="GET",route="/api/code/:id",status="500"} 1
+codelibrary_http_requests_total{method="GET",route="unmatched",status="404"} 1
+codelibrary_http_requests_total{method="GET",route="unmatched",status="429"} 1
+`), "codelibrary_http_requests_total")
+	assert.Nil(t, err)
+
+	assert.Equal(
+		t,
+		uint64(2),
+		histogramCount(t, m.Registry, "codelibrary_http_request_duration_seconds", map[string]string{
+			"method": "GET",
+			"route":  "/api/code/:id",
+			"status": "200",
+		}),
+	)
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	app := fiber.New()
+	app.Get("/metrics", m.Handler())
+
+	response, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, response.StatusCode)
+
+	body, err := io.ReadAll(response.Body)
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "codelibrary_code_samples_created_total")
+	assert.Contains(t, string(body), "codelibrary_logins_failed_total")
+	assert.Contains(t, string(body), "go_goroutines")
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func poolDesc(name string, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "database_pool", name), help, nil, nil)
+}
+
+var (
+	poolAcquiredDesc        = poolDesc("acquired_connections", "Connections in use.")
+	poolIdleDesc            = poolDesc("idle_connections", "Connections waiting to be used.")
+	poolTotalDesc           = poolDesc("total_connections", "Connections open or being opened.")
+	poolMaxDesc             = poolDesc("max_connections", "The most connections the pool will open.")
+	poolAcquiresDesc        = poolDesc("acquires_total", "Connections taken from the pool.")
+	poolWaitsDesc           = poolDesc("waits_total", "Connections taken from the pool which had to wait for one.")
+	poolCanceledDesc        = poolDesc("canceled_acquires_total", "Attempts to take a connection which were cancelled.")
+	poolAcquireDurationDesc = poolDesc("acquire_duration_seconds_total", "Time spent taking connections from the pool.")
+)
+
+// poolCollector reads statistics from a pgx pool each time metrics are
+// collected.
+type poolCollector struct {
+	stat func() *pgxpool.Stat
+}
+
+func (p poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredDesc
+	ch <- poolIdleDesc
+	ch <- poolTotalDesc
+	ch <- poolMaxDesc
+	ch <- poolAcquiresDesc
+	ch <- poolWaitsDesc
+	ch <- poolCanceledDesc
+	ch <- poolAcquireDurationDesc
+}
+
+func (p poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := p.stat()
+
+	if stat == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWaitsDesc, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledDesc, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(
+		poolAcquireDurationDesc,
+		prometheus.CounterValue,
+		stat.AcquireDuration().Seconds(),
+	)
+}
+
+// RegisterPool adds statistics for the connection pool of a database, which
+// must not be wrapped by InstrumentDatabase. Nothing is reported for databases
+// without a pgx pool.
+func (m *Metrics) RegisterPool(db database.DatabaseAPI) {
+	m.Registry.MustRegister(poolCollector{stat: func() *pgxpool.Stat {
+		return database.PoolStat(db)
+	}})
+}
@@ -0,0 +1,52 @@
+package metrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterPool(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	// Pools don't connect until they're used.
+	db, err := database.New(context.Background(), database.Config{
+		URL:      "postgres://postgres@localhost:1/codelibrary",
+		MaxConns: 4,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	m.RegisterPool(db)
+
+	err = testutil.GatherAndCompare(m.Registry, strings.NewReader(`
+# HELP codelibrary_database_pool_acquired_connections Connections in use.
+# TYPE codelibrary_database_pool_acquired_connections gauge
+codelibrary_database_pool_acquired_connections 0
+# HELP codelibrary_database_pool_max_connections The most connections the pool will open.
+# TYPE codelibrary_database_pool_max_connections gauge
+codelibrary_database_pool_max_connections 4
+`), "codelibrary_database_pool_acquired_connections", "codelibrary_database_pool_max_connections")
+	assert.Nil(t, err)
+}
+
+func TestRegisterPoolWithoutPool(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	m.RegisterPool(databasemock.New())
+
+	count, err := testutil.GatherAndCount(m.Registry, "codelibrary_database_pool_max_connections")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
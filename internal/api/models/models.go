@@ -18,6 +18,10 @@ type ErrorLocation struct {
 // The structure matches data typically generated by Python apps.
 type Error struct {
 	Detail []ErrorLocation `json:"detail"`
+	// RetryAfter is how many seconds to wait before trying again, for 429 errors.
+	RetryAfter int `json:"retryAfter,omitempty" example:"30"`
+	// RequestID identifies the request in the logs, for 500 errors.
+	RequestID string `json:"requestId,omitempty" example:"4b4c5e5e-8b1a-4bd8-9d0c-0b5a3c1c2a7e"`
 } //@name Error
 
 // NewErrorLocation creates a new error location object to return in a response.
@@ -39,31 +43,396 @@ func NewBodyError(_type string, msg string) Error {
 type Page[T any] struct {
 	Results []T    `json:"results"`
 	Count   uint64 `json:"count" example:"1"`
+	// Facets are counts for a search, when they are requested.
+	Facets *CodeSampleFacets `json:"facets,omitempty"`
+	// NextCursor continues from the end of this page, if there are more results.
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 type Language struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Retired bool   `json:"retired"`
 } //@name Language
 
+// LanguageSummary is a language along with how many samples use it.
+type LanguageSummary struct {
+	Language
+	SampleCount uint64 `json:"sampleCount" example:"1"`
+} //@name LanguageSummary
+
+type LanguageSubmission struct {
+	ID   string `json:"id" example:"python"`
+	Name string `json:"name" example:"Python"`
+} //@name LanguageSubmission
+
+type LanguageRename struct {
+	Name string `json:"name" example:"Python"`
+} //@name LanguageRename
+
+// Role is the permission level for a user.
+type Role string //@name Role
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is something a role allows a user to do.
+type Permission string
+
+const (
+	// PermissionModerateSamples allows editing and deleting any code sample.
+	PermissionModerateSamples Permission = "moderateSamples"
+	PermissionManageLanguages Permission = "manageLanguages"
+	PermissionManageRoles     Permission = "manageRoles"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {PermissionModerateSamples},
+	RoleAdmin: {
+		PermissionModerateSamples,
+		PermissionManageLanguages,
+		PermissionManageRoles,
+	},
+}
+
+// Valid returns true if a role is one we know about.
+func (role Role) Valid() bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+
+	return false
+}
+
+// Can returns true if a role grants a permission.
+func (role Role) Can(permission Permission) bool {
+	for _, rolePermission := range rolePermissions[role] {
+		if rolePermission == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
 type User struct {
 	ID       uuid.UUID `json:"id"`
 	Username string    `json:"username"`
+	Role     Role      `json:"role" example:"user"`
 } //@name User
 
+// Account is a user along with private details only they can see.
+type Account struct {
+	User
+	Email         *string `json:"email" example:"user@example.com"`
+	EmailVerified bool    `json:"emailVerified"`
+	// TwoFactorEnabled is true once TOTP enrolment has been confirmed.
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
+	// HasPassword is false for users who only log in with a provider.
+	HasPassword bool `json:"hasPassword"`
+} //@name Account
+
+// Session is a login for a user from one device.
+type Session struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"-"`
+	UserAgent string    `json:"userAgent"`
+	IPAddress string    `json:"ipAddress"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Expires   time.Time `json:"expires"`
+	// Current is true for the session making the request.
+	Current bool `json:"current"`
+	// Reauthenticated is true for sessions from logging in again with a
+	// provider which confirmed the user was there.
+	Reauthenticated bool `json:"-"`
+} //@name Session
+
+// Scope is a permission granted to a personal API token.
+type Scope string //@name Scope
+
+const (
+	ScopeSamplesRead  Scope = "samples:read"
+	ScopeSamplesWrite Scope = "samples:write"
+)
+
+// APIToken is a personal access token for scripts and editor clients.
+// Only a hash of the token is stored, so the token itself can't be shown.
+type APIToken struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"-"`
+	Name   string    `json:"name"`
+	Scopes []Scope   `json:"scopes" example:"samples:read,samples:write"`
+	// Expires is nil for tokens that never expire.
+	Expires  *time.Time `json:"expires"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastUsed"`
+} //@name APIToken
+
+// HasScope returns true if the token grants a scope.
+func (token APIToken) HasScope(scope Scope) bool {
+	for _, tokenScope := range token.Scopes {
+		if tokenScope == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewAPIToken is a newly created token, which is the only time the token
+// is available.
+type NewAPIToken struct {
+	APIToken
+	Token string `json:"token"`
+} //@name NewAPIToken
+
+type APITokenSubmission struct {
+	Name    string     `json:"name"`
+	Scopes  []Scope    `json:"scopes" example:"samples:read,samples:write"`
+	Expires *time.Time `json:"expires"`
+} //@name APITokenSubmission
+
+type RoleAssignment struct {
+	Role Role `json:"role" example:"moderator"`
+} //@name RoleAssignment
+
+// UserUpdate changes the details for the current user.
+// Fields which are left out are not changed.
+type UserUpdate struct {
+	Username *string `json:"username"`
+	// CurrentPassword is required for changing the password.
+	CurrentPassword string  `json:"currentPassword" example:"password"`
+	NewPassword     *string `json:"newPassword" example:"new password"`
+	ConfirmPassword string  `json:"confirmPassword" example:"new password"`
+	// Email sets a new address to verify, or removes the address if empty.
+	Email *string `json:"email" example:"user@example.com"`
+} //@name UserUpdate
+
+// SampleDisposal is what happens to the samples for a deleted account.
+type SampleDisposal string //@name SampleDisposal
+
+const (
+	SamplesDelete SampleDisposal = "delete"
+	// SamplesReassign keeps samples, credited to a "ghost" user.
+	SamplesReassign SampleDisposal = "reassign"
+)
+
+type AccountDeletion struct {
+	Password string         `json:"password" example:"password"`
+	Samples  SampleDisposal `json:"samples" example:"reassign"`
+} //@name AccountDeletion
+
+type PasswordResetRequest struct {
+	Email string `json:"email" example:"someone@example.com"`
+} //@name PasswordResetRequest
+
+type PasswordResetConfirmation struct {
+	// Token is the token sent in the password reset email.
+	Token           string `json:"token"`
+	Password        string `json:"password" example:"password"`
+	ConfirmPassword string `json:"confirmPassword" example:"password"`
+} //@name PasswordResetConfirmation
+
+// TOTP is a TOTP secret for two-factor authentication.
+type TOTP struct {
+	UserID    uuid.UUID
+	Secret    string
+	Confirmed bool
+	Created   time.Time
+}
+
+// ExternalIdentity links a user to the subject an OpenID Connect provider
+// gives them.
+type ExternalIdentity struct {
+	UserID  uuid.UUID
+	Issuer  string
+	Subject string
+	Created time.Time
+}
+
+// TOTPEnrolment is a new secret for adding to an authenticator app.
+type TOTPEnrolment struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	// URI is an otpauth:// URI, which can be shown as a QR code.
+	URI string `json:"uri"`
+} //@name TOTPEnrolment
+
+type TOTPCode struct {
+	Code string `json:"code" example:"123456"`
+} //@name TOTPCode
+
+// RecoveryCodes can each be used once instead of a TOTP code.
+// They are only shown once.
+type RecoveryCodes struct {
+	Codes []string `json:"codes" example:"abcde-fghij"`
+} //@name RecoveryCodes
+
+type TwoFactorRemoval struct {
+	Password string `json:"password" example:"password"`
+} //@name TwoFactorRemoval
+
+// PendingLogin is returned instead of a user when a login needs a second
+// factor. The token is exchanged for a session with a code.
+type PendingLogin struct {
+	PendingToken string    `json:"pendingToken"`
+	Expires      time.Time `json:"expires"`
+} //@name PendingLogin
+
+// TwoFactorLogin completes a login with either a TOTP code or a recovery code.
+type TwoFactorLogin struct {
+	PendingToken string `json:"pendingToken"`
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recoveryCode"`
+} //@name TwoFactorLogin
+
+type EmailVerification struct {
+	// Token is the token sent in the verification email.
+	Token string `json:"token"`
+} //@name EmailVerification
+
 type RegisterUser struct {
 	Username        string `json:"username"`
 	Password        string `json:"password" example:"password"`
 	ConfirmPassword string `json:"confirmPassword" example:"password"`
+	// Email is optional, and a link for verifying it is sent if it is set.
+	Email string `json:"email" example:"user@example.com"`
 } //@name RegisterUser
 
+// Status is the response for health checks.
+type Status struct {
+	Status string `json:"status" example:"ok"`
+} //@name Status
+
+// Version describes the build of the app and the database schema.
+type Version struct {
+	Commit    string `json:"commit" example:"3babd66"`
+	BuildTime string `json:"buildTime" example:"2023-09-01T12:00:00Z"`
+	// SchemaVersion is the database schema version the app needs.
+	SchemaVersion int `json:"schemaVersion" example:"1"`
+	// DatabaseSchemaVersion is the schema version of the database, which is
+	// null if the database can't be reached.
+	DatabaseSchemaVersion *int `json:"databaseSchemaVersion" example:"1"`
+} //@name Version
+
+// TagSummary is a tag along with how many samples use it.
+type TagSummary struct {
+	Name        string `json:"name" example:"concurrency"`
+	SampleCount uint64 `json:"sampleCount" example:"1"`
+} //@name TagSummary
+
+// LanguageFacet is the number of search results for a language.
+type LanguageFacet struct {
+	Language Language `json:"language"`
+	Count    uint64   `json:"count" example:"1"`
+} //@name LanguageFacet
+
+// AuthorFacet is the number of search results submitted by a user.
+type AuthorFacet struct {
+	Author User   `json:"author"`
+	Count  uint64 `json:"count" example:"1"`
+} //@name AuthorFacet
+
+// CodeSampleFacets are counts of search results for other filter values.
+// Each facet is counted ignoring its own filter, so the counts show how many
+// results there would be if the filter was changed.
+type CodeSampleFacets struct {
+	Languages []LanguageFacet `json:"languages"`
+	// Authors are the users with the most results.
+	Authors []AuthorFacet `json:"authors"`
+} //@name CodeSampleFacets
+
+// CodeSampleSort is a field code samples can be sorted by.
+type CodeSampleSort string //@name CodeSampleSort
+
+const (
+	SortRelevance CodeSampleSort = "relevance"
+	SortCreated   CodeSampleSort = "created"
+	SortModified  CodeSampleSort = "modified"
+	SortTitle     CodeSampleSort = "title"
+)
+
+// SortOrder is the direction results are sorted in.
+type SortOrder string //@name SortOrder
+
+const (
+	OrderAscending  SortOrder = "asc"
+	OrderDescending SortOrder = "desc"
+)
+
+// DefaultOrder returns the order used for a sort when none is given.
+// Titles are sorted alphabetically, and everything else highest first.
+func (s CodeSampleSort) DefaultOrder() SortOrder {
+	if s == SortTitle {
+		return OrderAscending
+	}
+
+	return OrderDescending
+}
+
+// SearchMode is how the text query for code samples is interpreted.
+type SearchMode string //@name SearchMode
+
+const (
+	// ModeText searches words in English, with stemming.
+	ModeText SearchMode = "text"
+	// ModeCode searches for substrings and identifiers in code.
+	ModeCode SearchMode = "code"
+)
+
+// CodeSampleView is how code samples are represented in a list.
+type CodeSampleView string //@name CodeSampleView
+
+const (
+	ViewFull    CodeSampleView = "full"
+	ViewSummary CodeSampleView = "summary"
+)
+
 type CodeSampleSearch struct {
-	Query     string   `query:"q"`
+	Query string `query:"q"`
+	// Mode defaults to text search.
+	Mode SearchMode `query:"mode"`
+	// CaseSensitive makes code searches match case exactly.
+	CaseSensitive bool `query:"caseSensitive"`
+	// Regex filters for samples with bodies matching an RE2 expression.
+	Regex     string   `query:"regex"`
 	Languages []string `query:"languages"`
-	Page      uint64   `query:"page"`
-	PageSize  uint64   `query:"pageSize"`
+	// Tags filters for samples with all of the given tags.
+	Tags []string `query:"tags"`
+	// AnyTags filters for samples with at least one of the given tags.
+	AnyTags []string `query:"anyTags"`
+	// SubmittedBy filters for samples submitted by a user, if set.
+	SubmittedBy uuid.UUID `query:"submittedBy"`
+	// Date filters are ignored when they are zero.
+	CreatedAfter  time.Time `query:"createdAfter"`
+	CreatedBefore time.Time `query:"createdBefore"`
+	ModifiedAfter time.Time `query:"modifiedAfter"`
+	// Sort defaults to relevance, or created when there's no query.
+	Sort CodeSampleSort `query:"sort"`
+	// Order defaults to the default order for the sort.
+	Order SortOrder `query:"order"`
+	// View selects full samples or summaries, full by default.
+	View CodeSampleView `query:"view"`
+	// Facets requests counts for languages and authors with the results.
+	Facets bool `query:"facets"`
+	// IncludeCount defaults to true. Counting can be skipped when paging
+	// through results with a cursor.
+	IncludeCount *bool `query:"includeCount"`
+	// Cursor continues from a previous page, in place of a page number.
+	Cursor   string `query:"cursor"`
+	Page     uint64 `query:"page"`
+	PageSize uint64 `query:"pageSize"`
 } // @name CodeSampleSearch
 
+// CountIncluded returns true if the total results should be counted.
+func (s CodeSampleSearch) CountIncluded() bool {
+	return s.IncludeCount == nil || *s.IncludeCount
+}
+
 type CodeSample struct {
 	ID          uuid.UUID `json:"id"`
 	SubmittedBy User      `json:"submittedBy"`
@@ -71,15 +440,97 @@ type CodeSample struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	Body        string    `json:"body"`
-	Created     time.Time `json:"created"`
-	Modified    time.Time `json:"modified"`
+	Tags        []string  `json:"tags"`
+	// MatchedLines are the lines matching a regex search, from 1.
+	MatchedLines []uint64  `json:"matchedLines,omitempty"`
+	Created      time.Time `json:"created"`
+	Modified     time.Time `json:"modified"`
 } //@name CodeSample
 
 type CodeSamplePage = Page[CodeSample] // @name CodeSamplePage
 
-type CodeSampleSubmission struct {
-	LanguageID  string `json:"languageId"`
+// CodeSampleLine is a numbered line from the body of a code sample.
+type CodeSampleLine struct {
+	// Number is the line number, starting from 1.
+	Number uint64 `json:"number" example:"1"`
+	// Text is HTML with search matches wrapped in <mark> tags.
+	Text string `json:"text"`
+} //@name CodeSampleLine
+
+// CodeSampleHighlights are excerpts of a code sample showing why it matched.
+// All text is HTML with search matches wrapped in <mark> tags.
+type CodeSampleHighlights struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
-	Body        string `json:"body"`
+	// Lines are the matching lines of the body, or the first lines if none match.
+	Lines []CodeSampleLine `json:"lines"`
+} //@name CodeSampleHighlights
+
+// CodeSampleSummary is a compact form of a code sample for list views.
+type CodeSampleSummary struct {
+	ID          uuid.UUID            `json:"id"`
+	SubmittedBy User                 `json:"submittedBy"`
+	Language    Language             `json:"language"`
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	Tags        []string             `json:"tags"`
+	Highlights  CodeSampleHighlights `json:"highlights"`
+	// MatchedLines are the lines matching a regex search, from 1.
+	MatchedLines []uint64  `json:"matchedLines,omitempty"`
+	Created      time.Time `json:"created"`
+	Modified     time.Time `json:"modified"`
+} //@name CodeSampleSummary
+
+type CodeSampleSummaryPage = Page[CodeSampleSummary] // @name CodeSampleSummaryPage
+
+// CodeSampleListItem describes results from listing code samples in the API
+// docs, which can only give one response for each status. Results are a
+// CodeSample for view=full, or a CodeSampleSummary for view=summary.
+type CodeSampleListItem struct {
+	ID          uuid.UUID `json:"id"`
+	SubmittedBy User      `json:"submittedBy"`
+	Language    Language  `json:"language"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	// Body is the whole body, only for view=full.
+	Body string   `json:"body,omitempty"`
+	Tags []string `json:"tags"`
+	// Highlights are excerpts showing why the sample matched, only for
+	// view=summary.
+	Highlights *CodeSampleHighlights `json:"highlights,omitempty"`
+	// MatchedLines are the lines matching a regex search, from 1.
+	MatchedLines []uint64  `json:"matchedLines,omitempty"`
+	Created      time.Time `json:"created"`
+	Modified     time.Time `json:"modified"`
+} //@name CodeSampleListItem
+
+type CodeSampleListPage = Page[CodeSampleListItem] // @name CodeSampleListPage
+
+// CodeSampleRevision is a snapshot of a code sample saved on every edit.
+type CodeSampleRevision struct {
+	CodeSampleID uuid.UUID `json:"codeSampleId"`
+	Revision     uint64    `json:"revision" example:"1"`
+	EditedBy     User      `json:"editedBy"`
+	Language     Language  `json:"language"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Body         string    `json:"body"`
+	// Tags are null for revisions saved before tags were kept with them.
+	Tags    []string  `json:"tags"`
+	Created time.Time `json:"created"`
+} //@name CodeSampleRevision
+
+// CodeSampleDiff is a unified diff between two revisions of a code sample.
+type CodeSampleDiff struct {
+	From uint64 `json:"from" example:"1"`
+	To   uint64 `json:"to" example:"2"`
+	Diff string `json:"diff"`
+} //@name CodeSampleDiff
+
+type CodeSampleSubmission struct {
+	LanguageID  string   `json:"languageId"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Body        string   `json:"body"`
+	Tags        []string `json:"tags" example:"concurrency,http-client"`
 } //@name CodeSampleSubmission
@@ -0,0 +1,181 @@
+// Package oidc logs users in through OpenID Connect providers, using the
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var MissingIDTokenErr = errors.New("no id_token in token response")
+var NonceMismatchErr = errors.New("id_token nonce does not match")
+
+// Config is the configuration for one provider.
+type Config struct {
+	// Name identifies the provider in login URLs, such as "company".
+	Name         string `toml:"name" yaml:"name"`
+	Issuer       string `toml:"issuer" yaml:"issuer"`
+	ClientID     string `toml:"client_id" yaml:"client_id"`
+	ClientSecret string `toml:"client_secret" yaml:"client_secret"`
+	// RedirectURL is the full URL for /api/auth/oidc/callback.
+	RedirectURL string `toml:"redirect_url" yaml:"redirect_url"`
+}
+
+// Identity is who a provider says a user is.
+type Identity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	// AuthTime is when the user last logged in at the provider, if it says.
+	AuthTime time.Time
+}
+
+// Provider is an issuer users can log in with.
+type Provider struct {
+	name     string
+	issuer   string
+	oauth    oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// NewProvider creates a provider, loading its endpoints and keys through
+// OpenID Connect discovery.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	provider, err := gooidc.NewProvider(ctx, config.Issuer)
+
+	if err != nil {
+		return nil, fmt.Errorf("oidc provider %s: %w", config.Name, err)
+	}
+
+	return &Provider{
+		name:   config.Name,
+		issuer: config.Issuer,
+		oauth: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{gooidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: provider.Verifier(&gooidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// GenerateVerifier creates a PKCE code verifier, to be kept until the
+// callback. It's stored in an encrypted cookie, so the browser holds it but
+// can't read it.
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// AuthCodeURL returns the URL to send the browser to for logging in.
+// With reauthenticate, the provider is asked to have the user log in again
+// even if they are still logged in there.
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string, reauthenticate bool) string {
+	options := []oauth2.AuthCodeOption{
+		gooidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	}
+
+	if reauthenticate {
+		options = append(options, oauth2.SetAuthURLParam("prompt", "login"), oauth2.SetAuthURLParam("max_age", "0"))
+	}
+
+	return p.oauth.AuthCodeURL(state, options...)
+}
+
+// Exchange swaps an authorization code for the identity of the user, checking
+// the signature, audience, expiry and nonce of the ID token.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+
+	if !ok {
+		return Identity{}, MissingIDTokenErr
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if idToken.Nonce != nonce {
+		return Identity{}, NonceMismatchErr
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		AuthTime          int64  `json:"auth_time"`
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}
+
+	if claims.AuthTime > 0 {
+		identity.AuthTime = time.Unix(claims.AuthTime, 0)
+	}
+
+	return identity, nil
+}
+
+// Providers are the providers users can log in with, by name.
+type Providers map[string]*Provider
+
+// Find returns a provider by name. If there is only one provider, the name
+// can be left empty.
+func (p Providers) Find(name string) (*Provider, bool) {
+	if len(name) == 0 && len(p) == 1 {
+		for _, provider := range p {
+			return provider, true
+		}
+	}
+
+	provider, ok := p[name]
+
+	return provider, ok
+}
+
+// New creates a provider for each configuration.
+func New(ctx context.Context, configs []Config) (Providers, error) {
+	providers := Providers{}
+
+	for _, config := range configs {
+		provider, err := NewProvider(ctx, config)
+
+		if err != nil {
+			return nil, err
+		}
+
+		providers[config.Name] = provider
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,169 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/oidc"
+	"github.com/dense-analysis/codelibrary/internal/api/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+func startProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	server, err := oidctest.NewServer()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "https://codelibrary.example/api/auth/oidc/callback",
+	})
+
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+
+	return server, provider
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	t.Parallel()
+	server, provider := startProvider(t)
+	defer server.Close()
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce", "verifier", false))
+
+	assert.Nil(t, err)
+	assert.Equal(t, server.Issuer()+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+
+	query := authURL.Query()
+
+	assert.Equal(t, "state", query.Get("state"))
+	assert.Equal(t, "nonce", query.Get("nonce"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.NotEmpty(t, query.Get("code_challenge"))
+	// The verifier itself must never be sent to the browser.
+	assert.NotContains(t, authURL.RawQuery, "verifier")
+	assert.Equal(t, "openid profile email", query.Get("scope"))
+	assert.Empty(t, query.Get("prompt"))
+}
+
+func TestAuthCodeURLReauthenticate(t *testing.T) {
+	t.Parallel()
+	server, provider := startProvider(t)
+	defer server.Close()
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce", "verifier", true))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "login", authURL.Query().Get("prompt"))
+	assert.Equal(t, "0", authURL.Query().Get("max_age"))
+}
+
+func TestExchange(t *testing.T) {
+	t.Parallel()
+	server, provider := startProvider(t)
+	defer server.Close()
+
+	server.SetClaims(map[string]any{
+		"sub":                "subject",
+		"email":              "someone@example.com",
+		"email_verified":     true,
+		"preferred_username": "someone",
+	})
+	loggedIn := time.Now().Add(-time.Hour).Truncate(time.Second)
+	server.SetLoggedIn(loggedIn)
+	verifier := oidc.GenerateVerifier()
+	code, state, err := server.Authorize(provider.AuthCodeURL("state", "nonce", verifier, false))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "state", state)
+
+	identity, err := provider.Exchange(context.Background(), code, verifier, "nonce")
+
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		oidc.Identity{
+			Issuer:            server.Issuer(),
+			Subject:           "subject",
+			Email:             "someone@example.com",
+			EmailVerified:     true,
+			PreferredUsername: "someone",
+			AuthTime:          loggedIn,
+		},
+		identity,
+	)
+}
+
+func TestExchangeReauthenticate(t *testing.T) {
+	t.Parallel()
+	server, provider := startProvider(t)
+	defer server.Close()
+
+	server.SetLoggedIn(time.Now().Add(-time.Hour))
+	verifier := oidc.GenerateVerifier()
+	before := time.Now().Truncate(time.Second)
+	code, _, err := server.Authorize(provider.AuthCodeURL("state", "nonce", verifier, true))
+
+	assert.Nil(t, err)
+
+	identity, err := provider.Exchange(context.Background(), code, verifier, "nonce")
+
+	assert.Nil(t, err)
+	// The user logged in again instead of using the earlier login.
+	assert.False(t, identity.AuthTime.Before(before))
+}
+
+func TestExchangeErrors(t *testing.T) {
+	t.Parallel()
+	server, provider := startProvider(t)
+	defer server.Close()
+
+	verifier := oidc.GenerateVerifier()
+
+	code, _, err := server.Authorize(provider.AuthCodeURL("state", "nonce", verifier, false))
+	assert.Nil(t, err)
+	_, err = provider.Exchange(context.Background(), code, oidc.GenerateVerifier(), "nonce")
+	assert.NotNil(t, err, "A different verifier should be rejected")
+
+	code, _, err = server.Authorize(provider.AuthCodeURL("state", "nonce", verifier, false))
+	assert.Nil(t, err)
+	_, err = provider.Exchange(context.Background(), code, verifier, "other")
+	assert.Equal(t, oidc.NonceMismatchErr, err)
+
+	code, _, err = server.Authorize(provider.AuthCodeURL("state", "nonce", verifier, false))
+	assert.Nil(t, err)
+	_, err = provider.Exchange(context.Background(), code, verifier, "nonce")
+	assert.Nil(t, err)
+	_, err = provider.Exchange(context.Background(), code, verifier, "nonce")
+	assert.NotNil(t, err, "Codes should only work once")
+}
+
+func TestFind(t *testing.T) {
+	one := &oidc.Provider{}
+	two := &oidc.Provider{}
+
+	provider, ok := oidc.Providers{"one": one}.Find("")
+	assert.True(t, ok)
+	assert.Same(t, one, provider)
+
+	_, ok = oidc.Providers{"one": one, "two": two}.Find("")
+	assert.False(t, ok)
+
+	provider, ok = oidc.Providers{"one": one, "two": two}.Find("two")
+	assert.True(t, ok)
+	assert.Same(t, two, provider)
+
+	_, ok = oidc.Providers{"one": one}.Find("three")
+	assert.False(t, ok)
+}
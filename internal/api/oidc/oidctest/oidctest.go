@@ -0,0 +1,321 @@
+// Package oidctest runs a mock OpenID Connect issuer, for testing logins
+// without a real provider.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+const keyID = "oidctest"
+
+// grant is an authorization code waiting to be exchanged.
+type grant struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      map[string]any
+	authTime    time.Time
+}
+
+// Server is a mock issuer with an authorization endpoint, a token endpoint
+// which checks PKCE, and RS256 signed ID tokens.
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	key          *rsa.PrivateKey
+	signer       jose.Signer
+	lock         sync.Mutex
+	claims       map[string]any
+	grants       map[string]grant
+	// loggedIn is when the user last logged in at the issuer. Later logins
+	// use it, as single sign-on does, unless they ask to log in again.
+	loggedIn     time.Time
+	ignorePrompt bool
+}
+
+// NewServer starts a mock issuer. Call Close when done with it.
+func NewServer() (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		key:          key,
+		signer:       signer,
+		claims:       map[string]any{"sub": "subject"},
+		grants:       map[string]grant{},
+		loggedIn:     time.Now(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// Issuer returns the issuer URL, for discovery.
+func (s *Server) Issuer() string {
+	return s.URL
+}
+
+// SetClaims sets the claims for the next logins, such as "sub" and "email".
+func (s *Server) SetClaims(claims map[string]any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.claims = claims
+}
+
+// SetLoggedIn sets when the user last logged in at the issuer, which is sent
+// as the auth_time claim.
+func (s *Server) SetLoggedIn(loggedIn time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.loggedIn = loggedIn
+}
+
+// SetIgnorePrompt makes the issuer ignore requests to log in again, and use
+// the last login instead, as some providers do.
+func (s *Server) SetIgnorePrompt(ignore bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ignorePrompt = ignore
+}
+
+// Authorize logs in as if a user had visited an authorization URL and
+// agreed, returning the code and state that would be sent to the callback.
+func (s *Server) Authorize(authURL string) (code string, state string, err error) {
+	parsed, err := url.Parse(authURL)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	query := parsed.Query()
+
+	if query.Get("client_id") != s.ClientID {
+		return "", "", errors.New("unknown client_id")
+	}
+
+	if query.Get("response_type") != "code" {
+		return "", "", errors.New("response_type must be code")
+	}
+
+	if query.Get("code_challenge_method") != "S256" || len(query.Get("code_challenge")) == 0 {
+		return "", "", errors.New("an S256 code_challenge is required")
+	}
+
+	data := make([]byte, 16)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", "", err
+	}
+
+	code = base64.RawURLEncoding.EncodeToString(data)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.ignorePrompt && (query.Get("prompt") == "login" || query.Get("max_age") == "0") {
+		s.loggedIn = time.Now()
+	}
+
+	s.grants[code] = grant{
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		claims:      s.claims,
+		authTime:    s.loggedIn,
+	}
+
+	return code, query.Get("state"), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{
+			Key:       &s.key.PublicKey,
+			KeyID:     keyID,
+			Algorithm: string(jose.RS256),
+			Use:       "sig",
+		}},
+	})
+}
+
+// authorize logs in straight away and redirects back to the client.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	code, state, err := s.Authorize(r.URL.String())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	redirectURL, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	query := redirectURL.Query()
+	query.Set("code", code)
+	query.Set("state", state)
+	redirectURL.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request")
+
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID != s.ClientID ||
+		subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.ClientSecret)) != 1 {
+		writeTokenError(w, "invalid_client")
+
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeTokenError(w, "unsupported_grant_type")
+
+		return
+	}
+
+	s.lock.Lock()
+	code := r.PostForm.Get("code")
+	grant, ok := s.grants[code]
+	// Codes can only be used once.
+	delete(s.grants, code)
+	s.lock.Unlock()
+
+	if !ok || grant.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeTokenError(w, "invalid_grant")
+
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.challenge {
+		writeTokenError(w, "invalid_grant")
+
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{}
+
+	for key, value := range grant.claims {
+		claims[key] = value
+	}
+
+	claims["iss"] = s.URL
+	claims["aud"] = s.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	claims["auth_time"] = grant.authTime.Unix()
+
+	if len(grant.nonce) > 0 {
+		claims["nonce"] = grant.nonce
+	}
+
+	payload, err := json.Marshal(claims)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	signature, err := s.signer.Sign(payload)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	idToken, err := signature.CompactSerialize()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
@@ -0,0 +1,158 @@
+// Package ratelimit limits how often clients can make requests, with a token
+// bucket for each client.
+//
+// Buckets are kept in memory, so each instance of the app has its own limits.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Budget is how many requests a client can make.
+type Budget struct {
+	// PerMinute is how quickly requests are allowed again.
+	PerMinute int `toml:"per_minute" yaml:"per_minute"`
+	// Burst is how many requests can be made at once, and the most a bucket
+	// holds. It defaults to PerMinute.
+	Burst int `toml:"burst" yaml:"burst"`
+}
+
+// Result is the outcome of taking a request from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a request is allowed again, if this one
+	// wasn't.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// sweepInterval is how often full buckets are thrown away.
+const sweepInterval = time.Minute
+
+// Limiter holds a bucket for each client.
+type Limiter struct {
+	budget    Budget
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewLimiter(budget Budget) *Limiter {
+	return &Limiter{budget: budget, buckets: map[string]*bucket{}}
+}
+
+// perSecond is how many tokens are added to a bucket each second.
+func (l *Limiter) perSecond() float64 {
+	return float64(l.budget.PerMinute) / 60
+}
+
+// fill adds the tokens a bucket has earned since it was last used.
+func (l *Limiter) fill(b *bucket, now time.Time) {
+	b.tokens += now.Sub(b.updated).Seconds() * l.perSecond()
+
+	if b.tokens > float64(l.budget.Burst) {
+		b.tokens = float64(l.budget.Burst)
+	}
+
+	b.updated = now
+}
+
+// sweep throws away buckets which have filled up again, which are the same
+// as having no bucket.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+
+	for key, b := range l.buckets {
+		l.fill(b, now)
+
+		if b.tokens >= float64(l.budget.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+// Take takes a request for a client from its bucket.
+func (l *Limiter) Take(key string, now time.Time) Result {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+
+	if ok {
+		l.fill(b, now)
+	} else {
+		b = &bucket{tokens: float64(l.budget.Burst), updated: now}
+		l.buckets[key] = b
+	}
+
+	result := Result{Limit: l.budget.Burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / l.perSecond() * float64(time.Second))
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = time.Duration((float64(l.budget.Burst) - b.tokens) / l.perSecond() * float64(time.Second))
+
+	return result
+}
+
+// Group is a set of routes which share a budget.
+type Group string
+
+const (
+	GroupRead  Group = "read"
+	GroupWrite Group = "write"
+	// GroupAuth is for routes which check credentials or send email.
+	GroupAuth Group = "auth"
+)
+
+// DefaultBudgets are the budgets used when none are configured.
+var DefaultBudgets = map[Group]Budget{
+	GroupRead:  {PerMinute: 300},
+	GroupWrite: {PerMinute: 60},
+	GroupAuth:  {PerMinute: 10},
+}
+
+// Limits are the limiters for each group. Groups without a limiter are not
+// limited.
+type Limits map[Group]*Limiter
+
+// New creates limiters for each group with a budget. A budget of 0 requests
+// per minute turns off limiting for a group.
+func New(budgets map[Group]Budget) Limits {
+	limits := Limits{}
+
+	for group, budget := range budgets {
+		if budget.PerMinute <= 0 {
+			continue
+		}
+
+		if budget.Burst <= 0 {
+			budget.Burst = budget.PerMinute
+		}
+
+		limits[group] = NewLimiter(budget)
+	}
+
+	return limits
+}
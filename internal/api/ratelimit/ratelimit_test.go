@@ -0,0 +1,86 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTake(t *testing.T) {
+	t.Parallel()
+	limiter := ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 3})
+	now := time.Now()
+
+	assert.Equal(
+		t,
+		ratelimit.Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second},
+		limiter.Take("a", now),
+	)
+	assert.Equal(
+		t,
+		ratelimit.Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second},
+		limiter.Take("a", now),
+	)
+	assert.Equal(
+		t,
+		ratelimit.Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second},
+		limiter.Take("a", now),
+	)
+	assert.Equal(
+		t,
+		ratelimit.Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second},
+		limiter.Take("a", now),
+	)
+
+	// Other clients have their own buckets.
+	assert.True(t, limiter.Take("b", now).Allowed)
+
+	// Half a token isn't enough for a request.
+	result := limiter.Take("a", now.Add(500*time.Millisecond))
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	assert.Equal(
+		t,
+		ratelimit.Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second},
+		limiter.Take("a", now.Add(time.Second)),
+	)
+}
+
+func TestTakeRefillsUpToBurst(t *testing.T) {
+	t.Parallel()
+	limiter := ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 2})
+	now := time.Now()
+
+	limiter.Take("a", now)
+	limiter.Take("a", now)
+
+	assert.Equal(
+		t,
+		ratelimit.Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second},
+		limiter.Take("a", now.Add(time.Hour)),
+	)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	limits := ratelimit.New(map[ratelimit.Group]ratelimit.Budget{
+		ratelimit.GroupRead:  {PerMinute: 60},
+		ratelimit.GroupWrite: {PerMinute: 0, Burst: 10},
+		ratelimit.GroupAuth:  {PerMinute: 10, Burst: 2},
+	})
+
+	assert.Nil(t, limits[ratelimit.GroupWrite])
+
+	// The burst defaults to the requests per minute.
+	if assert.NotNil(t, limits[ratelimit.GroupRead]) {
+		assert.Equal(t, 60, limits[ratelimit.GroupRead].Take("a", time.Now()).Limit)
+	}
+
+	if assert.NotNil(t, limits[ratelimit.GroupAuth]) {
+		assert.Equal(t, 2, limits[ratelimit.GroupAuth].Take("a", time.Now()).Limit)
+	}
+}
@@ -0,0 +1,41 @@
+// Package routeinfo finds the route which handled a request, for labelling
+// metrics and logs with route templates such as /api/code/:id.
+package routeinfo
+
+import (
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Unmatched is the route for requests which didn't reach a handler, so
+// unknown paths can't create new metric series.
+const Unmatched = "unmatched"
+
+// Matcher finds route templates. The zero value is ready to use.
+type Matcher struct {
+	once   sync.Once
+	routes map[string]bool
+}
+
+// Route returns the template for the route which handled a request, or
+// Unmatched. Call it after the request has been handled.
+func (m *Matcher) Route(c *fiber.Ctx) string {
+	// Routes are all registered before requests are handled.
+	m.once.Do(func() {
+		m.routes = map[string]bool{}
+
+		// Middleware isn't listed when filtering with GetRoutes.
+		for _, route := range c.App().GetRoutes(true) {
+			m.routes[route.Method+" "+route.Path] = true
+		}
+	})
+
+	// The route is the last one matched, which is middleware when the
+	// request didn't reach a handler, such as when it was rate limited.
+	if route := c.Route(); m.routes[route.Method+" "+route.Path] {
+		return route.Path
+	}
+
+	return Unmatched
+}
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/dense-analysis/codelibrary/internal/api/routeinfo"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AccessLogHandler logs every request with its route, status and duration,
+// and the user who made it. Probes aren't logged.
+func AccessLogHandler() fiber.Handler {
+	var matcher routeinfo.Matcher
+
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		// Send errors now so the status logged is the one sent.
+		if err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		if IsProbe(c) {
+			return nil
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("route", matcher.Route(c)),
+			slog.String("path", c.Path()),
+			slog.Int("status", c.Response().StatusCode()),
+			slog.Duration("duration", time.Since(start)),
+		}
+
+		if userID, ok := apisession.UserID(c); ok {
+			attrs = append(attrs, slog.String("user_id", userID.String()))
+		}
+
+		logging.Logger(c).LogAttrs(c.UserContext(), slog.LevelInfo, "request", attrs...)
+
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package routes_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
+	"github.com/dense-analysis/codelibrary/internal/api/errorhandler"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// logEntries decodes each line of JSON logs.
+func logEntries(t *testing.T, buffer *bytes.Buffer) []map[string]any {
+	t.Helper()
+	entries := []map[string]any{}
+	scanner := bufio.NewScanner(buffer)
+
+	for scanner.Scan() {
+		var entry map[string]any
+
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+	db := databasemock.New()
+	db.GetAPITokenUserResult.User = models.User{ID: uuid.New()}
+	db.GetAPITokenUserResult.Token.Scopes = []models.Scope{models.ScopeSamplesRead}
+
+	app := fiber.New(fiber.Config{ErrorHandler: errorhandler.ErrorHandler})
+	app.Use(logging.RequestIDHandler(slog.New(slog.NewJSONHandler(&buffer, nil))))
+	app.Use(routes.AccessLogHandler())
+	app.Get("/healthz", routes.HealthHandler())
+	app.Get("/api/code/:id", func(c *fiber.Ctx) error {
+		if _, err := apisession.LoadUser(c, db, models.ScopeSamplesRead); err != nil {
+			return err
+		}
+
+		return c.SendStatus(204)
+	})
+
+	request := httptest.NewRequest("GET", "/api/code/1", nil)
+	request.Header.Set("Authorization", "Bearer clt_abc")
+	request.Header.Set("X-Request-ID", "abc-123")
+
+	_, err := app.Test(request)
+	assert.Nil(t, err)
+
+	// Errors are logged with the status the error handler sends.
+	_, err = app.Test(httptest.NewRequest("GET", "/api/code/2", nil))
+	assert.Nil(t, err)
+
+	// Probes aren't logged.
+	_, err = app.Test(httptest.NewRequest("GET", "/healthz", nil))
+	assert.Nil(t, err)
+
+	entries := logEntries(t, &buffer)
+
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "request", entries[0]["msg"])
+		assert.Equal(t, "abc-123", entries[0]["request_id"])
+		assert.Equal(t, "GET", entries[0]["method"])
+		assert.Equal(t, "/api/code/:id", entries[0]["route"])
+		assert.Equal(t, "/api/code/1", entries[0]["path"])
+		assert.Equal(t, 204.0, entries[0]["status"])
+		assert.Equal(t, db.GetAPITokenUserResult.User.ID.String(), entries[0]["user_id"])
+		assert.Contains(t, entries[0], "duration")
+
+		assert.Equal(t, 403.0, entries[1]["status"])
+		assert.NotContains(t, entries[1], "user_id")
+	}
+}
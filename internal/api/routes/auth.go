@@ -2,9 +2,12 @@ package routes
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/apisession"
 	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -19,13 +22,61 @@ type LoginData struct {
 	Password string `json:"password" example:"password"`
 } //@name LoginData
 
+// checkNewPassword checks a new password follows the rules for passwords.
+func checkNewPassword(password string, confirmPassword string) (models.ErrorLocation, bool) {
+	if password != confirmPassword {
+		return models.NewErrorLocation("passwordMismatch", "Passwords do not match", "body"), false
+	}
+
+	if len(password) < minimumPasswordLength {
+		return models.NewErrorLocation("badPassword", "Password too short", "body"), false
+	}
+
+	if len(password) > maximumPasswordLength {
+		return models.NewErrorLocation("badPassword", "Password too long", "body"), false
+	}
+
+	return models.ErrorLocation{}, true
+}
+
+// reservedUsername returns true for names people can't take, such as the
+// ghost user credited with samples from deleted accounts.
+func reservedUsername(username string) bool {
+	return strings.EqualFold(username, database.GhostUsername)
+}
+
+func checkUsername(username string) (models.ErrorLocation, bool) {
+	if len(username) == 0 {
+		return models.NewErrorLocation("badUsername", "Username is required", "body"), false
+	}
+
+	if len(username) > maximumUsernameLength {
+		return models.NewErrorLocation("badUsername", "Username too long", "body"), false
+	}
+
+	if reservedUsername(username) {
+		return models.NewErrorLocation("badUsername", "Username is reserved", "body"), false
+	}
+
+	return models.ErrorLocation{}, true
+}
+
+// RegistrationPolicy sets how new accounts can be created.
+type RegistrationPolicy struct {
+	// DisableLocal stops people registering with a password, such as when
+	// everyone should log in through OpenID Connect instead.
+	DisableLocal bool
+}
+
 // LoginHandler godoc
 // @Tags Authentication
 // @Summary Log in
-// @Description Log in with user credentials
+// @Description Log in with user credentials. Logins are locked out for a while after too many failed attempts for a username or from an IP address. If the user has two-factor authentication turned on, a 202 response with a token for `/api/auth/login/totp` is returned instead of logging in
 // @Param data body LoginData true "Login Data"
 // @Success 200 {array} User
+// @Success 202 {object} PendingLogin
 // @Failure 403 {object} Error
+// @Failure 429 {object} Error
 // @Router /api/auth/login [post]
 func LoginHandler(db database.DatabaseAPI) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -42,24 +93,63 @@ func LoginHandler(db database.DatabaseAPI) fiber.Handler {
 			return sendBodyError(c, 403, "invalidCredentials", "Invalid user credentials")
 		}
 
-		user, err := db.GetUserWithCredentials(c.Context(), loginData.Username, loginData.Password)
+		now := time.Now()
+		lockedUntil, err := db.GetLoginLockout(c.Context(), loginKeys(c, loginData.Username), now)
 
 		if err != nil {
-			if errors.Is(err, database.NotFoundErr) {
-				return sendBodyError(c, 403, "invalidCredentials", "Invalid user credentials")
-			}
-
 			return err
 		}
 
-		err = apisession.SaveUser(c, user)
+		// Don't spend time checking passwords while locked out.
+		if !lockedUntil.IsZero() {
+			return sendLockedOut(c, lockedUntil, now)
+		}
+
+		user, err := db.GetUserWithCredentials(c.Context(), loginData.Username, loginData.Password)
+
+		if errors.Is(err, database.NotFoundErr) {
+			return failLogin(
+				c,
+				db,
+				loginData.Username,
+				now,
+				models.NewErrorLocation("invalidCredentials", "Invalid user credentials", "body"),
+			)
+		}
 
 		if err != nil {
 			return err
 		}
 
-		return c.JSON(user)
+		totp, err := db.GetTOTP(c.Context(), user.ID)
+
+		if err != nil && !errors.Is(err, database.NotFoundErr) {
+			return err
+		}
+
+		if err == nil && totp.Confirmed {
+			return startPendingLogin(c, db, user, now)
+		}
+
+		return completeLogin(c, db, user)
+	}
+}
+
+// completeLogin saves the user in a new session once every check has passed.
+func completeLogin(c *fiber.Ctx, db database.DatabaseAPI, user models.User) error {
+	// Only failures for the username are cleared, so one working login
+	// doesn't reset the count for everything else tried from an address.
+	err := db.ClearLoginFailures(c.Context(), usernameLoginLimit.key(c, user.Username))
+
+	if err != nil {
+		return err
 	}
+
+	if err := apisession.SaveUser(c, db, user); err != nil {
+		return err
+	}
+
+	return c.JSON(user)
 }
 
 // LogoutHandler godoc
@@ -70,41 +160,43 @@ func LoginHandler(db database.DatabaseAPI) fiber.Handler {
 // @Router /api/auth/logout [post]
 func LogoutHandler(db database.DatabaseAPI) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		return apisession.DeleteUser(c)
+		return apisession.DeleteUser(c, db)
 	}
 }
 
 // RegisterHandler godoc
 // @Tags Authentication
 // @Summary Register a new user
-// @Description Register a new user with a given password
+// @Description Register a new user with a given password. If an email address is given, a link for verifying it is sent. Registration can be turned off in favour of logging in with OpenID Connect
 // @Param data body RegisterUser true "User Data"
-// @Success 200 {array} User
+// @Success 200 {object} Account
 // @Failure 422 {object} Error
 // @Failure 403 {object} Error
 // @Router /api/auth/register [post]
-func RegisterHandler(db database.DatabaseAPI) fiber.Handler {
+func RegisterHandler(db database.DatabaseAPI, mail AccountMail, policy RegistrationPolicy) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if policy.DisableLocal {
+			return sendBodyError(c, 403, "registrationDisabled", "Registration with a password is disabled")
+		}
+
 		var registerUser models.RegisterUser
 
 		if err := c.BodyParser(&registerUser); err != nil {
 			return err
 		}
 
-		if registerUser.Password != registerUser.ConfirmPassword {
-			return sendBodyError(c, 422, "passwordMismatch", "Passwords do not match")
-		}
-
-		if len(registerUser.Password) < minimumPasswordLength {
-			return sendBodyError(c, 422, "badPassword", "Password too short")
+		if errorLocation, ok := checkNewPassword(registerUser.Password, registerUser.ConfirmPassword); !ok {
+			return sendError(c, 422, []models.ErrorLocation{errorLocation})
 		}
 
-		if len(registerUser.Password) > maximumPasswordLength {
-			return sendBodyError(c, 422, "badPassword", "Password too long")
+		if errorLocation, ok := checkUsername(registerUser.Username); !ok {
+			return sendError(c, 422, []models.ErrorLocation{errorLocation})
 		}
 
-		if len(registerUser.Username) > maximumUsernameLength {
-			return sendBodyError(c, 422, "badUsername", "Username too long")
+		if len(registerUser.Email) > 0 {
+			if errorLocation, ok := checkEmail(registerUser.Email); !ok {
+				return sendError(c, 422, []models.ErrorLocation{errorLocation})
+			}
 		}
 
 		id, err := uuid.NewRandom()
@@ -113,11 +205,25 @@ func RegisterHandler(db database.DatabaseAPI) fiber.Handler {
 			return err
 		}
 
-		user := models.User{
-			ID:       id,
-			Username: registerUser.Username,
+		account := models.Account{
+			User: models.User{
+				ID:       id,
+				Username: registerUser.Username,
+				Role:     models.RoleUser,
+			},
+		}
+
+		if len(registerUser.Email) > 0 {
+			account.Email = &registerUser.Email
+		}
+
+		err = db.RegisterUser(c.Context(), account, registerUser.Password)
+
+		if errors.Is(err, database.DuplicateEmailErr) {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("duplicateEmail", "Email address already in use", "body", "email"),
+			})
 		}
-		err = db.RegisterUser(c.Context(), user, registerUser.Password)
 
 		if errors.Is(err, database.DuplicateErr) {
 			return sendBodyError(c, 403, "duplicateUser", "User already exists")
@@ -127,6 +233,14 @@ func RegisterHandler(db database.DatabaseAPI) fiber.Handler {
 			return err
 		}
 
-		return c.JSON(user)
+		metrics.UsersRegistered.WithLabelValues("password").Inc()
+
+		if account.Email != nil {
+			if err := sendEmailVerification(c, db, mail, account.User, *account.Email); err != nil {
+				return err
+			}
+		}
+
+		return c.JSON(account)
 	}
 }
@@ -1,17 +1,31 @@
 package routes_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/apisession"
 	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/api/server"
 	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
+func registerHandler(db database.DatabaseAPI) fiber.Handler {
+	return routes.RegisterHandler(db, testMail(io.Discard), routes.RegistrationPolicy{})
+}
+
 func TestLogin(t *testing.T) {
 	t.Parallel()
 
@@ -32,14 +46,20 @@ func TestLogin(t *testing.T) {
 	r.GetResponse(&actualUser)
 	assert.Equal(t, expectedUser, actualUser)
 
-	// Ensure we save the user ID in the session correctly.
-	apisession.LoadUser(r.Ctx, r.DB)
-	calls := r.DB.GetCalls("GetUser")
-	assert.Equal(t, 1, len(calls))
+	// Ensure we create a session for the user.
+	calls := r.DB.GetCalls("CreateSession")
+
+	if assert.Equal(t, 1, len(calls)) {
+		session := calls[0][0].(models.Session)
+		assert.Equal(t, expectedUser.ID, session.UserID)
 
-	if len(calls) == 1 {
-		id := calls[0][0].(uuid.UUID)
-		assert.Equal(t, expectedUser.ID, id)
+		// Ensure we load the user back from the same session.
+		apisession.LoadUser(r.Ctx, r.DB)
+		calls = r.DB.GetCalls("GetSessionUser")
+
+		if assert.Equal(t, 1, len(calls)) {
+			assert.Equal(t, session.ID, calls[0][0].(uuid.UUID))
+		}
 	}
 }
 
@@ -90,6 +110,148 @@ func TestLoginErrors(t *testing.T) {
 	}
 }
 
+func TestLoginFailureCounted(t *testing.T) {
+	t.Parallel()
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	before := testutil.ToFloat64(metrics.LoginsFailed)
+
+	r.DB.GetUserWithCredentialsResult.B = database.NotFoundErr
+	r.SetRequestBody(routes.LoginData{Username: "user", Password: "123"})
+	r.AssertStatus(routes.LoginHandler, 403)
+
+	// Other tests run at the same time can count failures too.
+	assert.GreaterOrEqual(t, testutil.ToFloat64(metrics.LoginsFailed), before+1)
+}
+
+func TestLoginClearsFailuresForUsername(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetUserWithCredentialsResult.A = models.User{ID: testutils.UUIDFromInt(1), Username: "user"}
+
+	r.SetRequestBody(routes.LoginData{Username: "user", Password: "123"})
+	r.AssertStatus(routes.LoginHandler, 200)
+
+	assert.Equal(t, [][]any{{"username:user"}}, r.DB.GetCalls("ClearLoginFailures"))
+}
+
+func TestLoginLockedOut(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetLoginLockoutResult.A = time.Now().Add(30 * time.Second)
+
+	r.SetRequestBody(routes.LoginData{Username: "user", Password: "123"})
+	r.AssertStatus(routes.LoginHandler, 429)
+
+	var actualError models.Error
+	r.GetResponse(&actualError)
+	assert.Equal(t, 30, actualError.RetryAfter)
+	assert.Equal(t, "30", string(r.Ctx.Response().Header.Peek("Retry-After")))
+
+	calls := r.DB.GetCalls("GetLoginLockout")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, []string{"username:user", "ip:0.0.0.0"}, calls[0][0])
+	}
+
+	// Passwords shouldn't be checked while locked out.
+	assert.Equal(t, 0, len(r.DB.GetCalls("GetUserWithCredentials")))
+}
+
+func TestLoginFailureLockout(t *testing.T) {
+	var tests = map[string]struct {
+		failures           int
+		expectedStatusCode int
+		expectedRetryAfter int
+		expectedLocks      int
+	}{
+		"FreeAttempt":    {failures: 4, expectedStatusCode: 403},
+		"FirstLockout":   {failures: 5, expectedStatusCode: 429, expectedRetryAfter: 30, expectedLocks: 1},
+		"Backoff":        {failures: 7, expectedStatusCode: 429, expectedRetryAfter: 120, expectedLocks: 1},
+		"MaximumLockout": {failures: 15, expectedStatusCode: 429, expectedRetryAfter: 3600, expectedLocks: 1},
+		"IPLockout":      {failures: 20, expectedStatusCode: 429, expectedRetryAfter: 3600, expectedLocks: 2},
+		"ManyFailures":   {failures: 1000, expectedStatusCode: 429, expectedRetryAfter: 3600, expectedLocks: 2},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			r.DB.GetUserWithCredentialsResult.B = database.NotFoundErr
+			r.DB.RecordLoginFailureResult.A = testData.failures
+
+			r.SetRequestBody(routes.LoginData{Username: "user", Password: "123"})
+			r.AssertStatus(routes.LoginHandler, testData.expectedStatusCode)
+
+			var actualError models.Error
+			r.GetResponse(&actualError)
+			assert.Equal(t, testData.expectedRetryAfter, actualError.RetryAfter)
+
+			recordCalls := r.DB.GetCalls("RecordLoginFailure")
+
+			if assert.Equal(t, 2, len(recordCalls)) {
+				assert.Equal(t, "username:user", recordCalls[0][0])
+				assert.Equal(t, "ip:0.0.0.0", recordCalls[1][0])
+				// Failures from more than a day ago should be forgotten.
+				assert.Equal(t, 24*time.Hour, recordCalls[0][1].(time.Time).Sub(recordCalls[0][2].(time.Time)))
+			}
+
+			lockCalls := r.DB.GetCalls("LockLogin")
+
+			if assert.Equal(t, testData.expectedLocks, len(lockCalls)) && testData.expectedLocks > 0 {
+				assert.Equal(t, "username:user", lockCalls[0][0])
+				assert.Equal(t, testData.failures, lockCalls[0][1])
+			}
+
+			assert.Equal(t, 0, len(r.DB.GetCalls("ClearLoginFailures")))
+		})
+	}
+}
+
+func TestLoginFailuresByClientIP(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	db.GetUserWithCredentialsResult.B = database.NotFoundErr
+
+	// Requests in tests come from 0.0.0.0, which stands in for nginx.
+	var config fiber.Config
+	server.ProxyConfig{Header: "X-Real-IP", Trusted: []string{"0.0.0.0"}}.Apply(&config)
+	app := fiber.New(config)
+	app.Post("/api/auth/login", routes.LoginHandler(db))
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		body, _ := json.Marshal(routes.LoginData{Username: "user", Password: "123"})
+		request := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Real-IP", ip)
+		response, err := app.Test(request)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 403, response.StatusCode)
+	}
+
+	keys := []string{}
+
+	for _, call := range db.GetCalls("RecordLoginFailure") {
+		keys = append(keys, call[0].(string))
+	}
+
+	// Clients behind the proxy each have their own failures.
+	assert.Equal(t, []string{"username:user", "ip:203.0.113.1", "username:user", "ip:203.0.113.2"}, keys)
+}
+
 func TestLogout(t *testing.T) {
 	t.Parallel()
 
@@ -97,12 +259,15 @@ func TestLogout(t *testing.T) {
 	defer r.Release()
 
 	user := models.User{ID: testutils.UUIDFromInt(1)}
-	apisession.SaveUser(r.Ctx, user)
+	apisession.SaveUser(r.Ctx, r.DB, user)
 
 	r.AssertStatus(routes.LogoutHandler, 200)
 
 	_, err := apisession.LoadUser(r.Ctx, r.DB)
 	assert.Equal(t, apisession.NoUserInSessionErr, err)
+
+	// The session should be revoked, not just forgotten by the client.
+	assert.Equal(t, 1, len(r.DB.GetCalls("DeleteSession")))
 }
 
 func TestRegister(t *testing.T) {
@@ -118,10 +283,11 @@ func TestRegister(t *testing.T) {
 	}
 	r.SetRequestBody(registerUser)
 
-	r.AssertStatus(routes.RegisterHandler, 200)
+	r.AssertStatus(registerHandler, 200)
 
 	expectedUser := models.User{
 		Username: "user",
+		Role:     models.RoleUser,
 	}
 	var actualUser models.User
 	r.GetResponse(&actualUser)
@@ -129,6 +295,73 @@ func TestRegister(t *testing.T) {
 	assert.Equal(t, expectedUser, actualUser)
 }
 
+func TestRegisterWithEmail(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	var buffer bytes.Buffer
+	mail := testMail(&buffer)
+
+	r.SetRequestBody(models.RegisterUser{
+		Username:        "user",
+		Password:        "123456789",
+		ConfirmPassword: "123456789",
+		Email:           "user@example.com",
+	})
+	// Links must not be built from the Host header clients send.
+	r.Ctx.Request().Header.SetHost("attacker.example")
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.RegisterHandler(db, mail, routes.RegistrationPolicy{})
+	}, 200)
+
+	var actualAccount models.Account
+	r.GetResponse(&actualAccount)
+
+	if assert.NotNil(t, actualAccount.Email) {
+		assert.Equal(t, "user@example.com", *actualAccount.Email)
+	}
+
+	assert.False(t, actualAccount.EmailVerified)
+
+	calls := r.DB.GetCalls("CreateEmailVerification")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, actualAccount.ID, calls[0][0])
+		assert.Equal(t, "user@example.com", calls[0][1])
+	}
+
+	assert.Contains(t, buffer.String(), "To: user@example.com\r\n")
+	assert.Contains(t, buffer.String(), "https://codelibrary.example/verify-email?token=")
+	assert.NotContains(t, buffer.String(), "attacker.example")
+}
+
+func TestRegisterDisabled(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.SetRequestBody(models.RegisterUser{
+		Username:        "user",
+		Password:        "123456789",
+		ConfirmPassword: "123456789",
+	})
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.RegisterHandler(
+			db,
+			testMail(io.Discard),
+			routes.RegistrationPolicy{DisableLocal: true},
+		)
+	}, 403)
+
+	r.AssertResponseError(
+		models.NewErrorLocation("registrationDisabled", "Registration with a password is disabled", "body"),
+	)
+	assert.Empty(t, r.DB.GetCalls("RegisterUser"))
+}
+
 func TestRegisterErrors(t *testing.T) {
 	var tests = map[string]struct {
 		data               models.RegisterUser
@@ -175,6 +408,18 @@ func TestRegisterErrors(t *testing.T) {
 				"body",
 			),
 		},
+		"UsernameRequired": {
+			data: models.RegisterUser{
+				Password:        testutils.GenerateString('x', 8),
+				ConfirmPassword: testutils.GenerateString('x', 8),
+			},
+			expectedStatusCode: 422,
+			expectedError: models.NewErrorLocation(
+				"badUsername",
+				"Username is required",
+				"body",
+			),
+		},
 		"UsernameTooLong": {
 			data: models.RegisterUser{
 				Username:        testutils.GenerateString('x', 256),
@@ -188,6 +433,50 @@ func TestRegisterErrors(t *testing.T) {
 				"body",
 			),
 		},
+		"UsernameReserved": {
+			data: models.RegisterUser{
+				Username:        "Ghost",
+				Password:        testutils.GenerateString('x', 8),
+				ConfirmPassword: testutils.GenerateString('x', 8),
+			},
+			expectedStatusCode: 422,
+			expectedError: models.NewErrorLocation(
+				"badUsername",
+				"Username is reserved",
+				"body",
+			),
+		},
+		"InvalidEmail": {
+			data: models.RegisterUser{
+				Username:        "user",
+				Password:        "123456789",
+				ConfirmPassword: "123456789",
+				Email:           "not an email",
+			},
+			expectedStatusCode: 422,
+			expectedError: models.NewErrorLocation(
+				"badEmail",
+				"Invalid email address",
+				"body",
+				"email",
+			),
+		},
+		"DuplicateEmail": {
+			data: models.RegisterUser{
+				Username:        "user",
+				Password:        "123456789",
+				ConfirmPassword: "123456789",
+				Email:           "taken@example.com",
+			},
+			databaseError:      database.DuplicateEmailErr,
+			expectedStatusCode: 403,
+			expectedError: models.NewErrorLocation(
+				"duplicateEmail",
+				"Email address already in use",
+				"body",
+				"email",
+			),
+		},
 		"DuplicateUser": {
 			data: models.RegisterUser{
 				Username:        "user",
@@ -215,7 +504,7 @@ func TestRegisterErrors(t *testing.T) {
 			r.DB.RegisterUserResult = testData.databaseError
 
 			r.SetRequestBody(testData.data)
-			r.AssertStatus(routes.RegisterHandler, testData.expectedStatusCode)
+			r.AssertStatus(registerHandler, testData.expectedStatusCode)
 
 			r.AssertResponseError(testData.expectedError)
 		})
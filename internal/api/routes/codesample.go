@@ -1,10 +1,12 @@
 package routes
 
 import (
+	"errors"
 	"time"
 
 	"github.com/dense-analysis/codelibrary/internal/api/apisession"
 	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -12,6 +14,10 @@ import (
 
 func validateCodeSampleSearch(c *fiber.Ctx, search *models.CodeSampleSearch) (error, bool) {
 	if err := c.QueryParser(search); err != nil {
+		err = sendError(c, 422, []models.ErrorLocation{
+			models.NewErrorLocation("invalidValue", "Invalid query string", "query"),
+		})
+
 		return err, false
 	}
 
@@ -27,6 +33,13 @@ func validateCodeSampleSearch(c *fiber.Ctx, search *models.CodeSampleSearch) (er
 
 	errorDetail := []models.ErrorLocation{}
 
+	if _, ok := queries["page"]; ok && len(search.Cursor) > 0 {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Cannot use page with cursor", "query", "page"),
+		)
+	}
+
 	if search.Page == 0 {
 		errorDetail = append(
 			errorDetail,
@@ -41,6 +54,76 @@ func validateCodeSampleSearch(c *fiber.Ctx, search *models.CodeSampleSearch) (er
 		)
 	}
 
+	if !search.CreatedAfter.IsZero() &&
+		!search.CreatedBefore.IsZero() &&
+		!search.CreatedAfter.Before(search.CreatedBefore) {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "createdAfter must be before createdBefore", "query", "createdAfter"),
+		)
+	}
+
+	switch search.Sort {
+	case "", models.SortRelevance, models.SortCreated, models.SortModified, models.SortTitle:
+	default:
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Invalid sort", "query", "sort"),
+		)
+	}
+
+	switch search.Mode {
+	case "", models.ModeText, models.ModeCode:
+	default:
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Invalid mode", "query", "mode"),
+		)
+	}
+
+	if len(search.Regex) > 0 {
+		if message, ok := validateRegex(search.Regex); !ok {
+			errorDetail = append(
+				errorDetail,
+				models.NewErrorLocation("invalidValue", message, "query", "regex"),
+			)
+		}
+	}
+
+	switch search.View {
+	case "", models.ViewFull, models.ViewSummary:
+	default:
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Invalid view", "query", "view"),
+		)
+	}
+
+	switch search.Order {
+	case "", models.OrderAscending, models.OrderDescending:
+	default:
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Invalid order", "query", "order"),
+		)
+	}
+
+	var ok bool
+
+	if search.Tags, ok = normalizeTags(search.Tags); !ok {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Invalid tags", "query", "tags"),
+		)
+	}
+
+	if search.AnyTags, ok = normalizeTags(search.AnyTags); !ok {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Invalid anyTags", "query", "anyTags"),
+		)
+	}
+
 	if len(errorDetail) > 0 {
 		err := sendError(c, 422, errorDetail)
 
@@ -54,21 +137,53 @@ func validateCodeSampleSearch(c *fiber.Ctx, search *models.CodeSampleSearch) (er
 // @Tags Code Samples
 // @Summary List Code Samples
 // @Description Retrieve a list of Code Samples
-// @Param q query string false "A string for searching for code samples"
+// @Param q query string false "A string for searching for code samples. Leave empty to list all samples"
+// @Param mode query string false "text for English text search, or code for substrings and identifiers in code bodies" Enums(text, code)
+// @Param caseSensitive query boolean false "Match case exactly in code searches. Identifier spellings are only matched without case"
+// @Param regex query string false "Only include samples with bodies matching an RE2 regular expression, returning matchedLines for each"
 // @Param l query string false "Search for results for a particular language by name"
+// @Param tags query []string false "Only include samples with all of these tags" collectionFormat(csv)
+// @Param anyTags query []string false "Only include samples with any of these tags" collectionFormat(csv)
+// @Param submittedBy query string false "Only include samples submitted by the user with this UUID"
+// @Param createdAfter query string false "Only include samples created at or after this RFC 3339 time"
+// @Param createdBefore query string false "Only include samples created before this RFC 3339 time"
+// @Param modifiedAfter query string false "Only include samples modified at or after this RFC 3339 time"
+// @Param sort query string false "The field to sort by, relevance by default or created without q" Enums(relevance, created, modified, title)
+// @Param order query string false "The direction to sort in, desc by default except for title" Enums(asc, desc)
+// @Param facets query boolean false "Include counts of results for every language and the top authors, each ignoring its own filter"
+// @Param view query string false "full for whole samples, or summary for highlighted excerpts without bodies" Enums(full, summary)
+// @Param cursor query string false "Continue from the nextCursor of a previous page, in place of page"
+// @Param includeCount query boolean false "Count the total results, true by default"
 // @Param page query integer false "The page to list results from"
 // @Param pageSize query integer false "The amount of items to fetch in a given page"
-// @Success 200 {object} CodeSamplePage
+// @Success 200 {object} CodeSampleListPage "A CodeSamplePage with whole bodies for view=full, or a CodeSampleSummaryPage with highlights for view=summary"
 // @Router /api/code [get]
 func ListCodeSamplesHandler(db database.DatabaseAPI) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if err := apisession.CheckToken(c, db, models.ScopeSamplesRead); err != nil {
+			return err
+		}
+
 		var search models.CodeSampleSearch
 
 		if err, ok := validateCodeSampleSearch(c, &search); err != nil || !ok {
 			return err
 		}
 
-		page, err := db.FindCodeSamples(c.Context(), search)
+		var page any
+		var err error
+
+		if search.View == models.ViewSummary {
+			page, err = db.FindCodeSampleSummaries(c.Context(), search)
+		} else {
+			page, err = db.FindCodeSamples(c.Context(), search)
+		}
+
+		if errors.Is(err, database.InvalidCursorErr) {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Invalid cursor", "query", "cursor"),
+			})
+		}
 
 		if err != nil {
 			return err
@@ -82,7 +197,17 @@ type CodeSampleParams struct {
 	ID string `json:"id"`
 }
 
-func submitCodeSample(db database.DatabaseAPI, c *fiber.Ctx, mode SubmitMode) error {
+// SubmissionPolicy sets extra rules for who can submit new code samples.
+type SubmissionPolicy struct {
+	// RequireVerifiedEmail only accepts samples from users with a verified
+	// email address.
+	RequireVerifiedEmail bool
+	// RequireTwoFactor only accepts samples from users with two-factor
+	// authentication turned on.
+	RequireTwoFactor bool
+}
+
+func submitCodeSample(db database.DatabaseAPI, c *fiber.Ctx, mode SubmitMode, policy SubmissionPolicy) error {
 	var err error
 	var submission models.CodeSampleSubmission
 
@@ -110,12 +235,28 @@ func submitCodeSample(db database.DatabaseAPI, c *fiber.Ctx, mode SubmitMode) er
 		return err
 	}
 
-	user, err := apisession.LoadUser(c, db)
+	user, err := apisession.LoadUser(c, db, models.ScopeSamplesWrite)
 
 	if err != nil {
 		return err
 	}
 
+	if mode == Create && (policy.RequireVerifiedEmail || policy.RequireTwoFactor) {
+		account, err := db.GetAccount(c.Context(), user.ID)
+
+		if err != nil {
+			return err
+		}
+
+		if policy.RequireVerifiedEmail && !account.EmailVerified {
+			return sendBodyError(c, 403, "emailNotVerified", "A verified email address is required to submit code samples")
+		}
+
+		if policy.RequireTwoFactor && !account.TwoFactorEnabled {
+			return sendBodyError(c, 403, "twoFactorRequired", "Two-factor authentication is required to submit code samples")
+		}
+	}
+
 	language, err := db.GetLanguage(c.Context(), submission.LanguageID)
 
 	if err != nil {
@@ -132,6 +273,28 @@ func submitCodeSample(db database.DatabaseAPI, c *fiber.Ctx, mode SubmitMode) er
 		return err
 	}
 
+	tags, ok := normalizeTags(submission.Tags)
+
+	if !ok {
+		return sendError(
+			c,
+			422,
+			[]models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Invalid tags", "body", "tags"),
+			},
+		)
+	}
+
+	if len(tags) > maximumTagsPerSample {
+		return sendError(
+			c,
+			422,
+			[]models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Too many tags", "body", "tags"),
+			},
+		)
+	}
+
 	var sample models.CodeSample
 
 	if mode == Create {
@@ -145,21 +308,34 @@ func submitCodeSample(db database.DatabaseAPI, c *fiber.Ctx, mode SubmitMode) er
 			return err
 		}
 
-		if sample.SubmittedBy.ID != user.ID {
+		if !canEditSample(user, sample) {
 			return sendBodyError(c, 403, "forbidden", "Not your code sample")
 		}
 	}
 
+	// Retired languages can't be used for new samples, but existing samples
+	// can still be edited without changing the language.
+	if language.Retired && (mode == Create || sample.Language.ID != language.ID) {
+		return sendError(
+			c,
+			422,
+			[]models.ErrorLocation{
+				models.NewErrorLocation("retiredLanguage", "Language is retired", "body", "languageId"),
+			},
+		)
+	}
+
 	sample.Language = language
 	sample.Title = submission.Title
 	sample.Description = submission.Description
 	sample.Body = submission.Body
+	sample.Tags = tags
 	sample.Modified = time.Now()
 
 	if mode == Create {
 		err = db.CreateCodeSample(c.Context(), sample)
 	} else {
-		err = db.UpdateCodeSample(c.Context(), sample)
+		err = db.UpdateCodeSample(c.Context(), sample, user.ID)
 	}
 
 	if err != nil {
@@ -167,6 +343,7 @@ func submitCodeSample(db database.DatabaseAPI, c *fiber.Ctx, mode SubmitMode) er
 	}
 
 	if mode == Create {
+		metrics.CodeSamplesCreated.Inc()
 		c.Status(201)
 	}
 
@@ -176,27 +353,29 @@ func submitCodeSample(db database.DatabaseAPI, c *fiber.Ctx, mode SubmitMode) er
 // CreateCodeSampleHandler godoc
 // @Tags Code Samples
 // @Summary Submit Code Sample
-// @Description Submit a new Code Sample
+// @Description Submit a new Code Sample. The server may require a verified email address or two-factor authentication
 // @Param data body CodeSampleSubmission true "CodeSample data"
 // @Success 201 {object} CodeSample
+// @Failure 403 {object} Error
 // @Router /api/code [post]
-func CreateCodeSampleHandler(db database.DatabaseAPI) fiber.Handler {
+func CreateCodeSampleHandler(db database.DatabaseAPI, policy SubmissionPolicy) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		return submitCodeSample(db, c, Create)
+		return submitCodeSample(db, c, Create, policy)
 	}
 }
 
 // UpdateCodeSampleHandler godoc
 // @Tags Code Samples
 // @Summary Update a Code Sample
-// @Description Update an existing Code Sample
+// @Description Update an existing Code Sample. Moderators can update any sample
 // @Param id path string true "The UUID of the code sample to update"
 // @Param data body CodeSampleSubmission true "CodeSample data"
 // @Success 200 {object} CodeSample
 // @Router /api/code/{id} [put]
 func UpdateCodeSampleHandler(db database.DatabaseAPI) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		return submitCodeSample(db, c, Update)
+		// The policy only applies to new samples.
+		return submitCodeSample(db, c, Update, SubmissionPolicy{})
 	}
 }
 
@@ -209,6 +388,10 @@ func UpdateCodeSampleHandler(db database.DatabaseAPI) fiber.Handler {
 // @Router /api/code/{id} [get]
 func GetCodeSampleHandler(db database.DatabaseAPI) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if err := apisession.CheckToken(c, db, models.ScopeSamplesRead); err != nil {
+			return err
+		}
+
 		id, err := parseParamsID(c)
 
 		if err != nil {
@@ -228,7 +411,7 @@ func GetCodeSampleHandler(db database.DatabaseAPI) fiber.Handler {
 // DeleteCodeSampleHandler godoc
 // @Tags Code Samples
 // @Summary Delete a Code Sample
-// @Description Delete a Code Sample
+// @Description Delete a Code Sample. Moderators can delete any sample
 // @Param id path string true "The UUID of the code sample to delete"
 // @Success 204
 // @Router /api/code/{id} [delete]
@@ -242,7 +425,7 @@ func DeleteCodeSampleHandler(db database.DatabaseAPI) fiber.Handler {
 			})
 		}
 
-		user, err := apisession.LoadUser(c, db)
+		user, err := apisession.LoadUser(c, db, models.ScopeSamplesWrite)
 
 		if err != nil {
 			return err
@@ -254,13 +437,13 @@ func DeleteCodeSampleHandler(db database.DatabaseAPI) fiber.Handler {
 			return err
 		}
 
-		if sample.SubmittedBy.ID != user.ID {
+		if !canEditSample(user, sample) {
 			return sendError(c, 403, []models.ErrorLocation{
 				models.NewErrorLocation("forbidden", "Not your code sample", "params", "id"),
 			})
 		}
 
 		c.Status(204)
-		return db.DeleteCodeSample(c.Context(), id)
+		return db.DeleteCodeSample(c.Context(), id, user.ID)
 	}
 }
@@ -1,6 +1,7 @@
 package routes_test
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/dense-analysis/codelibrary/internal/api/routes"
 	"github.com/dense-analysis/codelibrary/internal/testutils"
 	"github.com/dense-analysis/ranges"
+	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -50,6 +52,76 @@ func TestListCodeSamplesInvalidParams(t *testing.T) {
 			search:        models.CodeSampleSearch{Page: 0, PageSize: 20},
 			expectedError: models.NewErrorLocation("invalidValue", "Invalid page", "query", "page"),
 		},
+		"InvalidSort": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Sort: "popularity"},
+			expectedError: models.NewErrorLocation("invalidValue", "Invalid sort", "query", "sort"),
+		},
+		"InvalidOrder": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Order: "up"},
+			expectedError: models.NewErrorLocation("invalidValue", "Invalid order", "query", "order"),
+		},
+		"InvalidTags": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Tags: []string{"c++", "no/slash"}},
+			expectedError: models.NewErrorLocation("invalidValue", "Invalid tags", "query", "tags"),
+		},
+		"InvalidAnyTags": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, AnyTags: []string{"-"}},
+			expectedError: models.NewErrorLocation("invalidValue", "Invalid anyTags", "query", "anyTags"),
+		},
+		"InvalidMode": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Mode: "regex"},
+			expectedError: models.NewErrorLocation("invalidValue", "Invalid mode", "query", "mode"),
+		},
+		"InvalidRegex": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Regex: `func (`},
+			expectedError: models.NewErrorLocation("invalidValue", "Invalid regex", "query", "regex"),
+		},
+		"RegexTooLong": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Regex: strings.Repeat("a", 257)},
+			expectedError: models.NewErrorLocation("invalidValue", "Regex too long", "query", "regex"),
+		},
+		"RegexRepeatTooLarge": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Regex: `a{256}`},
+			expectedError: models.NewErrorLocation("invalidValue", "Regex too complex", "query", "regex"),
+		},
+		"RegexTooComplex": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Regex: `[\pL\pN]{2}`},
+			expectedError: models.NewErrorLocation("invalidValue", "Regex too complex", "query", "regex"),
+		},
+		"RegexMatchesEmptyText": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Regex: `(foo)?`},
+			expectedError: models.NewErrorLocation("invalidValue", "Regex matches empty text", "query", "regex"),
+		},
+		"RegexNotSupported": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Regex: `a\x00`},
+			expectedError: models.NewErrorLocation("invalidValue", "Regex not supported", "query", "regex"),
+		},
+		"RegexMatchesNothing": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, Regex: `a[^\x00-\x{10FFFF}]`},
+			expectedError: models.NewErrorLocation("invalidValue", "Regex not supported", "query", "regex"),
+		},
+		"PageWithCursor": {
+			search:        models.CodeSampleSearch{Page: 2, PageSize: 20, Cursor: "abc"},
+			expectedError: models.NewErrorLocation("invalidValue", "Cannot use page with cursor", "query", "page"),
+		},
+		"InvalidView": {
+			search:        models.CodeSampleSearch{Page: 1, PageSize: 20, View: "compact"},
+			expectedError: models.NewErrorLocation("invalidValue", "Invalid view", "query", "view"),
+		},
+		"CreatedRangeBackwards": {
+			search: models.CodeSampleSearch{
+				Page:          1,
+				PageSize:      20,
+				CreatedAfter:  time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+				CreatedBefore: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			expectedError: models.NewErrorLocation(
+				"invalidValue",
+				"createdAfter must be before createdBefore",
+				"query",
+				"createdAfter",
+			),
+		},
 	}
 
 	for name, testData := range tests {
@@ -68,6 +140,137 @@ func TestListCodeSamplesInvalidParams(t *testing.T) {
 	}
 }
 
+func TestListCodeSamplesNormalizesTags(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.SetQueryArgs(models.CodeSampleSearch{
+		Page:     1,
+		PageSize: 20,
+		Tags:     []string{"HTTP Client", "regex"},
+		AnyTags:  []string{"Go"},
+	})
+	r.AssertStatus(routes.ListCodeSamplesHandler, 200)
+
+	calls := r.DB.GetCalls("FindCodeSamples")
+	assert.Equal(t, 1, len(calls))
+
+	if len(calls) == 1 {
+		search := calls[0][0].(models.CodeSampleSearch)
+		assert.Equal(t, []string{"http-client", "regex"}, search.Tags)
+		assert.Equal(t, []string{"go"}, search.AnyTags)
+	}
+}
+
+func TestListCodeSamplesInvalidQueryString(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().URI().SetQueryString("createdAfter=yesterday")
+	r.AssertStatus(routes.ListCodeSamplesHandler, 422)
+
+	r.AssertResponseError(models.NewErrorLocation("invalidValue", "Invalid query string", "query"))
+}
+
+func TestListCodeSamplesFilters(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().URI().SetQueryString(
+		"submittedBy=" + testutils.UUIDFromInt(1).String() +
+			"&createdAfter=2023-01-01T00:00:00Z" +
+			"&modifiedAfter=2023-02-01T12:30:00Z",
+	)
+	r.AssertStatus(routes.ListCodeSamplesHandler, 200)
+
+	calls := r.DB.GetCalls("FindCodeSamples")
+	assert.Equal(t, 1, len(calls))
+
+	if len(calls) == 1 {
+		search := calls[0][0].(models.CodeSampleSearch)
+		assert.Equal(t, "", search.Query)
+		assert.Equal(t, testutils.UUIDFromInt(1), search.SubmittedBy)
+		assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), search.CreatedAfter)
+		assert.True(t, search.CreatedBefore.IsZero())
+		assert.Equal(t, time.Date(2023, 2, 1, 12, 30, 0, 0, time.UTC), search.ModifiedAfter)
+		assert.Equal(t, uint64(1), search.Page)
+		assert.Equal(t, uint64(20), search.PageSize)
+	}
+}
+
+func TestListCodeSamplesSummaryView(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.FindCodeSampleSummariesResult.A = models.CodeSampleSummaryPage{
+		Count: 1,
+		Results: []models.CodeSampleSummary{
+			{
+				ID:    testutils.UUIDFromInt(1),
+				Title: "Adding two numbers",
+				Tags:  []string{},
+				Highlights: models.CodeSampleHighlights{
+					Title: "<mark>Adding</mark> two numbers",
+					Lines: []models.CodeSampleLine{{Number: 1, Text: "x + y"}},
+				},
+			},
+		},
+	}
+
+	r.SetQueryArgs(models.CodeSampleSearch{Query: "add", View: models.ViewSummary, Page: 1, PageSize: 20})
+	r.AssertStatus(routes.ListCodeSamplesHandler, 200)
+
+	assert.Equal(t, 0, len(r.DB.GetCalls("FindCodeSamples")))
+	assert.Equal(t, 1, len(r.DB.GetCalls("FindCodeSampleSummaries")))
+
+	var page models.CodeSampleSummaryPage
+	r.GetResponse(&page)
+
+	assert.Equal(t, r.DB.FindCodeSampleSummariesResult.A, page)
+}
+
+func TestListCodeSamplesCursor(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().URI().SetQueryString("cursor=abc&includeCount=false")
+	r.AssertStatus(routes.ListCodeSamplesHandler, 200)
+
+	calls := r.DB.GetCalls("FindCodeSamples")
+	assert.Equal(t, 1, len(calls))
+
+	if len(calls) == 1 {
+		search := calls[0][0].(models.CodeSampleSearch)
+		assert.Equal(t, "abc", search.Cursor)
+		assert.Equal(t, uint64(20), search.PageSize)
+		assert.False(t, search.CountIncluded())
+	}
+}
+
+func TestListCodeSamplesInvalidCursor(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.FindCodeSamplesResult.B = database.InvalidCursorErr
+
+	r.Ctx.Request().URI().SetQueryString("cursor=abc")
+	r.AssertStatus(routes.ListCodeSamplesHandler, 422)
+
+	r.AssertResponseError(models.NewErrorLocation("invalidValue", "Invalid cursor", "query", "cursor"))
+}
+
 func TestSubmitCodeSample(t *testing.T) {
 	var tests = map[string]struct {
 		mode routes.SubmitMode
@@ -91,8 +294,8 @@ func TestSubmitCodeSample(t *testing.T) {
 			}
 
 			// Mock session and database results.
-			apisession.SaveUser(r.Ctx, user)
-			r.DB.GetUserResult.A = user
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
 			r.DB.GetLanguageResult.A = language
 
 			submission := models.CodeSampleSubmission{
@@ -100,6 +303,7 @@ func TestSubmitCodeSample(t *testing.T) {
 				Title:       "My Code Sample",
 				Description: "My Description",
 				Body:        "2 + 2 == 4",
+				Tags:        []string{"Basic_Math", " regex", "regex", "http  client"},
 			}
 			r.SetRequestBody(submission)
 
@@ -110,12 +314,15 @@ func TestSubmitCodeSample(t *testing.T) {
 				Title:       submission.Title,
 				Description: submission.Description,
 				Body:        submission.Body,
+				Tags:        []string{"basic-math", "http-client", "regex"},
 			}
 
 			pastTime := time.Now().Add(-1 * time.Second)
 
 			if testData.mode == routes.Create {
-				r.AssertStatus(routes.CreateCodeSampleHandler, 201)
+				r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+					return routes.CreateCodeSampleHandler(db, routes.SubmissionPolicy{})
+				}, 201)
 			} else {
 				expectedSample.Created = pastTime
 				r.DB.GetCodeSampleResult.A = expectedSample
@@ -171,6 +378,7 @@ func TestUpdateCodeSampleValidation(t *testing.T) {
 	var tests = map[string]struct {
 		submission         models.CodeSampleSubmission
 		paramsID           string
+		language           models.Language
 		languageError      error
 		sample             models.CodeSample
 		expectedStatusCode int
@@ -200,6 +408,33 @@ func TestUpdateCodeSampleValidation(t *testing.T) {
 			expectedStatusCode: 422,
 			expectedError:      models.NewErrorLocation("notFound", "Language not found", "body", "languageId"),
 		},
+		"InvalidTags": {
+			submission:         models.CodeSampleSubmission{Tags: []string{"ok", "<script>"}},
+			paramsID:           testutils.UUIDFromInt(1).String(),
+			sample:             models.CodeSample{},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("invalidValue", "Invalid tags", "body", "tags"),
+		},
+		"TooManyTags": {
+			submission: models.CodeSampleSubmission{
+				Tags: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"},
+			},
+			paramsID:           testutils.UUIDFromInt(1).String(),
+			sample:             models.CodeSample{},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("invalidValue", "Too many tags", "body", "tags"),
+		},
+		"RetiredLanguage": {
+			submission: models.CodeSampleSubmission{LanguageID: "cobol"},
+			paramsID:   testutils.UUIDFromInt(1).String(),
+			language:   models.Language{ID: "cobol", Name: "COBOL", Retired: true},
+			sample: models.CodeSample{
+				SubmittedBy: models.User{ID: testutils.UUIDFromInt(2)},
+				Language:    models.Language{ID: "python", Name: "Python"},
+			},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("retiredLanguage", "Language is retired", "body", "languageId"),
+		},
 	}
 
 	for name, testData := range tests {
@@ -211,9 +446,10 @@ func TestUpdateCodeSampleValidation(t *testing.T) {
 			defer r.Release()
 
 			user := models.User{ID: testutils.UUIDFromInt(2)}
-			apisession.SaveUser(r.Ctx, user)
-			r.DB.GetUserResult.A = user
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
 
+			r.DB.GetLanguageResult.A = testData.language
 			r.DB.GetLanguageResult.B = testData.languageError
 
 			r.SetRequestBody(testData.submission)
@@ -227,6 +463,74 @@ func TestUpdateCodeSampleValidation(t *testing.T) {
 	}
 }
 
+func TestCreateCodeSamplePolicy(t *testing.T) {
+	var tests = map[string]struct {
+		policy             routes.SubmissionPolicy
+		account            models.Account
+		expectedStatusCode int
+		expectedError      models.ErrorLocation
+	}{
+		"VerifiedEmail": {
+			policy:             routes.SubmissionPolicy{RequireVerifiedEmail: true},
+			account:            models.Account{EmailVerified: true},
+			expectedStatusCode: 201,
+		},
+		"UnverifiedEmail": {
+			policy:             routes.SubmissionPolicy{RequireVerifiedEmail: true},
+			expectedStatusCode: 403,
+			expectedError: models.NewErrorLocation(
+				"emailNotVerified",
+				"A verified email address is required to submit code samples",
+				"body",
+			),
+		},
+		"TwoFactorEnabled": {
+			policy:             routes.SubmissionPolicy{RequireTwoFactor: true},
+			account:            models.Account{TwoFactorEnabled: true},
+			expectedStatusCode: 201,
+		},
+		"TwoFactorDisabled": {
+			policy:             routes.SubmissionPolicy{RequireTwoFactor: true},
+			account:            models.Account{EmailVerified: true},
+			expectedStatusCode: 403,
+			expectedError: models.NewErrorLocation(
+				"twoFactorRequired",
+				"Two-factor authentication is required to submit code samples",
+				"body",
+			),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1)}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			testData.account.User = user
+			r.DB.GetAccountResult.A = testData.account
+			r.DB.GetLanguageResult.A = models.Language{ID: "python", Name: "Python"}
+
+			r.SetRequestBody(models.CodeSampleSubmission{LanguageID: "python", Title: "Title"})
+			r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+				return routes.CreateCodeSampleHandler(db, testData.policy)
+			}, testData.expectedStatusCode)
+
+			if testData.expectedStatusCode == 201 {
+				assert.Equal(t, 1, len(r.DB.GetCalls("CreateCodeSample")))
+			} else {
+				r.AssertResponseError(testData.expectedError)
+				assert.Equal(t, 0, len(r.DB.GetCalls("CreateCodeSample")))
+			}
+		})
+	}
+}
+
 func TestGetCodeSample(t *testing.T) {
 	t.Parallel()
 
@@ -268,8 +572,8 @@ func TestDeleteCodeSample(t *testing.T) {
 	defer r.Release()
 
 	user := models.User{ID: testutils.UUIDFromInt(1)}
-	err := apisession.SaveUser(r.Ctx, user)
-	r.DB.GetUserResult.A = user
+	err := apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
 
 	assert.Nil(t, err)
 
@@ -291,6 +595,81 @@ func TestDeleteCodeSample(t *testing.T) {
 	}
 }
 
+func TestModerateCodeSample(t *testing.T) {
+	var tests = map[string]struct {
+		role               models.Role
+		expectedStatusCode int
+	}{
+		"User":      {role: models.RoleUser, expectedStatusCode: 403},
+		"Moderator": {role: models.RoleModerator, expectedStatusCode: 200},
+		"Admin":     {role: models.RoleAdmin, expectedStatusCode: 200},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(2), Role: testData.role}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+
+			language := models.Language{ID: "python", Name: "Python"}
+			r.DB.GetLanguageResult.A = language
+			r.DB.GetCodeSampleResult.A = models.CodeSample{
+				ID:          testutils.UUIDFromInt(123),
+				SubmittedBy: models.User{ID: testutils.UUIDFromInt(1)},
+				Language:    language,
+			}
+			r.SetRequestBody(models.CodeSampleSubmission{
+				LanguageID: language.ID,
+				Title:      "Cleaned up title",
+				Body:       "x + y",
+			})
+			r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(123).String()))
+
+			r.AssertStatus(routes.UpdateCodeSampleHandler, testData.expectedStatusCode)
+
+			calls := r.DB.GetCalls("UpdateCodeSample")
+
+			if testData.expectedStatusCode == 200 && assert.Equal(t, 1, len(calls)) {
+				// The sample should keep its submitter, with the moderator as the editor.
+				assert.Equal(t, testutils.UUIDFromInt(1), calls[0][0].(models.CodeSample).SubmittedBy.ID)
+				assert.Equal(t, user.ID, calls[0][1].(uuid.UUID))
+			} else if testData.expectedStatusCode != 200 {
+				assert.Equal(t, 0, len(calls))
+			}
+		})
+	}
+}
+
+func TestDeleteCodeSampleAsModerator(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	moderator := models.User{ID: testutils.UUIDFromInt(2), Role: models.RoleModerator}
+	apisession.SaveUser(r.Ctx, r.DB, moderator)
+	r.DB.GetSessionUserResult.A = moderator
+
+	r.DB.GetCodeSampleResult.A = models.CodeSample{
+		ID:          testutils.UUIDFromInt(123),
+		SubmittedBy: models.User{ID: testutils.UUIDFromInt(1)},
+	}
+	r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(123).String()))
+	r.AssertStatus(routes.DeleteCodeSampleHandler, 204)
+
+	assert.Equal(
+		t,
+		[][]any{{testutils.UUIDFromInt(123), moderator.ID}},
+		r.DB.GetCalls("DeleteCodeSample"),
+	)
+}
+
 func TestDeleteCodeSampleValidation(t *testing.T) {
 	var tests = map[string]struct {
 		paramsID           string
@@ -323,8 +702,8 @@ func TestDeleteCodeSampleValidation(t *testing.T) {
 			defer r.Release()
 
 			user := models.User{ID: testutils.UUIDFromInt(2)}
-			apisession.SaveUser(r.Ctx, user)
-			r.DB.GetUserResult.A = user
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
 
 			r.DB.GetCodeSampleResult.A = testData.sample
 			r.SetParams(ranges.MakePair("id", testData.paramsID))
@@ -342,8 +721,8 @@ func TestDeleteCodeSample404(t *testing.T) {
 	defer r.Release()
 
 	user := models.User{ID: testutils.UUIDFromInt(1)}
-	apisession.SaveUser(r.Ctx, user)
-	r.DB.GetUserResult.A = user
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
 
 	id := testutils.UUIDFromInt(1)
 
@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+const maximumEmailLength = 255
+
+// emailVerificationLifetime is how long a verification email can be used for.
+const emailVerificationLifetime = 24 * time.Hour
+
+// checkEmail does a basic check that an email address looks right.
+// Sending a link to the address is the real check.
+func checkEmail(email string) (models.ErrorLocation, bool) {
+	at := strings.LastIndex(email, "@")
+
+	if at < 1 || at == len(email)-1 || strings.ContainsAny(email, " \t\r\n") {
+		return models.NewErrorLocation("badEmail", "Invalid email address", "body", "email"), false
+	}
+
+	if len(email) > maximumEmailLength {
+		return models.NewErrorLocation("badEmail", "Email address too long", "body", "email"), false
+	}
+
+	return models.ErrorLocation{}, true
+}
+
+// sendEmailVerification emails a link for verifying an address for a user.
+func sendEmailVerification(
+	c *fiber.Ctx,
+	db database.DatabaseAPI,
+	mail AccountMail,
+	user models.User,
+	email string,
+) error {
+	token, err := generateToken("")
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = db.CreateEmailVerification(
+		c.Context(),
+		user.ID,
+		email,
+		database.HashToken(token),
+		now,
+		now.Add(emailVerificationLifetime),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	link := mail.link("/verify-email", token)
+
+	return mail.Send(c.Context(), mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\n"+
+				"Please verify your email address within the next day here:\n\n"+
+				"%s\n\n"+
+				"If you didn't add this address to an account, you can ignore this email.\n",
+			user.Username,
+			link,
+		),
+	})
+}
+
+// RequestEmailVerificationHandler godoc
+// @Tags Users
+// @Summary Resend an email verification link
+// @Description Email a new link for verifying the email address for the current user
+// @Success 204
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/users/me/email/verification [post]
+func RequestEmailVerificationHandler(db database.DatabaseAPI, mail AccountMail) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		account, err := db.GetAccount(c.Context(), user.ID)
+
+		if err != nil {
+			return err
+		}
+
+		if account.Email == nil {
+			return sendBodyError(c, 422, "noEmail", "There is no email address to verify")
+		}
+
+		if account.EmailVerified {
+			return sendBodyError(c, 422, "emailVerified", "Email address is already verified")
+		}
+
+		if err := sendEmailVerification(c, db, mail, account.User, *account.Email); err != nil {
+			return err
+		}
+
+		c.Status(204)
+
+		return nil
+	}
+}
+
+// VerifyEmailHandler godoc
+// @Tags Authentication
+// @Summary Verify an email address
+// @Description Verify an email address with a token from a verification email. Other users who added the address without verifying it lose it
+// @Param data body EmailVerification true "The token from the email"
+// @Success 204
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/auth/verify-email [post]
+func VerifyEmailHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var verification models.EmailVerification
+
+		if err := c.BodyParser(&verification); err != nil {
+			return err
+		}
+
+		err := database.NotFoundErr
+
+		if len(verification.Token) > 0 {
+			err = db.VerifyEmail(c.Context(), database.HashToken(verification.Token), time.Now())
+		}
+
+		if errors.Is(err, database.NotFoundErr) {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "token"),
+			})
+		}
+
+		if errors.Is(err, database.DuplicateEmailErr) {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("duplicateEmail", "Email address already in use", "body"),
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		c.Status(204)
+
+		return nil
+	}
+}
@@ -0,0 +1,291 @@
+package routes_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeEmail(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	var buffer bytes.Buffer
+	mail := testMail(&buffer)
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetAccountResult.A = models.Account{
+		User:          user,
+		Email:         stringPointer("old@example.com"),
+		EmailVerified: true,
+	}
+
+	r.SetRequestBody(models.UserUpdate{Email: stringPointer("new@example.com")})
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.UpdateCurrentUserHandler(db, mail)
+	}, 200)
+
+	var actualAccount models.Account
+	r.GetResponse(&actualAccount)
+	assert.Equal(
+		t,
+		models.Account{User: user, Email: stringPointer("new@example.com")},
+		actualAccount,
+	)
+	assert.Equal(
+		t,
+		[][]any{{user.ID, database.AccountChanges{ChangeEmail: true, Email: stringPointer("new@example.com")}}},
+		r.DB.GetCalls("UpdateAccount"),
+	)
+
+	calls := r.DB.GetCalls("CreateEmailVerification")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0])
+		assert.Equal(t, "new@example.com", calls[0][1])
+	}
+
+	assert.Contains(t, buffer.String(), "To: new@example.com\r\n")
+}
+
+func TestRemoveEmail(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	var buffer bytes.Buffer
+	mail := testMail(&buffer)
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetAccountResult.A = models.Account{
+		User:          user,
+		Email:         stringPointer("old@example.com"),
+		EmailVerified: true,
+	}
+
+	r.SetRequestBody(models.UserUpdate{Email: stringPointer("")})
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.UpdateCurrentUserHandler(db, mail)
+	}, 200)
+
+	var actualAccount models.Account
+	r.GetResponse(&actualAccount)
+	assert.Equal(t, models.Account{User: user}, actualAccount)
+	assert.Equal(t, [][]any{{user.ID, database.AccountChanges{ChangeEmail: true}}}, r.DB.GetCalls("UpdateAccount"))
+	assert.Equal(t, 0, buffer.Len())
+}
+
+func TestKeepSameEmail(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	var buffer bytes.Buffer
+	mail := testMail(&buffer)
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	account := models.Account{
+		User:          user,
+		Email:         stringPointer("user@example.com"),
+		EmailVerified: true,
+	}
+	r.DB.GetAccountResult.A = account
+
+	r.SetRequestBody(models.UserUpdate{Email: stringPointer("user@example.com")})
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.UpdateCurrentUserHandler(db, mail)
+	}, 200)
+
+	// Sending the same address again shouldn't lose the verification.
+	var actualAccount models.Account
+	r.GetResponse(&actualAccount)
+	assert.Equal(t, account, actualAccount)
+	assert.Equal(t, 0, len(r.DB.GetCalls("UpdateAccount")))
+	assert.Equal(t, 0, buffer.Len())
+}
+
+func TestChangeEmailErrors(t *testing.T) {
+	var tests = map[string]struct {
+		email              string
+		databaseError      error
+		expectedStatusCode int
+		expectedError      models.ErrorLocation
+	}{
+		"InvalidEmail": {
+			email:              "user",
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("badEmail", "Invalid email address", "body", "email"),
+		},
+		"HeaderInjection": {
+			email:              "user@example.com\r\nBcc: other@example.com",
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("badEmail", "Invalid email address", "body", "email"),
+		},
+		"EmailTooLong": {
+			email:              testutils.GenerateString('x', 250) + "@example.com",
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("badEmail", "Email address too long", "body", "email"),
+		},
+		"DuplicateEmail": {
+			email:              "taken@example.com",
+			databaseError:      database.DuplicateEmailErr,
+			expectedStatusCode: 403,
+			expectedError:      models.NewErrorLocation("duplicateEmail", "Email address already in use", "body", "email"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			var buffer bytes.Buffer
+			mail := testMail(&buffer)
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			r.DB.GetAccountResult.A = models.Account{User: user}
+			r.DB.UpdateAccountResult = testData.databaseError
+
+			r.SetRequestBody(models.UserUpdate{Email: &testData.email})
+			r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+				return routes.UpdateCurrentUserHandler(db, mail)
+			}, testData.expectedStatusCode)
+			r.AssertResponseError(testData.expectedError)
+			assert.Equal(t, 0, buffer.Len())
+		})
+	}
+}
+
+func TestRequestEmailVerification(t *testing.T) {
+	var tests = map[string]struct {
+		account            models.Account
+		expectedStatusCode int
+		expectedError      models.ErrorLocation
+	}{
+		"Unverified": {
+			account:            models.Account{Email: stringPointer("user@example.com")},
+			expectedStatusCode: 204,
+		},
+		"NoEmail": {
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("noEmail", "There is no email address to verify", "body"),
+		},
+		"AlreadyVerified": {
+			account:            models.Account{Email: stringPointer("user@example.com"), EmailVerified: true},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("emailVerified", "Email address is already verified", "body"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			var buffer bytes.Buffer
+			mail := testMail(&buffer)
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			testData.account.User = user
+			r.DB.GetAccountResult.A = testData.account
+
+			r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+				return routes.RequestEmailVerificationHandler(db, mail)
+			}, testData.expectedStatusCode)
+
+			if testData.expectedStatusCode == 204 {
+				assert.Equal(t, 1, len(r.DB.GetCalls("CreateEmailVerification")))
+				assert.Contains(t, buffer.String(), "To: user@example.com\r\n")
+			} else {
+				r.AssertResponseError(testData.expectedError)
+				assert.Equal(t, 0, buffer.Len())
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.SetRequestBody(models.EmailVerification{Token: "abc"})
+	r.AssertStatus(routes.VerifyEmailHandler, 204)
+
+	calls := r.DB.GetCalls("VerifyEmail")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, database.HashToken("abc"), calls[0][0])
+	}
+}
+
+func TestVerifyEmailErrors(t *testing.T) {
+	var tests = map[string]struct {
+		token         string
+		databaseError error
+	}{
+		"ExpiredToken": {token: "abc", databaseError: database.NotFoundErr},
+		"MissingToken": {},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			r.DB.VerifyEmailResult = testData.databaseError
+
+			r.SetRequestBody(models.EmailVerification{Token: testData.token})
+			r.AssertStatus(routes.VerifyEmailHandler, 422)
+			r.AssertResponseError(
+				models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "token"),
+			)
+		})
+	}
+}
+
+func TestVerifyEmailVerifiedElsewhere(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.VerifyEmailResult = database.DuplicateEmailErr
+
+	r.SetRequestBody(models.EmailVerification{Token: "abc"})
+	r.AssertStatus(routes.VerifyEmailHandler, 403)
+	r.AssertResponseError(
+		models.NewErrorLocation("duplicateEmail", "Email address already in use", "body"),
+	)
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/buildinfo"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// readyTimeout is how long the database has to answer readiness checks.
+const readyTimeout = 2 * time.Second
+
+// probePaths are requested constantly by orchestrators and monitoring, so they
+// aren't rate limited or logged.
+var probePaths = map[string]bool{
+	"/healthz":     true,
+	"/readyz":      true,
+	"/api/version": true,
+}
+
+// IsProbe returns true for health, readiness and version requests.
+func IsProbe(c *fiber.Ctx) bool {
+	return probePaths[routePath(c)]
+}
+
+// HealthHandler godoc
+// @Tags Health
+// @Summary Check Health
+// @Description Check the process is running
+// @Success 200 {object} Status
+// @Router /healthz [get]
+func HealthHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(models.Status{Status: "ok"})
+	}
+}
+
+// ReadyHandler godoc
+// @Tags Health
+// @Summary Check Readiness
+// @Description Check the app can serve requests, with the database reachable
+// @Description and the schema up to date
+// @Success 200 {object} Status
+// @Failure 503 {object} Error
+// @Router /readyz [get]
+func ReadyHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), readyTimeout)
+		defer cancel()
+
+		if err := db.Ping(ctx); err != nil {
+			return sendError(c, 503, []models.ErrorLocation{
+				models.NewErrorLocation("databaseUnavailable", "The database can't be reached", "database"),
+			})
+		}
+
+		version, err := db.GetSchemaVersion(ctx)
+
+		if err != nil {
+			return sendError(c, 503, []models.ErrorLocation{
+				models.NewErrorLocation("schemaVersionUnknown", "The database schema version can't be read", "database"),
+			})
+		}
+
+		if version < database.SchemaVersion {
+			return sendError(c, 503, []models.ErrorLocation{
+				models.NewErrorLocation(
+					"schemaOutdated",
+					fmt.Sprintf("The database schema is version %d, but version %d is needed", version, database.SchemaVersion),
+					"database",
+				),
+			})
+		}
+
+		return c.JSON(models.Status{Status: "ready"})
+	}
+}
+
+// VersionHandler godoc
+// @Tags Health
+// @Summary Get Version
+// @Description Get the commit and build time of the app, and schema versions
+// @Success 200 {object} Version
+// @Router /api/version [get]
+func VersionHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		info := buildinfo.Get()
+		version := models.Version{
+			Commit:        info.Commit,
+			BuildTime:     info.Time,
+			SchemaVersion: database.SchemaVersion,
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), readyTimeout)
+		defer cancel()
+
+		// The version is still useful when the database is down.
+		if databaseVersion, err := db.GetSchemaVersion(ctx); err == nil {
+			version.DatabaseSchemaVersion = &databaseVersion
+		}
+
+		return c.JSON(version)
+	}
+}
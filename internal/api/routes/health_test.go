@@ -0,0 +1,142 @@
+package routes_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.AssertStatus(func(database.DatabaseAPI) fiber.Handler { return routes.HealthHandler() }, 200)
+
+	var status models.Status
+	r.GetResponse(&status)
+	assert.Equal(t, models.Status{Status: "ok"}, status)
+	assert.Empty(t, r.DB.GetCalls("Ping"), "Health checks shouldn't use the database")
+}
+
+func TestReady(t *testing.T) {
+	t.Parallel()
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetSchemaVersionResult.A = database.SchemaVersion
+
+	r.AssertStatus(routes.ReadyHandler, 200)
+
+	var status models.Status
+	r.GetResponse(&status)
+	assert.Equal(t, models.Status{Status: "ready"}, status)
+	assert.Len(t, r.DB.GetCalls("Ping"), 1)
+}
+
+func TestReadyNewerSchema(t *testing.T) {
+	t.Parallel()
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetSchemaVersionResult.A = database.SchemaVersion + 1
+
+	r.AssertStatus(routes.ReadyHandler, 200)
+}
+
+func TestNotReady(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		setup    func(db *databasemock.MockDatabaseAPI)
+		expected models.ErrorLocation
+	}{
+		{
+			"database down",
+			func(db *databasemock.MockDatabaseAPI) {
+				db.PingResult = errors.New("connection refused")
+			},
+			models.NewErrorLocation("databaseUnavailable", "The database can't be reached", "database"),
+		},
+		{
+			"no schema version",
+			func(db *databasemock.MockDatabaseAPI) {
+				db.GetSchemaVersionResult.B = errors.New(`relation "schema_version" does not exist`)
+			},
+			models.NewErrorLocation("schemaVersionUnknown", "The database schema version can't be read", "database"),
+		},
+		{
+			"old schema",
+			func(db *databasemock.MockDatabaseAPI) {
+				db.GetSchemaVersionResult.A = database.SchemaVersion - 1
+			},
+			models.NewErrorLocation(
+				"schemaOutdated",
+				fmt.Sprintf(
+					"The database schema is version %d, but version %d is needed",
+					database.SchemaVersion-1,
+					database.SchemaVersion,
+				),
+				"database",
+			),
+		},
+	} {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			test.setup(r.DB)
+
+			r.AssertStatus(routes.ReadyHandler, 503)
+			r.AssertResponseError(test.expected)
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetSchemaVersionResult.A = 4
+
+	r.AssertStatus(routes.VersionHandler, 200)
+
+	databaseVersion := 4
+	var version models.Version
+	r.GetResponse(&version)
+	assert.Equal(
+		t,
+		models.Version{
+			Commit:                "unknown",
+			BuildTime:             "unknown",
+			SchemaVersion:         database.SchemaVersion,
+			DatabaseSchemaVersion: &databaseVersion,
+		},
+		version,
+	)
+}
+
+func TestVersionDatabaseDown(t *testing.T) {
+	t.Parallel()
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetSchemaVersionResult.B = errors.New("connection refused")
+
+	r.AssertStatus(routes.VersionHandler, 200)
+
+	var version models.Version
+	r.GetResponse(&version)
+	assert.Equal(t, database.SchemaVersion, version.SchemaVersion)
+	assert.Nil(t, version.DatabaseSchemaVersion)
+}
@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+const maximumLanguageIDLength = 255
+const maximumLanguageNameLength = 255
+
+var languageIDRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+type LanguageListParams struct {
+	Retired bool `query:"retired"`
+}
+
+func validateLanguageName(name string) []models.ErrorLocation {
+	errorDetail := []models.ErrorLocation{}
+
+	if len(name) == 0 {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Name is required", "body", "name"),
+		)
+	} else if len(name) > maximumLanguageNameLength {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Name too long", "body", "name"),
+		)
+	}
+
+	return errorDetail
+}
+
+// ListLanguagesHandler godoc
+// @Tags Languages
+// @Summary List Languages
+// @Description List languages code samples can be submitted for
+// @Param retired query boolean false "Include retired languages"
+// @Success 200 {array} LanguageSummary
+// @Router /api/languages [get]
+func ListLanguagesHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var params LanguageListParams
+
+		if err := c.QueryParser(&params); err != nil {
+			return err
+		}
+
+		languages, err := db.ListLanguages(c.Context(), params.Retired)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(languages)
+	}
+}
+
+// GetLanguageHandler godoc
+// @Tags Languages
+// @Summary Get a Language
+// @Description Get a language, including retired languages
+// @Param id path string true "The ID of the language to get"
+// @Success 200 {object} LanguageSummary
+// @Failure 404 {object} Error
+// @Router /api/languages/{id} [get]
+func GetLanguageHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		language, err := db.GetLanguageSummary(c.Context(), c.Params("id"))
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(language)
+	}
+}
+
+// CreateLanguageHandler godoc
+// @Tags Languages
+// @Summary Create a Language
+// @Description Add a new language. Admin only.
+// @Param data body LanguageSubmission true "Language data"
+// @Success 201 {object} Language
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/languages [post]
+func CreateLanguageHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := permittedUser(c, models.PermissionManageLanguages); !ok {
+			return sendPermissionDenied(c)
+		}
+
+		var submission models.LanguageSubmission
+
+		if err := c.BodyParser(&submission); err != nil {
+			return err
+		}
+
+		errorDetail := []models.ErrorLocation{}
+
+		if len(submission.ID) > maximumLanguageIDLength ||
+			!languageIDRegex.MatchString(submission.ID) {
+			errorDetail = append(
+				errorDetail,
+				models.NewErrorLocation("invalidValue", "Invalid language ID", "body", "id"),
+			)
+		}
+
+		errorDetail = append(errorDetail, validateLanguageName(submission.Name)...)
+
+		if len(errorDetail) > 0 {
+			return sendError(c, 422, errorDetail)
+		}
+
+		language := models.Language{
+			ID:   submission.ID,
+			Name: submission.Name,
+		}
+		err := db.CreateLanguage(c.Context(), language)
+
+		if errors.Is(err, database.DuplicateErr) {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("duplicateLanguage", "Language already exists", "body", "id"),
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return c.Status(201).JSON(language)
+	}
+}
+
+// RenameLanguageHandler godoc
+// @Tags Languages
+// @Summary Rename a Language
+// @Description Change the display name of a language. Admin only.
+// @Param id path string true "The ID of the language to rename"
+// @Param data body LanguageRename true "Language data"
+// @Success 200 {object} Language
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/languages/{id} [put]
+func RenameLanguageHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := permittedUser(c, models.PermissionManageLanguages); !ok {
+			return sendPermissionDenied(c)
+		}
+
+		var rename models.LanguageRename
+
+		if err := c.BodyParser(&rename); err != nil {
+			return err
+		}
+
+		if errorDetail := validateLanguageName(rename.Name); len(errorDetail) > 0 {
+			return sendError(c, 422, errorDetail)
+		}
+
+		id := c.Params("id")
+
+		if err := db.RenameLanguage(c.Context(), id, rename.Name); err != nil {
+			return err
+		}
+
+		language, err := db.GetLanguage(c.Context(), id)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(language)
+	}
+}
+
+// RetireLanguageHandler godoc
+// @Tags Languages
+// @Summary Retire a Language
+// @Description Stop accepting new code samples for a language. Existing samples are kept. Admin only.
+// @Param id path string true "The ID of the language to retire"
+// @Success 204
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Router /api/languages/{id} [delete]
+func RetireLanguageHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := permittedUser(c, models.PermissionManageLanguages); !ok {
+			return sendPermissionDenied(c)
+		}
+
+		if err := db.RetireLanguage(c.Context(), c.Params("id")); err != nil {
+			return err
+		}
+
+		return c.SendStatus(204)
+	}
+}
@@ -0,0 +1,199 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/dense-analysis/ranges"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListLanguages(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	expectedLanguages := []models.LanguageSummary{
+		{
+			Language:    models.Language{ID: "python", Name: "Python"},
+			SampleCount: 3,
+		},
+	}
+	r.DB.ListLanguagesResult.A = expectedLanguages
+
+	r.AssertStatus(routes.ListLanguagesHandler, 200)
+
+	var actualLanguages []models.LanguageSummary
+	r.GetResponse(&actualLanguages)
+	assert.Equal(t, expectedLanguages, actualLanguages)
+
+	calls := r.DB.GetCalls("ListLanguages")
+	assert.Equal(t, [][]any{{false}}, calls)
+}
+
+func TestGetLanguage(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	expectedLanguage := models.LanguageSummary{
+		Language:    models.Language{ID: "cobol", Name: "COBOL", Retired: true},
+		SampleCount: 1,
+	}
+	r.DB.GetLanguageSummaryResult.A = expectedLanguage
+	r.SetParams(ranges.MakePair("id", "cobol"))
+
+	r.AssertStatus(routes.GetLanguageHandler, 200)
+
+	var actualLanguage models.LanguageSummary
+	r.GetResponse(&actualLanguage)
+	assert.Equal(t, expectedLanguage, actualLanguage)
+}
+
+func TestGetLanguage404(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetLanguageSummaryResult.B = database.NotFoundErr
+	r.SetParams(ranges.MakePair("id", "missing"))
+
+	r.AssertStatus(routes.GetLanguageHandler, 404)
+}
+
+func TestCreateLanguage(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	admin := models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin}
+	apisession.SaveUser(r.Ctx, r.DB, admin)
+	r.DB.GetSessionUserResult.A = admin
+
+	r.SetRequestBody(models.LanguageSubmission{ID: "zig", Name: "Zig"})
+	r.AssertStatus(requiring(models.PermissionManageLanguages, routes.CreateLanguageHandler), 201)
+
+	expectedLanguage := models.Language{ID: "zig", Name: "Zig"}
+	var actualLanguage models.Language
+	r.GetResponse(&actualLanguage)
+	assert.Equal(t, expectedLanguage, actualLanguage)
+	assert.Equal(t, [][]any{{expectedLanguage}}, r.DB.GetCalls("CreateLanguage"))
+}
+
+func TestCreateLanguageValidation(t *testing.T) {
+	var tests = map[string]struct {
+		user               models.User
+		submission         models.LanguageSubmission
+		databaseError      error
+		expectedStatusCode int
+		expectedErrors     []models.ErrorLocation
+	}{
+		"NotAdmin": {
+			user:               models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleUser},
+			submission:         models.LanguageSubmission{ID: "zig", Name: "Zig"},
+			expectedStatusCode: 403,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("forbidden", "Permission denied", "body"),
+			},
+		},
+		"InvalidFields": {
+			user:               models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin},
+			submission:         models.LanguageSubmission{ID: "Zig Lang", Name: ""},
+			expectedStatusCode: 422,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Invalid language ID", "body", "id"),
+				models.NewErrorLocation("invalidValue", "Name is required", "body", "name"),
+			},
+		},
+		"Duplicate": {
+			user:               models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin},
+			submission:         models.LanguageSubmission{ID: "python", Name: "Python"},
+			databaseError:      database.DuplicateErr,
+			expectedStatusCode: 422,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("duplicateLanguage", "Language already exists", "body", "id"),
+			},
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			apisession.SaveUser(r.Ctx, r.DB, testData.user)
+			r.DB.GetSessionUserResult.A = testData.user
+			r.DB.CreateLanguageResult = testData.databaseError
+
+			r.SetRequestBody(testData.submission)
+			r.AssertStatus(requiring(models.PermissionManageLanguages, routes.CreateLanguageHandler), testData.expectedStatusCode)
+			r.AssertResponseError(testData.expectedErrors...)
+		})
+	}
+}
+
+func TestRenameLanguage(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	admin := models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin}
+	apisession.SaveUser(r.Ctx, r.DB, admin)
+	r.DB.GetSessionUserResult.A = admin
+
+	expectedLanguage := models.Language{ID: "fortran", Name: "Fortran"}
+	r.DB.GetLanguageResult.A = expectedLanguage
+
+	r.SetParams(ranges.MakePair("id", "fortran"))
+	r.SetRequestBody(models.LanguageRename{Name: "Fortran"})
+	r.AssertStatus(requiring(models.PermissionManageLanguages, routes.RenameLanguageHandler), 200)
+
+	var actualLanguage models.Language
+	r.GetResponse(&actualLanguage)
+	assert.Equal(t, expectedLanguage, actualLanguage)
+	assert.Equal(t, [][]any{{"fortran", "Fortran"}}, r.DB.GetCalls("RenameLanguage"))
+}
+
+func TestRetireLanguage(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	admin := models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin}
+	apisession.SaveUser(r.Ctx, r.DB, admin)
+	r.DB.GetSessionUserResult.A = admin
+
+	r.SetParams(ranges.MakePair("id", "logo"))
+	r.AssertStatus(requiring(models.PermissionManageLanguages, routes.RetireLanguageHandler), 204)
+
+	assert.Equal(t, [][]any{{"logo"}}, r.DB.GetCalls("RetireLanguage"))
+}
+
+func TestRetireLanguageNotAdmin(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	r.SetParams(ranges.MakePair("id", "logo"))
+	r.AssertStatus(requiring(models.PermissionManageLanguages, routes.RetireLanguageHandler), 403)
+
+	assert.Equal(t, 0, len(r.DB.GetCalls("RetireLanguage")))
+}
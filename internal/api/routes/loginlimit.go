@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginLimit is how many failed logins are allowed for a key before logins
+// for the key are locked out.
+type loginLimit struct {
+	freeAttempts int
+	key          func(c *fiber.Ctx, username string) string
+}
+
+var usernameLoginLimit = loginLimit{
+	freeAttempts: 5,
+	key: func(c *fiber.Ctx, username string) string {
+		return "username:" + username
+	},
+}
+
+// Many users can share an IP address, so addresses are allowed more attempts.
+var ipLoginLimit = loginLimit{
+	freeAttempts: 20,
+	key: func(c *fiber.Ctx, username string) string {
+		return "ip:" + c.IP()
+	},
+}
+
+var loginLimits = []loginLimit{usernameLoginLimit, ipLoginLimit}
+
+const baseLockout = 30 * time.Second
+const maximumLockout = time.Hour
+
+// loginFailureWindow is how long failed logins are remembered for.
+const loginFailureWindow = 24 * time.Hour
+
+// lockoutDuration returns how long to lock out logins for after a number of
+// failures, doubling for each failure after the free attempts.
+func (limit loginLimit) lockoutDuration(failures int) time.Duration {
+	if failures < limit.freeAttempts {
+		return 0
+	}
+
+	doublings := failures - limit.freeAttempts
+
+	// Avoid overflowing when shifting after lots of failures.
+	if doublings >= 16 {
+		return maximumLockout
+	}
+
+	duration := baseLockout << doublings
+
+	if duration > maximumLockout {
+		return maximumLockout
+	}
+
+	return duration
+}
+
+func loginKeys(c *fiber.Ctx, username string) []string {
+	keys := make([]string, len(loginLimits))
+
+	for i, limit := range loginLimits {
+		keys[i] = limit.key(c, username)
+	}
+
+	return keys
+}
+
+// recordLoginFailure counts a failed login for a username and the client IP
+// address, locking out logins for either if there have been too many
+// failures. The end of the lockout is returned, or a zero time.
+func recordLoginFailure(c *fiber.Ctx, db database.DatabaseAPI, username string, now time.Time) (time.Time, error) {
+	var lockedUntil time.Time
+
+	for _, limit := range loginLimits {
+		key := limit.key(c, username)
+		failures, err := db.RecordLoginFailure(c.Context(), key, now, now.Add(-loginFailureWindow))
+
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		duration := limit.lockoutDuration(failures)
+
+		if duration == 0 {
+			continue
+		}
+
+		until := now.Add(duration)
+
+		if err := db.LockLogin(c.Context(), key, failures, until, now); err != nil {
+			return time.Time{}, err
+		}
+
+		if until.After(lockedUntil) {
+			lockedUntil = until
+		}
+	}
+
+	return lockedUntil, nil
+}
+
+// failLogin records a failed login and sends an error, or a 429 response if
+// there have now been too many failures.
+func failLogin(
+	c *fiber.Ctx,
+	db database.DatabaseAPI,
+	username string,
+	now time.Time,
+	errorLocation models.ErrorLocation,
+) error {
+	metrics.LoginsFailed.Inc()
+	lockedUntil, err := recordLoginFailure(c, db, username, now)
+
+	if err != nil {
+		return err
+	}
+
+	if !lockedUntil.IsZero() {
+		return sendLockedOut(c, lockedUntil, now)
+	}
+
+	return sendError(c, 403, []models.ErrorLocation{errorLocation})
+}
+
+// sendLockedOut sends a 429 response saying when logins can be tried again.
+func sendLockedOut(c *fiber.Ctx, until time.Time, now time.Time) error {
+	return sendTooManyRequests(c, "tooManyAttempts", "Too many failed login attempts", until.Sub(now))
+}
@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+)
+
+// backgroundMailTimeout is how long emails sent after responding can take,
+// including looking up who to send them to.
+const backgroundMailTimeout = time.Minute
+
+// AccountMail sends emails about accounts, with links back to the site.
+type AccountMail struct {
+	mailer.Mailer
+	// PublicURL is where the site is served. Links are built from it instead
+	// of the request, as clients can send any Host header.
+	PublicURL string
+	// Pending tracks emails still being sent after responding, so they can
+	// finish before the server stops.
+	Pending *sync.WaitGroup
+}
+
+// link returns the full URL for a page on the site taking a token.
+func (m AccountMail) link(path string, token string) string {
+	return strings.TrimSuffix(m.PublicURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendLater runs a task which sends mail after the response, so clients can't
+// tell from the response or how long it takes whether mail was sent.
+// Failures are logged instead.
+func (m AccountMail) sendLater(logger *slog.Logger, task func(ctx context.Context) error) {
+	m.Pending.Add(1)
+
+	go func() {
+		defer m.Pending.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundMailTimeout)
+		defer cancel()
+
+		if err := task(ctx); err != nil {
+			logger.Error("could not send email", "error", err)
+		}
+	}()
+}
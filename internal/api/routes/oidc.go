@@ -0,0 +1,281 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/metrics"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/oidc"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const oidcLoginCookie = "oidcLogin"
+
+// oidcLoginLifetime is how long someone has to log in with a provider.
+const oidcLoginLifetime = 10 * time.Minute
+
+// maximumProvisionAttempts is how many usernames are tried for a new user
+// before giving up.
+const maximumProvisionAttempts = 5
+
+// oidcLogin is kept in a cookie while someone logs in with a provider.
+type oidcLogin struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// Reauthenticate is set when the provider was asked to log the user in
+	// again, to confirm a change.
+	Reauthenticate bool `json:"reauthenticate,omitempty"`
+}
+
+func setOIDCLoginCookie(c *fiber.Ctx, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		HTTPOnly: true,
+		Secure:   true,
+		// The cookie has to be sent when the provider redirects back.
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Expires:  expires,
+	})
+}
+
+// loadOIDCLogin reads back the login started in the browser and clears it,
+// so it can only be used once.
+func loadOIDCLogin(c *fiber.Ctx) (oidcLogin, bool) {
+	var login oidcLogin
+
+	data, err := base64.RawURLEncoding.DecodeString(c.Cookies(oidcLoginCookie))
+	setOIDCLoginCookie(c, "", time.Unix(0, 0))
+
+	if err != nil || json.Unmarshal(data, &login) != nil {
+		return oidcLogin{}, false
+	}
+
+	return login, len(login.State) > 0
+}
+
+// externalUsername picks a username for a new user from their identity.
+func externalUsername(identity oidc.Identity) string {
+	username := strings.TrimSpace(identity.PreferredUsername)
+
+	if len(username) == 0 {
+		username, _, _ = strings.Cut(identity.Email, "@")
+		username = strings.TrimSpace(username)
+	}
+
+	if len(username) == 0 || reservedUsername(username) {
+		username = "user"
+	}
+
+	// Leave room for a suffix if the name is taken.
+	if len(username) > maximumUsernameLength-6 {
+		username = strings.ToValidUTF8(username[:maximumUsernameLength-6], "")
+	}
+
+	return username
+}
+
+// provisionExternalUser creates an account for someone logging in with a
+// provider for the first time.
+func provisionExternalUser(c *fiber.Ctx, db database.DatabaseAPI, identity oidc.Identity) (models.User, error) {
+	account := models.Account{User: models.User{Role: models.RoleUser}}
+
+	if _, ok := checkEmail(identity.Email); ok && identity.EmailVerified {
+		_, err := db.GetUserByEmail(c.Context(), identity.Email)
+
+		// An address which is already in use is left off instead of linking
+		// the accounts, so nobody can take over an account by adding its
+		// address at a provider.
+		if errors.Is(err, database.NotFoundErr) {
+			account.Email = &identity.Email
+			account.EmailVerified = true
+		} else if err != nil {
+			return models.User{}, err
+		}
+	}
+
+	username := externalUsername(identity)
+
+	for attempt := 1; ; attempt++ {
+		id, err := uuid.NewRandom()
+
+		if err != nil {
+			return models.User{}, err
+		}
+
+		account.ID = id
+		account.Username = username
+
+		if attempt > 1 {
+			number, err := rand.Int(rand.Reader, big.NewInt(10000))
+
+			if err != nil {
+				return models.User{}, err
+			}
+
+			account.Username = fmt.Sprintf("%s-%04d", username, number)
+		}
+
+		user, err := db.CreateExternalUser(c.Context(), account, models.ExternalIdentity{
+			UserID:  id,
+			Issuer:  identity.Issuer,
+			Subject: identity.Subject,
+			Created: time.Now(),
+		})
+
+		if errors.Is(err, database.DuplicateErr) && attempt < maximumProvisionAttempts {
+			continue
+		}
+
+		// Another login for the same identity might have created the user.
+		if err == nil && user.ID == id {
+			metrics.UsersRegistered.WithLabelValues("oidc").Inc()
+		}
+
+		return user, err
+	}
+}
+
+// OIDCLoginHandler godoc
+// @Tags Authentication
+// @Summary Log in with OpenID Connect
+// @Description Redirect the browser to an OpenID Connect provider to log in. The provider can be left out if only one is configured. Users without a password log in again with `reauthenticate` before deleting their account or turning off two-factor authentication
+// @Param provider query string false "The name of the provider"
+// @Param reauthenticate query bool false "Ask the provider to have the user log in again"
+// @Success 302
+// @Failure 404 {object} Error
+// @Router /api/auth/oidc/login [get]
+func OIDCLoginHandler(providers oidc.Providers) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		provider, ok := providers.Find(c.Query("provider"))
+
+		if !ok {
+			return sendError(c, 404, []models.ErrorLocation{
+				models.NewErrorLocation("unknownProvider", "Unknown login provider", "query", "provider"),
+			})
+		}
+
+		state, err := generateToken("")
+
+		if err != nil {
+			return err
+		}
+
+		nonce, err := generateToken("")
+
+		if err != nil {
+			return err
+		}
+
+		login := oidcLogin{
+			Provider:       provider.Name(),
+			State:          state,
+			Nonce:          nonce,
+			Verifier:       oidc.GenerateVerifier(),
+			Reauthenticate: c.QueryBool("reauthenticate"),
+		}
+		data, err := json.Marshal(login)
+
+		if err != nil {
+			return err
+		}
+
+		setOIDCLoginCookie(c, base64.RawURLEncoding.EncodeToString(data), time.Now().Add(oidcLoginLifetime))
+
+		return c.Redirect(provider.AuthCodeURL(
+			login.State,
+			login.Nonce,
+			login.Verifier,
+			login.Reauthenticate,
+		))
+	}
+}
+
+// OIDCCallbackHandler godoc
+// @Tags Authentication
+// @Summary Finish logging in with OpenID Connect
+// @Description The provider redirects back here after logging in. An account is created the first time someone logs in, with their email address if the provider has verified it. The provider is responsible for any second factor
+// @Param code query string true "The authorization code"
+// @Param state query string true "The state from the login"
+// @Success 302
+// @Failure 403 {object} Error
+// @Router /api/auth/oidc/callback [get]
+func OIDCCallbackHandler(db database.DatabaseAPI, providers oidc.Providers) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		login, ok := loadOIDCLogin(c)
+
+		if !ok || subtle.ConstantTimeCompare([]byte(login.State), []byte(c.Query("state"))) != 1 {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("invalidState", "Login expired or was started elsewhere", "query", "state"),
+			})
+		}
+
+		if len(c.Query("error")) > 0 {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("oidcError", "Login was refused by the provider", "query", "error"),
+			})
+		}
+
+		provider, ok := providers.Find(login.Provider)
+
+		if !ok {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("invalidState", "Login expired or was started elsewhere", "query", "state"),
+			})
+		}
+
+		// The request context from fasthttp can't be used for outgoing requests.
+		identity, err := provider.Exchange(c.UserContext(), c.Query("code"), login.Verifier, login.Nonce)
+
+		if err != nil {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("oidcError", "Could not log in with the provider", "query", "code"),
+			})
+		}
+
+		// Providers can log users in without asking, so check they really
+		// logged in again when asked to.
+		if login.Reauthenticate &&
+			(identity.AuthTime.IsZero() || time.Since(identity.AuthTime) > reauthenticationWindow) {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("reauthenticationRequired", "The provider didn't ask you to log in again", "query", "code"),
+			})
+		}
+
+		user, err := db.GetExternalIdentityUser(c.Context(), identity.Issuer, identity.Subject)
+
+		if errors.Is(err, database.NotFoundErr) {
+			user, err = provisionExternalUser(c, db, identity)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if login.Reauthenticate {
+			err = apisession.SaveReauthenticatedUser(c, db, user)
+		} else {
+			err = apisession.SaveUser(c, db, user)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return c.Redirect("/")
+	}
+}
@@ -0,0 +1,463 @@
+package routes_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/oidc"
+	"github.com/dense-analysis/codelibrary/internal/api/oidc/oidctest"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func startOIDCServer(t *testing.T) (*oidctest.Server, oidc.Providers) {
+	t.Helper()
+	server, err := oidctest.NewServer()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "https://codelibrary.example/api/auth/oidc/callback",
+	})
+
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+
+	return server, oidc.Providers{"test": provider}
+}
+
+// startOIDCLogin runs the login handler and logs in at the mock issuer,
+// returning the login cookie, code and state for the callback.
+func startOIDCLogin(t *testing.T, server *oidctest.Server, providers oidc.Providers) (string, string, string) {
+	t.Helper()
+
+	return startOIDCLoginWithQuery(t, server, providers, "")
+}
+
+// startOIDCLoginWithQuery is startOIDCLogin with a query for the login handler.
+func startOIDCLoginWithQuery(
+	t *testing.T,
+	server *oidctest.Server,
+	providers oidc.Providers,
+	query string,
+) (string, string, string) {
+	t.Helper()
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().URI().SetQueryString(query)
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.OIDCLoginHandler(providers)
+	}, 302)
+
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey("oidcLogin")
+
+	if !r.Ctx.Response().Header.Cookie(cookie) {
+		t.Fatal("No oidcLogin cookie was set")
+	}
+
+	code, state, err := server.Authorize(string(r.Ctx.Response().Header.Peek("Location")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(cookie.Value()), code, state
+}
+
+func setOIDCCallback(r RouteTester, cookie string, code string, state string) {
+	r.Ctx.Request().Header.SetCookie("oidcLogin", cookie)
+	r.Ctx.Request().URI().SetQueryString(url.Values{"code": {code}, "state": {state}}.Encode())
+}
+
+func oidcCallbackHandler(providers oidc.Providers) func(db database.DatabaseAPI) fiber.Handler {
+	return func(db database.DatabaseAPI) fiber.Handler {
+		return routes.OIDCCallbackHandler(db, providers)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+	server, providers := startOIDCServer(t)
+	defer server.Close()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().URI().SetQueryString("provider=test")
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.OIDCLoginHandler(providers)
+	}, 302)
+
+	location, err := url.Parse(string(r.Ctx.Response().Header.Peek("Location")))
+
+	assert.Nil(t, err)
+	assert.Equal(t, server.Issuer()+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, location.Query().Get("state"))
+	assert.NotEmpty(t, location.Query().Get("nonce"))
+
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey("oidcLogin")
+
+	if assert.True(t, r.Ctx.Response().Header.Cookie(cookie)) {
+		assert.True(t, cookie.HTTPOnly())
+		assert.Equal(t, fasthttp.CookieSameSiteLaxMode, cookie.SameSite())
+	}
+}
+
+func TestOIDCLoginReauthenticate(t *testing.T) {
+	t.Parallel()
+	server, providers := startOIDCServer(t)
+	defer server.Close()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().URI().SetQueryString("provider=test&reauthenticate=true")
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.OIDCLoginHandler(providers)
+	}, 302)
+
+	location, err := url.Parse(string(r.Ctx.Response().Header.Peek("Location")))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "login", location.Query().Get("prompt"))
+}
+
+func TestOIDCLoginUnknownProvider(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().URI().SetQueryString("provider=other")
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.OIDCLoginHandler(oidc.Providers{})
+	}, 404)
+
+	r.AssertResponseError(
+		models.NewErrorLocation("unknownProvider", "Unknown login provider", "query", "provider"),
+	)
+}
+
+func TestOIDCCallbackExistingUser(t *testing.T) {
+	t.Parallel()
+	server, providers := startOIDCServer(t)
+	defer server.Close()
+
+	cookie, code, state := startOIDCLogin(t, server, providers)
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "someone", Role: models.RoleUser}
+	r.DB.GetExternalIdentityUserResult.A = user
+	setOIDCCallback(r, cookie, code, state)
+
+	r.AssertStatus(oidcCallbackHandler(providers), 302)
+
+	assert.Equal(t, "/", string(r.Ctx.Response().Header.Peek("Location")))
+	assert.Equal(
+		t,
+		[][]any{{server.Issuer(), "subject"}},
+		r.DB.GetCalls("GetExternalIdentityUser"),
+	)
+	assert.Empty(t, r.DB.GetCalls("CreateExternalUser"))
+
+	if calls := r.DB.GetCalls("CreateSession"); assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0].(models.Session).UserID)
+		assert.False(t, calls[0][0].(models.Session).Reauthenticated)
+	}
+}
+
+func TestOIDCCallbackReauthenticate(t *testing.T) {
+	var tests = map[string]struct {
+		ignorePrompt       bool
+		expectedStatusCode int
+	}{
+		"LoggedInAgain": {expectedStatusCode: 302},
+		// Providers which log users in without asking can't confirm changes.
+		"PromptIgnored": {ignorePrompt: true, expectedStatusCode: 403},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			server, providers := startOIDCServer(t)
+			defer server.Close()
+
+			server.SetLoggedIn(time.Now().Add(-time.Hour))
+			server.SetIgnorePrompt(testData.ignorePrompt)
+			cookie, code, state := startOIDCLoginWithQuery(t, server, providers, "reauthenticate=true")
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "someone", Role: models.RoleUser}
+			r.DB.GetExternalIdentityUserResult.A = user
+			setOIDCCallback(r, cookie, code, state)
+
+			r.AssertStatus(oidcCallbackHandler(providers), testData.expectedStatusCode)
+
+			calls := r.DB.GetCalls("CreateSession")
+
+			if testData.expectedStatusCode == 302 {
+				if assert.Equal(t, 1, len(calls)) {
+					assert.Equal(t, user.ID, calls[0][0].(models.Session).UserID)
+					assert.True(t, calls[0][0].(models.Session).Reauthenticated)
+				}
+			} else {
+				r.AssertResponseError(models.NewErrorLocation(
+					"reauthenticationRequired",
+					"The provider didn't ask you to log in again",
+					"query",
+					"code",
+				))
+				assert.Empty(t, calls)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackProvisioning(t *testing.T) {
+	email := "someone@example.com"
+
+	var tests = map[string]struct {
+		claims           map[string]any
+		emailUserError   error
+		expectedUsername string
+		expectedEmail    *string
+	}{
+		"PreferredUsername": {
+			claims: map[string]any{
+				"sub":                "subject",
+				"preferred_username": "someone",
+				"email":              "someone@example.com",
+				"email_verified":     true,
+			},
+			emailUserError:   database.NotFoundErr,
+			expectedUsername: "someone",
+			expectedEmail:    &email,
+		},
+		"EmailUsername": {
+			claims: map[string]any{
+				"sub":            "subject",
+				"email":          "someone@example.com",
+				"email_verified": true,
+			},
+			emailUserError:   database.NotFoundErr,
+			expectedUsername: "someone",
+			expectedEmail:    &email,
+		},
+		"UnverifiedEmail": {
+			claims: map[string]any{
+				"sub":                "subject",
+				"preferred_username": "someone",
+				"email":              "someone@example.com",
+				"email_verified":     false,
+			},
+			expectedUsername: "someone",
+		},
+		"EmailInUse": {
+			claims: map[string]any{
+				"sub":                "subject",
+				"preferred_username": "someone",
+				"email":              "someone@example.com",
+				"email_verified":     true,
+			},
+			expectedUsername: "someone",
+		},
+		"NoName": {
+			claims:           map[string]any{"sub": "subject"},
+			expectedUsername: "user",
+		},
+		"ReservedName": {
+			claims: map[string]any{
+				"sub":                "subject",
+				"preferred_username": "ghost",
+			},
+			expectedUsername: "user",
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			server, providers := startOIDCServer(t)
+			defer server.Close()
+
+			server.SetClaims(testData.claims)
+			cookie, code, state := startOIDCLogin(t, server, providers)
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			r.DB.GetExternalIdentityUserResult.B = database.NotFoundErr
+			r.DB.GetUserByEmailResult.B = testData.emailUserError
+			r.DB.CreateExternalUserResult.A = models.User{ID: testutils.UUIDFromInt(3)}
+			setOIDCCallback(r, cookie, code, state)
+
+			r.AssertStatus(oidcCallbackHandler(providers), 302)
+
+			calls := r.DB.GetCalls("CreateExternalUser")
+
+			if !assert.Equal(t, 1, len(calls)) {
+				return
+			}
+
+			account := calls[0][0].(models.Account)
+			identity := calls[0][1].(models.ExternalIdentity)
+
+			assert.Equal(t, testData.expectedUsername, account.Username)
+			assert.Equal(t, models.RoleUser, account.Role)
+			assert.Equal(t, testData.expectedEmail, account.Email)
+			assert.Equal(t, testData.expectedEmail != nil, account.EmailVerified)
+			assert.Equal(t, account.ID, identity.UserID)
+			assert.Equal(t, server.Issuer(), identity.Issuer)
+			assert.Equal(t, "subject", identity.Subject)
+
+			if calls := r.DB.GetCalls("CreateSession"); assert.Equal(t, 1, len(calls)) {
+				assert.Equal(t, testutils.UUIDFromInt(3), calls[0][0].(models.Session).UserID)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackDuplicateUsername(t *testing.T) {
+	t.Parallel()
+	server, providers := startOIDCServer(t)
+	defer server.Close()
+
+	server.SetClaims(map[string]any{"sub": "subject", "preferred_username": "someone"})
+	cookie, code, state := startOIDCLogin(t, server, providers)
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetExternalIdentityUserResult.B = database.NotFoundErr
+	r.DB.CreateExternalUserResult.B = database.DuplicateErr
+	setOIDCCallback(r, cookie, code, state)
+
+	err := routes.OIDCCallbackHandler(r.DB, providers)(r.Ctx)
+
+	assert.Equal(t, database.DuplicateErr, err)
+
+	calls := r.DB.GetCalls("CreateExternalUser")
+
+	if assert.Equal(t, 5, len(calls)) {
+		assert.Equal(t, "someone", calls[0][0].(models.Account).Username)
+		assert.Regexp(t, `^someone-\d{4}$`, calls[1][0].(models.Account).Username)
+	}
+}
+
+func TestOIDCCallbackIdentityCreatedElsewhere(t *testing.T) {
+	t.Parallel()
+	server, providers := startOIDCServer(t)
+	defer server.Close()
+
+	server.SetClaims(map[string]any{"sub": "subject", "preferred_username": "someone"})
+	cookie, code, state := startOIDCLogin(t, server, providers)
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	// Another login for the same identity created the user first.
+	user := models.User{ID: testutils.UUIDFromInt(2), Username: "someone", Role: models.RoleUser}
+	r.DB.GetExternalIdentityUserResult.B = database.NotFoundErr
+	r.DB.CreateExternalUserResult.A = user
+	setOIDCCallback(r, cookie, code, state)
+
+	r.AssertStatus(oidcCallbackHandler(providers), 302)
+
+	assert.Equal(t, 1, len(r.DB.GetCalls("CreateExternalUser")))
+
+	if calls := r.DB.GetCalls("CreateSession"); assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0].(models.Session).UserID)
+	}
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	server, providers := startOIDCServer(t)
+	defer server.Close()
+
+	var tests = map[string]struct {
+		setup         func(r RouteTester)
+		expectedError models.ErrorLocation
+	}{
+		"NoCookie": {
+			setup: func(r RouteTester) {
+				r.Ctx.Request().URI().SetQueryString("code=code&state=state")
+			},
+			expectedError: models.NewErrorLocation("invalidState", "Login expired or was started elsewhere", "query", "state"),
+		},
+		"WrongState": {
+			setup: func(r RouteTester) {
+				cookie, code, _ := startOIDCLogin(t, server, providers)
+				setOIDCCallback(r, cookie, code, "other")
+			},
+			expectedError: models.NewErrorLocation("invalidState", "Login expired or was started elsewhere", "query", "state"),
+		},
+		"ProviderError": {
+			setup: func(r RouteTester) {
+				cookie, _, state := startOIDCLogin(t, server, providers)
+				r.Ctx.Request().Header.SetCookie("oidcLogin", cookie)
+				r.Ctx.Request().URI().SetQueryString(
+					url.Values{"error": {"access_denied"}, "state": {state}}.Encode(),
+				)
+			},
+			expectedError: models.NewErrorLocation("oidcError", "Login was refused by the provider", "query", "error"),
+		},
+		"BadCode": {
+			setup: func(r RouteTester) {
+				cookie, _, state := startOIDCLogin(t, server, providers)
+				setOIDCCallback(r, cookie, "other", state)
+			},
+			expectedError: models.NewErrorLocation("oidcError", "Could not log in with the provider", "query", "code"),
+		},
+		"CodeForAnotherLogin": {
+			setup: func(r RouteTester) {
+				cookie, _, state := startOIDCLogin(t, server, providers)
+				_, code, _ := startOIDCLogin(t, server, providers)
+				setOIDCCallback(r, cookie, code, state)
+			},
+			expectedError: models.NewErrorLocation("oidcError", "Could not log in with the provider", "query", "code"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			testData.setup(r)
+
+			r.AssertStatus(oidcCallbackHandler(providers), 403)
+
+			r.AssertResponseError(testData.expectedError)
+			assert.Empty(t, r.DB.GetCalls("GetExternalIdentityUser"))
+			assert.Empty(t, r.DB.GetCalls("CreateSession"))
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// passwordResetLifetime is how long a password reset email can be used for.
+const passwordResetLifetime = time.Hour
+
+// RequestPasswordResetHandler godoc
+// @Tags Authentication
+// @Summary Request a password reset
+// @Description Email a link for resetting the password to the user who has verified an email address. The response is the same whether or not there is a user with the address, and the email is sent afterwards
+// @Param data body PasswordResetRequest true "The email address for the account"
+// @Success 204
+// @Failure 422 {object} Error
+// @Router /api/auth/password-reset [post]
+func RequestPasswordResetHandler(db database.DatabaseAPI, mail AccountMail) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var request models.PasswordResetRequest
+
+		if err := c.BodyParser(&request); err != nil {
+			return err
+		}
+
+		if len(request.Email) == 0 {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Email is required", "body", "email"),
+			})
+		}
+
+		// Everything else happens after responding, so whether an address has
+		// an account isn't revealed by the response or how long it takes.
+		email := strings.Clone(request.Email)
+		mail.sendLater(logging.Logger(c), func(ctx context.Context) error {
+			return sendPasswordReset(ctx, db, mail, email)
+		})
+
+		c.Status(204)
+
+		return nil
+	}
+}
+
+// sendPasswordReset emails a password reset link if a user has verified the
+// email address.
+func sendPasswordReset(ctx context.Context, db database.DatabaseAPI, mail AccountMail, email string) error {
+	user, err := db.GetUserByEmail(ctx, email)
+
+	if errors.Is(err, database.NotFoundErr) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken("")
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = db.CreatePasswordReset(
+		ctx,
+		user.ID,
+		database.HashToken(token),
+		now,
+		now.Add(passwordResetLifetime),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	link := mail.link("/reset-password", token)
+
+	return mail.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\n"+
+				"Someone asked to reset the password for your account. "+
+				"You can choose a new password within the next hour here:\n\n"+
+				"%s\n\n"+
+				"If this wasn't you, you can ignore this email.\n",
+			user.Username,
+			link,
+		),
+	})
+}
+
+// ConfirmPasswordResetHandler godoc
+// @Tags Authentication
+// @Summary Reset a password
+// @Description Set a new password with a token from a password reset email. Every session for the user is logged out
+// @Param data body PasswordResetConfirmation true "The token and new password"
+// @Success 204
+// @Failure 422 {object} Error
+// @Router /api/auth/password-reset/confirm [post]
+func ConfirmPasswordResetHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var confirmation models.PasswordResetConfirmation
+
+		if err := c.BodyParser(&confirmation); err != nil {
+			return err
+		}
+
+		if errorLocation, ok := checkNewPassword(confirmation.Password, confirmation.ConfirmPassword); !ok {
+			return sendError(c, 422, []models.ErrorLocation{errorLocation})
+		}
+
+		err := database.NotFoundErr
+
+		if len(confirmation.Token) > 0 {
+			err = db.ResetPassword(
+				c.Context(),
+				database.HashToken(confirmation.Token),
+				confirmation.Password,
+				time.Now(),
+			)
+		}
+
+		if errors.Is(err, database.NotFoundErr) {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "token"),
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		c.Status(204)
+
+		return nil
+	}
+}
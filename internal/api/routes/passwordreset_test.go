@@ -0,0 +1,201 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var resetLinkRegex = regexp.MustCompile(`https://codelibrary\.example/reset-password\?token=(\S+)`)
+
+func TestRequestPasswordReset(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	var buffer bytes.Buffer
+	mail := testMail(&buffer)
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user"}
+	r.DB.GetUserByEmailResult.A = user
+
+	r.SetRequestBody(models.PasswordResetRequest{Email: "user@example.com"})
+	// Links must not be built from the Host header clients send.
+	r.Ctx.Request().Header.SetHost("attacker.example")
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.RequestPasswordResetHandler(db, mail)
+	}, 204)
+	mail.Pending.Wait()
+
+	assert.Contains(t, buffer.String(), "To: user@example.com\r\n")
+	assert.NotContains(t, buffer.String(), "attacker.example")
+	match := resetLinkRegex.FindStringSubmatch(buffer.String())
+
+	if assert.NotNil(t, match) {
+		token, _ := url.QueryUnescape(match[1])
+		calls := r.DB.GetCalls("CreatePasswordReset")
+
+		if assert.Equal(t, 1, len(calls)) {
+			assert.Equal(t, user.ID, calls[0][0].(uuid.UUID))
+			// Only a hash of the emailed token should be saved.
+			assert.Equal(t, database.HashToken(token), calls[0][1].(string))
+			assert.Equal(t, time.Hour, calls[0][3].(time.Time).Sub(calls[0][2].(time.Time)))
+		}
+	}
+}
+
+func TestRequestPasswordResetNotSent(t *testing.T) {
+	var tests = map[string]struct {
+		email string
+	}{
+		"UnknownEmail": {"nobody@example.com"},
+		// Only verified addresses are found, so nobody can take over an
+		// account by reading mail sent to an address typed into it.
+		"UnverifiedEmail": {"unverified@example.com"},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			var buffer bytes.Buffer
+			mail := testMail(&buffer)
+
+			r.DB.GetUserByEmailResult.B = database.NotFoundErr
+
+			r.SetRequestBody(models.PasswordResetRequest{Email: testData.email})
+			r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+				return routes.RequestPasswordResetHandler(db, mail)
+			}, 204)
+			mail.Pending.Wait()
+
+			calls := r.DB.GetCalls("GetUserByEmail")
+
+			if assert.Equal(t, 1, len(calls)) {
+				assert.Equal(t, testData.email, calls[0][0].(string))
+			}
+
+			assert.Equal(t, 0, buffer.Len())
+			assert.Equal(t, 0, len(r.DB.GetCalls("CreatePasswordReset")))
+		})
+	}
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, message mailer.Message) error {
+	return errors.New("connection refused")
+}
+
+func TestRequestPasswordResetSendFails(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	mail := testMail(nil)
+	mail.Mailer = failingMailer{}
+	r.DB.GetUserByEmailResult.A = models.User{ID: testutils.UUIDFromInt(1), Username: "user"}
+
+	// Failures are only logged, so they don't reveal the address has an account.
+	r.SetRequestBody(models.PasswordResetRequest{Email: "user@example.com"})
+	r.AssertStatus(func(db database.DatabaseAPI) fiber.Handler {
+		return routes.RequestPasswordResetHandler(db, mail)
+	}, 204)
+	mail.Pending.Wait()
+
+	assert.Equal(t, 1, len(r.DB.GetCalls("CreatePasswordReset")))
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.SetRequestBody(models.PasswordResetConfirmation{
+		Token:           "abc",
+		Password:        "new password",
+		ConfirmPassword: "new password",
+	})
+	r.AssertStatus(routes.ConfirmPasswordResetHandler, 204)
+
+	calls := r.DB.GetCalls("ResetPassword")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, database.HashToken("abc"), calls[0][0].(string))
+		assert.Equal(t, "new password", calls[0][1].(string))
+	}
+}
+
+func TestConfirmPasswordResetErrors(t *testing.T) {
+	var tests = map[string]struct {
+		confirmation       models.PasswordResetConfirmation
+		databaseError      error
+		expectedStatusCode int
+		expectedError      models.ErrorLocation
+	}{
+		"ExpiredToken": {
+			confirmation: models.PasswordResetConfirmation{
+				Token:           "abc",
+				Password:        "new password",
+				ConfirmPassword: "new password",
+			},
+			databaseError:      database.NotFoundErr,
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "token"),
+		},
+		"MissingToken": {
+			confirmation: models.PasswordResetConfirmation{
+				Password:        "new password",
+				ConfirmPassword: "new password",
+			},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "token"),
+		},
+		"PasswordTooLong": {
+			confirmation: models.PasswordResetConfirmation{
+				Token:           "abc",
+				Password:        testutils.GenerateString('x', 65),
+				ConfirmPassword: testutils.GenerateString('x', 65),
+			},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("badPassword", "Password too long", "body"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			r.DB.ResetPasswordResult = testData.databaseError
+
+			r.SetRequestBody(testData.confirmation)
+			r.AssertStatus(routes.ConfirmPasswordResetHandler, testData.expectedStatusCode)
+			r.AssertResponseError(testData.expectedError)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission only lets a request through if the user in the session
+// has a role granting a permission. It is attached to routes when they are
+// registered, and the user is kept for handlers to read with permittedUser.
+func RequirePermission(db database.DatabaseAPI, permission models.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		if !user.Role.Can(permission) {
+			return sendPermissionDenied(c)
+		}
+
+		c.Locals("permittedUser", user)
+
+		return c.Next()
+	}
+}
+
+func sendPermissionDenied(c *fiber.Ctx) error {
+	return sendBodyError(c, 403, "forbidden", "Permission denied")
+}
+
+// permittedUser returns the user let through by RequirePermission.
+// Handlers refuse requests if the middleware wasn't attached to their route,
+// so a route registered without it can't be used by anyone.
+func permittedUser(c *fiber.Ctx, permission models.Permission) (models.User, bool) {
+	user, ok := c.Locals("permittedUser").(models.User)
+
+	return user, ok && user.Role.Can(permission)
+}
+
+// canEditSample returns true if a user submitted a sample, or if they can
+// moderate samples submitted by anyone.
+func canEditSample(user models.User, sample models.CodeSample) bool {
+	return sample.SubmittedBy.ID == user.ID || user.Role.Can(models.PermissionModerateSamples)
+}
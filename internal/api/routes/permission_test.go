@@ -0,0 +1,111 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// requiring runs a handler behind RequirePermission, as main registers it.
+func requiring(
+	permission models.Permission,
+	wrappedHandler func(db database.DatabaseAPI) fiber.Handler,
+) func(db database.DatabaseAPI) fiber.Handler {
+	return WithMiddleware(
+		func(db database.DatabaseAPI) fiber.Handler {
+			return routes.RequirePermission(db, permission)
+		},
+		wrappedHandler,
+	)
+}
+
+func TestRequirePermission(t *testing.T) {
+	var tests = map[string]struct {
+		user               *models.User
+		expectedStatusCode int
+		expectedErrors     []models.ErrorLocation
+	}{
+		"NoSession": {
+			expectedStatusCode: 403,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("permissionDenied", "Permission Denied", "body"),
+			},
+		},
+		"WithoutPermission": {
+			user:               &models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleModerator},
+			expectedStatusCode: 403,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("forbidden", "Permission denied", "body"),
+			},
+		},
+		"WithPermission": {
+			user:               &models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin},
+			expectedStatusCode: 204,
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			if testData.user != nil {
+				apisession.SaveUser(r.Ctx, r.DB, *testData.user)
+				r.DB.GetSessionUserResult.A = *testData.user
+			}
+
+			called := false
+			handler := func(db database.DatabaseAPI) fiber.Handler {
+				return func(c *fiber.Ctx) error {
+					called = true
+
+					return c.SendStatus(204)
+				}
+			}
+
+			r.AssertStatus(requiring(models.PermissionManageLanguages, handler), testData.expectedStatusCode)
+			assert.Equal(t, testData.expectedStatusCode == 204, called)
+
+			if len(testData.expectedErrors) > 0 {
+				r.AssertResponseError(testData.expectedErrors...)
+			}
+		})
+	}
+}
+
+// Handlers refuse requests when a route is registered without the
+// middleware, even from admins.
+func TestPermissionHandlersWithoutMiddleware(t *testing.T) {
+	for name, handler := range map[string]func(db database.DatabaseAPI) fiber.Handler{
+		"CreateLanguage": routes.CreateLanguageHandler,
+		"RenameLanguage": routes.RenameLanguageHandler,
+		"RetireLanguage": routes.RetireLanguageHandler,
+		"GrantRole":      routes.GrantRoleHandler,
+		"RevokeRole":     routes.RevokeRoleHandler,
+	} {
+		handler := handler
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			admin := models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin}
+			apisession.SaveUser(r.Ctx, r.DB, admin)
+			r.DB.GetSessionUserResult.A = admin
+
+			r.SetRequestBody(models.RoleAssignment{Role: models.RoleModerator})
+			r.AssertStatus(handler, 403)
+			r.AssertResponseError(models.NewErrorLocation("forbidden", "Permission denied", "body"))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+// authRateLimitPaths are routes which check credentials or send email, which
+// share the smallest budget.
+var authRateLimitPaths = map[string]bool{
+	"/api/auth/login":                  true,
+	"/api/auth/login/totp":             true,
+	"/api/auth/register":               true,
+	"/api/auth/password-reset":         true,
+	"/api/auth/password-reset/confirm": true,
+	"/api/auth/verify-email":           true,
+	"/api/auth/oidc/login":             true,
+	"/api/auth/oidc/callback":          true,
+	"/api/users/me/email/verification": true,
+}
+
+// routePath returns the path of a request for looking up in sets of routes.
+// Routes match without case or trailing slashes, so paths must too.
+func routePath(c *fiber.Ctx) string {
+	return strings.TrimSuffix(strings.ToLower(c.Path()), "/")
+}
+
+// rateLimitGroup returns the budget a request is counted against.
+func rateLimitGroup(c *fiber.Ctx) ratelimit.Group {
+	if authRateLimitPaths[routePath(c)] {
+		return ratelimit.GroupAuth
+	}
+
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return ratelimit.GroupRead
+	default:
+		return ratelimit.GroupWrite
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds for headers.
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
+
+// sendTooManyRequests sends a 429 response saying when to try again.
+func sendTooManyRequests(c *fiber.Ctx, _type string, msg string, retryAfter time.Duration) error {
+	seconds := ceilSeconds(retryAfter)
+
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	response := models.NewBodyError(_type, msg)
+	response.RetryAfter = seconds
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+
+	return c.Status(429).JSON(response)
+}
+
+// RateLimitHandler limits how often each client can make requests, with
+// separate budgets for reading, writing and authentication.
+// Clients are identified by API token, user or IP address.
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are sent
+// with every limited response. Health checks aren't limited.
+func RateLimitHandler(db database.DatabaseAPI, limits ratelimit.Limits) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limiter := limits[rateLimitGroup(c)]
+
+		if limiter == nil || IsProbe(c) {
+			return c.Next()
+		}
+
+		key, err := apisession.ClientKey(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		result := limiter.Take(key, time.Now())
+
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			return sendTooManyRequests(c, "rateLimited", "Too many requests", result.RetryAfter)
+		}
+
+		return c.Next()
+	}
+}
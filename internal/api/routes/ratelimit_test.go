@@ -0,0 +1,210 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/ratelimit"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/api/server"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRateLimitApp(db *databasemock.MockDatabaseAPI, limits ratelimit.Limits) *fiber.App {
+	app := fiber.New()
+	app.Use(routes.RateLimitHandler(db, limits))
+
+	ok := func(c *fiber.Ctx) error {
+		return c.SendStatus(204)
+	}
+
+	app.Get("/api/code", ok)
+	app.Post("/api/code", ok)
+	app.Post("/api/auth/login", ok)
+
+	return app
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	app := newRateLimitApp(db, ratelimit.Limits{
+		ratelimit.GroupRead: ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 2}),
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/api/code", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 204, response.StatusCode)
+	assert.Equal(t, "2", response.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", response.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", response.Header.Get("RateLimit-Reset"))
+
+	response, err = app.Test(httptest.NewRequest("GET", "/api/code", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 204, response.StatusCode)
+	assert.Equal(t, "0", response.Header.Get("RateLimit-Remaining"))
+
+	response, err = app.Test(httptest.NewRequest("GET", "/api/code", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 429, response.StatusCode)
+	assert.Equal(t, "1", response.Header.Get("Retry-After"))
+
+	var actualError models.Error
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&actualError))
+
+	expectedError := models.NewBodyError("rateLimited", "Too many requests")
+	expectedError.RetryAfter = 1
+	assert.Equal(t, expectedError, actualError)
+
+	// Groups without a limiter aren't limited.
+	response, err = app.Test(httptest.NewRequest("POST", "/api/code", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 204, response.StatusCode)
+	assert.Empty(t, response.Header.Get("RateLimit-Limit"))
+}
+
+func TestRateLimitGroups(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	app := newRateLimitApp(db, ratelimit.Limits{
+		ratelimit.GroupRead:  ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 3}),
+		ratelimit.GroupWrite: ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 2}),
+		ratelimit.GroupAuth:  ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 1}),
+	})
+
+	var tests = []struct {
+		method string
+		path   string
+		limit  string
+	}{
+		{"GET", "/api/code", "3"},
+		{"POST", "/api/code", "2"},
+		{"POST", "/api/auth/login", "1"},
+		{"POST", "/api/auth/login/", "1"},
+	}
+
+	for _, testData := range tests {
+		response, err := app.Test(httptest.NewRequest(testData.method, testData.path, nil))
+
+		assert.Nil(t, err)
+		assert.Equal(t, testData.limit, response.Header.Get("RateLimit-Limit"), testData.method+" "+testData.path)
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	db.GetAPITokenIDResult.A = testutils.UUIDFromInt(1)
+	app := newRateLimitApp(db, ratelimit.Limits{
+		ratelimit.GroupRead: ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 1}),
+	})
+
+	response, err := app.Test(httptest.NewRequest("GET", "/api/code", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 204, response.StatusCode)
+
+	// Clients with a token have their own budget.
+	request := httptest.NewRequest("GET", "/api/code", nil)
+	request.Header.Set("Authorization", "Bearer clt_abc")
+	response, err = app.Test(request)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 204, response.StatusCode)
+
+	response, err = app.Test(httptest.NewRequest("GET", "/api/code", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 429, response.StatusCode)
+}
+
+func TestRateLimitByClientIP(t *testing.T) {
+	t.Parallel()
+
+	// Requests in tests come from 0.0.0.0, which stands in for nginx.
+	var config fiber.Config
+	server.ProxyConfig{Header: "X-Real-IP", Trusted: []string{"0.0.0.0"}}.Apply(&config)
+	app := fiber.New(config)
+	app.Use(routes.RateLimitHandler(databasemock.New(), ratelimit.Limits{
+		ratelimit.GroupRead: ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 1}),
+	}))
+	app.Get("/api/code", func(c *fiber.Ctx) error {
+		return c.SendStatus(204)
+	})
+
+	for _, testData := range []struct {
+		ip                 string
+		expectedStatusCode int
+	}{
+		{"203.0.113.1", 204},
+		// Clients behind the proxy have their own budgets.
+		{"203.0.113.2", 204},
+		{"203.0.113.1", 429},
+	} {
+		request := httptest.NewRequest("GET", "/api/code", nil)
+		request.Header.Set("X-Real-IP", testData.ip)
+		response, err := app.Test(request)
+
+		assert.Nil(t, err)
+		assert.Equal(t, testData.expectedStatusCode, response.StatusCode, testData.ip)
+	}
+}
+
+func TestRateLimitRejectsWithoutWrites(t *testing.T) {
+	t.Parallel()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	db := databasemock.New()
+	db.GetSessionResult.A = models.Session{UserID: user.ID}
+	db.GetSessionUserResult.A = user
+	app := fiber.New()
+	app.Use(routes.RateLimitHandler(db, ratelimit.Limits{
+		ratelimit.GroupRead: ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 1}),
+	}))
+	app.Get("/api/users/me", routes.GetCurrentUserHandler(db))
+
+	for _, expectedStatusCode := range []int{200, 429} {
+		request := httptest.NewRequest("GET", "/api/users/me", nil)
+		request.Header.Set("Cookie", "sessionID="+testutils.UUIDFromInt(2).String())
+		response, err := app.Test(request)
+
+		assert.Nil(t, err)
+		assert.Equal(t, expectedStatusCode, response.StatusCode)
+	}
+
+	// Sessions are only looked up to pick a budget, and only extended for
+	// requests which are let through.
+	assert.Equal(t, 2, len(db.GetCalls("GetSession")))
+	assert.Equal(t, 1, len(db.GetCalls("GetSessionUser")))
+}
+
+func TestRateLimitSkipsProbes(t *testing.T) {
+	t.Parallel()
+
+	db := databasemock.New()
+	app := fiber.New()
+	app.Use(routes.RateLimitHandler(db, ratelimit.Limits{
+		ratelimit.GroupRead: ratelimit.NewLimiter(ratelimit.Budget{PerMinute: 60, Burst: 1}),
+	}))
+	app.Get("/healthz", routes.HealthHandler())
+
+	for i := 0; i < 3; i++ {
+		response, err := app.Test(httptest.NewRequest("GET", "/healthz/", nil))
+
+		assert.Nil(t, err)
+		assert.Equal(t, 200, response.StatusCode)
+		assert.Empty(t, response.Header.Get("RateLimit-Limit"))
+	}
+}
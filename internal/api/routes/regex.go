@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+)
+
+const maximumRegexLength = 256
+
+// maximumRegexComplexity bounds the size of a regex, which counts every
+// operator and every range of characters in a class, as many times as they
+// can be repeated.
+const maximumRegexComplexity = 1000
+
+// maximumRegexRepeat is the largest count PostgreSQL allows in `{n,m}`.
+const maximumRegexRepeat = 255
+
+func regexComplexity(re *syntax.Regexp) (int, bool) {
+	complexity := 1
+
+	if re.Op == syntax.OpCharClass {
+		complexity += len(re.Rune) / 2
+	}
+
+	if re.Op == syntax.OpRepeat && (re.Min > maximumRegexRepeat || re.Max > maximumRegexRepeat) {
+		return complexity, false
+	}
+
+	for _, sub := range re.Sub {
+		subComplexity, ok := regexComplexity(sub)
+
+		if re.Op == syntax.OpRepeat {
+			if re.Max > 1 {
+				subComplexity *= re.Max
+			} else if re.Min > 1 {
+				subComplexity *= re.Min
+			}
+		}
+
+		complexity += subComplexity
+
+		if !ok {
+			return complexity, false
+		}
+	}
+
+	return complexity, true
+}
+
+// validateRegex checks a regex search is valid RE2 syntax and cheap enough
+// to run, returning a message explaining the problem if it isn't.
+func validateRegex(pattern string) (string, bool) {
+	if len(pattern) > maximumRegexLength {
+		return "Regex too long", false
+	}
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+
+	if err != nil {
+		return "Invalid regex", false
+	}
+
+	if complexity, ok := regexComplexity(re); !ok || complexity > maximumRegexComplexity {
+		return "Regex too complex", false
+	}
+
+	// Patterns like `a*` match every sample, and can't use the index.
+	if regexp.MustCompile(pattern).MatchString("") {
+		return "Regex matches empty text", false
+	}
+
+	// Some patterns, such as ones matching NUL characters, can't be run in
+	// the database.
+	if database.CheckRegex(pattern) != nil {
+		return "Regex not supported", false
+	}
+
+	return "", true
+}
@@ -0,0 +1,305 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+type CodeSampleDiffParams struct {
+	From uint64 `query:"from"`
+	To   uint64 `query:"to"`
+}
+
+// parseRevisionParams parses the code sample ID and revision number from the path.
+// A 400 response is sent if either of them are invalid.
+func parseRevisionParams(c *fiber.Ctx) (uuid.UUID, uint64, error, bool) {
+	id, err := parseParamsID(c)
+
+	if err != nil {
+		return id, 0, sendError(c, 400, []models.ErrorLocation{
+			models.NewErrorLocation("invalidId", "invalid UUID", "params", "id"),
+		}), false
+	}
+
+	revision, err := c.ParamsInt("rev")
+
+	if err != nil || revision < 1 {
+		return id, 0, sendError(c, 400, []models.ErrorLocation{
+			models.NewErrorLocation("invalidRevision", "invalid revision", "params", "rev"),
+		}), false
+	}
+
+	return id, uint64(revision), nil, true
+}
+
+// revisionField is one field of a revision to diff.
+type revisionField struct {
+	name string
+	a    string
+	b    string
+}
+
+// tagLines puts each tag on its own line, for diffs.
+func tagLines(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	return strings.Join(tags, "\n") + "\n"
+}
+
+// diffRevisions creates a unified diff between two revisions.
+// Each field is diffed as if it were a separate file.
+func diffRevisions(from models.CodeSampleRevision, to models.CodeSampleRevision) (string, error) {
+	fields := []revisionField{
+		{"language", from.Language.ID, to.Language.ID},
+		{"title", from.Title, to.Title},
+		{"description", from.Description, to.Description},
+		{"body", from.Body, to.Body},
+	}
+
+	// Tags are only compared when both revisions kept them.
+	if from.Tags != nil && to.Tags != nil {
+		fields = append(fields, revisionField{"tags", tagLines(from.Tags), tagLines(to.Tags)})
+	}
+
+	var builder strings.Builder
+
+	for _, field := range fields {
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(field.a),
+			B:        difflib.SplitLines(field.b),
+			FromFile: "a/" + field.name,
+			FromDate: fmt.Sprintf("revision %d", from.Revision),
+			ToFile:   "b/" + field.name,
+			ToDate:   fmt.Sprintf("revision %d", to.Revision),
+			Context:  3,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		builder.WriteString(diff)
+	}
+
+	return builder.String(), nil
+}
+
+// ListCodeSampleRevisionsHandler godoc
+// @Tags Code Samples
+// @Summary List Code Sample revisions
+// @Description List every saved revision of a Code Sample, newest first
+// @Param id path string true "The UUID of the code sample"
+// @Success 200 {array} CodeSampleRevision
+// @Failure 404 {object} Error
+// @Router /api/code/{id}/revisions [get]
+func ListCodeSampleRevisionsHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := apisession.CheckToken(c, db, models.ScopeSamplesRead); err != nil {
+			return err
+		}
+
+		id, err := parseParamsID(c)
+
+		if err != nil {
+			return sendError(c, 400, []models.ErrorLocation{
+				models.NewErrorLocation("invalidId", "invalid UUID", "params", "id"),
+			})
+		}
+
+		// Check the sample exists so we can return 404.
+		if _, err := db.GetCodeSample(c.Context(), id); err != nil {
+			return err
+		}
+
+		revisions, err := db.ListCodeSampleRevisions(c.Context(), id)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(revisions)
+	}
+}
+
+// GetCodeSampleRevisionHandler godoc
+// @Tags Code Samples
+// @Summary Get a Code Sample revision
+// @Description Get a single revision of a Code Sample
+// @Param id path string true "The UUID of the code sample"
+// @Param rev path integer true "The revision number"
+// @Success 200 {object} CodeSampleRevision
+// @Failure 404 {object} Error
+// @Router /api/code/{id}/revisions/{rev} [get]
+func GetCodeSampleRevisionHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := apisession.CheckToken(c, db, models.ScopeSamplesRead); err != nil {
+			return err
+		}
+
+		id, revision, err, ok := parseRevisionParams(c)
+
+		if err != nil || !ok {
+			return err
+		}
+
+		result, err := db.GetCodeSampleRevision(c.Context(), id, revision)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(result)
+	}
+}
+
+// DiffCodeSampleRevisionsHandler godoc
+// @Tags Code Samples
+// @Summary Diff Code Sample revisions
+// @Description Create a unified diff between any two revisions of a Code Sample
+// @Param id path string true "The UUID of the code sample"
+// @Param from query integer true "The revision to diff from"
+// @Param to query integer true "The revision to diff to"
+// @Success 200 {object} CodeSampleDiff
+// @Failure 404 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/code/{id}/diff [get]
+func DiffCodeSampleRevisionsHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := apisession.CheckToken(c, db, models.ScopeSamplesRead); err != nil {
+			return err
+		}
+
+		id, err := parseParamsID(c)
+
+		if err != nil {
+			return sendError(c, 400, []models.ErrorLocation{
+				models.NewErrorLocation("invalidId", "invalid UUID", "params", "id"),
+			})
+		}
+
+		var params CodeSampleDiffParams
+
+		if err := c.QueryParser(&params); err != nil {
+			return err
+		}
+
+		errorDetail := []models.ErrorLocation{}
+
+		if params.From == 0 {
+			errorDetail = append(
+				errorDetail,
+				models.NewErrorLocation("invalidValue", "Invalid from", "query", "from"),
+			)
+		}
+
+		if params.To == 0 {
+			errorDetail = append(
+				errorDetail,
+				models.NewErrorLocation("invalidValue", "Invalid to", "query", "to"),
+			)
+		}
+
+		if len(errorDetail) > 0 {
+			return sendError(c, 422, errorDetail)
+		}
+
+		from, err := db.GetCodeSampleRevision(c.Context(), id, params.From)
+
+		if err != nil {
+			return err
+		}
+
+		to, err := db.GetCodeSampleRevision(c.Context(), id, params.To)
+
+		if err != nil {
+			return err
+		}
+
+		diff, err := diffRevisions(from, to)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(models.CodeSampleDiff{
+			From: params.From,
+			To:   params.To,
+			Diff: diff,
+		})
+	}
+}
+
+// RestoreCodeSampleRevisionHandler godoc
+// @Tags Code Samples
+// @Summary Restore a Code Sample revision
+// @Description Save an old revision as the newest version of a Code Sample, including its tags. Revisions saved before tags were kept with them leave the tags as they are. Moderators can restore any sample
+// @Param id path string true "The UUID of the code sample"
+// @Param rev path integer true "The revision number to restore"
+// @Success 200 {object} CodeSample
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Router /api/code/{id}/revisions/{rev}/restore [post]
+func RestoreCodeSampleRevisionHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, revisionNumber, err, ok := parseRevisionParams(c)
+
+		if err != nil || !ok {
+			return err
+		}
+
+		user, err := apisession.LoadUser(c, db, models.ScopeSamplesWrite)
+
+		if err != nil {
+			return err
+		}
+
+		sample, err := db.GetCodeSample(c.Context(), id)
+
+		if err != nil {
+			return err
+		}
+
+		if !canEditSample(user, sample) {
+			return sendBodyError(c, 403, "forbidden", "Not your code sample")
+		}
+
+		revision, err := db.GetCodeSampleRevision(c.Context(), id, revisionNumber)
+
+		if err != nil {
+			return err
+		}
+
+		if revision.Language.Retired && sample.Language.ID != revision.Language.ID {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("retiredLanguage", "Language is retired", "params", "rev"),
+			})
+		}
+
+		sample.Language = revision.Language
+		sample.Title = revision.Title
+		sample.Description = revision.Description
+		sample.Body = revision.Body
+
+		if revision.Tags != nil {
+			sample.Tags = revision.Tags
+		}
+
+		sample.Modified = time.Now()
+
+		if err := db.UpdateCodeSample(c.Context(), sample, user.ID); err != nil {
+			return err
+		}
+
+		return c.JSON(sample)
+	}
+}
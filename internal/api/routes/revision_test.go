@@ -0,0 +1,273 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/dense-analysis/ranges"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListCodeSampleRevisions(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	id := testutils.UUIDFromInt(1)
+	expectedRevisions := []models.CodeSampleRevision{
+		{CodeSampleID: id, Revision: 2},
+		{CodeSampleID: id, Revision: 1},
+	}
+	r.DB.GetCodeSampleResult.A = models.CodeSample{ID: id}
+	r.DB.ListCodeSampleRevisionsResult.A = expectedRevisions
+	r.SetParams(ranges.MakePair("id", id.String()))
+
+	r.AssertStatus(routes.ListCodeSampleRevisionsHandler, 200)
+
+	var actualRevisions []models.CodeSampleRevision
+	r.GetResponse(&actualRevisions)
+	assert.Equal(t, expectedRevisions, actualRevisions)
+}
+
+func TestListCodeSampleRevisions404(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.DB.GetCodeSampleResult.B = database.NotFoundErr
+	r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(1).String()))
+
+	r.AssertStatus(routes.ListCodeSampleRevisionsHandler, 404)
+	assert.Equal(t, 0, len(r.DB.GetCalls("ListCodeSampleRevisions")))
+}
+
+func TestGetCodeSampleRevision(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	id := testutils.UUIDFromInt(1)
+	expectedRevision := models.CodeSampleRevision{CodeSampleID: id, Revision: 3}
+	r.DB.GetCodeSampleRevisionResult.A = expectedRevision
+	r.SetParams(
+		ranges.MakePair("id", id.String()),
+		ranges.MakePair("rev", "3"),
+	)
+
+	r.AssertStatus(routes.GetCodeSampleRevisionHandler, 200)
+
+	var actualRevision models.CodeSampleRevision
+	r.GetResponse(&actualRevision)
+	assert.Equal(t, expectedRevision, actualRevision)
+	assert.Equal(t, [][]any{{id, uint64(3)}}, r.DB.GetCalls("GetCodeSampleRevision"))
+}
+
+func TestGetCodeSampleRevisionInvalidParams(t *testing.T) {
+	var tests = map[string]struct {
+		paramsID       string
+		paramsRevision string
+		expectedError  models.ErrorLocation
+	}{
+		"InvalidUUID": {
+			paramsID:       "x",
+			paramsRevision: "1",
+			expectedError:  models.NewErrorLocation("invalidId", "invalid UUID", "params", "id"),
+		},
+		"InvalidRevision": {
+			paramsID:       testutils.UUIDFromInt(1).String(),
+			paramsRevision: "x",
+			expectedError:  models.NewErrorLocation("invalidRevision", "invalid revision", "params", "rev"),
+		},
+		"ZeroRevision": {
+			paramsID:       testutils.UUIDFromInt(1).String(),
+			paramsRevision: "0",
+			expectedError:  models.NewErrorLocation("invalidRevision", "invalid revision", "params", "rev"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			r.SetParams(
+				ranges.MakePair("id", testData.paramsID),
+				ranges.MakePair("rev", testData.paramsRevision),
+			)
+
+			r.AssertStatus(routes.GetCodeSampleRevisionHandler, 400)
+			r.AssertResponseError(testData.expectedError)
+		})
+	}
+}
+
+func TestDiffCodeSampleRevisions(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	id := testutils.UUIDFromInt(1)
+	r.DB.GetCodeSampleRevisionResult.A = models.CodeSampleRevision{
+		CodeSampleID: id,
+		Language:     models.Language{ID: "python"},
+		Title:        "Title",
+		Body:         "a = 1\nb = 2\n",
+	}
+	r.SetParams(ranges.MakePair("id", id.String()))
+	r.SetQueryArgs(routes.CodeSampleDiffParams{From: 1, To: 2})
+
+	r.AssertStatus(routes.DiffCodeSampleRevisionsHandler, 200)
+
+	var diff models.CodeSampleDiff
+	r.GetResponse(&diff)
+	// Both revisions are the same, so there should be no difference.
+	assert.Equal(t, models.CodeSampleDiff{From: 1, To: 2}, diff)
+	assert.Equal(
+		t,
+		[][]any{{id, uint64(1)}, {id, uint64(2)}},
+		r.DB.GetCalls("GetCodeSampleRevision"),
+	)
+}
+
+func TestDiffCodeSampleRevisionsInvalidParams(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(1).String()))
+
+	r.AssertStatus(routes.DiffCodeSampleRevisionsHandler, 422)
+	r.AssertResponseError(
+		models.NewErrorLocation("invalidValue", "Invalid from", "query", "from"),
+		models.NewErrorLocation("invalidValue", "Invalid to", "query", "to"),
+	)
+}
+
+func TestRestoreCodeSampleRevision(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	id := testutils.UUIDFromInt(123)
+	r.DB.GetCodeSampleResult.A = models.CodeSample{
+		ID:          id,
+		SubmittedBy: user,
+		Language:    models.Language{ID: "python", Name: "Python"},
+		Title:       "New title",
+		Body:        "new body",
+		Tags:        []string{"new"},
+	}
+	r.DB.GetCodeSampleRevisionResult.A = models.CodeSampleRevision{
+		CodeSampleID: id,
+		Revision:     1,
+		Language:     models.Language{ID: "python", Name: "Python"},
+		Title:        "Old title",
+		Description:  "Old description",
+		Body:         "old body",
+		Tags:         []string{},
+	}
+	r.SetParams(
+		ranges.MakePair("id", id.String()),
+		ranges.MakePair("rev", "1"),
+	)
+
+	r.AssertStatus(routes.RestoreCodeSampleRevisionHandler, 200)
+
+	calls := r.DB.GetCalls("UpdateCodeSample")
+	assert.Equal(t, 1, len(calls))
+
+	if len(calls) == 1 {
+		sample := calls[0][0].(models.CodeSample)
+		assert.Equal(t, id, sample.ID)
+		assert.Equal(t, user, sample.SubmittedBy)
+		assert.Equal(t, "Old title", sample.Title)
+		assert.Equal(t, "Old description", sample.Description)
+		assert.Equal(t, "old body", sample.Body)
+		assert.Equal(t, []string{}, sample.Tags)
+	}
+}
+
+func TestRestoreCodeSampleRevisionWithoutTags(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	id := testutils.UUIDFromInt(123)
+	r.DB.GetCodeSampleResult.A = models.CodeSample{
+		ID:          id,
+		SubmittedBy: user,
+		Language:    models.Language{ID: "python", Name: "Python"},
+		Title:       "New title",
+		Body:        "new body",
+		Tags:        []string{"new"},
+	}
+	// Revisions saved before tags were kept with them have no tags.
+	r.DB.GetCodeSampleRevisionResult.A = models.CodeSampleRevision{
+		CodeSampleID: id,
+		Revision:     1,
+		Language:     models.Language{ID: "python", Name: "Python"},
+		Title:        "Old title",
+		Body:         "old body",
+	}
+	r.SetParams(
+		ranges.MakePair("id", id.String()),
+		ranges.MakePair("rev", "1"),
+	)
+
+	r.AssertStatus(routes.RestoreCodeSampleRevisionHandler, 200)
+
+	calls := r.DB.GetCalls("UpdateCodeSample")
+	assert.Equal(t, 1, len(calls))
+
+	if len(calls) == 1 {
+		sample := calls[0][0].(models.CodeSample)
+		assert.Equal(t, "Old title", sample.Title)
+		assert.Equal(t, []string{"new"}, sample.Tags)
+	}
+}
+
+func TestRestoreCodeSampleRevisionWrongUser(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(2)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	r.DB.GetCodeSampleResult.A = models.CodeSample{
+		SubmittedBy: models.User{ID: testutils.UUIDFromInt(1)},
+	}
+	r.SetParams(
+		ranges.MakePair("id", uuid.New().String()),
+		ranges.MakePair("rev", "1"),
+	)
+
+	r.AssertStatus(routes.RestoreCodeSampleRevisionHandler, 403)
+	r.AssertResponseError(models.NewErrorLocation("forbidden", "Not your code sample", "body"))
+	assert.Equal(t, 0, len(r.DB.GetCalls("UpdateCodeSample")))
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func setUserRole(c *fiber.Ctx, db database.DatabaseAPI, role models.Role) error {
+	admin, ok := permittedUser(c, models.PermissionManageRoles)
+
+	if !ok {
+		return sendPermissionDenied(c)
+	}
+
+	id, err := parseParamsID(c)
+
+	if err != nil {
+		return sendError(c, 400, []models.ErrorLocation{
+			models.NewErrorLocation("invalidId", "invalid UUID", "params", "id"),
+		})
+	}
+
+	// Stop admins from locking themselves out.
+	if id == admin.ID {
+		return sendError(c, 422, []models.ErrorLocation{
+			models.NewErrorLocation("invalidValue", "Cannot change your own role", "params", "id"),
+		})
+	}
+
+	user, err := db.SetUserRole(c.Context(), id, role, admin.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(user)
+}
+
+// GrantRoleHandler godoc
+// @Tags Users
+// @Summary Grant a role
+// @Description Give a user a role, such as moderator. Admin only.
+// @Param id path string true "The UUID of the user"
+// @Param data body RoleAssignment true "The role to grant"
+// @Success 200 {object} User
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/users/{id}/role [put]
+func GrantRoleHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var assignment models.RoleAssignment
+
+		if err := c.BodyParser(&assignment); err != nil {
+			return err
+		}
+
+		if !assignment.Role.Valid() {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Invalid role", "body", "role"),
+			})
+		}
+
+		return setUserRole(c, db, assignment.Role)
+	}
+}
+
+// RevokeRoleHandler godoc
+// @Tags Users
+// @Summary Revoke a role
+// @Description Return a user to the normal user role. Admin only.
+// @Param id path string true "The UUID of the user"
+// @Success 200 {object} User
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/users/{id}/role [delete]
+func RevokeRoleHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return setUserRole(c, db, models.RoleUser)
+	}
+}
@@ -0,0 +1,116 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/dense-analysis/ranges"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantRole(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	admin := models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin}
+	apisession.SaveUser(r.Ctx, r.DB, admin)
+	r.DB.GetSessionUserResult.A = admin
+
+	expectedUser := models.User{ID: testutils.UUIDFromInt(2), Username: "mod", Role: models.RoleModerator}
+	r.DB.SetUserRoleResult.A = expectedUser
+
+	r.SetParams(ranges.MakePair("id", expectedUser.ID.String()))
+	r.SetRequestBody(models.RoleAssignment{Role: models.RoleModerator})
+	r.AssertStatus(requiring(models.PermissionManageRoles, routes.GrantRoleHandler), 200)
+
+	var actualUser models.User
+	r.GetResponse(&actualUser)
+	assert.Equal(t, expectedUser, actualUser)
+	assert.Equal(
+		t,
+		[][]any{{expectedUser.ID, models.RoleModerator, admin.ID}},
+		r.DB.GetCalls("SetUserRole"),
+	)
+}
+
+func TestRevokeRole(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	admin := models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin}
+	apisession.SaveUser(r.Ctx, r.DB, admin)
+	r.DB.GetSessionUserResult.A = admin
+
+	r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(2).String()))
+	r.AssertStatus(requiring(models.PermissionManageRoles, routes.RevokeRoleHandler), 200)
+
+	assert.Equal(
+		t,
+		[][]any{{testutils.UUIDFromInt(2), models.RoleUser, admin.ID}},
+		r.DB.GetCalls("SetUserRole"),
+	)
+}
+
+func TestGrantRoleErrors(t *testing.T) {
+	var tests = map[string]struct {
+		user               models.User
+		paramsID           string
+		role               models.Role
+		expectedStatusCode int
+		expectedErrors     []models.ErrorLocation
+	}{
+		"Moderator": {
+			user:               models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleModerator},
+			paramsID:           testutils.UUIDFromInt(2).String(),
+			role:               models.RoleModerator,
+			expectedStatusCode: 403,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("forbidden", "Permission denied", "body"),
+			},
+		},
+		"InvalidRole": {
+			user:               models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin},
+			paramsID:           testutils.UUIDFromInt(2).String(),
+			role:               "owner",
+			expectedStatusCode: 422,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Invalid role", "body", "role"),
+			},
+		},
+		"OwnRole": {
+			user:               models.User{ID: testutils.UUIDFromInt(1), Role: models.RoleAdmin},
+			paramsID:           testutils.UUIDFromInt(1).String(),
+			role:               models.RoleUser,
+			expectedStatusCode: 422,
+			expectedErrors: []models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "Cannot change your own role", "params", "id"),
+			},
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			apisession.SaveUser(r.Ctx, r.DB, testData.user)
+			r.DB.GetSessionUserResult.A = testData.user
+
+			r.SetParams(ranges.MakePair("id", testData.paramsID))
+			r.SetRequestBody(models.RoleAssignment{Role: testData.role})
+			r.AssertStatus(requiring(models.PermissionManageRoles, routes.GrantRoleHandler), testData.expectedStatusCode)
+			r.AssertResponseError(testData.expectedErrors...)
+			assert.Equal(t, 0, len(r.DB.GetCalls("SetUserRole")))
+		})
+	}
+}
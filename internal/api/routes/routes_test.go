@@ -1,17 +1,22 @@
 package routes_test
 
 import (
+	"encoding"
 	"encoding/json"
+	"io"
 	"net/url"
 	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 	"unsafe"
 
 	"github.com/dense-analysis/codelibrary/internal/api/database"
 	"github.com/dense-analysis/codelibrary/internal/api/database/databasemock"
 	"github.com/dense-analysis/codelibrary/internal/api/errorhandler"
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
 	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
 	"github.com/dense-analysis/ranges"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
@@ -25,6 +30,15 @@ type RouteTester struct {
 	DB  *databasemock.MockDatabaseAPI
 }
 
+// testMail writes account emails with links to https://codelibrary.example.
+func testMail(writer io.Writer) routes.AccountMail {
+	return routes.AccountMail{
+		Mailer:    mailer.NewLogMailer(writer),
+		PublicURL: "https://codelibrary.example/",
+		Pending:   &sync.WaitGroup{},
+	}
+}
+
 func NewRouteTester(t *testing.T) RouteTester {
 	app := fiber.New()
 
@@ -71,6 +85,25 @@ func (r *RouteTester) AssertStatus(
 	}
 }
 
+// WithMiddleware runs middleware before a handler, as routes registered with
+// middleware do.
+func WithMiddleware(
+	middleware func(db database.DatabaseAPI) fiber.Handler,
+	wrappedHandler func(db database.DatabaseAPI) fiber.Handler,
+) func(db database.DatabaseAPI) fiber.Handler {
+	return func(db database.DatabaseAPI) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			// Set up the route stack so calling Next runs the handler.
+			route := c.Route()
+			route.Handlers = []fiber.Handler{middleware(db), wrappedHandler(db)}
+			forceFieldAccess(reflect.ValueOf(c).Elem().FieldByName("route")).Set(reflect.ValueOf(route))
+			forceFieldAccess(reflect.ValueOf(c).Elem().FieldByName("indexHandler")).SetInt(0)
+
+			return route.Handlers[0](c)
+		}
+	}
+}
+
 func (r *RouteTester) SetParams(params ...ranges.Pair[string, string]) {
 	// Get the route or the default route.
 	route := r.Ctx.Route()
@@ -117,8 +150,22 @@ func (r *RouteTester) SetQueryArgs(value any) {
 				name = fieldType.Name
 			}
 
+			// Leave out nil pointers, which are optional values.
+			if fieldValue.Kind() == reflect.Pointer {
+				if fieldValue.IsNil() {
+					continue
+				}
+
+				fieldValue = fieldValue.Elem()
+			}
+
 			value := fieldValue.Interface()
 
+			// Leave out unset values such as zero times and UUIDs.
+			if _, ok := value.(encoding.TextMarshaler); ok && fieldValue.IsZero() {
+				continue
+			}
+
 			if len(queryString) > 0 {
 				queryString += "&"
 			}
@@ -133,6 +180,8 @@ func (r *RouteTester) SetQueryArgs(value any) {
 				queryString += strconv.FormatInt(v, 10)
 			case uint64:
 				queryString += strconv.FormatUint(v, 10)
+			case bool:
+				queryString += strconv.FormatBool(v)
 			case string:
 				queryString += url.QueryEscape(v)
 			case []string:
@@ -143,8 +192,21 @@ func (r *RouteTester) SetQueryArgs(value any) {
 					),
 					",",
 				)
+			case encoding.TextMarshaler:
+				text, err := v.MarshalText()
+
+				if err != nil {
+					panic(err)
+				}
+
+				queryString += url.QueryEscape(string(text))
 			default:
-				panic("Unhandled type: " + fieldType.Name)
+				// Handle named types such as enums by their underlying kind.
+				if fieldValue.Kind() == reflect.String {
+					queryString += url.QueryEscape(fieldValue.String())
+				} else {
+					panic("Unhandled type: " + fieldType.Name)
+				}
 			}
 		}
 	}
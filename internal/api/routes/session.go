@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListSessionsHandler godoc
+// @Tags Authentication
+// @Summary List sessions
+// @Description List the active sessions for the current user
+// @Success 200 {array} Session
+// @Failure 403 {object} Error
+// @Router /api/auth/sessions [get]
+func ListSessionsHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		sessions, err := db.ListSessions(c.Context(), user.ID, time.Now())
+
+		if err != nil {
+			return err
+		}
+
+		// LoadUser has already checked the session ID.
+		currentID, _ := apisession.SessionID(c)
+
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == currentID
+		}
+
+		return c.JSON(sessions)
+	}
+}
+
+// DeleteSessionHandler godoc
+// @Tags Authentication
+// @Summary Revoke a session
+// @Description Log out a session for the current user, which may be the current session
+// @Param id path string true "The UUID of the session to revoke"
+// @Success 204
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Router /api/auth/sessions/{id} [delete]
+func DeleteSessionHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseParamsID(c)
+
+		if err != nil {
+			return sendError(c, 400, []models.ErrorLocation{
+				models.NewErrorLocation("invalidId", "invalid UUID", "params", "id"),
+			})
+		}
+
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		if err := db.DeleteUserSession(c.Context(), user.ID, id); err != nil {
+			return err
+		}
+
+		if currentID, _ := apisession.SessionID(c); currentID == id {
+			apisession.ClearSession(c)
+		}
+
+		c.Status(204)
+
+		return nil
+	}
+}
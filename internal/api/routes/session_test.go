@@ -0,0 +1,115 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/dense-analysis/ranges"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListSessions(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	currentID, _ := apisession.SessionID(r.Ctx)
+	r.DB.ListSessionsResult.A = []models.Session{
+		{ID: testutils.UUIDFromInt(2), UserAgent: "curl/8.0"},
+		{ID: currentID, UserAgent: "Firefox"},
+	}
+
+	r.AssertStatus(routes.ListSessionsHandler, 200)
+
+	var sessions []models.Session
+	r.GetResponse(&sessions)
+
+	if assert.Equal(t, 2, len(sessions)) {
+		assert.False(t, sessions[0].Current)
+		assert.True(t, sessions[1].Current)
+	}
+
+	calls := r.DB.GetCalls("ListSessions")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0].(uuid.UUID))
+	}
+}
+
+func TestListSessionsNotLoggedIn(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.AssertStatus(routes.ListSessionsHandler, 403)
+	assert.Equal(t, 0, len(r.DB.GetCalls("ListSessions")))
+}
+
+func TestDeleteSession(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(2).String()))
+	r.AssertStatus(routes.DeleteSessionHandler, 204)
+
+	calls := r.DB.GetCalls("DeleteUserSession")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0].(uuid.UUID))
+		assert.Equal(t, testutils.UUIDFromInt(2), calls[0][1].(uuid.UUID))
+	}
+
+	// Revoking another session should keep the current one.
+	_, err := apisession.SessionID(r.Ctx)
+	assert.Nil(t, err)
+}
+
+func TestDeleteCurrentSession(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	currentID, _ := apisession.SessionID(r.Ctx)
+	r.SetParams(ranges.MakePair("id", currentID.String()))
+	r.AssertStatus(routes.DeleteSessionHandler, 204)
+
+	_, err := apisession.SessionID(r.Ctx)
+	assert.Equal(t, apisession.NoUserInSessionErr, err)
+}
+
+func TestDeleteSessionNotFound(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.DeleteUserSessionResult = database.NotFoundErr
+
+	r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(2).String()))
+	r.AssertStatus(routes.DeleteSessionHandler, 404)
+}
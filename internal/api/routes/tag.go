@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/gofiber/fiber/v2"
+)
+
+const maximumTagLength = 50
+const maximumTagsPerSample = 10
+
+var tagSeparatorRegex = regexp.MustCompile(`[\s_-]+`)
+var tagRegex = regexp.MustCompile(`^[a-z0-9+#.]+(-[a-z0-9+#.]+)*$`)
+
+// normalizeTags lowercases tags, joins words with hyphens, then sorts and
+// deduplicates them. ok is false if any tag is invalid after normalization.
+func normalizeTags(tags []string) (normalized []string, ok bool) {
+	normalized = make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		tag = tagSeparatorRegex.ReplaceAllString(tag, "-")
+
+		// Skip empty values, which can come from query strings like `tags=`.
+		if len(tag) == 0 {
+			continue
+		}
+
+		if len(tag) > maximumTagLength || !tagRegex.MatchString(tag) {
+			return normalized, false
+		}
+
+		if _, ok := seen[tag]; !ok {
+			seen[tag] = struct{}{}
+			normalized = append(normalized, tag)
+		}
+	}
+
+	sort.Strings(normalized)
+
+	return normalized, true
+}
+
+// ListTagsHandler godoc
+// @Tags Code Samples
+// @Summary List Tags
+// @Description List tags used by code samples, most used first
+// @Success 200 {array} TagSummary
+// @Router /api/tags [get]
+func ListTagsHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tags, err := db.ListTags(c.Context())
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(tags)
+	}
+}
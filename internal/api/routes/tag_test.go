@@ -0,0 +1,28 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTags(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	expectedTags := []models.TagSummary{
+		{Name: "concurrency", SampleCount: 5},
+		{Name: "regex", SampleCount: 2},
+	}
+	r.DB.ListTagsResult.A = expectedTags
+
+	r.AssertStatus(routes.ListTagsHandler, 200)
+
+	var actualTags []models.TagSummary
+	r.GetResponse(&actualTags)
+	assert.Equal(t, expectedTags, actualTags)
+}
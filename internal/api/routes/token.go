@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const maximumTokenNameLength = 255
+
+// tokenPrefix makes tokens easy to recognise, such as when scanning for
+// leaked secrets.
+const tokenPrefix = "clt_"
+
+// generateToken creates a random secret for a client to send back later.
+func generateToken(prefix string) (string, error) {
+	data := make([]byte, 32)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return prefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func validateAPITokenSubmission(c *fiber.Ctx, submission *models.APITokenSubmission) (error, bool) {
+	if err := c.BodyParser(submission); err != nil {
+		return err, false
+	}
+
+	errorDetail := []models.ErrorLocation{}
+
+	if len(submission.Name) == 0 {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Name is required", "body", "name"),
+		)
+	} else if len(submission.Name) > maximumTokenNameLength {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "Name too long", "body", "name"),
+		)
+	}
+
+	if len(submission.Scopes) == 0 {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "At least one scope is required", "body", "scopes"),
+		)
+	}
+
+	for _, scope := range submission.Scopes {
+		switch scope {
+		case models.ScopeSamplesRead, models.ScopeSamplesWrite:
+		default:
+			errorDetail = append(
+				errorDetail,
+				models.NewErrorLocation("invalidValue", "Invalid scope", "body", "scopes"),
+			)
+		}
+	}
+
+	if submission.Expires != nil && !submission.Expires.After(time.Now()) {
+		errorDetail = append(
+			errorDetail,
+			models.NewErrorLocation("invalidValue", "expires must be in the future", "body", "expires"),
+		)
+	}
+
+	if len(errorDetail) > 0 {
+		return sendError(c, 422, errorDetail), false
+	}
+
+	return nil, true
+}
+
+// ListAPITokensHandler godoc
+// @Tags Authentication
+// @Summary List API tokens
+// @Description List the personal API tokens for the current user
+// @Success 200 {array} APIToken
+// @Failure 403 {object} Error
+// @Router /api/auth/tokens [get]
+func ListAPITokensHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		tokens, err := db.ListAPITokens(c.Context(), user.ID)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(tokens)
+	}
+}
+
+// CreateAPITokenHandler godoc
+// @Tags Authentication
+// @Summary Create an API token
+// @Description Create a personal API token for use with `Authorization: Bearer`. The token is only returned once
+// @Param data body APITokenSubmission true "Token data"
+// @Success 201 {object} NewAPIToken
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/auth/tokens [post]
+func CreateAPITokenHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		var submission models.APITokenSubmission
+
+		if err, ok := validateAPITokenSubmission(c, &submission); err != nil || !ok {
+			return err
+		}
+
+		id, err := uuid.NewRandom()
+
+		if err != nil {
+			return err
+		}
+
+		secret, err := generateToken(tokenPrefix)
+
+		if err != nil {
+			return err
+		}
+
+		token := models.NewAPIToken{
+			APIToken: models.APIToken{
+				ID:      id,
+				UserID:  user.ID,
+				Name:    submission.Name,
+				Scopes:  submission.Scopes,
+				Expires: submission.Expires,
+				Created: time.Now(),
+			},
+			Token: secret,
+		}
+
+		if err := db.CreateAPIToken(c.Context(), token.APIToken, database.HashToken(secret)); err != nil {
+			return err
+		}
+
+		c.Status(201)
+
+		return c.JSON(token)
+	}
+}
+
+// DeleteAPITokenHandler godoc
+// @Tags Authentication
+// @Summary Revoke an API token
+// @Description Revoke a personal API token for the current user
+// @Param id path string true "The UUID of the token to revoke"
+// @Success 204
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Router /api/auth/tokens/{id} [delete]
+func DeleteAPITokenHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseParamsID(c)
+
+		if err != nil {
+			return sendError(c, 400, []models.ErrorLocation{
+				models.NewErrorLocation("invalidId", "invalid UUID", "params", "id"),
+			})
+		}
+
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		if err := db.DeleteAPIToken(c.Context(), user.ID, id); err != nil {
+			return err
+		}
+
+		c.Status(204)
+
+		return nil
+	}
+}
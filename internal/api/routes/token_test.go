@@ -0,0 +1,209 @@
+package routes_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/dense-analysis/ranges"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	r.SetRequestBody(models.APITokenSubmission{
+		Name:   "Editor",
+		Scopes: []models.Scope{models.ScopeSamplesRead},
+	})
+	r.AssertStatus(routes.CreateAPITokenHandler, 201)
+
+	var token models.NewAPIToken
+	r.GetResponse(&token)
+	assert.True(t, strings.HasPrefix(token.Token, "clt_"))
+	assert.Equal(t, "Editor", token.Name)
+	assert.Equal(t, []models.Scope{models.ScopeSamplesRead}, token.Scopes)
+
+	calls := r.DB.GetCalls("CreateAPIToken")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0].(models.APIToken).UserID)
+		// Only a hash of the token should be saved.
+		assert.Equal(t, database.HashToken(token.Token), calls[0][1].(string))
+	}
+}
+
+func TestCreateAPITokenErrors(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	expires := time.Now().Add(-time.Hour)
+	r.SetRequestBody(models.APITokenSubmission{
+		Scopes:  []models.Scope{"everything"},
+		Expires: &expires,
+	})
+	r.AssertStatus(routes.CreateAPITokenHandler, 422)
+	r.AssertResponseError(
+		models.NewErrorLocation("invalidValue", "Name is required", "body", "name"),
+		models.NewErrorLocation("invalidValue", "Invalid scope", "body", "scopes"),
+		models.NewErrorLocation("invalidValue", "expires must be in the future", "body", "expires"),
+	)
+	assert.Equal(t, 0, len(r.DB.GetCalls("CreateAPIToken")))
+}
+
+func TestCreateAPITokenWithToken(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	// Tokens can't be used to create more tokens.
+	r.Ctx.Request().Header.Set("Authorization", "Bearer clt_abc")
+	r.DB.GetAPITokenUserResult.Token.Scopes = []models.Scope{
+		models.ScopeSamplesRead,
+		models.ScopeSamplesWrite,
+	}
+
+	r.SetRequestBody(models.APITokenSubmission{
+		Name:   "Editor",
+		Scopes: []models.Scope{models.ScopeSamplesRead},
+	})
+	r.AssertStatus(routes.CreateAPITokenHandler, 403)
+	r.AssertResponseError(
+		models.NewErrorLocation("insufficientScope", "API token does not have the required scope", "header", "Authorization"),
+	)
+}
+
+func TestListAPITokens(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	expectedTokens := []models.APIToken{
+		{ID: testutils.UUIDFromInt(2), Name: "Editor", Scopes: []models.Scope{models.ScopeSamplesRead}},
+	}
+	r.DB.ListAPITokensResult.A = expectedTokens
+
+	r.AssertStatus(routes.ListAPITokensHandler, 200)
+
+	var actualTokens []models.APIToken
+	r.GetResponse(&actualTokens)
+	assert.Equal(t, expectedTokens, actualTokens)
+}
+
+func TestDeleteAPIToken(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1)}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(2).String()))
+	r.AssertStatus(routes.DeleteAPITokenHandler, 204)
+
+	calls := r.DB.GetCalls("DeleteAPIToken")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0].(uuid.UUID))
+		assert.Equal(t, testutils.UUIDFromInt(2), calls[0][1].(uuid.UUID))
+	}
+}
+
+func TestInvalidAPIToken(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	r.Ctx.Request().Header.Set("Authorization", "Bearer clt_abc")
+	r.DB.GetAPITokenUserResult.Err = database.NotFoundErr
+
+	// Bad tokens should be reported even for routes that don't need a user.
+	r.AssertStatus(routes.ListCodeSamplesHandler, 401)
+	r.AssertResponseError(
+		models.NewErrorLocation("invalidToken", "Invalid API token", "header", "Authorization"),
+	)
+	assert.Equal(t, "Bearer", string(r.Ctx.Response().Header.Peek("WWW-Authenticate")))
+
+	calls := r.DB.GetCalls("GetAPITokenUser")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, database.HashToken("clt_abc"), calls[0][0].(string))
+	}
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	var tests = map[string]struct {
+		scopes         []models.Scope
+		handler        func(db database.DatabaseAPI) fiber.Handler
+		expectedStatus int
+	}{
+		"ReadWithReadScope": {
+			scopes:         []models.Scope{models.ScopeSamplesRead},
+			handler:        routes.GetCodeSampleHandler,
+			expectedStatus: 200,
+		},
+		"ReadWithWriteScope": {
+			scopes:         []models.Scope{models.ScopeSamplesWrite},
+			handler:        routes.GetCodeSampleHandler,
+			expectedStatus: 403,
+		},
+		"DeleteWithWriteScope": {
+			scopes:         []models.Scope{models.ScopeSamplesWrite},
+			handler:        routes.DeleteCodeSampleHandler,
+			expectedStatus: 204,
+		},
+		"DeleteWithReadScope": {
+			scopes:         []models.Scope{models.ScopeSamplesRead},
+			handler:        routes.DeleteCodeSampleHandler,
+			expectedStatus: 403,
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1)}
+			r.Ctx.Request().Header.Set("Authorization", "Bearer clt_abc")
+			r.DB.GetAPITokenUserResult.User = user
+			r.DB.GetAPITokenUserResult.Token.Scopes = testData.scopes
+			r.DB.GetCodeSampleResult.A = models.CodeSample{SubmittedBy: user}
+			r.SetParams(ranges.MakePair("id", testutils.UUIDFromInt(2).String()))
+
+			r.AssertStatus(testData.handler, testData.expectedStatus)
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/totp"
+	"github.com/gofiber/fiber/v2"
+)
+
+// totpIssuer is the name shown for accounts in authenticator apps.
+const totpIssuer = "Code Library"
+
+const recoveryCodeCount = 10
+
+// pendingLoginLifetime is how long a user has to enter a code after entering
+// their password.
+const pendingLoginLifetime = 5 * time.Minute
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode creates a code such as "abcde-fghij".
+func generateRecoveryCode() (string, error) {
+	data := make([]byte, 7)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	text := strings.ToLower(recoveryCodeEncoding.EncodeToString(data))
+
+	return text[:5] + "-" + text[5:10], nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes,
+// which are easy to get wrong when typing a code in.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	return database.HashToken(code)
+}
+
+// startPendingLogin sends a token for finishing a login with a second factor.
+func startPendingLogin(c *fiber.Ctx, db database.DatabaseAPI, user models.User, now time.Time) error {
+	token, err := generateToken("")
+
+	if err != nil {
+		return err
+	}
+
+	pending := models.PendingLogin{
+		PendingToken: token,
+		Expires:      now.Add(pendingLoginLifetime),
+	}
+	err = db.CreatePendingLogin(c.Context(), user.ID, database.HashToken(token), now, pending.Expires)
+
+	if err != nil {
+		return err
+	}
+
+	c.Status(202)
+
+	return c.JSON(pending)
+}
+
+// EnrolTOTPHandler godoc
+// @Tags Authentication
+// @Summary Start setting up two-factor authentication
+// @Description Create a new TOTP secret for the current user. Two-factor authentication is turned on once a code for the secret is confirmed
+// @Success 200 {object} TOTPEnrolment
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/auth/totp [post]
+func EnrolTOTPHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		secret, err := totp.GenerateSecret()
+
+		if err != nil {
+			return err
+		}
+
+		err = db.SetTOTP(c.Context(), models.TOTP{
+			UserID:  user.ID,
+			Secret:  secret,
+			Created: time.Now(),
+		})
+
+		if errors.Is(err, database.DuplicateErr) {
+			return sendBodyError(c, 422, "twoFactorEnabled", "Two-factor authentication is already enabled")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(models.TOTPEnrolment{
+			Secret: secret,
+			URI:    totp.URI(totpIssuer, user.Username, secret),
+		})
+	}
+}
+
+// ConfirmTOTPHandler godoc
+// @Tags Authentication
+// @Summary Turn on two-factor authentication
+// @Description Confirm a new TOTP secret with a code from an authenticator app. Recovery codes are returned, and are only shown once
+// @Param data body TOTPCode true "A code from the authenticator app"
+// @Success 200 {object} RecoveryCodes
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/auth/totp/confirm [post]
+func ConfirmTOTPHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		var code models.TOTPCode
+
+		if err := c.BodyParser(&code); err != nil {
+			return err
+		}
+
+		secret, err := db.GetTOTP(c.Context(), user.ID)
+
+		if errors.Is(err, database.NotFoundErr) {
+			return sendBodyError(c, 422, "noTwoFactor", "Two-factor authentication has not been set up")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if secret.Confirmed {
+			return sendBodyError(c, 422, "twoFactorEnabled", "Two-factor authentication is already enabled")
+		}
+
+		step, ok := totp.Validate(secret.Secret, code.Code, time.Now())
+
+		if !ok {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidCode", "Invalid code", "body", "code"),
+			})
+		}
+
+		recoveryCodes := models.RecoveryCodes{Codes: make([]string, recoveryCodeCount)}
+		hashes := make([]string, recoveryCodeCount)
+
+		for i := range recoveryCodes.Codes {
+			recoveryCodes.Codes[i], err = generateRecoveryCode()
+
+			if err != nil {
+				return err
+			}
+
+			hashes[i] = hashRecoveryCode(recoveryCodes.Codes[i])
+		}
+
+		if err := db.ConfirmTOTP(c.Context(), user.ID, step, hashes); err != nil {
+			return err
+		}
+
+		return c.JSON(recoveryCodes)
+	}
+}
+
+// DisableTOTPHandler godoc
+// @Tags Authentication
+// @Summary Turn off two-factor authentication
+// @Description Remove the TOTP secret and recovery codes for the current user. The current password is required, or for users without a password, logging in with `/api/auth/oidc/login?reauthenticate=true` in the last 5 minutes
+// @Param data body TwoFactorRemoval true "The current password"
+// @Success 204
+// @Failure 403 {object} Error
+// @Failure 404 {object} Error
+// @Router /api/auth/totp [delete]
+func DisableTOTPHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		var removal models.TwoFactorRemoval
+
+		if err := c.BodyParser(&removal); err != nil {
+			return err
+		}
+
+		if ok, err := reauthenticate(c, db, user, removal.Password, "password"); err != nil || !ok {
+			return err
+		}
+
+		if err := db.DeleteTOTP(c.Context(), user.ID); err != nil {
+			return err
+		}
+
+		c.Status(204)
+
+		return nil
+	}
+}
+
+// LoginTOTPHandler godoc
+// @Tags Authentication
+// @Summary Finish logging in with two-factor authentication
+// @Description Exchange a pending login token from `/api/auth/login` and either a TOTP code or a recovery code for a session
+// @Param data body TwoFactorLogin true "The pending login token and a code"
+// @Success 200 {object} User
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Failure 429 {object} Error
+// @Router /api/auth/login/totp [post]
+func LoginTOTPHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var login models.TwoFactorLogin
+
+		if err := c.BodyParser(&login); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		hash := database.HashToken(login.PendingToken)
+		err := database.NotFoundErr
+		var user models.User
+
+		if len(login.PendingToken) > 0 {
+			user, err = db.GetPendingLogin(c.Context(), hash, now)
+		}
+
+		if errors.Is(err, database.NotFoundErr) {
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "pendingToken"),
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		lockedUntil, err := db.GetLoginLockout(c.Context(), loginKeys(c, user.Username), now)
+
+		if err != nil {
+			return err
+		}
+
+		if !lockedUntil.IsZero() {
+			return sendLockedOut(c, lockedUntil, now)
+		}
+
+		if len(login.RecoveryCode) > 0 {
+			err = db.UseRecoveryCode(c.Context(), user.ID, hashRecoveryCode(login.RecoveryCode))
+
+			if errors.Is(err, database.NotFoundErr) {
+				return failLogin(
+					c,
+					db,
+					user.Username,
+					now,
+					models.NewErrorLocation("invalidCode", "Invalid recovery code", "body", "recoveryCode"),
+				)
+			}
+		} else {
+			err = checkTOTPCode(c, db, user, login.Code, now)
+
+			if errors.Is(err, database.NotFoundErr) {
+				return failLogin(
+					c,
+					db,
+					user.Username,
+					now,
+					models.NewErrorLocation("invalidCode", "Invalid code", "body", "code"),
+				)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := db.DeletePendingLogin(c.Context(), hash); err != nil {
+			return err
+		}
+
+		return completeLogin(c, db, user)
+	}
+}
+
+// checkTOTPCode checks a code for a user and uses it up.
+// NotFoundErr is returned if the code is wrong or has already been used.
+func checkTOTPCode(c *fiber.Ctx, db database.DatabaseAPI, user models.User, code string, now time.Time) error {
+	secret, err := db.GetTOTP(c.Context(), user.ID)
+
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret.Secret, code, now)
+
+	if !secret.Confirmed || !ok {
+		return database.NotFoundErr
+	}
+
+	return db.UseTOTPStep(c.Context(), user.ID, step)
+}
@@ -0,0 +1,375 @@
+package routes_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/api/totp"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func currentCode(t *testing.T) string {
+	code, err := totp.Code(testSecret, totp.Step(time.Now()))
+	assert.Nil(t, err)
+
+	return code
+}
+
+func TestEnrolTOTP(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+
+	r.AssertStatus(routes.EnrolTOTPHandler, 200)
+
+	var enrolment models.TOTPEnrolment
+	r.GetResponse(&enrolment)
+
+	uri, err := url.Parse(enrolment.URI)
+	assert.Nil(t, err)
+	assert.Equal(t, "/Code Library:user", uri.Path)
+	assert.Equal(t, enrolment.Secret, uri.Query().Get("secret"))
+
+	calls := r.DB.GetCalls("SetTOTP")
+
+	if assert.Equal(t, 1, len(calls)) {
+		secret := calls[0][0].(models.TOTP)
+		assert.Equal(t, user.ID, secret.UserID)
+		assert.Equal(t, enrolment.Secret, secret.Secret)
+		assert.False(t, secret.Confirmed)
+	}
+}
+
+func TestEnrolTOTPAlreadyEnabled(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.SetTOTPResult = database.DuplicateErr
+
+	r.AssertStatus(routes.EnrolTOTPHandler, 422)
+	r.AssertResponseError(
+		models.NewErrorLocation("twoFactorEnabled", "Two-factor authentication is already enabled", "body"),
+	)
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetTOTPResult.A = models.TOTP{UserID: user.ID, Secret: testSecret}
+
+	r.SetRequestBody(models.TOTPCode{Code: currentCode(t)})
+	r.AssertStatus(routes.ConfirmTOTPHandler, 200)
+
+	var recoveryCodes models.RecoveryCodes
+	r.GetResponse(&recoveryCodes)
+	assert.Equal(t, 10, len(recoveryCodes.Codes))
+
+	calls := r.DB.GetCalls("ConfirmTOTP")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0])
+
+		// Only hashes of the recovery codes should be saved.
+		hashes := calls[0][2].([]string)
+
+		for i, code := range recoveryCodes.Codes {
+			assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+			assert.Equal(t, database.HashToken(strings.ReplaceAll(code, "-", "")), hashes[i])
+		}
+	}
+}
+
+func TestConfirmTOTPErrors(t *testing.T) {
+	var tests = map[string]struct {
+		secret        models.TOTP
+		secretError   error
+		code          string
+		expectedError models.ErrorLocation
+	}{
+		"WrongCode": {
+			secret:        models.TOTP{Secret: testSecret},
+			code:          "000000",
+			expectedError: models.NewErrorLocation("invalidCode", "Invalid code", "body", "code"),
+		},
+		"NotSetUp": {
+			secretError:   database.NotFoundErr,
+			code:          "000000",
+			expectedError: models.NewErrorLocation("noTwoFactor", "Two-factor authentication has not been set up", "body"),
+		},
+		"AlreadyConfirmed": {
+			secret:        models.TOTP{Secret: testSecret, Confirmed: true},
+			expectedError: models.NewErrorLocation("twoFactorEnabled", "Two-factor authentication is already enabled", "body"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			r.DB.GetTOTPResult.A = testData.secret
+			r.DB.GetTOTPResult.B = testData.secretError
+
+			if len(testData.code) == 0 {
+				testData.code = currentCode(t)
+			}
+
+			r.SetRequestBody(models.TOTPCode{Code: testData.code})
+			r.AssertStatus(routes.ConfirmTOTPHandler, 422)
+			r.AssertResponseError(testData.expectedError)
+			assert.Equal(t, 0, len(r.DB.GetCalls("ConfirmTOTP")))
+		})
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	var tests = map[string]struct {
+		withoutPassword    bool
+		reauthenticated    bool
+		loggedInAgo        time.Duration
+		credentialsError   error
+		expectedStatusCode int
+		expectedDeletes    int
+	}{
+		"CorrectPassword": {expectedStatusCode: 204, expectedDeletes: 1},
+		"WrongPassword":   {credentialsError: database.NotFoundErr, expectedStatusCode: 403},
+		// Users who only log in with a provider have to have logged in again.
+		"Reauthenticated": {
+			withoutPassword:    true,
+			reauthenticated:    true,
+			loggedInAgo:        time.Minute,
+			expectedStatusCode: 204,
+			expectedDeletes:    1,
+		},
+		"OldLogin":    {withoutPassword: true, reauthenticated: true, loggedInAgo: time.Hour, expectedStatusCode: 403},
+		"RecentLogin": {withoutPassword: true, loggedInAgo: time.Minute, expectedStatusCode: 403},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			r.DB.GetAccountResult.A = models.Account{User: user, HasPassword: !testData.withoutPassword}
+			r.DB.GetSessionResult.A = models.Session{
+				UserID:          user.ID,
+				Created:         time.Now().Add(-testData.loggedInAgo),
+				Reauthenticated: testData.reauthenticated,
+			}
+			r.DB.GetUserWithCredentialsResult.A = user
+			r.DB.GetUserWithCredentialsResult.B = testData.credentialsError
+
+			r.SetRequestBody(models.TwoFactorRemoval{Password: "password"})
+			r.AssertStatus(routes.DisableTOTPHandler, testData.expectedStatusCode)
+
+			assert.Equal(t, testData.expectedDeletes, len(r.DB.GetCalls("DeleteTOTP")))
+		})
+	}
+}
+
+func TestLoginRequiresTOTP(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user"}
+	r.DB.GetUserWithCredentialsResult.A = user
+	r.DB.GetTOTPResult.A = models.TOTP{UserID: user.ID, Secret: testSecret, Confirmed: true}
+
+	r.SetRequestBody(routes.LoginData{Username: "user", Password: "123"})
+	r.AssertStatus(routes.LoginHandler, 202)
+
+	var pending models.PendingLogin
+	r.GetResponse(&pending)
+	assert.NotEqual(t, "", pending.PendingToken)
+
+	calls := r.DB.GetCalls("CreatePendingLogin")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, user.ID, calls[0][0])
+		assert.Equal(t, database.HashToken(pending.PendingToken), calls[0][1])
+		assert.Equal(t, 5*time.Minute, calls[0][3].(time.Time).Sub(calls[0][2].(time.Time)))
+	}
+
+	// The user shouldn't be logged in until a code is entered.
+	assert.Equal(t, 0, len(r.DB.GetCalls("CreateSession")))
+	assert.Equal(t, 0, len(r.DB.GetCalls("ClearLoginFailures")))
+}
+
+func TestLoginTOTP(t *testing.T) {
+	var tests = map[string]struct {
+		login                models.TwoFactorLogin
+		expectedStepCalls    int
+		expectedRecoveryHash string
+	}{
+		"Code": {
+			login:             models.TwoFactorLogin{PendingToken: "abc"},
+			expectedStepCalls: 1,
+		},
+		"RecoveryCode": {
+			login:                models.TwoFactorLogin{PendingToken: "abc", RecoveryCode: " ABCDE-FGHIJ"},
+			expectedRecoveryHash: database.HashToken("abcdefghij"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user"}
+			r.DB.GetPendingLoginResult.A = user
+			r.DB.GetTOTPResult.A = models.TOTP{UserID: user.ID, Secret: testSecret, Confirmed: true}
+
+			if len(testData.login.RecoveryCode) == 0 {
+				testData.login.Code = currentCode(t)
+			}
+
+			r.SetRequestBody(testData.login)
+			r.AssertStatus(routes.LoginTOTPHandler, 200)
+
+			var actualUser models.User
+			r.GetResponse(&actualUser)
+			assert.Equal(t, user, actualUser)
+
+			assert.Equal(t, database.HashToken("abc"), r.DB.GetCalls("GetPendingLogin")[0][0])
+			assert.Equal(t, testData.expectedStepCalls, len(r.DB.GetCalls("UseTOTPStep")))
+
+			if len(testData.expectedRecoveryHash) > 0 {
+				assert.Equal(t, [][]any{{user.ID, testData.expectedRecoveryHash}}, r.DB.GetCalls("UseRecoveryCode"))
+			}
+
+			assert.Equal(t, [][]any{{database.HashToken("abc")}}, r.DB.GetCalls("DeletePendingLogin"))
+			assert.Equal(t, [][]any{{"username:user"}}, r.DB.GetCalls("ClearLoginFailures"))
+			assert.Equal(t, 1, len(r.DB.GetCalls("CreateSession")))
+		})
+	}
+}
+
+func TestLoginTOTPErrors(t *testing.T) {
+	var tests = map[string]struct {
+		login                  models.TwoFactorLogin
+		pendingError           error
+		stepError              error
+		recoveryError          error
+		lockedOut              bool
+		expectedStatusCode     int
+		expectedError          models.ErrorLocation
+		expectedFailureRecords int
+	}{
+		"MissingToken": {
+			login:              models.TwoFactorLogin{Code: "000000"},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "pendingToken"),
+		},
+		"ExpiredToken": {
+			login:              models.TwoFactorLogin{PendingToken: "abc", Code: "000000"},
+			pendingError:       database.NotFoundErr,
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("invalidToken", "Invalid or expired token", "body", "pendingToken"),
+		},
+		"WrongCode": {
+			login:                  models.TwoFactorLogin{PendingToken: "abc", Code: "000000"},
+			expectedStatusCode:     403,
+			expectedError:          models.NewErrorLocation("invalidCode", "Invalid code", "body", "code"),
+			expectedFailureRecords: 2,
+		},
+		"ReusedCode": {
+			login:                  models.TwoFactorLogin{PendingToken: "abc"},
+			stepError:              database.NotFoundErr,
+			expectedStatusCode:     403,
+			expectedError:          models.NewErrorLocation("invalidCode", "Invalid code", "body", "code"),
+			expectedFailureRecords: 2,
+		},
+		"WrongRecoveryCode": {
+			login:                  models.TwoFactorLogin{PendingToken: "abc", RecoveryCode: "abcde-fghij"},
+			recoveryError:          database.NotFoundErr,
+			expectedStatusCode:     403,
+			expectedError:          models.NewErrorLocation("invalidCode", "Invalid recovery code", "body", "recoveryCode"),
+			expectedFailureRecords: 2,
+		},
+		"LockedOut": {
+			login:              models.TwoFactorLogin{PendingToken: "abc"},
+			lockedOut:          true,
+			expectedStatusCode: 429,
+			expectedError:      models.NewErrorLocation("tooManyAttempts", "Too many failed login attempts", "body"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user"}
+			r.DB.GetPendingLoginResult.A = user
+			r.DB.GetPendingLoginResult.B = testData.pendingError
+			r.DB.GetTOTPResult.A = models.TOTP{UserID: user.ID, Secret: testSecret, Confirmed: true}
+			r.DB.UseTOTPStepResult = testData.stepError
+			r.DB.UseRecoveryCodeResult = testData.recoveryError
+
+			if testData.lockedOut {
+				r.DB.GetLoginLockoutResult.A = time.Now().Add(time.Minute)
+			}
+
+			if len(testData.login.Code) == 0 && len(testData.login.RecoveryCode) == 0 {
+				testData.login.Code = currentCode(t)
+			}
+
+			r.SetRequestBody(testData.login)
+			r.AssertStatus(routes.LoginTOTPHandler, testData.expectedStatusCode)
+
+			var actualError models.Error
+			r.GetResponse(&actualError)
+			assert.Equal(t, []models.ErrorLocation{testData.expectedError}, actualError.Detail)
+
+			assert.Equal(t, testData.expectedFailureRecords, len(r.DB.GetCalls("RecordLoginFailure")))
+			assert.Equal(t, 0, len(r.DB.GetCalls("DeletePendingLogin")))
+			assert.Equal(t, 0, len(r.DB.GetCalls("CreateSession")))
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package routes
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// sameEmail returns true if two optional email addresses are the same.
+func sameEmail(left *string, right *string) bool {
+	if left == nil || right == nil {
+		return left == right
+	}
+
+	return *left == *right
+}
+
+// checkCurrentPassword checks the password for the current user, for changes
+// which need more than a session. Wrong passwords count as failed logins, so
+// a stolen session can't be used to guess the password.
+// A 403 response, or a 429 response when locked out, is sent if the password
+// is wrong, and false is returned.
+func checkCurrentPassword(
+	c *fiber.Ctx,
+	db database.DatabaseAPI,
+	user models.User,
+	password string,
+	field string,
+) (bool, error) {
+	errorLocation := models.NewErrorLocation("invalidCredentials", "Incorrect password", "body", field)
+
+	if len(password) == 0 || len(password) > maximumPasswordLength {
+		return false, sendError(c, 403, []models.ErrorLocation{errorLocation})
+	}
+
+	now := time.Now()
+	lockedUntil, err := db.GetLoginLockout(c.Context(), loginKeys(c, user.Username), now)
+
+	if err != nil {
+		return false, err
+	}
+
+	if !lockedUntil.IsZero() {
+		return false, sendLockedOut(c, lockedUntil, now)
+	}
+
+	_, err = db.GetUserWithCredentials(c.Context(), user.Username, password)
+
+	if errors.Is(err, database.NotFoundErr) {
+		return false, failLogin(c, db, user.Username, now, errorLocation)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// reauthenticationWindow is how long after logging in again with a provider
+// users without a password can make changes which need them to log in again.
+const reauthenticationWindow = 5 * time.Minute
+
+// reauthenticate checks the current user is really there before a change such
+// as deleting their account. Users with a password enter it, and users who
+// only log in with a provider need a session from recently logging in again
+// with reauthenticate set, where the provider confirmed they logged in.
+func reauthenticate(
+	c *fiber.Ctx,
+	db database.DatabaseAPI,
+	user models.User,
+	password string,
+	field string,
+) (bool, error) {
+	account, err := db.GetAccount(c.Context(), user.ID)
+
+	if err != nil {
+		return false, err
+	}
+
+	if account.HasPassword {
+		return checkCurrentPassword(c, db, user, password, field)
+	}
+
+	errorLocation := models.NewErrorLocation(
+		"reauthenticationRequired",
+		"Log in with your provider again to confirm",
+		"body",
+	)
+	id, err := apisession.SessionID(c)
+
+	if err != nil {
+		return false, sendError(c, 403, []models.ErrorLocation{errorLocation})
+	}
+
+	now := time.Now()
+	session, err := db.GetSession(c.Context(), id, now)
+
+	if errors.Is(err, database.NotFoundErr) {
+		return false, sendError(c, 403, []models.ErrorLocation{errorLocation})
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	// Logging in creates a new session, so sessions are as old as the login.
+	if !session.Reauthenticated || session.UserID != user.ID ||
+		now.Sub(session.Created) > reauthenticationWindow {
+		return false, sendError(c, 403, []models.ErrorLocation{errorLocation})
+	}
+
+	return true, nil
+}
+
+// GetCurrentUserHandler godoc
+// @Tags Users
+// @Summary Get the current user
+// @Description Get the account for the current session, including private details such as the email address
+// @Success 200 {object} Account
+// @Failure 403 {object} Error
+// @Router /api/users/me [get]
+func GetCurrentUserHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		account, err := db.GetAccount(c.Context(), user.ID)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(account)
+	}
+}
+
+// UpdateCurrentUserHandler godoc
+// @Tags Users
+// @Summary Update the current user
+// @Description Change the username, email address or password for the current user. Changing the password requires the current password, and logs out every other session. A new email address needs to be verified again
+// @Param data body UserUpdate true "The details to change"
+// @Success 200 {object} Account
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/users/me [patch]
+func UpdateCurrentUserHandler(db database.DatabaseAPI, mail AccountMail) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		var update models.UserUpdate
+
+		if err := c.BodyParser(&update); err != nil {
+			return err
+		}
+
+		if update.Username != nil {
+			if errorLocation, ok := checkUsername(*update.Username); !ok {
+				return sendError(c, 422, []models.ErrorLocation{errorLocation})
+			}
+		}
+
+		if update.Email != nil && len(*update.Email) > 0 {
+			if errorLocation, ok := checkEmail(*update.Email); !ok {
+				return sendError(c, 422, []models.ErrorLocation{errorLocation})
+			}
+		}
+
+		if update.NewPassword != nil {
+			if errorLocation, ok := checkNewPassword(*update.NewPassword, update.ConfirmPassword); !ok {
+				return sendError(c, 422, []models.ErrorLocation{errorLocation})
+			}
+
+			if ok, err := checkCurrentPassword(c, db, user, update.CurrentPassword, "currentPassword"); err != nil || !ok {
+				return err
+			}
+		}
+
+		account, err := db.GetAccount(c.Context(), user.ID)
+
+		if err != nil {
+			return err
+		}
+
+		// Everything has been checked, so the changes are saved together.
+		var changes database.AccountChanges
+
+		if update.Username != nil && *update.Username != account.Username {
+			changes.Username = update.Username
+		}
+
+		if update.Email != nil {
+			// An empty string removes the address.
+			var email *string
+
+			if len(*update.Email) > 0 {
+				email = update.Email
+			}
+
+			if !sameEmail(email, account.Email) {
+				changes.ChangeEmail = true
+				changes.Email = email
+			}
+		}
+
+		if update.NewPassword != nil {
+			changes.Password = update.NewPassword
+			// LoadUser has already checked the session ID.
+			changes.KeepSessionID, _ = apisession.SessionID(c)
+		}
+
+		if changes == (database.AccountChanges{}) {
+			return c.JSON(account)
+		}
+
+		err = db.UpdateAccount(c.Context(), user.ID, changes)
+
+		if errors.Is(err, database.DuplicateUsernameErr) {
+			return sendBodyError(c, 403, "duplicateUser", "User already exists")
+		}
+
+		if errors.Is(err, database.DuplicateEmailErr) {
+			return sendError(c, 403, []models.ErrorLocation{
+				models.NewErrorLocation("duplicateEmail", "Email address already in use", "body", "email"),
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if changes.Username != nil {
+			account.Username = *changes.Username
+		}
+
+		if changes.ChangeEmail {
+			account.Email = changes.Email
+			account.EmailVerified = false
+
+			if changes.Email != nil {
+				if err := sendEmailVerification(c, db, mail, account.User, *changes.Email); err != nil {
+					return err
+				}
+			}
+		}
+
+		return c.JSON(account)
+	}
+}
+
+// DeleteCurrentUserHandler godoc
+// @Tags Users
+// @Summary Delete the current user
+// @Description Delete the account for the current user, either deleting their code samples or keeping them credited to a "ghost" user. Users without a password need to have logged in with `/api/auth/oidc/login?reauthenticate=true` in the last 5 minutes instead
+// @Param data body AccountDeletion true "The current password and what to do with samples"
+// @Success 204
+// @Failure 403 {object} Error
+// @Failure 422 {object} Error
+// @Router /api/users/me [delete]
+func DeleteCurrentUserHandler(db database.DatabaseAPI) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, err := apisession.LoadUser(c, db)
+
+		if err != nil {
+			return err
+		}
+
+		var deletion models.AccountDeletion
+
+		if err := c.BodyParser(&deletion); err != nil {
+			return err
+		}
+
+		switch deletion.Samples {
+		case models.SamplesDelete, models.SamplesReassign:
+		default:
+			return sendError(c, 422, []models.ErrorLocation{
+				models.NewErrorLocation("invalidValue", "samples must be delete or reassign", "body", "samples"),
+			})
+		}
+
+		if ok, err := reauthenticate(c, db, user, deletion.Password, "password"); err != nil || !ok {
+			return err
+		}
+
+		if err := db.DeleteUser(c.Context(), user.ID, deletion.Samples); err != nil {
+			return err
+		}
+
+		// Sessions are deleted with the user, so only the cookie is left.
+		apisession.ClearSession(c)
+		c.Status(204)
+
+		return nil
+	}
+}
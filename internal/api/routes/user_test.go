@@ -0,0 +1,417 @@
+package routes_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/apisession"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/models"
+	"github.com/dense-analysis/codelibrary/internal/api/routes"
+	"github.com/dense-analysis/codelibrary/internal/testutils"
+	"github.com/dense-analysis/ranges"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func updateCurrentUserHandler(db database.DatabaseAPI) fiber.Handler {
+	return routes.UpdateCurrentUserHandler(db, testMail(io.Discard))
+}
+
+func TestGetCurrentUser(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	account := models.Account{User: user, Email: stringPointer("user@example.com"), EmailVerified: true}
+	r.DB.GetAccountResult.A = account
+
+	r.AssertStatus(routes.GetCurrentUserHandler, 200)
+
+	var actualAccount models.Account
+	r.GetResponse(&actualAccount)
+	assert.Equal(t, account, actualAccount)
+}
+
+func TestChangeUsername(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetAccountResult.A = models.Account{User: user}
+
+	r.SetRequestBody(models.UserUpdate{Username: stringPointer("new_name")})
+	r.AssertStatus(updateCurrentUserHandler, 200)
+
+	var actualUser models.User
+	r.GetResponse(&actualUser)
+	assert.Equal(t, "new_name", actualUser.Username)
+	// The password isn't needed or changed for a new username.
+	assert.Equal(
+		t,
+		[][]any{{user.ID, database.AccountChanges{Username: stringPointer("new_name")}}},
+		r.DB.GetCalls("UpdateAccount"),
+	)
+	assert.Equal(t, 0, len(r.DB.GetCalls("GetUserWithCredentials")))
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetAccountResult.A = models.Account{User: user}
+	r.DB.GetUserWithCredentialsResult.A = user
+
+	r.SetRequestBody(models.UserUpdate{
+		CurrentPassword: "old password",
+		NewPassword:     stringPointer("new password"),
+		ConfirmPassword: "new password",
+	})
+	r.AssertStatus(updateCurrentUserHandler, 200)
+
+	assert.Equal(t, [][]any{{"user", "old password"}}, r.DB.GetCalls("GetUserWithCredentials"))
+
+	// Every session except the current one should be logged out.
+	sessionID, _ := apisession.SessionID(r.Ctx)
+	assert.Equal(
+		t,
+		[][]any{{user.ID, database.AccountChanges{Password: stringPointer("new password"), KeepSessionID: sessionID}}},
+		r.DB.GetCalls("UpdateAccount"),
+	)
+}
+
+// Changes are saved in one call, so a failure saves none of them.
+func TestUpdateCurrentUserTogether(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetAccountResult.A = models.Account{User: user}
+	r.DB.GetUserWithCredentialsResult.A = user
+	r.DB.UpdateAccountResult = database.DuplicateEmailErr
+
+	r.SetRequestBody(models.UserUpdate{
+		Username:        stringPointer("new_name"),
+		Email:           stringPointer("taken@example.com"),
+		CurrentPassword: "old password",
+		NewPassword:     stringPointer("new password"),
+		ConfirmPassword: "new password",
+	})
+	r.AssertStatus(updateCurrentUserHandler, 403)
+	r.AssertResponseError(
+		models.NewErrorLocation("duplicateEmail", "Email address already in use", "body", "email"),
+	)
+
+	sessionID, _ := apisession.SessionID(r.Ctx)
+	assert.Equal(
+		t,
+		[][]any{{user.ID, database.AccountChanges{
+			Username:      stringPointer("new_name"),
+			ChangeEmail:   true,
+			Email:         stringPointer("taken@example.com"),
+			Password:      stringPointer("new password"),
+			KeepSessionID: sessionID,
+		}}},
+		r.DB.GetCalls("UpdateAccount"),
+	)
+	assert.Equal(t, 0, len(r.DB.GetCalls("CreateEmailVerification")))
+}
+
+func TestUpdateCurrentUserErrors(t *testing.T) {
+	var tests = map[string]struct {
+		update             models.UserUpdate
+		credentialsError   error
+		databaseError      error
+		expectedStatusCode int
+		expectedError      models.ErrorLocation
+	}{
+		"WrongPassword": {
+			update: models.UserUpdate{
+				CurrentPassword: "wrong password",
+				NewPassword:     stringPointer("new password"),
+				ConfirmPassword: "new password",
+			},
+			credentialsError:   database.NotFoundErr,
+			expectedStatusCode: 403,
+			expectedError:      models.NewErrorLocation("invalidCredentials", "Incorrect password", "body", "currentPassword"),
+		},
+		"MissingPassword": {
+			update: models.UserUpdate{
+				NewPassword:     stringPointer("new password"),
+				ConfirmPassword: "new password",
+			},
+			expectedStatusCode: 403,
+			expectedError:      models.NewErrorLocation("invalidCredentials", "Incorrect password", "body", "currentPassword"),
+		},
+		"PasswordTooShort": {
+			update: models.UserUpdate{
+				CurrentPassword: "old password",
+				NewPassword:     stringPointer("short"),
+				ConfirmPassword: "short",
+			},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("badPassword", "Password too short", "body"),
+		},
+		"PasswordMismatch": {
+			update: models.UserUpdate{
+				CurrentPassword: "old password",
+				NewPassword:     stringPointer("new password"),
+				ConfirmPassword: "other password",
+			},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("passwordMismatch", "Passwords do not match", "body"),
+		},
+		"EmptyUsername": {
+			update:             models.UserUpdate{Username: stringPointer("")},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("badUsername", "Username is required", "body"),
+		},
+		"ReservedUsername": {
+			update:             models.UserUpdate{Username: stringPointer("ghost")},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("badUsername", "Username is reserved", "body"),
+		},
+		"DuplicateUsername": {
+			update:             models.UserUpdate{Username: stringPointer("taken")},
+			databaseError:      database.DuplicateUsernameErr,
+			expectedStatusCode: 403,
+			expectedError:      models.NewErrorLocation("duplicateUser", "User already exists", "body"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			r.DB.GetUserWithCredentialsResult.B = testData.credentialsError
+			r.DB.UpdateAccountResult = testData.databaseError
+
+			r.SetRequestBody(testData.update)
+			r.AssertStatus(updateCurrentUserHandler, testData.expectedStatusCode)
+			r.AssertResponseError(testData.expectedError)
+
+			// Passwords are never changed when something is wrong.
+			for _, call := range r.DB.GetCalls("UpdateAccount") {
+				assert.Nil(t, call[1].(database.AccountChanges).Password)
+			}
+		})
+	}
+}
+
+// Checking the current password counts failures like logging in, so stolen
+// sessions can't be used to guess passwords.
+func TestCurrentPasswordLoginLimits(t *testing.T) {
+	t.Parallel()
+
+	update := models.UserUpdate{
+		CurrentPassword: "wrong password",
+		NewPassword:     stringPointer("new password"),
+		ConfirmPassword: "new password",
+	}
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetUserWithCredentialsResult.B = database.NotFoundErr
+	r.DB.RecordLoginFailureResult.A = 5
+
+	r.SetRequestBody(update)
+	r.AssertStatus(updateCurrentUserHandler, 429)
+
+	recordCalls := r.DB.GetCalls("RecordLoginFailure")
+
+	if assert.Equal(t, 2, len(recordCalls)) {
+		assert.Equal(t, "username:user", recordCalls[0][0])
+		assert.Equal(t, "ip:0.0.0.0", recordCalls[1][0])
+	}
+
+	// Passwords aren't checked at all while locked out.
+	locked := NewRouteTester(t)
+	defer locked.Release()
+
+	apisession.SaveUser(locked.Ctx, locked.DB, user)
+	locked.DB.GetSessionUserResult.A = user
+	locked.DB.GetLoginLockoutResult.A = time.Now().Add(time.Minute)
+
+	locked.SetRequestBody(update)
+	locked.AssertStatus(updateCurrentUserHandler, 429)
+
+	calls := locked.DB.GetCalls("GetLoginLockout")
+
+	if assert.Equal(t, 1, len(calls)) {
+		assert.Equal(t, []string{"username:user", "ip:0.0.0.0"}, calls[0][0])
+	}
+
+	assert.Equal(t, 0, len(locked.DB.GetCalls("GetUserWithCredentials")))
+	assert.Equal(t, 0, len(locked.DB.GetCalls("UpdateAccount")))
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	t.Parallel()
+
+	r := NewRouteTester(t)
+	defer r.Release()
+
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+	apisession.SaveUser(r.Ctx, r.DB, user)
+	r.DB.GetSessionUserResult.A = user
+	r.DB.GetAccountResult.A = models.Account{User: user, HasPassword: true}
+	r.DB.GetUserWithCredentialsResult.A = user
+
+	r.SetRequestBody(models.AccountDeletion{Password: "password", Samples: models.SamplesReassign})
+	r.AssertStatus(routes.DeleteCurrentUserHandler, 204)
+
+	assert.Equal(t, [][]any{{user.ID, models.SamplesReassign}}, r.DB.GetCalls("DeleteUser"))
+
+	_, err := apisession.SessionID(r.Ctx)
+	assert.Equal(t, apisession.NoUserInSessionErr, err)
+}
+
+func TestDeleteCurrentUserErrors(t *testing.T) {
+	var tests = map[string]struct {
+		deletion           models.AccountDeletion
+		credentialsError   error
+		expectedStatusCode int
+		expectedError      models.ErrorLocation
+	}{
+		"WrongPassword": {
+			deletion:           models.AccountDeletion{Password: "wrong", Samples: models.SamplesDelete},
+			credentialsError:   database.NotFoundErr,
+			expectedStatusCode: 403,
+			expectedError:      models.NewErrorLocation("invalidCredentials", "Incorrect password", "body", "password"),
+		},
+		"MissingSamples": {
+			deletion:           models.AccountDeletion{Password: "password"},
+			expectedStatusCode: 422,
+			expectedError:      models.NewErrorLocation("invalidValue", "samples must be delete or reassign", "body", "samples"),
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			r.DB.GetAccountResult.A = models.Account{User: user, HasPassword: true}
+			r.DB.GetUserWithCredentialsResult.B = testData.credentialsError
+
+			r.SetRequestBody(testData.deletion)
+			r.AssertStatus(routes.DeleteCurrentUserHandler, testData.expectedStatusCode)
+			r.AssertResponseError(testData.expectedError)
+			assert.Equal(t, 0, len(r.DB.GetCalls("DeleteUser")))
+		})
+	}
+}
+
+func TestDeleteCurrentUserWithoutPassword(t *testing.T) {
+	user := models.User{ID: testutils.UUIDFromInt(1), Username: "user", Role: models.RoleUser}
+
+	var tests = map[string]struct {
+		session            models.Session
+		sessionError       error
+		expectedStatusCode int
+	}{
+		"Reauthenticated": {
+			session: models.Session{
+				UserID:          user.ID,
+				Created:         time.Now().Add(-time.Minute),
+				Reauthenticated: true,
+			},
+			expectedStatusCode: 204,
+		},
+		// A new session might come from the provider logging the user in
+		// without asking, so it has to be from logging in again.
+		"RecentLogin": {
+			session:            models.Session{UserID: user.ID, Created: time.Now().Add(-time.Minute)},
+			expectedStatusCode: 403,
+		},
+		"OldLogin": {
+			session: models.Session{
+				UserID:          user.ID,
+				Created:         time.Now().Add(-10 * time.Minute),
+				Reauthenticated: true,
+			},
+			expectedStatusCode: 403,
+		},
+		"OtherUser": {
+			session: models.Session{
+				UserID:          testutils.UUIDFromInt(2),
+				Created:         time.Now(),
+				Reauthenticated: true,
+			},
+			expectedStatusCode: 403,
+		},
+		"ExpiredSession": {
+			sessionError:       database.NotFoundErr,
+			expectedStatusCode: 403,
+		},
+	}
+
+	for name, testData := range tests {
+		testData := testData
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewRouteTester(t)
+			defer r.Release()
+
+			// Users who only log in with a provider have no password to enter.
+			apisession.SaveUser(r.Ctx, r.DB, user)
+			r.DB.GetSessionUserResult.A = user
+			r.DB.GetAccountResult.A = models.Account{User: user}
+			r.DB.GetSessionResult = ranges.MakePair(testData.session, testData.sessionError)
+
+			r.SetRequestBody(models.AccountDeletion{Samples: models.SamplesDelete})
+			r.AssertStatus(routes.DeleteCurrentUserHandler, testData.expectedStatusCode)
+
+			if testData.expectedStatusCode == 204 {
+				assert.Equal(t, [][]any{{user.ID, models.SamplesDelete}}, r.DB.GetCalls("DeleteUser"))
+			} else {
+				r.AssertResponseError(
+					models.NewErrorLocation("reauthenticationRequired", "Log in with your provider again to confirm", "body"),
+				)
+				assert.Empty(t, r.DB.GetCalls("DeleteUser"))
+			}
+
+			assert.Empty(t, r.DB.GetCalls("GetUserWithCredentials"))
+		})
+	}
+}
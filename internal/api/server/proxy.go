@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProxyConfig is how to find the client IP address for requests forwarded by
+// a reverse proxy such as nginx.
+type ProxyConfig struct {
+	// Header is set by the proxy to the client IP address, such as X-Real-IP.
+	Header string `toml:"header" yaml:"header"`
+	// Trusted lists the IP addresses or CIDR ranges of proxies. The header is
+	// ignored for requests from anywhere else, as clients can set it too.
+	Trusted []string `toml:"trusted" yaml:"trusted"`
+}
+
+// Check returns true if every trusted proxy is an IP address or CIDR range.
+func (p ProxyConfig) Check() bool {
+	for _, proxy := range p.Trusted {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Apply sets up the app so c.IP() returns the client IP address from the
+// header for requests from trusted proxies, and the address of the
+// connection otherwise.
+func (p ProxyConfig) Apply(config *fiber.Config) {
+	config.ProxyHeader = p.Header
+	config.EnableTrustedProxyCheck = true
+	config.TrustedProxies = p.Trusted
+	config.EnableIPValidation = true
+}
@@ -0,0 +1,49 @@
+package server_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dense-analysis/codelibrary/internal/api/server"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// clientIP returns the IP address the app sees for a request with X-Real-IP.
+func clientIP(t *testing.T, proxy server.ProxyConfig, realIP string) string {
+	t.Helper()
+	var config fiber.Config
+	proxy.Apply(&config)
+	app := fiber.New(config)
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.IP())
+	})
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Real-IP", realIP)
+	response, err := app.Test(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := make([]byte, 64)
+	n, _ := response.Body.Read(body)
+
+	return string(body[:n])
+}
+
+func TestProxyConfig(t *testing.T) {
+	// Test requests come from 0.0.0.0.
+	trusted := server.ProxyConfig{Header: "X-Real-IP", Trusted: []string{"0.0.0.0/8"}}
+	untrusted := server.ProxyConfig{Header: "X-Real-IP", Trusted: []string{"10.0.0.1"}}
+
+	assert.Equal(t, "203.0.113.1", clientIP(t, trusted, "203.0.113.1"))
+	assert.Equal(t, "0.0.0.0", clientIP(t, untrusted, "203.0.113.1"))
+	assert.Equal(t, "0.0.0.0", clientIP(t, server.ProxyConfig{}, "203.0.113.1"))
+}
+
+func TestProxyConfigCheck(t *testing.T) {
+	assert.True(t, server.ProxyConfig{Trusted: []string{"10.0.0.1", "172.16.0.0/12", "::1"}}.Check())
+	assert.False(t, server.ProxyConfig{Trusted: []string{"nginx"}}.Check())
+}
@@ -0,0 +1,47 @@
+// Package server runs the app until it's told to stop, and then stops it
+// without dropping requests which are still being handled.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var DrainTimeoutErr = errors.New("timed out waiting for requests to finish")
+
+// Serve handles requests from a listener until the context is done. It then
+// stops accepting connections and waits up to drainTimeout for requests in
+// flight to finish.
+func Serve(ctx context.Context, app *fiber.App, listener net.Listener, drainTimeout time.Duration) error {
+	served := make(chan error, 1)
+
+	go func() {
+		served <- app.Listener(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	err := app.ShutdownWithContext(drainCtx)
+	// The server might not have started using the listener yet, in which case
+	// only closing it will stop the server.
+	listener.Close()
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return DrainTimeoutErr
+	} else if err != nil {
+		return err
+	}
+
+	return <-served
+}
@@ -0,0 +1,106 @@
+package server_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/server"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer serves an app with a slow route, returning the address and a
+// channel for the result of Serve.
+func startServer(
+	ctx context.Context,
+	t *testing.T,
+	delay time.Duration,
+	drainTimeout time.Duration,
+) (string, chan error) {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		time.Sleep(delay)
+
+		return c.SendString("done")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.Serve(ctx, app, listener, drainTimeout)
+	}()
+
+	return listener.Addr().String(), served
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	address, served := startServer(ctx, t, 200*time.Millisecond, 5*time.Second)
+
+	responses := make(chan string, 1)
+
+	go func() {
+		response, err := http.Get("http://" + address + "/slow")
+
+		if err != nil {
+			responses <- err.Error()
+
+			return
+		}
+
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		responses <- string(body)
+	}()
+
+	// Stop the server while the request is being handled.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	assert.Equal(t, "done", <-responses)
+	assert.Nil(t, <-served)
+
+	_, err := net.Dial("tcp", address)
+	assert.NotNil(t, err, "The server should stop accepting connections")
+}
+
+func TestServeDrainTimeout(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	address, served := startServer(ctx, t, time.Second, 100*time.Millisecond)
+
+	go http.Get("http://" + address + "/slow")
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	assert.Equal(t, server.DrainTimeoutErr, <-served)
+}
+
+func TestServeStoppedBeforeStarting(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, served := startServer(ctx, t, 0, time.Second)
+
+	select {
+	case err := <-served:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+}
@@ -0,0 +1,84 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the SHA1 secret used for the test vectors in RFC 6238.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC gives 8 digit codes, so these are the last 6 digits.
+	var tests = map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for seconds, expectedCode := range tests {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(seconds, 0)))
+
+		assert.Nil(t, err)
+		assert.Equal(t, expectedCode, code, "time %d", seconds)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	step, ok := totp.Validate(rfcSecret, "050471", now)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now), step)
+
+	// Codes from the step before or after are allowed for clock drift.
+	previous, _ := totp.Code(rfcSecret, totp.Step(now)-1)
+	step, ok = totp.Validate(rfcSecret, previous, now)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now)-1, step)
+
+	tooOld, _ := totp.Code(rfcSecret, totp.Step(now)-2)
+	_, ok = totp.Validate(rfcSecret, tooOld, now)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(rfcSecret, "000000", now)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(rfcSecret, "", now)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate("not base32!", "050471", now)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 32, len(secret))
+
+	code, err := totp.Code(secret, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(code))
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(totp.URI("Code Library", "some user", "ABCDEF"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Code Library:some user", uri.Path)
+	assert.Equal(t, "ABCDEF", uri.Query().Get("secret"))
+	assert.Equal(t, "Code Library", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+	assert.Equal(t, "30", uri.Query().Get("period"))
+}
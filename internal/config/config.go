@@ -0,0 +1,480 @@
+// Package config loads settings for the app from an optional TOML or YAML file
+// and the environment, and checks them all before the server starts.
+//
+// Settings in the environment override settings in the file.
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+	"github.com/dense-analysis/codelibrary/internal/api/oidc"
+	"github.com/dense-analysis/codelibrary/internal/api/ratelimit"
+	"github.com/dense-analysis/codelibrary/internal/api/server"
+	"gopkg.in/yaml.v3"
+)
+
+// cookieSecretLength is the length of the AES-256 key for encrypting cookies.
+const cookieSecretLength = 32
+
+// OIDC lists the OpenID Connect providers users can log in with.
+type OIDC struct {
+	// RedirectURL is used for providers which don't set their own.
+	RedirectURL string        `toml:"redirect_url" yaml:"redirect_url"`
+	Providers   []oidc.Config `toml:"providers" yaml:"providers"`
+}
+
+// RateLimits are the budgets for each group of routes.
+type RateLimits struct {
+	Read  ratelimit.Budget `toml:"read" yaml:"read"`
+	Write ratelimit.Budget `toml:"write" yaml:"write"`
+	Auth  ratelimit.Budget `toml:"auth" yaml:"auth"`
+}
+
+func (r RateLimits) Budgets() map[ratelimit.Group]ratelimit.Budget {
+	return map[ratelimit.Group]ratelimit.Budget{
+		ratelimit.GroupRead:  r.Read,
+		ratelimit.GroupWrite: r.Write,
+		ratelimit.GroupAuth:  r.Auth,
+	}
+}
+
+type Config struct {
+	Port int `toml:"port" yaml:"port"`
+	// MetricsPort is the port metrics are served on, apart from the API so
+	// they aren't exposed along with it.
+	MetricsPort int `toml:"metrics_port" yaml:"metrics_port"`
+	// Proxy is the reverse proxy requests come through, if there is one.
+	Proxy server.ProxyConfig `toml:"proxy" yaml:"proxy"`
+	// PublicURL is the address people visit the site at, which links in
+	// emails are built from.
+	PublicURL string `toml:"public_url" yaml:"public_url"`
+	// ShutdownTimeout is how long to wait for requests to finish when stopping.
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" yaml:"shutdown_timeout"`
+	// CookieSecret is a base64 key for encrypting cookies.
+	CookieSecret             string          `toml:"cookie_secret" yaml:"cookie_secret"`
+	RequireVerifiedEmail     bool            `toml:"require_verified_email" yaml:"require_verified_email"`
+	RequireTwoFactor         bool            `toml:"require_two_factor" yaml:"require_two_factor"`
+	DisableLocalRegistration bool            `toml:"disable_local_registration" yaml:"disable_local_registration"`
+	Log                      logging.Config  `toml:"log" yaml:"log"`
+	Database                 database.Config `toml:"database" yaml:"database"`
+	Mail                     mailer.Config   `toml:"mail" yaml:"mail"`
+	OIDC                     OIDC            `toml:"oidc" yaml:"oidc"`
+	RateLimits               RateLimits      `toml:"rate_limits" yaml:"rate_limits"`
+}
+
+// Default returns the settings used when nothing else is set.
+func Default() Config {
+	return Config{
+		Port:            7000,
+		MetricsPort:     7001,
+		ShutdownTimeout: 30 * time.Second,
+		Log:             logging.Config{Format: logging.FormatJSON, Level: "info"},
+		Database: database.Config{
+			Port:            "5432",
+			ConnectAttempts: database.DefaultConnectAttempts,
+		},
+		Mail: mailer.Config{SMTPPort: "587"},
+		RateLimits: RateLimits{
+			Read:  ratelimit.DefaultBudgets[ratelimit.GroupRead],
+			Write: ratelimit.DefaultBudgets[ratelimit.GroupWrite],
+			Auth:  ratelimit.DefaultBudgets[ratelimit.GroupAuth],
+		},
+	}
+}
+
+// Error lists every problem found with the configuration.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Load reads the file named by CONFIG_FILE, if it is set, and then the
+// environment, and checks the result.
+// An *Error with every problem is returned if anything is wrong.
+func Load() (Config, error) {
+	config := Default()
+	problems := []string{}
+
+	if path := os.Getenv("CONFIG_FILE"); len(path) > 0 {
+		problems = append(problems, LoadFile(path, &config)...)
+	}
+
+	problems = append(problems, LoadEnv(&config)...)
+	problems = append(problems, config.Check()...)
+
+	if len(problems) > 0 {
+		return config, &Error{Problems: problems}
+	}
+
+	return config, nil
+}
+
+// LoadFile reads settings from a TOML or YAML file, chosen by the extension.
+// Unknown settings are reported as problems, to catch typos.
+func LoadFile(path string, config *Config) []string {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		metadata, err := toml.Decode(string(data), config)
+
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %v", path, err)}
+		}
+
+		problems := []string{}
+
+		for _, key := range metadata.Undecoded() {
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %s", path, key))
+		}
+
+		return problems
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(config); err != nil {
+			return []string{fmt.Sprintf("%s: %v", path, err)}
+		}
+
+		return nil
+	default:
+		return []string{fmt.Sprintf("%s: config files must end in .toml, .yaml or .yml", path)}
+	}
+}
+
+// envLoader reads settings from the environment, noting any which can't be
+// parsed. Empty variables are ignored.
+type envLoader struct {
+	problems []string
+}
+
+func (l *envLoader) string(name string, value *string) {
+	if text := os.Getenv(name); len(text) > 0 {
+		*value = text
+	}
+}
+
+// list reads a list separated by commas.
+func (l *envLoader) list(name string, value *[]string) {
+	if text := os.Getenv(name); len(text) > 0 {
+		*value = []string{}
+
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				*value = append(*value, item)
+			}
+		}
+	}
+}
+
+func (l *envLoader) int(name string, value *int) {
+	if text := os.Getenv(name); len(text) > 0 {
+		number, err := strconv.Atoi(text)
+
+		if err != nil {
+			l.problems = append(l.problems, name+" must be a whole number")
+		} else {
+			*value = number
+		}
+	}
+}
+
+func (l *envLoader) int32(name string, value *int32) {
+	if text := os.Getenv(name); len(text) > 0 {
+		number, err := strconv.ParseInt(text, 10, 32)
+
+		if err != nil {
+			l.problems = append(l.problems, name+" must be a whole number")
+		} else {
+			*value = int32(number)
+		}
+	}
+}
+
+func (l *envLoader) bool(name string, value *bool) {
+	if text := os.Getenv(name); len(text) > 0 {
+		flag, err := strconv.ParseBool(text)
+
+		if err != nil {
+			l.problems = append(l.problems, name+" must be true or false")
+		} else {
+			*value = flag
+		}
+	}
+}
+
+func (l *envLoader) duration(name string, value *time.Duration) {
+	if text := os.Getenv(name); len(text) > 0 {
+		duration, err := time.ParseDuration(text)
+
+		if err != nil {
+			l.problems = append(l.problems, name+" must be a duration such as 30s or 5m")
+		} else {
+			*value = duration
+		}
+	}
+}
+
+func (l *envLoader) budget(group ratelimit.Group, budget *ratelimit.Budget) {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(string(group))
+
+	l.int(prefix, &budget.PerMinute)
+	l.int(prefix+"_BURST", &budget.Burst)
+}
+
+// LoadEnv reads settings from the environment.
+func LoadEnv(config *Config) []string {
+	var l envLoader
+
+	l.int("API_PORT", &config.Port)
+	l.int("METRICS_PORT", &config.MetricsPort)
+	l.string("PUBLIC_URL", &config.PublicURL)
+	l.string("PROXY_HEADER", &config.Proxy.Header)
+	l.list("TRUSTED_PROXIES", &config.Proxy.Trusted)
+	l.duration("SHUTDOWN_TIMEOUT", &config.ShutdownTimeout)
+	l.string("COOKIE_SECRET", &config.CookieSecret)
+	l.bool("REQUIRE_VERIFIED_EMAIL", &config.RequireVerifiedEmail)
+	l.bool("REQUIRE_TWO_FACTOR", &config.RequireTwoFactor)
+	l.bool("DISABLE_LOCAL_REGISTRATION", &config.DisableLocalRegistration)
+
+	l.string("LOG_FORMAT", &config.Log.Format)
+	l.string("LOG_LEVEL", &config.Log.Level)
+
+	l.string("DATABASE_URL", &config.Database.URL)
+	l.string("POSTGRES_HOST", &config.Database.Host)
+	l.string("POSTGRES_PORT", &config.Database.Port)
+	l.string("POSTGRES_USER", &config.Database.User)
+	l.string("POSTGRES_PASSWORD", &config.Database.Password)
+	l.string("POSTGRES_DB", &config.Database.Name)
+	l.int32("DATABASE_MAX_CONNS", &config.Database.MaxConns)
+	l.int32("DATABASE_MIN_CONNS", &config.Database.MinConns)
+	l.duration("DATABASE_MAX_CONN_LIFETIME", &config.Database.MaxConnLifetime)
+	l.duration("DATABASE_MAX_CONN_IDLE_TIME", &config.Database.MaxConnIdleTime)
+	l.int("DATABASE_CONNECT_ATTEMPTS", &config.Database.ConnectAttempts)
+
+	l.string("SMTP_HOST", &config.Mail.SMTPHost)
+	l.string("SMTP_PORT", &config.Mail.SMTPPort)
+	l.string("SMTP_USERNAME", &config.Mail.SMTPUsername)
+	l.string("SMTP_PASSWORD", &config.Mail.SMTPPassword)
+	l.string("MAIL_FROM", &config.Mail.From)
+	l.string("MAIL_FILE", &config.Mail.File)
+	l.bool("MAIL_LOG", &config.Mail.Log)
+
+	l.string("OIDC_REDIRECT_URL", &config.OIDC.RedirectURL)
+
+	// Providers from the environment are added to any in the file, or change
+	// the settings for a provider with the same name.
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+
+		if len(name) == 0 {
+			continue
+		}
+
+		index := -1
+
+		for i, provider := range config.OIDC.Providers {
+			if provider.Name == name {
+				index = i
+			}
+		}
+
+		if index < 0 {
+			config.OIDC.Providers = append(config.OIDC.Providers, oidc.Config{Name: name})
+			index = len(config.OIDC.Providers) - 1
+		}
+
+		provider := &config.OIDC.Providers[index]
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		l.string(prefix+"ISSUER", &provider.Issuer)
+		l.string(prefix+"CLIENT_ID", &provider.ClientID)
+		l.string(prefix+"CLIENT_SECRET", &provider.ClientSecret)
+	}
+
+	l.budget(ratelimit.GroupRead, &config.RateLimits.Read)
+	l.budget(ratelimit.GroupWrite, &config.RateLimits.Write)
+	l.budget(ratelimit.GroupAuth, &config.RateLimits.Auth)
+
+	return l.problems
+}
+
+// checkPort checks a port number is in range.
+func checkPort(port int) bool {
+	return port >= 1 && port <= 65535
+}
+
+// checkURL checks a URL is an absolute http or https URL.
+func checkURL(text string) bool {
+	parsed, err := url.Parse(text)
+
+	return err == nil && (parsed.Scheme == "https" || parsed.Scheme == "http") && len(parsed.Host) > 0
+}
+
+// Check returns every problem with the settings.
+func (c Config) Check() []string {
+	problems := []string{}
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !checkPort(c.Port) {
+		add("port (API_PORT) must be between 1 and 65535")
+	}
+
+	if !checkPort(c.MetricsPort) {
+		add("metrics_port (METRICS_PORT) must be between 1 and 65535")
+	} else if c.MetricsPort == c.Port {
+		add("metrics_port (METRICS_PORT) must be different from port (API_PORT)")
+	}
+
+	if len(c.PublicURL) == 0 {
+		add("public_url (PUBLIC_URL) is required, such as https://codelibrary.example")
+	} else if parsed, err := url.Parse(c.PublicURL); err != nil || !checkURL(c.PublicURL) ||
+		len(parsed.RawQuery) > 0 || len(parsed.Fragment) > 0 {
+		add("public_url (PUBLIC_URL) must be an http or https URL without a query or fragment")
+	}
+
+	if len(c.Proxy.Header) > 0 && len(c.Proxy.Trusted) == 0 {
+		add("proxy.trusted (TRUSTED_PROXIES) is required with proxy.header (PROXY_HEADER)")
+	}
+
+	if !c.Proxy.Check() {
+		add("proxy.trusted (TRUSTED_PROXIES) must be IP addresses or CIDR ranges")
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		add("shutdown_timeout (SHUTDOWN_TIMEOUT) must be more than 0")
+	}
+
+	if len(c.CookieSecret) == 0 {
+		add("cookie_secret (COOKIE_SECRET) is required, such as from `openssl rand -base64 32`")
+	} else if key, err := base64.StdEncoding.DecodeString(c.CookieSecret); err != nil {
+		add("cookie_secret (COOKIE_SECRET) must be base64")
+	} else if len(key) != cookieSecretLength {
+		add("cookie_secret (COOKIE_SECRET) must be %d bytes, not %d", cookieSecretLength, len(key))
+	}
+
+	if c.Log.Format != logging.FormatJSON && c.Log.Format != logging.FormatText {
+		add("log.format (LOG_FORMAT) must be json or text")
+	}
+
+	if err := new(slog.Level).UnmarshalText([]byte(c.Log.Level)); err != nil {
+		add("log.level (LOG_LEVEL) must be debug, info, warn or error")
+	}
+
+	if len(c.Database.URL) == 0 && (len(c.Database.Host) == 0 || len(c.Database.Name) == 0) {
+		add("database.url (DATABASE_URL) or database.host and database.name (POSTGRES_HOST and POSTGRES_DB) are required")
+	} else if _, err := c.Database.PoolConfig(); err != nil {
+		add("database settings are invalid: %v", err)
+	}
+
+	if c.Database.MaxConns < 0 {
+		add("database.max_conns (DATABASE_MAX_CONNS) can't be negative")
+	}
+
+	if c.Database.MinConns < 0 {
+		add("database.min_conns (DATABASE_MIN_CONNS) can't be negative")
+	}
+
+	if c.Database.MaxConns > 0 && c.Database.MinConns > c.Database.MaxConns {
+		add("database.min_conns (DATABASE_MIN_CONNS) can't be more than database.max_conns (DATABASE_MAX_CONNS)")
+	}
+
+	if c.Database.MaxConnLifetime < 0 {
+		add("database.max_conn_lifetime (DATABASE_MAX_CONN_LIFETIME) can't be negative")
+	}
+
+	if c.Database.MaxConnIdleTime < 0 {
+		add("database.max_conn_idle_time (DATABASE_MAX_CONN_IDLE_TIME) can't be negative")
+	}
+
+	if c.Database.ConnectAttempts < 1 {
+		add("database.connect_attempts (DATABASE_CONNECT_ATTEMPTS) must be at least 1")
+	}
+
+	if len(c.Mail.SMTPHost) > 0 {
+		if port, err := strconv.Atoi(c.Mail.SMTPPort); err != nil || !checkPort(port) {
+			add("mail.smtp_port (SMTP_PORT) must be between 1 and 65535")
+		}
+
+		if len(c.Mail.From) == 0 {
+			add("mail.from (MAIL_FROM) is required for sending mail through SMTP")
+		}
+	} else if len(c.Mail.File) == 0 && !c.Mail.Log {
+		add("mail.smtp_host (SMTP_HOST) or mail.file (MAIL_FILE) is required, or mail.log (MAIL_LOG) for development")
+	}
+
+	names := map[string]bool{}
+
+	for i, provider := range c.OIDC.Providers {
+		label := fmt.Sprintf("oidc provider %s", provider.Name)
+
+		if len(provider.Name) == 0 {
+			label = fmt.Sprintf("oidc provider %d", i+1)
+			add("%s needs a name", label)
+		} else if names[provider.Name] {
+			add("%s is listed more than once", label)
+		}
+
+		names[provider.Name] = true
+
+		if !checkURL(provider.Issuer) {
+			add("%s needs an http or https issuer URL", label)
+		}
+
+		if len(provider.ClientID) == 0 {
+			add("%s needs a client_id", label)
+		}
+
+		if len(provider.RedirectURL) == 0 && !checkURL(c.OIDC.RedirectURL) {
+			add("%s needs a redirect URL, such as oidc.redirect_url (OIDC_REDIRECT_URL)", label)
+		} else if len(provider.RedirectURL) > 0 && !checkURL(provider.RedirectURL) {
+			add("%s has an invalid redirect_url", label)
+		}
+	}
+
+	for _, group := range []ratelimit.Group{ratelimit.GroupRead, ratelimit.GroupWrite, ratelimit.GroupAuth} {
+		if budget := c.RateLimits.Budgets()[group]; budget.PerMinute < 0 || budget.Burst < 0 {
+			add("rate_limits.%s can't be negative", group)
+		}
+	}
+
+	return problems
+}
+
+// OIDCProviders returns the settings for each provider, with the shared
+// redirect URL filled in.
+func (c Config) OIDCProviders() []oidc.Config {
+	providers := make([]oidc.Config, len(c.OIDC.Providers))
+
+	for i, provider := range c.OIDC.Providers {
+		if len(provider.RedirectURL) == 0 {
+			provider.RedirectURL = c.OIDC.RedirectURL
+		}
+
+		providers[i] = provider
+	}
+
+	return providers
+}
@@ -0,0 +1,325 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dense-analysis/codelibrary/internal/api/database"
+	"github.com/dense-analysis/codelibrary/internal/api/logging"
+	"github.com/dense-analysis/codelibrary/internal/api/mailer"
+	"github.com/dense-analysis/codelibrary/internal/api/oidc"
+	"github.com/dense-analysis/codelibrary/internal/api/ratelimit"
+	"github.com/dense-analysis/codelibrary/internal/api/server"
+	"github.com/dense-analysis/codelibrary/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+// clearEnv empties every variable the config reads, so the environment the
+// tests run in can't change the results.
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{
+		"CONFIG_FILE", "API_PORT", "METRICS_PORT", "PUBLIC_URL", "PROXY_HEADER", "TRUSTED_PROXIES",
+		"SHUTDOWN_TIMEOUT", "COOKIE_SECRET",
+		"REQUIRE_VERIFIED_EMAIL", "REQUIRE_TWO_FACTOR", "DISABLE_LOCAL_REGISTRATION",
+		"LOG_FORMAT", "LOG_LEVEL",
+		"DATABASE_URL", "POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB",
+		"DATABASE_MAX_CONNS", "DATABASE_MIN_CONNS", "DATABASE_MAX_CONN_LIFETIME", "DATABASE_MAX_CONN_IDLE_TIME",
+		"DATABASE_CONNECT_ATTEMPTS",
+		"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "MAIL_FROM", "MAIL_FILE", "MAIL_LOG",
+		"OIDC_PROVIDERS", "OIDC_REDIRECT_URL",
+		"RATE_LIMIT_READ", "RATE_LIMIT_READ_BURST",
+		"RATE_LIMIT_WRITE", "RATE_LIMIT_WRITE_BURST",
+		"RATE_LIMIT_AUTH", "RATE_LIMIT_AUTH_BURST",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+func writeFile(t *testing.T, name string, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("API_PORT", "8080")
+	t.Setenv("METRICS_PORT", "8081")
+	t.Setenv("PUBLIC_URL", "https://codelibrary.example")
+	t.Setenv("PROXY_HEADER", "X-Real-IP")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, 172.16.0.0/12")
+	t.Setenv("SHUTDOWN_TIMEOUT", "10s")
+	t.Setenv("COOKIE_SECRET", testSecret)
+	t.Setenv("REQUIRE_TWO_FACTOR", "true")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("POSTGRES_HOST", "db")
+	t.Setenv("POSTGRES_USER", "postgres")
+	t.Setenv("POSTGRES_DB", "codelibrary")
+	t.Setenv("DATABASE_MAX_CONNS", "20")
+	t.Setenv("DATABASE_MAX_CONN_IDLE_TIME", "5m")
+	t.Setenv("MAIL_LOG", "true")
+	t.Setenv("OIDC_PROVIDERS", "company")
+	t.Setenv("OIDC_COMPANY_ISSUER", "https://sso.example.com")
+	t.Setenv("OIDC_COMPANY_CLIENT_ID", "client")
+	t.Setenv("OIDC_REDIRECT_URL", "https://codelibrary.example/api/auth/oidc/callback")
+	t.Setenv("RATE_LIMIT_AUTH", "5")
+
+	cfg, err := config.Load()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, 8081, cfg.MetricsPort)
+	assert.Equal(t, "https://codelibrary.example", cfg.PublicURL)
+	assert.Equal(
+		t,
+		server.ProxyConfig{Header: "X-Real-IP", Trusted: []string{"10.0.0.1", "172.16.0.0/12"}},
+		cfg.Proxy,
+	)
+	assert.Equal(t, 10*time.Second, cfg.ShutdownTimeout)
+	assert.True(t, cfg.RequireTwoFactor)
+	assert.False(t, cfg.RequireVerifiedEmail)
+	assert.Equal(t, logging.Config{Format: logging.FormatJSON, Level: "debug"}, cfg.Log)
+	assert.Equal(
+		t,
+		database.Config{
+			Host:            "db",
+			Port:            "5432",
+			User:            "postgres",
+			Name:            "codelibrary",
+			MaxConns:        20,
+			MaxConnIdleTime: 5 * time.Minute,
+			ConnectAttempts: database.DefaultConnectAttempts,
+		},
+		cfg.Database,
+	)
+	assert.Equal(t, mailer.Config{SMTPPort: "587", Log: true}, cfg.Mail)
+	assert.Equal(
+		t,
+		[]oidc.Config{{
+			Name:        "company",
+			Issuer:      "https://sso.example.com",
+			ClientID:    "client",
+			RedirectURL: "https://codelibrary.example/api/auth/oidc/callback",
+		}},
+		cfg.OIDCProviders(),
+	)
+	assert.Equal(t, ratelimit.Budget{PerMinute: 5}, cfg.RateLimits.Auth)
+	assert.Equal(t, ratelimit.DefaultBudgets[ratelimit.GroupRead], cfg.RateLimits.Read)
+}
+
+func TestLoadFile(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		text string
+	}{
+		{
+			"config.toml",
+			`
+port = 9000
+public_url = "https://codelibrary.example"
+shutdown_timeout = "1m"
+cookie_secret = "` + testSecret + `"
+
+[log]
+format = "text"
+
+[database]
+url = "postgres://postgres@db/codelibrary"
+max_conns = 10
+
+[mail]
+file = "/var/log/codelibrary/mail.log"
+
+[[oidc.providers]]
+name = "company"
+issuer = "https://sso.example.com"
+client_id = "client"
+redirect_url = "https://codelibrary.example/api/auth/oidc/callback"
+
+[rate_limits.write]
+per_minute = 30
+burst = 5
+`,
+		},
+		{
+			"config.yaml",
+			`
+port: 9000
+public_url: https://codelibrary.example
+shutdown_timeout: 1m
+cookie_secret: "` + testSecret + `"
+log:
+  format: text
+database:
+  url: postgres://postgres@db/codelibrary
+  max_conns: 10
+mail:
+  file: /var/log/codelibrary/mail.log
+oidc:
+  providers:
+    - name: company
+      issuer: https://sso.example.com
+      client_id: client
+      redirect_url: https://codelibrary.example/api/auth/oidc/callback
+rate_limits:
+  write:
+    per_minute: 30
+    burst: 5
+`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("CONFIG_FILE", writeFile(t, test.name, test.text))
+			// The environment overrides the file.
+			t.Setenv("API_PORT", "9001")
+			t.Setenv("OIDC_PROVIDERS", "company")
+			t.Setenv("OIDC_COMPANY_CLIENT_SECRET", "secret")
+
+			cfg, err := config.Load()
+
+			assert.Nil(t, err)
+			assert.Equal(t, 9001, cfg.Port)
+			assert.Equal(t, "https://codelibrary.example", cfg.PublicURL)
+			assert.Equal(t, time.Minute, cfg.ShutdownTimeout)
+			assert.Equal(t, testSecret, cfg.CookieSecret)
+			assert.Equal(t, logging.Config{Format: logging.FormatText, Level: "info"}, cfg.Log)
+			assert.Equal(t, "postgres://postgres@db/codelibrary", cfg.Database.URL)
+			assert.Equal(t, int32(10), cfg.Database.MaxConns)
+			assert.Equal(t, "/var/log/codelibrary/mail.log", cfg.Mail.File)
+			assert.Equal(
+				t,
+				[]oidc.Config{{
+					Name:         "company",
+					Issuer:       "https://sso.example.com",
+					ClientID:     "client",
+					ClientSecret: "secret",
+					RedirectURL:  "https://codelibrary.example/api/auth/oidc/callback",
+				}},
+				cfg.OIDCProviders(),
+			)
+			assert.Equal(t, ratelimit.Budget{PerMinute: 30, Burst: 5}, cfg.RateLimits.Write)
+		})
+	}
+}
+
+func TestLoadFileUnknownSettings(t *testing.T) {
+	for name, text := range map[string]string{
+		"config.toml": "prot = 9000\n",
+		"config.yaml": "prot: 9000\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Default()
+			problems := config.LoadFile(writeFile(t, name, text), &cfg)
+
+			if assert.Len(t, problems, 1) {
+				assert.Contains(t, problems[0], "prot")
+			}
+		})
+	}
+
+	cfg := config.Default()
+	problems := config.LoadFile(writeFile(t, "config.json", "{}"), &cfg)
+
+	if assert.Len(t, problems, 1) {
+		assert.Contains(t, problems[0], "must end in .toml, .yaml or .yml")
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("API_PORT", "70000")
+	t.Setenv("METRICS_PORT", "0")
+	t.Setenv("PUBLIC_URL", "https://codelibrary.example/?next=/")
+	t.Setenv("PROXY_HEADER", "X-Real-IP")
+	t.Setenv("TRUSTED_PROXIES", "nginx")
+	t.Setenv("COOKIE_SECRET", "c2hvcnQ=")
+	t.Setenv("DATABASE_URL", "postgres://postgres@db/codelibrary")
+	t.Setenv("DATABASE_MAX_CONNS", "2")
+	t.Setenv("DATABASE_MIN_CONNS", "4")
+	t.Setenv("DATABASE_MAX_CONN_LIFETIME", "forever")
+	t.Setenv("DATABASE_CONNECT_ATTEMPTS", "0")
+	t.Setenv("SHUTDOWN_TIMEOUT", "-1s")
+	t.Setenv("REQUIRE_TWO_FACTOR", "yes please")
+	t.Setenv("LOG_FORMAT", "xml")
+	t.Setenv("LOG_LEVEL", "loud")
+	t.Setenv("SMTP_HOST", "mail.example.com")
+	t.Setenv("OIDC_PROVIDERS", "company")
+	t.Setenv("OIDC_COMPANY_ISSUER", "sso.example.com")
+
+	_, err := config.Load()
+
+	if assert.IsType(t, &config.Error{}, err) {
+		assert.Equal(
+			t,
+			[]string{
+				"REQUIRE_TWO_FACTOR must be true or false",
+				"DATABASE_MAX_CONN_LIFETIME must be a duration such as 30s or 5m",
+				"port (API_PORT) must be between 1 and 65535",
+				"metrics_port (METRICS_PORT) must be between 1 and 65535",
+				"public_url (PUBLIC_URL) must be an http or https URL without a query or fragment",
+				"proxy.trusted (TRUSTED_PROXIES) must be IP addresses or CIDR ranges",
+				"shutdown_timeout (SHUTDOWN_TIMEOUT) must be more than 0",
+				"cookie_secret (COOKIE_SECRET) must be 32 bytes, not 5",
+				"log.format (LOG_FORMAT) must be json or text",
+				"log.level (LOG_LEVEL) must be debug, info, warn or error",
+				"database.min_conns (DATABASE_MIN_CONNS) can't be more than database.max_conns (DATABASE_MAX_CONNS)",
+				"database.connect_attempts (DATABASE_CONNECT_ATTEMPTS) must be at least 1",
+				"mail.from (MAIL_FROM) is required for sending mail through SMTP",
+				"oidc provider company needs an http or https issuer URL",
+				"oidc provider company needs a client_id",
+				"oidc provider company needs a redirect URL, such as oidc.redirect_url (OIDC_REDIRECT_URL)",
+			},
+			err.(*config.Error).Problems,
+		)
+	}
+}
+
+func TestLoadMetricsPortSharedWithAPI(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("API_PORT", "7001")
+	t.Setenv("PUBLIC_URL", "https://codelibrary.example")
+	t.Setenv("COOKIE_SECRET", testSecret)
+	t.Setenv("DATABASE_URL", "postgres://postgres@db/codelibrary")
+	t.Setenv("MAIL_LOG", "true")
+
+	_, err := config.Load()
+
+	if assert.IsType(t, &config.Error{}, err) {
+		assert.Equal(
+			t,
+			[]string{"metrics_port (METRICS_PORT) must be different from port (API_PORT)"},
+			err.(*config.Error).Problems,
+		)
+	}
+}
+
+func TestLoadRequiredSettings(t *testing.T) {
+	clearEnv(t)
+
+	_, err := config.Load()
+
+	if assert.IsType(t, &config.Error{}, err) {
+		assert.Equal(
+			t,
+			[]string{
+				"public_url (PUBLIC_URL) is required, such as https://codelibrary.example",
+				"cookie_secret (COOKIE_SECRET) is required, such as from `openssl rand -base64 32`",
+				"database.url (DATABASE_URL) or database.host and database.name (POSTGRES_HOST and POSTGRES_DB) are required",
+				"mail.smtp_host (SMTP_HOST) or mail.file (MAIL_FILE) is required, or mail.log (MAIL_LOG) for development",
+			},
+			err.(*config.Error).Problems,
+		)
+	}
+}
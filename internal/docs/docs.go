@@ -18,7 +18,7 @@ const docTemplate = `{
     "paths": {
         "/api/auth/login": {
             "post": {
-                "description": "Log in with user credentials",
+                "description": "Log in with user credentials. Logins are locked out for a while after too many failed attempts for a username or from an IP address. If the user has two-factor authentication turned on, a 202 response with a token for ` + "`" + `/api/auth/login/totp` + "`" + ` is returned instead of logging in",
                 "tags": [
                     "Authentication"
                 ],
@@ -44,44 +44,42 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/PendingLogin"
+                        }
+                    },
                     "403": {
                         "description": "Forbidden",
                         "schema": {
                             "$ref": "#/definitions/Error"
                         }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
                     }
                 }
             }
         },
-        "/api/auth/logout": {
-            "post": {
-                "description": "Clear the user from the session",
-                "tags": [
-                    "Authentication"
-                ],
-                "summary": "Log out",
-                "responses": {
-                    "204": {
-                        "description": "No Content"
-                    }
-                }
-            }
-        },
-        "/api/auth/register": {
+        "/api/auth/login/totp": {
             "post": {
-                "description": "Register a new user with a given password",
+                "description": "Exchange a pending login token from ` + "`" + `/api/auth/login` + "`" + ` and either a TOTP code or a recovery code for a session",
                 "tags": [
                     "Authentication"
                 ],
-                "summary": "Register a new user",
+                "summary": "Finish logging in with two-factor authentication",
                 "parameters": [
                     {
-                        "description": "User Data",
+                        "description": "The pending login token and a code",
                         "name": "data",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/RegisterUser"
+                            "$ref": "#/definitions/TwoFactorLogin"
                         }
                     }
                 ],
@@ -89,10 +87,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/User"
-                            }
+                            "$ref": "#/definitions/User"
                         }
                     },
                     "403": {
@@ -106,125 +101,177 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/Error"
                         }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
                     }
                 }
             }
         },
-        "/api/code": {
+        "/api/auth/logout": {
+            "post": {
+                "description": "Clear the user from the session",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Log out",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    }
+                }
+            }
+        },
+        "/api/auth/oidc/callback": {
             "get": {
-                "description": "Retrieve a list of Code Samples",
+                "description": "The provider redirects back here after logging in. An account is created the first time someone logs in, with their email address if the provider has verified it. The provider is responsible for any second factor",
                 "tags": [
-                    "Code Samples"
+                    "Authentication"
                 ],
-                "summary": "List Code Samples",
+                "summary": "Finish logging in with OpenID Connect",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "A string for searching for code samples",
-                        "name": "q",
-                        "in": "query"
+                        "description": "The authorization code",
+                        "name": "code",
+                        "in": "query",
+                        "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Search for results for a particular language by name",
-                        "name": "l",
-                        "in": "query"
+                        "description": "The state from the login",
+                        "name": "state",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "302": {
+                        "description": "Found"
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/oidc/login": {
+            "get": {
+                "description": "Redirect the browser to an OpenID Connect provider to log in. The provider can be left out if only one is configured. Users without a password log in again with ` + "`" + `reauthenticate` + "`" + ` before deleting their account or turning off two-factor authentication",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Log in with OpenID Connect",
+                "parameters": [
                     {
-                        "type": "integer",
-                        "description": "The page to list results from",
-                        "name": "page",
+                        "type": "string",
+                        "description": "The name of the provider",
+                        "name": "provider",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "The amount of items to fetch in a given page",
-                        "name": "pageSize",
+                        "type": "boolean",
+                        "description": "Ask the provider to have the user log in again",
+                        "name": "reauthenticate",
                         "in": "query"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "302": {
+                        "description": "Found"
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/CodeSamplePage"
+                            "$ref": "#/definitions/Error"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/auth/password-reset": {
             "post": {
-                "description": "Submit a new Code Sample",
+                "description": "Email a link for resetting the password to the user who has verified an email address. The response is the same whether or not there is a user with the address, and the email is sent afterwards",
                 "tags": [
-                    "Code Samples"
+                    "Authentication"
                 ],
-                "summary": "Submit Code Sample",
+                "summary": "Request a password reset",
                 "parameters": [
                     {
-                        "description": "CodeSample data",
+                        "description": "The email address for the account",
                         "name": "data",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/CodeSampleSubmission"
+                            "$ref": "#/definitions/PasswordResetRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
                         "schema": {
-                            "$ref": "#/definitions/CodeSample"
+                            "$ref": "#/definitions/Error"
                         }
                     }
                 }
             }
         },
-        "/api/code/{id}": {
-            "get": {
-                "description": "Get a Code Sample",
+        "/api/auth/password-reset/confirm": {
+            "post": {
+                "description": "Set a new password with a token from a password reset email. Every session for the user is logged out",
                 "tags": [
-                    "Code Samples"
+                    "Authentication"
                 ],
-                "summary": "Get a Code Sample",
+                "summary": "Reset a password",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "The UUID of the code sample to get",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "The token and new password",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/PasswordResetConfirmation"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
                         "schema": {
-                            "$ref": "#/definitions/CodeSample"
+                            "$ref": "#/definitions/Error"
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update an existing Code Sample",
+            }
+        },
+        "/api/auth/register": {
+            "post": {
+                "description": "Register a new user with a given password. If an email address is given, a link for verifying it is sent. Registration can be turned off in favour of logging in with OpenID Connect",
                 "tags": [
-                    "Code Samples"
+                    "Authentication"
                 ],
-                "summary": "Update a Code Sample",
+                "summary": "Register a new user",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "The UUID of the code sample to update",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "CodeSample data",
+                        "description": "User Data",
                         "name": "data",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/CodeSampleSubmission"
+                            "$ref": "#/definitions/RegisterUser"
                         }
                     }
                 ],
@@ -232,21 +279,61 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/CodeSample"
+                            "$ref": "#/definitions/Account"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/auth/sessions": {
+            "get": {
+                "description": "List the active sessions for the current user",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "List sessions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/Session"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/sessions/{id}": {
             "delete": {
-                "description": "Delete a Code Sample",
+                "description": "Log out a session for the current user, which may be the current session",
                 "tags": [
-                    "Code Samples"
+                    "Authentication"
                 ],
-                "summary": "Delete a Code Sample",
+                "summary": "Revoke a session",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "The UUID of the code sample to delete",
+                        "description": "The UUID of the session to revoke",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -255,73 +342,1556 @@ const docTemplate = `{
                 "responses": {
                     "204": {
                         "description": "No Content"
-                    }
-                }
-            }
-        }
-    },
-    "definitions": {
-        "CodeSample": {
-            "type": "object",
-            "properties": {
-                "body": {
-                    "type": "string"
-                },
-                "created": {
-                    "type": "string"
-                },
-                "description": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string"
-                },
-                "language": {
-                    "$ref": "#/definitions/Language"
-                },
-                "modified": {
-                    "type": "string"
-                },
-                "submittedBy": {
-                    "$ref": "#/definitions/User"
-                },
-                "title": {
-                    "type": "string"
-                }
-            }
-        },
-        "CodeSamplePage": {
-            "type": "object",
-            "properties": {
-                "count": {
-                    "type": "integer",
-                    "example": 1
-                },
-                "results": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/CodeSample"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
                     }
                 }
             }
         },
-        "CodeSampleSubmission": {
-            "type": "object",
-            "properties": {
-                "body": {
-                    "type": "string"
-                },
-                "description": {
-                    "type": "string"
-                },
+        "/api/auth/tokens": {
+            "get": {
+                "description": "List the personal API tokens for the current user",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "List API tokens",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/APIToken"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a personal API token for use with ` + "`" + `Authorization: Bearer` + "`" + `. The token is only returned once",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Create an API token",
+                "parameters": [
+                    {
+                        "description": "Token data",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/APITokenSubmission"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/NewAPIToken"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/tokens/{id}": {
+            "delete": {
+                "description": "Revoke a personal API token for the current user",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Revoke an API token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the token to revoke",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/totp": {
+            "post": {
+                "description": "Create a new TOTP secret for the current user. Two-factor authentication is turned on once a code for the secret is confirmed",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Start setting up two-factor authentication",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/TOTPEnrolment"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove the TOTP secret and recovery codes for the current user. The current password is required, or for users without a password, logging in with ` + "`" + `/api/auth/oidc/login?reauthenticate=true` + "`" + ` in the last 5 minutes",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Turn off two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "The current password",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/TwoFactorRemoval"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/totp/confirm": {
+            "post": {
+                "description": "Confirm a new TOTP secret with a code from an authenticator app. Recovery codes are returned, and are only shown once",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Turn on two-factor authentication",
+                "parameters": [
+                    {
+                        "description": "A code from the authenticator app",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/TOTPCode"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/RecoveryCodes"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/auth/verify-email": {
+            "post": {
+                "description": "Verify an email address with a token from a verification email. Other users who added the address without verifying it lose it",
+                "tags": [
+                    "Authentication"
+                ],
+                "summary": "Verify an email address",
+                "parameters": [
+                    {
+                        "description": "The token from the email",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/EmailVerification"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/code": {
+            "get": {
+                "description": "Retrieve a list of Code Samples",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "List Code Samples",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "A string for searching for code samples. Leave empty to list all samples",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "text",
+                            "code"
+                        ],
+                        "type": "string",
+                        "description": "text for English text search, or code for substrings and identifiers in code bodies",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Match case exactly in code searches. Identifier spellings are only matched without case",
+                        "name": "caseSensitive",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include samples with bodies matching an RE2 regular expression, returning matchedLines for each",
+                        "name": "regex",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Search for results for a particular language by name",
+                        "name": "l",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Only include samples with all of these tags",
+                        "name": "tags",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Only include samples with any of these tags",
+                        "name": "anyTags",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include samples submitted by the user with this UUID",
+                        "name": "submittedBy",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include samples created at or after this RFC 3339 time",
+                        "name": "createdAfter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include samples created before this RFC 3339 time",
+                        "name": "createdBefore",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only include samples modified at or after this RFC 3339 time",
+                        "name": "modifiedAfter",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "relevance",
+                            "created",
+                            "modified",
+                            "title"
+                        ],
+                        "type": "string",
+                        "description": "The field to sort by, relevance by default or created without q",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "The direction to sort in, desc by default except for title",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include counts of results for every language and the top authors, each ignoring its own filter",
+                        "name": "facets",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "full",
+                            "summary"
+                        ],
+                        "type": "string",
+                        "description": "full for whole samples, or summary for highlighted excerpts without bodies",
+                        "name": "view",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Continue from the nextCursor of a previous page, in place of page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Count the total results, true by default",
+                        "name": "includeCount",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The page to list results from",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The amount of items to fetch in a given page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "A CodeSamplePage with whole bodies for view=full, or a CodeSampleSummaryPage with highlights for view=summary",
+                        "schema": {
+                            "$ref": "#/definitions/CodeSampleListPage"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Submit a new Code Sample. The server may require a verified email address or two-factor authentication",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "Submit Code Sample",
+                "parameters": [
+                    {
+                        "description": "CodeSample data",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CodeSampleSubmission"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/CodeSample"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/code/{id}": {
+            "get": {
+                "description": "Get a Code Sample",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "Get a Code Sample",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the code sample to get",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/CodeSample"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update an existing Code Sample. Moderators can update any sample",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "Update a Code Sample",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the code sample to update",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "CodeSample data",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CodeSampleSubmission"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/CodeSample"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a Code Sample. Moderators can delete any sample",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "Delete a Code Sample",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the code sample to delete",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    }
+                }
+            }
+        },
+        "/api/code/{id}/diff": {
+            "get": {
+                "description": "Create a unified diff between any two revisions of a Code Sample",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "Diff Code Sample revisions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the code sample",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The revision to diff from",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The revision to diff to",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/CodeSampleDiff"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/code/{id}/revisions": {
+            "get": {
+                "description": "List every saved revision of a Code Sample, newest first",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "List Code Sample revisions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the code sample",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/CodeSampleRevision"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/code/{id}/revisions/{rev}": {
+            "get": {
+                "description": "Get a single revision of a Code Sample",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "Get a Code Sample revision",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the code sample",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The revision number",
+                        "name": "rev",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/CodeSampleRevision"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/code/{id}/revisions/{rev}/restore": {
+            "post": {
+                "description": "Save an old revision as the newest version of a Code Sample, including its tags. Revisions saved before tags were kept with them leave the tags as they are. Moderators can restore any sample",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "Restore a Code Sample revision",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the code sample",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The revision number to restore",
+                        "name": "rev",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/CodeSample"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/languages": {
+            "get": {
+                "description": "List languages code samples can be submitted for",
+                "tags": [
+                    "Languages"
+                ],
+                "summary": "List Languages",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Include retired languages",
+                        "name": "retired",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/LanguageSummary"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Add a new language. Admin only.",
+                "tags": [
+                    "Languages"
+                ],
+                "summary": "Create a Language",
+                "parameters": [
+                    {
+                        "description": "Language data",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/LanguageSubmission"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/Language"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/languages/{id}": {
+            "get": {
+                "description": "Get a language, including retired languages",
+                "tags": [
+                    "Languages"
+                ],
+                "summary": "Get a Language",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ID of the language to get",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/LanguageSummary"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Change the display name of a language. Admin only.",
+                "tags": [
+                    "Languages"
+                ],
+                "summary": "Rename a Language",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ID of the language to rename",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Language data",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/LanguageRename"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Language"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stop accepting new code samples for a language. Existing samples are kept. Admin only.",
+                "tags": [
+                    "Languages"
+                ],
+                "summary": "Retire a Language",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ID of the language to retire",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/tags": {
+            "get": {
+                "description": "List tags used by code samples, most used first",
+                "tags": [
+                    "Code Samples"
+                ],
+                "summary": "List Tags",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/TagSummary"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/me": {
+            "get": {
+                "description": "Get the account for the current session, including private details such as the email address",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get the current user",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Account"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete the account for the current user, either deleting their code samples or keeping them credited to a \"ghost\" user. Users without a password need to have logged in with ` + "`" + `/api/auth/oidc/login?reauthenticate=true` + "`" + ` in the last 5 minutes instead",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Delete the current user",
+                "parameters": [
+                    {
+                        "description": "The current password and what to do with samples",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/AccountDeletion"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Change the username, email address or password for the current user. Changing the password requires the current password, and logs out every other session. A new email address needs to be verified again",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Update the current user",
+                "parameters": [
+                    {
+                        "description": "The details to change",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/UserUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Account"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/me/email/verification": {
+            "post": {
+                "description": "Email a new link for verifying the email address for the current user",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Resend an email verification link",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}/role": {
+            "put": {
+                "description": "Give a user a role, such as moderator. Admin only.",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Grant a role",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the user",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "The role to grant",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/RoleAssignment"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/User"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Return a user to the normal user role. Admin only.",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Revoke a role",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The UUID of the user",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/User"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/version": {
+            "get": {
+                "description": "Get the commit and build time of the app, and schema versions",
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Get Version",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Version"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Check the process is running",
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Check Health",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Status"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Check the app can serve requests, with the database reachable\nand the schema up to date",
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Check Readiness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/Status"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/Error"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "APIToken": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "string"
+                },
+                "expires": {
+                    "description": "Expires is nil for tokens that never expire.",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lastUsed": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/Scope"
+                    },
+                    "example": [
+                        "samples:read",
+                        "samples:write"
+                    ]
+                }
+            }
+        },
+        "APITokenSubmission": {
+            "type": "object",
+            "properties": {
+                "expires": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/Scope"
+                    },
+                    "example": [
+                        "samples:read",
+                        "samples:write"
+                    ]
+                }
+            }
+        },
+        "Account": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "user@example.com"
+                },
+                "emailVerified": {
+                    "type": "boolean"
+                },
+                "hasPassword": {
+                    "description": "HasPassword is false for users who only log in with a provider.",
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "role": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/Role"
+                        }
+                    ],
+                    "example": "user"
+                },
+                "twoFactorEnabled": {
+                    "description": "TwoFactorEnabled is true once TOTP enrolment has been confirmed.",
+                    "type": "boolean"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "AccountDeletion": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "password"
+                },
+                "samples": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/SampleDisposal"
+                        }
+                    ],
+                    "example": "reassign"
+                }
+            }
+        },
+        "AuthorFacet": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "$ref": "#/definitions/User"
+                },
+                "count": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "CodeSample": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "string"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "language": {
+                    "$ref": "#/definitions/Language"
+                },
+                "matchedLines": {
+                    "description": "MatchedLines are the lines matching a regex search, from 1.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "modified": {
+                    "type": "string"
+                },
+                "submittedBy": {
+                    "$ref": "#/definitions/User"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "CodeSampleDiff": {
+            "type": "object",
+            "properties": {
+                "diff": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "to": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "CodeSampleFacets": {
+            "type": "object",
+            "properties": {
+                "authors": {
+                    "description": "Authors are the users with the most results.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/AuthorFacet"
+                    }
+                },
+                "languages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/LanguageFacet"
+                    }
+                }
+            }
+        },
+        "CodeSampleHighlights": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "lines": {
+                    "description": "Lines are the matching lines of the body, or the first lines if none match.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/CodeSampleLine"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "CodeSampleLine": {
+            "type": "object",
+            "properties": {
+                "number": {
+                    "description": "Number is the line number, starting from 1.",
+                    "type": "integer",
+                    "example": 1
+                },
+                "text": {
+                    "description": "Text is HTML with search matches wrapped in \u003cmark\u003e tags.",
+                    "type": "string"
+                }
+            }
+        },
+        "CodeSampleListItem": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "description": "Body is the whole body, only for view=full.",
+                    "type": "string"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "highlights": {
+                    "description": "Highlights are excerpts showing why the sample matched, only for\nview=summary.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/CodeSampleHighlights"
+                        }
+                    ]
+                },
+                "id": {
+                    "type": "string"
+                },
+                "language": {
+                    "$ref": "#/definitions/Language"
+                },
+                "matchedLines": {
+                    "description": "MatchedLines are the lines matching a regex search, from 1.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "modified": {
+                    "type": "string"
+                },
+                "submittedBy": {
+                    "$ref": "#/definitions/User"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "CodeSampleListPage": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "facets": {
+                    "description": "Facets are counts for a search, when they are requested.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/CodeSampleFacets"
+                        }
+                    ]
+                },
+                "nextCursor": {
+                    "description": "NextCursor continues from the end of this page, if there are more results.",
+                    "type": "string"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/CodeSampleListItem"
+                    }
+                }
+            }
+        },
+        "CodeSampleRevision": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "string"
+                },
+                "codeSampleId": {
+                    "type": "string"
+                },
+                "created": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "editedBy": {
+                    "$ref": "#/definitions/User"
+                },
+                "language": {
+                    "$ref": "#/definitions/Language"
+                },
+                "revision": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "tags": {
+                    "description": "Tags are null for revisions saved before tags were kept with them.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "CodeSampleSubmission": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
                 "languageId": {
                     "type": "string"
                 },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "concurrency",
+                        "http-client"
+                    ]
+                },
                 "title": {
                     "type": "string"
                 }
             }
         },
+        "EmailVerification": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "description": "Token is the token sent in the verification email.",
+                    "type": "string"
+                }
+            }
+        },
         "Error": {
             "type": "object",
             "properties": {
@@ -330,6 +1900,16 @@ const docTemplate = `{
                     "items": {
                         "$ref": "#/definitions/ErrorLocation"
                     }
+                },
+                "requestId": {
+                    "description": "RequestID identifies the request in the logs, for 500 errors.",
+                    "type": "string",
+                    "example": "4b4c5e5e-8b1a-4bd8-9d0c-0b5a3c1c2a7e"
+                },
+                "retryAfter": {
+                    "description": "RetryAfter is how many seconds to wait before trying again, for 429 errors.",
+                    "type": "integer",
+                    "example": 30
                 }
             }
         },
@@ -358,6 +1938,61 @@ const docTemplate = `{
                 },
                 "name": {
                     "type": "string"
+                },
+                "retired": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "LanguageFacet": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "language": {
+                    "$ref": "#/definitions/Language"
+                }
+            }
+        },
+        "LanguageRename": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "Python"
+                }
+            }
+        },
+        "LanguageSubmission": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "python"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Python"
+                }
+            }
+        },
+        "LanguageSummary": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "retired": {
+                    "type": "boolean"
+                },
+                "sampleCount": {
+                    "type": "integer",
+                    "example": 1
                 }
             }
         },
@@ -373,6 +2008,91 @@ const docTemplate = `{
                 }
             }
         },
+        "NewAPIToken": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "string"
+                },
+                "expires": {
+                    "description": "Expires is nil for tokens that never expire.",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lastUsed": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/Scope"
+                    },
+                    "example": [
+                        "samples:read",
+                        "samples:write"
+                    ]
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "PasswordResetConfirmation": {
+            "type": "object",
+            "properties": {
+                "confirmPassword": {
+                    "type": "string",
+                    "example": "password"
+                },
+                "password": {
+                    "type": "string",
+                    "example": "password"
+                },
+                "token": {
+                    "description": "Token is the token sent in the password reset email.",
+                    "type": "string"
+                }
+            }
+        },
+        "PasswordResetRequest": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "someone@example.com"
+                }
+            }
+        },
+        "PendingLogin": {
+            "type": "object",
+            "properties": {
+                "expires": {
+                    "type": "string"
+                },
+                "pendingToken": {
+                    "type": "string"
+                }
+            }
+        },
+        "RecoveryCodes": {
+            "type": "object",
+            "properties": {
+                "codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "abcde-fghij"
+                    ]
+                }
+            }
+        },
         "RegisterUser": {
             "type": "object",
             "properties": {
@@ -380,6 +2100,11 @@ const docTemplate = `{
                     "type": "string",
                     "example": "password"
                 },
+                "email": {
+                    "description": "Email is optional, and a link for verifying it is sent if it is set.",
+                    "type": "string",
+                    "example": "user@example.com"
+                },
                 "password": {
                     "type": "string",
                     "example": "password"
@@ -389,16 +2114,216 @@ const docTemplate = `{
                 }
             }
         },
+        "Role": {
+            "type": "string",
+            "enum": [
+                "user",
+                "moderator",
+                "admin"
+            ],
+            "x-enum-varnames": [
+                "RoleUser",
+                "RoleModerator",
+                "RoleAdmin"
+            ]
+        },
+        "RoleAssignment": {
+            "type": "object",
+            "properties": {
+                "role": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/Role"
+                        }
+                    ],
+                    "example": "moderator"
+                }
+            }
+        },
+        "SampleDisposal": {
+            "type": "string",
+            "enum": [
+                "delete",
+                "reassign"
+            ],
+            "x-enum-varnames": [
+                "SamplesDelete",
+                "SamplesReassign"
+            ]
+        },
+        "Scope": {
+            "type": "string",
+            "enum": [
+                "samples:read",
+                "samples:write"
+            ],
+            "x-enum-varnames": [
+                "ScopeSamplesRead",
+                "ScopeSamplesWrite"
+            ]
+        },
+        "Session": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "string"
+                },
+                "current": {
+                    "description": "Current is true for the session making the request.",
+                    "type": "boolean"
+                },
+                "expires": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "ipAddress": {
+                    "type": "string"
+                },
+                "lastSeen": {
+                    "type": "string"
+                },
+                "userAgent": {
+                    "type": "string"
+                }
+            }
+        },
+        "Status": {
+            "type": "object",
+            "properties": {
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
+        "TOTPCode": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "123456"
+                }
+            }
+        },
+        "TOTPEnrolment": {
+            "type": "object",
+            "properties": {
+                "secret": {
+                    "type": "string",
+                    "example": "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+                },
+                "uri": {
+                    "description": "URI is an otpauth:// URI, which can be shown as a QR code.",
+                    "type": "string"
+                }
+            }
+        },
+        "TagSummary": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "concurrency"
+                },
+                "sampleCount": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "TwoFactorLogin": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "123456"
+                },
+                "pendingToken": {
+                    "type": "string"
+                },
+                "recoveryCode": {
+                    "type": "string"
+                }
+            }
+        },
+        "TwoFactorRemoval": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": "password"
+                }
+            }
+        },
         "User": {
             "type": "object",
             "properties": {
                 "id": {
                     "type": "string"
                 },
+                "role": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/Role"
+                        }
+                    ],
+                    "example": "user"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "UserUpdate": {
+            "type": "object",
+            "properties": {
+                "confirmPassword": {
+                    "type": "string",
+                    "example": "new password"
+                },
+                "currentPassword": {
+                    "description": "CurrentPassword is required for changing the password.",
+                    "type": "string",
+                    "example": "password"
+                },
+                "email": {
+                    "description": "Email sets a new address to verify, or removes the address if empty.",
+                    "type": "string",
+                    "example": "user@example.com"
+                },
+                "newPassword": {
+                    "type": "string",
+                    "example": "new password"
+                },
                 "username": {
                     "type": "string"
                 }
             }
+        },
+        "Version": {
+            "type": "object",
+            "properties": {
+                "buildTime": {
+                    "type": "string",
+                    "example": "2023-09-01T12:00:00Z"
+                },
+                "commit": {
+                    "type": "string",
+                    "example": "3babd66"
+                },
+                "databaseSchemaVersion": {
+                    "description": "DatabaseSchemaVersion is the schema version of the database, which is\nnull if the database can't be reached.",
+                    "type": "integer",
+                    "example": 1
+                },
+                "schemaVersion": {
+                    "description": "SchemaVersion is the database schema version the app needs.",
+                    "type": "integer",
+                    "example": 1
+                }
+            }
         }
     }
 }`
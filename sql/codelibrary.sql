@@ -7,11 +7,157 @@ CREATE TABLE IF NOT EXISTS "user" (
     CONSTRAINT username_unique UNIQUE (username)
 );
 
+ALTER TABLE "user"
+    ADD COLUMN IF NOT EXISTS role varchar(32) NOT NULL DEFAULT 'user';
+
+ALTER TABLE "user"
+    ADD COLUMN IF NOT EXISTS email varchar(255);
+
+ALTER TABLE "user"
+    ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT false;
+
+DROP INDEX IF EXISTS user_email_unique;
+
+-- Only verified addresses are unique, so nobody can keep an address from its
+-- owner by adding it to their account first.
+CREATE UNIQUE INDEX IF NOT EXISTS user_verified_email_unique ON "user" (lower(email))
+    WHERE email_verified;
+
+-- Samples from deleted accounts can be kept and credited to this user.
+-- Nobody can log in as the ghost, as no password matches an empty hash.
+-- The name is reserved, and this fails if another user already has it, as
+-- accounts can't be deleted without the ghost.
+INSERT INTO "user" (id, username, password_hash)
+VALUES ('00000000-0000-4000-8000-000000000000', 'ghost', '')
+ON CONFLICT (id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS session (
+    id uuid PRIMARY KEY NOT NULL,
+    user_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    created timestamp with time zone NOT NULL,
+    last_seen timestamp with time zone NOT NULL,
+    expires timestamp with time zone NOT NULL,
+    user_agent text NOT NULL,
+    ip_address text NOT NULL,
+    -- Set when the user logged in again at their provider to confirm a change.
+    reauthenticated boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS session_user_id_index ON session (user_id);
+
+CREATE TABLE IF NOT EXISTS api_token (
+    id uuid PRIMARY KEY NOT NULL,
+    user_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    name text NOT NULL,
+    token_hash char(64) NOT NULL,
+    scopes text[] NOT NULL,
+    created timestamp with time zone NOT NULL,
+    expires timestamp with time zone,
+    last_used timestamp with time zone,
+    CONSTRAINT api_token_hash_unique UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS api_token_user_id_index ON api_token (user_id);
+
+CREATE TABLE IF NOT EXISTS password_reset (
+    token_hash char(64) PRIMARY KEY NOT NULL,
+    user_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    created timestamp with time zone NOT NULL,
+    expires timestamp with time zone NOT NULL
+);
+
+-- The address is saved with the token, so a link sent for an old address
+-- can't verify a new one.
+CREATE TABLE IF NOT EXISTS email_verification (
+    token_hash char(64) PRIMARY KEY NOT NULL,
+    user_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    email varchar(255) NOT NULL,
+    created timestamp with time zone NOT NULL,
+    expires timestamp with time zone NOT NULL
+);
+
+-- The secret has to be kept as it is to check codes. last_step is the time
+-- step of the last code used, so codes can't be used twice.
+CREATE TABLE IF NOT EXISTS totp (
+    user_id uuid PRIMARY KEY NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    secret varchar(64) NOT NULL,
+    confirmed boolean NOT NULL DEFAULT false,
+    last_step bigint,
+    created timestamp with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recovery_code (
+    user_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    code_hash char(64) NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- A login which has passed the password check and needs a second factor.
+CREATE TABLE IF NOT EXISTS pending_login (
+    token_hash char(64) PRIMARY KEY NOT NULL,
+    user_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    created timestamp with time zone NOT NULL,
+    expires timestamp with time zone NOT NULL
+);
+
+-- Users who log in with OpenID Connect are found by the subject their
+-- provider gives them, which doesn't change like usernames or emails can.
+CREATE TABLE IF NOT EXISTS external_identity (
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    user_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE CASCADE,
+    created timestamp with time zone NOT NULL,
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS external_identity_user_id_index
+    ON external_identity (user_id);
+
+-- Failed logins are counted for each username and IP address, such as
+-- 'username:someone' or 'ip:127.0.0.1'.
+CREATE TABLE IF NOT EXISTS login_failure (
+    key text PRIMARY KEY NOT NULL,
+    failures integer NOT NULL,
+    last_failure timestamp with time zone NOT NULL,
+    locked_until timestamp with time zone
+);
+
+-- Old failures are deleted by when they happened.
+CREATE INDEX IF NOT EXISTS login_failure_last_failure_index
+ON login_failure (last_failure);
+
+CREATE TABLE IF NOT EXISTS login_lockout (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    key text NOT NULL,
+    failures integer NOT NULL,
+    locked_until timestamp with time zone NOT NULL,
+    created timestamp with time zone NOT NULL
+);
+
 CREATE TABLE IF NOT EXISTS language (
     id varchar(255) PRIMARY KEY NOT NULL,
     name text NOT NULL
 );
 
+ALTER TABLE language
+    ADD COLUMN IF NOT EXISTS retired boolean NOT NULL DEFAULT false;
+
 CREATE TABLE IF NOT EXISTS codesample (
     id uuid PRIMARY KEY NOT NULL,
     submitted_by_id uuid NOT NULL
@@ -31,6 +177,89 @@ CREATE TABLE IF NOT EXISTS codesample (
 CREATE INDEX IF NOT EXISTS codesample_fulltext_index
     ON codesample USING GIN (search_index);
 
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Trigrams accelerate substring and pattern searches over code.
+CREATE INDEX IF NOT EXISTS codesample_body_trigram_index
+    ON codesample USING GIN (body gin_trgm_ops);
+
+CREATE TABLE IF NOT EXISTS codesample_revision (
+    codesample_id uuid NOT NULL
+        REFERENCES codesample(id)
+        ON DELETE CASCADE,
+    revision integer NOT NULL,
+    edited_by_id uuid NOT NULL
+        REFERENCES "user"(id)
+        ON DELETE RESTRICT,
+    language_id varchar(255) NOT NULL
+        REFERENCES language(id)
+        ON DELETE RESTRICT,
+    title text NOT NULL,
+    description text NOT NULL,
+    body text NOT NULL,
+    created timestamp with time zone NOT NULL,
+    PRIMARY KEY (codesample_id, revision)
+);
+
+-- Tags are NULL for revisions saved before tags were kept with them.
+ALTER TABLE codesample_revision
+    ADD COLUMN IF NOT EXISTS tags varchar(50)[];
+
+-- Samples created before revisions were stored start at their current state.
+INSERT INTO codesample_revision (
+    codesample_id, revision, edited_by_id, language_id,
+    title, description, body,
+    created
+)
+SELECT
+    id, 1, submitted_by_id, language_id,
+    title, description, body,
+    modified
+FROM codesample
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM codesample_revision
+    WHERE codesample_revision.codesample_id = codesample.id
+);
+
+CREATE TABLE IF NOT EXISTS tag (
+    name varchar(50) PRIMARY KEY NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS codesample_tag (
+    codesample_id uuid NOT NULL
+        REFERENCES codesample(id)
+        ON DELETE CASCADE,
+    tag varchar(50) NOT NULL
+        REFERENCES tag(name)
+        ON DELETE CASCADE,
+    PRIMARY KEY (codesample_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS codesample_tag_tag_index
+    ON codesample_tag (tag);
+
+CREATE TABLE IF NOT EXISTS moderation_action (
+    id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    actor_id uuid
+        REFERENCES "user"(id)
+        ON DELETE SET NULL,
+    action varchar(32) NOT NULL,
+    -- Samples can be deleted, so they aren't referenced.
+    codesample_id uuid,
+    user_id uuid
+        REFERENCES "user"(id)
+        ON DELETE SET NULL,
+    details text NOT NULL,
+    created timestamp with time zone NOT NULL
+);
+
+-- There is one row, recording which version of this file was last run.
+CREATE TABLE IF NOT EXISTS schema_version (
+    id boolean PRIMARY KEY DEFAULT true CHECK (id),
+    version integer NOT NULL
+);
+
 INSERT INTO language (id, name) VALUES
     ('ada', 'Ada'),
     ('bash', 'Bash'),
@@ -70,3 +299,8 @@ INSERT INTO language (id, name) VALUES
     ('visualbasic', 'Visual Basic'),
     ('zsh', 'zsh')
 ON CONFLICT DO NOTHING;
+
+-- The version is recorded last, so it's only updated once everything above has
+-- run. Increase it along with database.SchemaVersion when changing the schema.
+INSERT INTO schema_version (version) VALUES (1)
+ON CONFLICT (id) DO UPDATE SET version = excluded.version;